@@ -0,0 +1,191 @@
+package mavcom
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How often the vehicle's state is checked while waiting for an action to
+// take effect
+const actionPollInterval = 100 * time.Millisecond
+
+// ArduPilot only disarms in the air when param2 of the arm command is this
+const forceDisarmMagic = 21196
+
+// Runs the pre-flight checks in PreflightChecks, refusing with a
+// *PreflightError if any fail, then arms the motors and returns once the
+// vehicle reports that it is armed
+func (v *Vehicle) Arm(ctx context.Context) error {
+	if v.PreflightChecks != nil {
+		report := v.CheckPreflight(ctx, v.PreflightChecks)
+		if ctx.Err() != nil {
+			return fmt.Errorf("arm: %w", ctx.Err())
+		}
+		if !report.Passed() {
+			return &PreflightError{Report: report}
+		}
+	}
+	return v.ArmUnchecked(ctx)
+}
+
+// Arms the motors without running the pre-flight checks, leaving only the
+// vehicle's own to stop it, and returns once the vehicle reports that it is
+// armed
+func (v *Vehicle) ArmUnchecked(ctx context.Context) error {
+	if err := v.command(ctx, "arm", mavlink.MAV_CMD_COMPONENT_ARM_DISARM, 1); err != nil {
+		return err
+	}
+	acked := time.Now()
+	return v.waitFor(ctx, "arm", "vehicle to report armed", func() bool {
+		return v.heardSince(mavlink.MAVLINK_MSG_ID_HEARTBEAT, acked) && v.armed()
+	})
+}
+
+// Disarms the motors and returns once the vehicle reports that it is
+// disarmed. Vehicles refuse to disarm in the air unless force is set, in which
+// case they will fall.
+func (v *Vehicle) Disarm(ctx context.Context, force bool) error {
+	var forceParam float32
+	if force {
+		forceParam = forceDisarmMagic
+	}
+	if err := v.command(ctx, "disarm", mavlink.MAV_CMD_COMPONENT_ARM_DISARM, 0, forceParam); err != nil {
+		return err
+	}
+	acked := time.Now()
+	return v.waitFor(ctx, "disarm", "vehicle to report disarmed", func() bool {
+		return v.heardSince(mavlink.MAVLINK_MSG_ID_HEARTBEAT, acked) && !v.armed()
+	})
+}
+
+// Takes off to an altitude in meters above home and returns once the vehicle
+// has climbed to it. ArduCopter only takes off armed and in GUIDED mode, PX4
+// switches into TAKEOFF and then LOITER by itself.
+func (v *Vehicle) Takeoff(ctx context.Context, altitude float64) error {
+	if altitude <= 0 {
+		return fmt.Errorf("takeoff: invalid altitude %v m", altitude)
+	}
+	v.lock.Lock()
+	firmware := v.firmware
+	// PX4 takes the altitude above mean sea level, and where home is
+	// follows from the vehicle's altitude above both
+	positionKnown := v.Connection.CurrentStates.GlobalPositionIntState != nil
+	homeAMSL := v.Position.AltitudeAMSL - v.Position.AltitudeRelative
+	v.lock.Unlock()
+
+	params := []float32{0, 0, 0, 0, 0, 0, float32(altitude)}
+	if firmware == FirmwarePX4 {
+		if !positionKnown {
+			return fmt.Errorf("takeoff: vehicle hasn't reported its altitude")
+		}
+		nan := float32(math.NaN())
+		params = []float32{0, 0, 0, nan, nan, nan, float32(homeAMSL + altitude)}
+	}
+	err := v.command(ctx, "takeoff", mavlink.MAV_CMD_NAV_TAKEOFF, params...)
+	if err != nil {
+		return err
+	}
+	acked := time.Now()
+	// autopilots level off a little short of the target
+	tolerance := math.Max(0.5, altitude*0.05)
+	return v.waitFor(ctx, "takeoff", fmt.Sprintf("vehicle to reach %v m", altitude), func() bool {
+		return v.heardSince(mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT, acked) &&
+			v.Connection.CurrentStates.GlobalPositionIntState["RelativeAlt"].(float64) >= altitude-tolerance
+	})
+}
+
+// Lands where the vehicle is and returns once it is on the ground
+func (v *Vehicle) Land(ctx context.Context) error {
+	var params []float32
+	v.lock.Lock()
+	if v.firmware == FirmwarePX4 {
+		// PX4 lands at the location given unless it is NaN, rather than
+		// treating zeros as where the vehicle is
+		nan := float32(math.NaN())
+		params = []float32{0, 0, 0, nan, nan, nan, nan}
+	}
+	v.lock.Unlock()
+	if err := v.command(ctx, "land", mavlink.MAV_CMD_NAV_LAND, params...); err != nil {
+		return err
+	}
+	acked := time.Now()
+	return v.waitFor(ctx, "land", "vehicle to land", func() bool {
+		return v.landedSince(acked)
+	})
+}
+
+// Flies back to the launch point and returns once the vehicle has switched
+// into RTL, without waiting for it to arrive and land. Only ArduPilot and PX4
+// are supported, as the RTL mode of other autopilots isn't known.
+func (v *Vehicle) ReturnToLaunch(ctx context.Context) error {
+	v.lock.Lock()
+	firmware, airframe := v.firmware, v.Airframe
+	v.lock.Unlock()
+	if modesFor(firmware, airframe) == nil {
+		return fmt.Errorf("return to launch: flight modes of %v autopilots aren't known", firmware)
+	}
+	if err := v.command(ctx, "return to launch", mavlink.MAV_CMD_NAV_RETURN_TO_LAUNCH); err != nil {
+		return err
+	}
+	acked := time.Now()
+	return v.waitFor(ctx, "return to launch", "vehicle to switch to RTL", func() bool {
+		if !v.heardSince(mavlink.MAVLINK_MSG_ID_HEARTBEAT, acked) {
+			return false
+		}
+		customMode := uint32(v.Connection.CurrentStates.Heartbeat["CustomMode"].(float64))
+		return modeName(v.firmware, v.Airframe, customMode) == "RTL"
+	})
+}
+
+// Whether a message has arrived since t, so that the state it carries
+// reflects anything that happened before then. Must be called holding the
+// lock.
+func (v *Vehicle) heardSince(messageID int, t time.Time) bool {
+	return v.received[messageID].After(t)
+}
+
+// Must be called holding the lock
+func (v *Vehicle) armed() bool {
+	baseMode := uint8(v.Connection.CurrentStates.Heartbeat["BaseMode"].(float64))
+	return baseMode&mavlink.MAV_MODE_FLAG_SAFETY_ARMED != 0
+}
+
+// Whether the vehicle has reported being on the ground since t. Vehicles
+// that don't send EXTENDED_SYS_STATE are taken to have landed once they are
+// down at home altitude and no longer descending. Must be called holding the
+// lock.
+func (v *Vehicle) landedSince(t time.Time) bool {
+	states := v.Connection.CurrentStates
+	if states.ExtendedSysState != nil {
+		return v.heardSince(mavlink.MAVLINK_MSG_ID_EXTENDED_SYS_STATE, t) &&
+			LandedState(states.ExtendedSysState["LandedState"].(float64)) == LandedStateOnGround
+	}
+	return v.heardSince(mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT, t) &&
+		v.heardSince(mavlink.MAVLINK_MSG_ID_VFR_HUD, t) &&
+		states.GlobalPositionIntState["RelativeAlt"].(float64) < 0.5 &&
+		math.Abs(states.VFRHUDState["Clb"].(float64)) < 0.1
+}
+
+// Polls the vehicle's state until done returns true, which is called holding
+// the lock
+func (v *Vehicle) waitFor(ctx context.Context, action string, what string, done func() bool) error {
+	ticker := time.NewTicker(actionPollInterval)
+	defer ticker.Stop()
+	for {
+		v.lock.Lock()
+		finished := done()
+		v.lock.Unlock()
+		if finished {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: waiting for %s: %w", action, what, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
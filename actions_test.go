@@ -0,0 +1,100 @@
+package mavcom
+
+import (
+	"math"
+	"testing"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// A simulator that climbs and descends quickly, to keep flights short
+func fastSimConfig(autopilot uint8) sim.Config {
+	config := sim.DefaultConfig()
+	config.Autopilot = autopilot
+	config.ClimbRate = 10
+	config.DescentRate = 10
+	return config
+}
+
+func TestArmTakeoffLand(t *testing.T) {
+	// the mode each autopilot holds in after taking off
+	holdModes := map[uint8]string{
+		sim.AutopilotArduPilot: "GUIDED",
+		sim.AutopilotPX4:       "LOITER",
+	}
+	for autopilot, holdMode := range holdModes {
+		autopilot, holdMode := autopilot, holdMode
+		t.Run(Firmware(autopilot).String(), func(t *testing.T) {
+			t.Parallel()
+			s, v := newSimVehicle(t, fastSimConfig(autopilot))
+			ctx := testContext(t)
+
+			if err := v.Arm(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if !s.State().Armed {
+				t.Fatal("simulator not armed")
+			}
+			if err := v.Takeoff(ctx, 5); err != nil {
+				t.Fatal(err)
+			}
+			// PX4 takes the altitude above mean sea level
+			if altitude := s.State().Altitude; math.Abs(altitude-5) > 1 {
+				t.Errorf("took off to %.1f m, want 5 m", altitude)
+			}
+			v.lock.Lock()
+			mode := v.FlightState.Mode
+			v.lock.Unlock()
+			if mode != holdMode {
+				t.Errorf("mode %s after taking off, want %s", mode, holdMode)
+			}
+			if err := v.Land(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if !s.State().Landed {
+				t.Error("simulator not landed")
+			}
+			if err := v.Disarm(ctx, false); err != nil {
+				t.Fatal(err)
+			}
+			if s.State().Armed {
+				t.Error("simulator still armed")
+			}
+		})
+	}
+}
+
+func TestReturnToLaunch(t *testing.T) {
+	for _, autopilot := range []uint8{sim.AutopilotArduPilot, sim.AutopilotPX4} {
+		autopilot := autopilot
+		t.Run(Firmware(autopilot).String(), func(t *testing.T) {
+			t.Parallel()
+			s, v := newSimVehicle(t, fastSimConfig(autopilot))
+			ctx := testContext(t)
+
+			if err := v.Arm(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Takeoff(ctx, 5); err != nil {
+				t.Fatal(err)
+			}
+			if err := v.ReturnToLaunch(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if mode := s.State().Mode; mode != sim.ModeRTL {
+				t.Errorf("simulator in mode %d, want RTL", mode)
+			}
+		})
+	}
+}
+
+func TestReturnToLaunchUnknownAutopilot(t *testing.T) {
+	s, v := newSimVehicle(t, fastSimConfig(mavlink.MAV_AUTOPILOT_GENERIC))
+	if err := v.ReturnToLaunch(testContext(t)); err == nil {
+		t.Fatal("return to launch with unknown modes succeeded")
+	}
+	if mode := s.State().Mode; mode == sim.ModeRTL {
+		t.Error("command sent to an autopilot whose modes aren't known")
+	}
+}
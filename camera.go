@@ -0,0 +1,639 @@
+package mavcom
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/communicator"
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// How long to wait for a camera to acknowledge a request for its
+	// information, and then for the information to arrive
+	cameraRequestTimeout = 2 * time.Second
+	cameraDiscoveryTime  = time.Second
+
+	// Most skipped images asked for again at once. A bigger jump in the image
+	// index is more likely a camera that was restarted or a link that was
+	// down for a while than a few lost messages.
+	cameraMaxMissingImages = 10
+
+	// Captured images buffered for each subscriber
+	capturedImageBuffer = 64
+)
+
+// CameraID identifies a camera by the MAVLink component it is, which is
+// where its commands go. Cameras driven by the autopilot share its
+// component ID.
+type CameraID struct {
+	SystemID    uint8
+	ComponentID uint8
+}
+
+func (id CameraID) String() string {
+	return fmt.Sprintf("%d/%d", id.SystemID, id.ComponentID)
+}
+
+// CameraCapability is the CAMERA_CAP_FLAGS a camera reports
+type CameraCapability uint32
+
+const (
+	CameraCanCaptureVideo            CameraCapability = mavlink.CAMERA_CAP_FLAGS_CAPTURE_VIDEO
+	CameraCanCaptureImage            CameraCapability = mavlink.CAMERA_CAP_FLAGS_CAPTURE_IMAGE
+	CameraHasModes                   CameraCapability = mavlink.CAMERA_CAP_FLAGS_HAS_MODES
+	CameraCanCaptureImageInVideoMode CameraCapability = mavlink.CAMERA_CAP_FLAGS_CAN_CAPTURE_IMAGE_IN_VIDEO_MODE
+	CameraCanCaptureVideoInImageMode CameraCapability = mavlink.CAMERA_CAP_FLAGS_CAN_CAPTURE_VIDEO_IN_IMAGE_MODE
+	CameraHasSurveyMode              CameraCapability = mavlink.CAMERA_CAP_FLAGS_HAS_IMAGE_SURVEY_MODE
+	CameraHasZoom                    CameraCapability = mavlink.CAMERA_CAP_FLAGS_HAS_BASIC_ZOOM
+	CameraHasFocus                   CameraCapability = mavlink.CAMERA_CAP_FLAGS_HAS_BASIC_FOCUS
+	CameraHasVideoStream             CameraCapability = mavlink.CAMERA_CAP_FLAGS_HAS_VIDEO_STREAM
+)
+
+var cameraCapabilityNames = []struct {
+	capability CameraCapability
+	name       string
+}{
+	{CameraCanCaptureVideo, "VIDEO"},
+	{CameraCanCaptureImage, "IMAGE"},
+	{CameraHasModes, "MODES"},
+	{CameraCanCaptureImageInVideoMode, "IMAGE_IN_VIDEO_MODE"},
+	{CameraCanCaptureVideoInImageMode, "VIDEO_IN_IMAGE_MODE"},
+	{CameraHasSurveyMode, "SURVEY_MODE"},
+	{CameraHasZoom, "ZOOM"},
+	{CameraHasFocus, "FOCUS"},
+	{CameraHasVideoStream, "VIDEO_STREAM"},
+}
+
+func (c CameraCapability) String() string {
+	var names []string
+	for _, n := range cameraCapabilityNames {
+		if c&n.capability != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+func (c CameraCapability) Has(capability CameraCapability) bool {
+	return c&capability == capability
+}
+
+// CameraMode is whether a camera is set up for taking pictures or recording
+// video
+type CameraMode uint8
+
+const (
+	CameraModeImage  CameraMode = mavlink.CAMERA_MODE_IMAGE
+	CameraModeVideo  CameraMode = mavlink.CAMERA_MODE_VIDEO
+	CameraModeSurvey CameraMode = mavlink.CAMERA_MODE_IMAGE_SURVEY
+)
+
+func (m CameraMode) String() string {
+	switch m {
+	case CameraModeImage:
+		return "IMAGE"
+	case CameraModeVideo:
+		return "VIDEO"
+	case CameraModeSurvey:
+		return "SURVEY"
+	default:
+		return fmt.Sprintf("MODE(%d)", uint8(m))
+	}
+}
+
+// Camera is what is known about a camera. Information from
+// CAMERA_INFORMATION, the settings from CAMERA_SETTINGS and the capture
+// status from CAMERA_CAPTURE_STATUS each arrive separately, and the Has
+// fields say which have.
+type Camera struct {
+	ID CameraID
+
+	HasInformation  bool
+	Vendor          string
+	Model           string
+	FirmwareVersion string
+	Capabilities    CameraCapability
+	// focal length and sensor size in millimeters, 0 when unknown
+	FocalLength  float64
+	SensorWidth  float64
+	SensorHeight float64
+	// image resolution in pixels
+	ResolutionH int
+	ResolutionV int
+	// where to fetch the camera's definition file, describing the rest of
+	// its settings, if it has one
+	DefinitionURI string
+	// the gimbal the camera is mounted on, 0 if none
+	GimbalDeviceID uint8
+
+	HasSettings bool
+	Mode        CameraMode
+	// in percent, -1 when the camera doesn't report them
+	Zoom  float64
+	Focus float64
+
+	HasCaptureStatus bool
+	// taking pictures, either a single one or at an interval
+	Capturing bool
+	// seconds between pictures while capturing at an interval
+	ImageInterval float64
+	Recording     bool
+	RecordingTime time.Duration
+	// free storage in MiB, -1 when the camera doesn't report it
+	AvailableCapacity float64
+	ImageCount        int
+}
+
+// What is kept about the images of each camera beyond what Camera reports
+type cameraImages struct {
+	// the sequence number of the last single picture asked for
+	sequence int
+	// the highest image index received, -1 before the first, and indexes
+	// below it that were skipped and have been asked for again
+	lastIndex int32
+	missing   map[int32]bool
+	// the time since boot of each picture received, to tell a picture sent
+	// again from one numbered again after the camera restarted
+	taken map[int32]uint32
+	// how many times the camera has restarted, so a picture asked for just
+	// before isn't compared against the old numbering
+	restarts int
+}
+
+// CapturedImage is where and when a camera took a picture, from
+// CAMERA_IMAGE_CAPTURED, to geotag the image with
+type CapturedImage struct {
+	Camera CameraID
+	// counts up from 0 for each picture the camera takes
+	Index int
+	// when the picture was taken, the zero time when the camera doesn't know
+	// the time of day
+	Time time.Time
+	// the vehicle's clock when the picture was taken, see
+	// Vehicle.BootTimeToLocal
+	TimeBootMs       uint32
+	Latitude         float64
+	Longitude        float64
+	AltitudeAMSL     float64
+	AltitudeRelative float64
+	// the camera's attitude in degrees relative to north and the horizon, 0
+	// when the camera doesn't report it
+	Roll  float64
+	Pitch float64
+	Yaw   float64
+	// false when the camera failed to take the picture
+	Captured bool
+	// where the camera stored the picture, if it says
+	FileURL string
+}
+
+// Components that are cameras announce themselves with their own heartbeat
+func isCameraHeartbeat(msg *mavlink.HeartbeatMessage) bool {
+	return msg.Type == mavlink.MAV_TYPE_CAMERA ||
+		(msg.ComponentID >= mavlink.MAV_COMP_ID_CAMERA && msg.ComponentID <= mavlink.MAV_COMP_ID_CAMERA6)
+}
+
+// Handles the heartbeat of a component that isn't an autopilot, such as a
+// camera or another ground station. Must be called holding the lock.
+func (v *Vehicle) handleComponentHeartbeat(msg *mavlink.HeartbeatMessage) {
+	if !isCameraHeartbeat(msg) {
+		return
+	}
+	id := CameraID{msg.SystemID, msg.ComponentID}
+	if _, ok := v.cameras[id]; ok {
+		return
+	}
+	v.camera(id)
+	// cameras are asked for their information as soon as they are heard
+	// from, so that they turn up without having to be discovered
+	if v.replay == nil {
+		go v.requestCameraInformation(id)
+	}
+}
+
+// Must be called holding the lock
+func (v *Vehicle) camera(id CameraID) *Camera {
+	c, ok := v.cameras[id]
+	if !ok {
+		c = &Camera{ID: id, Zoom: -1, Focus: -1, AvailableCapacity: -1}
+		v.cameras[id] = c
+	}
+	return c
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleCameraInformation(msg *mavlink.CameraInformationMessage) {
+	c := v.camera(CameraID{msg.SystemID, msg.ComponentID})
+	c.HasInformation = true
+	c.Vendor = msg.VendorName
+	c.Model = msg.ModelName
+	c.FirmwareVersion = ""
+	if version := msg.FirmwareVersion; version != 0 {
+		// major in the lowest byte, then minor, patch and dev
+		c.FirmwareVersion = fmt.Sprintf("%d.%d.%d.%d", version&0xff, version>>8&0xff, version>>16&0xff, version>>24)
+	}
+	c.Capabilities = CameraCapability(msg.Flags)
+	c.FocalLength = float64(msg.FocalLength)
+	c.SensorWidth = float64(msg.SensorSizeH)
+	c.SensorHeight = float64(msg.SensorSizeV)
+	c.ResolutionH = int(msg.ResolutionH)
+	c.ResolutionV = int(msg.ResolutionV)
+	c.DefinitionURI = msg.CamDefinitionURI
+	c.GimbalDeviceID = msg.GimbalDeviceID
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleCameraSettings(msg *mavlink.CameraSettingsMessage) {
+	c := v.camera(CameraID{msg.SystemID, msg.ComponentID})
+	c.HasSettings = true
+	c.Mode = CameraMode(msg.ModeID)
+	c.Zoom = percentOrUnknown(msg.ZoomLevel)
+	c.Focus = percentOrUnknown(msg.FocusLevel)
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleCameraCaptureStatus(msg *mavlink.CameraCaptureStatusMessage) {
+	c := v.camera(CameraID{msg.SystemID, msg.ComponentID})
+	c.HasCaptureStatus = true
+	c.Capturing = msg.ImageStatus != 0
+	c.ImageInterval = float64(msg.ImageInterval)
+	c.Recording = msg.VideoStatus != 0
+	c.RecordingTime = time.Duration(msg.RecordingTimeMs) * time.Millisecond
+	c.AvailableCapacity = percentOrUnknown(msg.AvailableCapacity)
+	c.ImageCount = int(msg.ImageCount)
+}
+
+// Cameras send NaN for levels they don't have
+func percentOrUnknown(value float32) float64 {
+	if math.IsNaN(float64(value)) {
+		return -1
+	}
+	return float64(value)
+}
+
+// Must be called holding the lock
+func (v *Vehicle) imagesOf(id CameraID) *cameraImages {
+	images, ok := v.cameraImages[id]
+	if !ok {
+		// cameras only skip a picture they have already taken when the
+		// sequence number matches the last one, so starting from the time
+		// keeps a new connection from repeating the last one's numbers
+		images = &cameraImages{
+			sequence:  int(time.Now().Unix() % 1000000),
+			lastIndex: -1,
+			missing:   make(map[int32]bool),
+			taken:     make(map[int32]uint32),
+		}
+		v.cameraImages[id] = images
+	}
+	return images
+}
+
+// Whether a picture shows the camera restarted and is numbering its pictures
+// from 0 again: its index was passed on before, but with a different time
+// since boot, and either its time since boot went backwards or its index
+// dropped by more than a few
+func (images *cameraImages) restarted(index int32, timeBootMs uint32) bool {
+	if index > images.lastIndex || images.missing[index] {
+		return false
+	}
+	if taken, ok := images.taken[index]; ok && taken == timeBootMs {
+		return false
+	}
+	return timeBootMs < images.taken[images.lastIndex] || images.lastIndex-index > cameraMaxMissingImages
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleCameraImageCaptured(msg *mavlink.CameraImageCapturedMessage) {
+	id := CameraID{msg.SystemID, msg.ComponentID}
+	images := v.imagesOf(id)
+
+	if images.restarted(msg.ImageIndex, msg.TimeBootMs) {
+		// the pictures still missing are gone with the old numbering
+		images.lastIndex = -1
+		images.missing = make(map[int32]bool)
+		images.taken = make(map[int32]uint32)
+		images.restarts++
+	}
+	// cameras send each picture once as it is taken and again whenever it
+	// is asked for, so only pictures not seen before are passed on
+	index := msg.ImageIndex
+	switch {
+	case images.missing[index]:
+		delete(images.missing, index)
+	case index > images.lastIndex:
+		if images.lastIndex >= 0 && index-images.lastIndex-1 <= cameraMaxMissingImages {
+			var skipped []int32
+			for i := images.lastIndex + 1; i < index; i++ {
+				images.missing[i] = true
+				skipped = append(skipped, i)
+			}
+			if len(skipped) > 0 && v.replay == nil {
+				go v.requestCapturedImages(id, skipped)
+			}
+		}
+		images.lastIndex = index
+	default:
+		return
+	}
+	images.taken[index] = msg.TimeBootMs
+
+	image := CapturedImage{
+		Camera:           id,
+		Index:            int(index),
+		TimeBootMs:       msg.TimeBootMs,
+		Latitude:         float64(msg.Lat) / 1e7,
+		Longitude:        float64(msg.Lon) / 1e7,
+		AltitudeAMSL:     float64(msg.Alt) / 1000,
+		AltitudeRelative: float64(msg.RelativeAlt) / 1000,
+		Captured:         msg.CaptureResult == 1,
+		FileURL:          msg.FileURL,
+	}
+	if msg.TimeUTC != 0 {
+		image.Time = time.UnixMicro(int64(msg.TimeUTC)).UTC()
+	}
+	roll, pitch, yaw := mavlink.EulerFromQuaternion(msg.Q)
+	if !math.IsNaN(roll) && !math.IsNaN(pitch) && !math.IsNaN(yaw) {
+		image.Roll, image.Pitch, image.Yaw = roll*180/math.Pi, pitch*180/math.Pi, yaw*180/math.Pi
+	}
+	for sub := range v.imageSubs {
+		select {
+		case sub <- image:
+		default:
+		}
+	}
+}
+
+// Asks a camera to send pictures it took again, for the ones whose
+// CAMERA_IMAGE_CAPTURED was lost
+func (v *Vehicle) requestCapturedImages(id CameraID, indexes []int32) {
+	for _, index := range indexes {
+		ctx, cancel := context.WithTimeout(context.Background(), cameraRequestTimeout)
+		v.Connection.SendCommandTo(ctx, id.SystemID, id.ComponentID, mavlink.MAV_CMD_REQUEST_MESSAGE,
+			mavlink.MAVLINK_MSG_ID_CAMERA_IMAGE_CAPTURED, float32(index))
+		cancel()
+	}
+}
+
+func (v *Vehicle) requestCameraInformation(id CameraID) {
+	for _, messageID := range []float32{
+		mavlink.MAVLINK_MSG_ID_CAMERA_INFORMATION,
+		mavlink.MAVLINK_MSG_ID_CAMERA_SETTINGS,
+		mavlink.MAVLINK_MSG_ID_CAMERA_CAPTURE_STATUS,
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), cameraRequestTimeout)
+		v.Connection.SendCommandTo(ctx, id.SystemID, id.ComponentID, mavlink.MAV_CMD_REQUEST_MESSAGE, messageID)
+		cancel()
+	}
+}
+
+// Returns every camera heard from, ordered by system and component ID
+func (v *Vehicle) Cameras() []Camera {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	cameras := make([]Camera, 0, len(v.cameras))
+	for _, c := range v.cameras {
+		cameras = append(cameras, *c)
+	}
+	sort.Slice(cameras, func(i, j int) bool {
+		if cameras[i].ID.SystemID != cameras[j].ID.SystemID {
+			return cameras[i].ID.SystemID < cameras[j].ID.SystemID
+		}
+		return cameras[i].ID.ComponentID < cameras[j].ID.ComponentID
+	})
+	return cameras
+}
+
+// Returns a camera on the vehicle by its component ID, and false if it
+// hasn't been heard from
+func (v *Vehicle) Camera(componentID uint8) (Camera, bool) {
+	targetSystem, _ := v.Connection.Target()
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	c, ok := v.cameras[CameraID{targetSystem, componentID}]
+	if !ok {
+		return Camera{}, false
+	}
+	return *c, true
+}
+
+// Asks every component on the vehicle for CAMERA_INFORMATION and returns
+// the cameras that answered, along with any already known. This finds
+// cameras driven by the autopilot, which don't send heartbeats of their
+// own. A vehicle without cameras returns none rather than an error.
+func (v *Vehicle) DiscoverCameras(ctx context.Context) ([]Camera, error) {
+	targetSystem, _ := v.Connection.Target()
+	requestCtx, cancel := context.WithTimeout(ctx, cameraRequestTimeout)
+	defer cancel()
+	_, err := v.Connection.SendCommandTo(requestCtx, targetSystem, 0, mavlink.MAV_CMD_REQUEST_MESSAGE,
+		mavlink.MAVLINK_MSG_ID_CAMERA_INFORMATION)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("discover cameras: %w", ctx.Err())
+	}
+	if err == nil {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("discover cameras: %w", ctx.Err())
+		case <-time.After(cameraDiscoveryTime):
+		}
+	}
+
+	var cameras []Camera
+	for _, c := range v.Cameras() {
+		if c.ID.SystemID == targetSystem {
+			cameras = append(cameras, c)
+		}
+	}
+	return cameras, nil
+}
+
+// Asks a camera for its settings and capture status again, which cameras
+// otherwise only send when asked
+func (v *Vehicle) RefreshCamera(ctx context.Context, id CameraID) error {
+	for _, messageID := range []float32{mavlink.MAVLINK_MSG_ID_CAMERA_SETTINGS, mavlink.MAVLINK_MSG_ID_CAMERA_CAPTURE_STATUS} {
+		if err := v.cameraCommand(ctx, "refresh camera", id, mavlink.MAV_CMD_REQUEST_MESSAGE, messageID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Vehicle) cameraCommand(ctx context.Context, name string, id CameraID, command uint16, params ...float32) error {
+	result, err := v.Connection.SendCommandTo(ctx, id.SystemID, id.ComponentID, command, params...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if CommandResult(result.Result) != ResultAccepted {
+		return fmt.Errorf("%s: camera responded %v", name, CommandResult(result.Result))
+	}
+	return nil
+}
+
+// Switches a camera between taking pictures and recording video
+func (v *Vehicle) SetCameraMode(ctx context.Context, id CameraID, mode CameraMode) error {
+	return v.cameraCommand(ctx, "set camera mode", id, mavlink.MAV_CMD_SET_CAMERA_MODE, 0, float32(mode))
+}
+
+// Takes a single picture and waits for the camera to say where it was
+// taken. The picture also goes to SubscribeImageCaptures.
+func (v *Vehicle) TakePhoto(ctx context.Context, id CameraID) (CapturedImage, error) {
+	images, unsubscribe := v.SubscribeImageCaptures()
+	defer unsubscribe()
+
+	// the sequence number lets the camera tell a command sent again from a
+	// request for another picture, and the picture is the first one newer
+	// than those already seen
+	v.lock.Lock()
+	state := v.imagesOf(id)
+	state.sequence++
+	sequence, lastIndex, restarts := state.sequence, int(state.lastIndex), state.restarts
+	v.lock.Unlock()
+
+	err := v.cameraCommand(ctx, "take photo", id, mavlink.MAV_CMD_IMAGE_START_CAPTURE, 0, 0, 1, float32(sequence))
+	if err != nil {
+		return CapturedImage{}, err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return CapturedImage{}, fmt.Errorf("take photo: %w", ctx.Err())
+		case image, ok := <-images:
+			if !ok {
+				return CapturedImage{}, fmt.Errorf("take photo: %w", communicator.ErrConnectionClosed)
+			}
+			if image.Camera != id {
+				continue
+			}
+			v.lock.Lock()
+			if state.restarts != restarts {
+				// the camera numbers its pictures from 0 again
+				lastIndex, restarts = -1, state.restarts
+			}
+			v.lock.Unlock()
+			if image.Index > lastIndex {
+				return image, nil
+			}
+		}
+	}
+}
+
+// Starts taking pictures every interval, stopping after count pictures or,
+// when count is 0, once StopPhotoInterval is called. Pictures go to
+// SubscribeImageCaptures as they are taken.
+func (v *Vehicle) StartPhotoInterval(ctx context.Context, id CameraID, interval time.Duration, count int) error {
+	return v.cameraCommand(ctx, "start photo interval", id, mavlink.MAV_CMD_IMAGE_START_CAPTURE,
+		0, float32(interval.Seconds()), float32(count))
+}
+
+// Stops taking pictures at an interval
+func (v *Vehicle) StopPhotoInterval(ctx context.Context, id CameraID) error {
+	return v.cameraCommand(ctx, "stop photo interval", id, mavlink.MAV_CMD_IMAGE_STOP_CAPTURE, 0)
+}
+
+// Starts recording video on every stream of a camera. While recording, the
+// camera sends its capture status once a second.
+func (v *Vehicle) StartVideo(ctx context.Context, id CameraID) error {
+	return v.cameraCommand(ctx, "start video", id, mavlink.MAV_CMD_VIDEO_START_CAPTURE, 0, 1)
+}
+
+// Stops recording video
+func (v *Vehicle) StopVideo(ctx context.Context, id CameraID) error {
+	return v.cameraCommand(ctx, "stop video", id, mavlink.MAV_CMD_VIDEO_STOP_CAPTURE, 0)
+}
+
+// Returns a channel that receives every picture any camera takes, once
+// each, and a function that ends the subscription. Pictures whose message
+// was lost are asked for again, so they may arrive out of order. Pictures
+// are dropped if the channel isn't read fast enough.
+func (v *Vehicle) SubscribeImageCaptures() (<-chan CapturedImage, func()) {
+	sub := make(chan CapturedImage, capturedImageBuffer)
+	v.lock.Lock()
+	if v.imageSubs == nil {
+		// the connection has already closed
+		close(sub)
+	} else {
+		v.imageSubs[sub] = true
+	}
+	v.lock.Unlock()
+
+	unsubscribe := func() {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+		if v.imageSubs[sub] {
+			delete(v.imageSubs, sub)
+			close(sub)
+		}
+	}
+	return sub, unsubscribe
+}
+
+// Must be called holding the lock
+func (v *Vehicle) closeImageSubscriptions() {
+	for sub := range v.imageSubs {
+		close(sub)
+	}
+	v.imageSubs = nil
+}
+
+// GeotagWriter writes captured images as CSV, one row per picture, for
+// photogrammetry tools to match up with the image files
+type GeotagWriter struct {
+	w *csv.Writer
+	// the header is written before the first row
+	started bool
+}
+
+var geotagHeader = []string{
+	"camera", "index", "time", "time_boot_ms", "latitude", "longitude",
+	"altitude_amsl", "altitude_relative", "roll", "pitch", "yaw", "captured", "file_url",
+}
+
+func NewGeotagWriter(w io.Writer) *GeotagWriter {
+	return &GeotagWriter{w: csv.NewWriter(w)}
+}
+
+// Writes a row for a picture and flushes it, so that the file is complete up
+// to the last picture if the program stops
+func (g *GeotagWriter) Write(image CapturedImage) error {
+	if !g.started {
+		g.started = true
+		if err := g.w.Write(geotagHeader); err != nil {
+			return err
+		}
+	}
+	var taken string
+	if !image.Time.IsZero() {
+		taken = image.Time.Format(time.RFC3339Nano)
+	}
+	float := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	err := g.w.Write([]string{
+		image.Camera.String(),
+		strconv.Itoa(image.Index),
+		taken,
+		strconv.FormatUint(uint64(image.TimeBootMs), 10),
+		float(image.Latitude),
+		float(image.Longitude),
+		float(image.AltitudeAMSL),
+		float(image.AltitudeRelative),
+		float(image.Roll),
+		float(image.Pitch),
+		float(image.Yaw),
+		strconv.FormatBool(image.Captured),
+		image.FileURL,
+	})
+	if err != nil {
+		return err
+	}
+	g.w.Flush()
+	return g.w.Error()
+}
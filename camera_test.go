@@ -0,0 +1,90 @@
+package mavcom
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+func TestImageCapturesAfterCameraRestart(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	images, unsubscribe := v.SubscribeImageCaptures()
+	defer unsubscribe()
+
+	capture := func(index int32, timeBootMs uint32) {
+		a.send(mavlink.MAV_COMP_ID_CAMERA, mavlink.CameraImageCaptured{
+			ImageIndex:    index,
+			TimeBootMs:    timeBootMs,
+			CaptureResult: 1,
+		})
+	}
+	expect := func(index int, timeBootMs uint32) {
+		t.Helper()
+		select {
+		case image := <-images:
+			if image.Index != index || image.TimeBootMs != timeBootMs {
+				t.Errorf("received picture %d at %d ms, want %d at %d ms", image.Index, image.TimeBootMs, index, timeBootMs)
+			}
+		case <-time.After(simTestTimeout):
+			t.Fatalf("picture %d not received", index)
+		}
+	}
+
+	capture(0, 1000)
+	capture(1, 2000)
+	capture(2, 3000)
+	// sent again, as when another ground station asks for it
+	capture(1, 2000)
+	// the camera restarted
+	capture(0, 500)
+	capture(1, 1500)
+	// and restarted without its clock going backwards, having taken many
+	// pictures since
+	capture(30, 9000)
+	capture(0, 10000)
+	for _, want := range []struct {
+		index      int
+		timeBootMs uint32
+	}{{0, 1000}, {1, 2000}, {2, 3000}, {0, 500}, {1, 1500}, {30, 9000}, {0, 10000}} {
+		expect(want.index, want.timeBootMs)
+	}
+	select {
+	case image := <-images:
+		t.Errorf("received picture %d at %d ms again", image.Index, image.TimeBootMs)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTakePhotoAfterCameraRestart(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	ctx := testContext(t)
+	camera := CameraID{1, mavlink.MAV_COMP_ID_CAMERA}
+	images, unsubscribe := v.SubscribeImageCaptures()
+	defer unsubscribe()
+	for index := int32(0); index < 3; index++ {
+		a.send(camera.ComponentID, mavlink.CameraImageCaptured{ImageIndex: index, TimeBootMs: 1000 * uint32(index+1), CaptureResult: 1})
+		<-images
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		image, err := v.TakePhoto(ctx, camera)
+		if err == nil && image.Index != 0 {
+			err = fmt.Errorf("took picture %d, want 0", image.Index)
+		}
+		done <- err
+	}()
+	// skipping the vehicle's request for AUTOPILOT_VERSION
+	long := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_LONG)).(*mavlink.CommandLongMessage)
+	for long.Command != mavlink.MAV_CMD_IMAGE_START_CAPTURE {
+		long = decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_LONG)).(*mavlink.CommandLongMessage)
+	}
+	a.send(camera.ComponentID, mavlink.CommandAck{Command: mavlink.MAV_CMD_IMAGE_START_CAPTURE})
+	// the camera restarted since the last picture, so numbers this one 0
+	a.send(camera.ComponentID, mavlink.CameraImageCaptured{ImageIndex: 0, TimeBootMs: 500, CaptureResult: 1})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,1063 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	mavcom "github.com/arducrow/go-mavcom"
+	"github.com/arducrow/go-mavcom/router"
+)
+
+// A command handler. start begins talking to the vehicle and waits for its
+// first heartbeat, handlers call it once they are ready for messages.
+type commandFunc func(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error
+
+var commands = map[string]commandFunc{
+	"watch":     watch,
+	"arm":       arm,
+	"disarm":    disarm,
+	"mode":      mode,
+	"takeoff":   takeoff,
+	"land":      land,
+	"rtl":       rtl,
+	"param":     param,
+	"mission":   mission,
+	"fence":     fence,
+	"ftp":       ftpCommand,
+	"log":       logCommand,
+	"gimbal":    gimbalCommand,
+	"camera":    cameraCommand,
+	"traffic":   traffic,
+	"rtcm":      rtcm,
+	"health":    health,
+	"preflight": preflight,
+	"version":   version,
+	"record":    record,
+	"inspect":   inspect,
+}
+
+type commandResult struct {
+	Command string `json:"command"`
+	Result  string `json:"result"`
+}
+
+// Runs a flight action and reports it once the vehicle has carried it out.
+// The vehicle has to physically move, so it is given much longer than it
+// takes to reply.
+func runAction(ctx context.Context, start func() error, timeout time.Duration, name string, action func(context.Context) error) error {
+	if err := start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*timeout)
+	defer cancel()
+	if err := action(ctx); err != nil {
+		return err
+	}
+	printResult(commandResult{Command: name, Result: "done"}, "%s: done", name)
+	return nil
+}
+
+func watch(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	messages, unsubscribe := v.Connection.Subscribe()
+	defer unsubscribe()
+	if err := start(); err != nil {
+		return err
+	}
+
+	type watchedMessage struct {
+		Time   time.Time              `json:"time"`
+		Name   string                 `json:"name"`
+		ID     int                    `json:"id"`
+		Fields map[string]interface{} `json:"fields"`
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			fields := msg.MessageData()
+			printResult(watchedMessage{
+				Time:   time.Now(),
+				Name:   msg.GetMessageName(),
+				ID:     msg.GetMessageID(),
+				Fields: fields,
+			}, "%-20s %s", msg.GetMessageName(), formatFields(fields))
+		}
+	}
+}
+
+func arm(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	flags := flag.NewFlagSet("arm", flag.ContinueOnError)
+	skipChecks := flags.Bool("skip-checks", false, "arm without running the pre-flight checks")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *skipChecks {
+		return runAction(ctx, start, timeout, "arm", v.ArmUnchecked)
+	}
+	return runAction(ctx, start, timeout, "arm", v.Arm)
+}
+
+func disarm(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	flags := flag.NewFlagSet("disarm", flag.ContinueOnError)
+	force := flags.Bool("force", false, "disarm even if the vehicle is flying")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return runAction(ctx, start, timeout, "disarm", func(ctx context.Context) error {
+		return v.Disarm(ctx, *force)
+	})
+}
+
+func mode(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: mode <name>")
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := v.SetMode(ctx, args[0]); err != nil {
+		return err
+	}
+	printResult(commandResult{Command: "mode " + args[0], Result: mavcom.ResultAccepted.String()},
+		"mode %s: %v", args[0], mavcom.ResultAccepted)
+	return nil
+}
+
+func takeoff(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: takeoff <altitude>")
+	}
+	altitude, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return fmt.Errorf("invalid altitude %q", args[0])
+	}
+	return runAction(ctx, start, timeout, "takeoff", func(ctx context.Context) error {
+		return v.Takeoff(ctx, altitude)
+	})
+}
+
+func land(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	return runAction(ctx, start, timeout, "land", v.Land)
+}
+
+func rtl(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	return runAction(ctx, start, timeout, "rtl", v.ReturnToLaunch)
+}
+
+func param(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: param get <name> | param set <name> <value> | param dump")
+	}
+	if err := start(); err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "get" && len(args) == 2:
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		value, err := v.GetParam(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		printResult(map[string]float64{args[1]: value}, "%s = %v", args[1], value)
+		return nil
+
+	case args[0] == "set" && len(args) == 3:
+		value, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q", args[2])
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := v.SetParam(ctx, args[1], value); err != nil {
+			return err
+		}
+		printResult(map[string]float64{args[1]: value}, "%s = %v", args[1], value)
+		return nil
+
+	case args[0] == "dump" && len(args) == 1:
+		// a full parameter list can take a while over a slow radio, so the
+		// timeout only applies to the vehicle going quiet rather than the
+		// whole download
+		ctx, cancel := context.WithTimeout(ctx, 10*timeout)
+		defer cancel()
+		params, err := v.Params(ctx)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			printResult(params, "")
+			return nil
+		}
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(output, "%-16s %v\n", name, params[name])
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("usage: param get <name> | param set <name> <value> | param dump")
+	}
+}
+
+func mission(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	if len(args) != 2 || (args[0] != "upload" && args[0] != "download") {
+		return fmt.Errorf("usage: mission upload <file> | mission download <file>")
+	}
+	path := args[1]
+	if err := start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*timeout)
+	defer cancel()
+
+	type missionResult struct {
+		Command string `json:"command"`
+		File    string `json:"file"`
+		Items   int    `json:"items"`
+	}
+
+	if args[0] == "upload" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		items, err := mavcom.ReadWaypoints(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := v.UploadMission(ctx, items); err != nil {
+			return err
+		}
+		printResult(missionResult{Command: "upload", File: path, Items: len(items)},
+			"uploaded %d mission items from %s", len(items), path)
+		return nil
+	}
+
+	items, err := v.DownloadMission(ctx)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := mavcom.WriteWaypoints(file, items); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	printResult(missionResult{Command: "download", File: path, Items: len(items)},
+		"downloaded %d mission items to %s", len(items), path)
+	return nil
+}
+
+func fence(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	if len(args) != 2 || (args[0] != "upload" && args[0] != "download") {
+		return fmt.Errorf("usage: fence upload <file> | fence download <file>")
+	}
+	path := args[1]
+	if err := start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*timeout)
+	defer cancel()
+
+	type fenceResult struct {
+		Command  string `json:"command"`
+		File     string `json:"file"`
+		Polygons int    `json:"polygons"`
+		Circles  int    `json:"circles"`
+	}
+
+	if args[0] == "upload" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		f, err := mavcom.ReadGeoJSONFence(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := v.UploadFence(ctx, f); err != nil {
+			return err
+		}
+		printResult(fenceResult{Command: "upload", File: path, Polygons: len(f.Polygons), Circles: len(f.Circles)},
+			"uploaded %d polygons and %d circles from %s", len(f.Polygons), len(f.Circles), path)
+		return nil
+	}
+
+	f, err := v.DownloadFence(ctx)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := mavcom.WriteGeoJSONFence(file, f); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	printResult(fenceResult{Command: "download", File: path, Polygons: len(f.Polygons), Circles: len(f.Circles)},
+		"downloaded %d polygons and %d circles to %s", len(f.Polygons), len(f.Circles), path)
+	return nil
+}
+
+func ftpCommand(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	const usage = "usage: ftp ls <dir> | ftp get <remote> <local> | ftp put <local> <remote> | ftp rm <remote>"
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*timeout)
+	defer cancel()
+	client := v.FTP()
+
+	type transferResult struct {
+		Command string `json:"command"`
+		Remote  string `json:"remote"`
+		Local   string `json:"local,omitempty"`
+		Bytes   int    `json:"bytes,omitempty"`
+	}
+
+	switch {
+	case args[0] == "ls" && len(args) == 2:
+		entries, err := client.List(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			printResult(entries, "")
+			return nil
+		}
+		for _, entry := range entries {
+			if entry.Dir {
+				fmt.Fprintf(output, "%10s  %s/\n", "", entry.Name)
+			} else {
+				fmt.Fprintf(output, "%10d  %s\n", entry.Size, entry.Name)
+			}
+		}
+		return nil
+
+	case args[0] == "get" && len(args) == 3:
+		data, err := client.ReadFile(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[2], data, 0o644); err != nil {
+			return err
+		}
+		printResult(transferResult{Command: "get", Remote: args[1], Local: args[2], Bytes: len(data)},
+			"read %d bytes from %s to %s", len(data), args[1], args[2])
+		return nil
+
+	case args[0] == "put" && len(args) == 3:
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		if err := client.WriteFile(ctx, args[2], data); err != nil {
+			return err
+		}
+		printResult(transferResult{Command: "put", Remote: args[2], Local: args[1], Bytes: len(data)},
+			"wrote %d bytes from %s to %s", len(data), args[1], args[2])
+		return nil
+
+	case args[0] == "rm" && len(args) == 2:
+		if err := client.Remove(ctx, args[1]); err != nil {
+			return err
+		}
+		printResult(transferResult{Command: "rm", Remote: args[1]}, "removed %s", args[1])
+		return nil
+
+	default:
+		return fmt.Errorf(usage)
+	}
+}
+
+func logCommand(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	const usage = "usage: log ls | log get <id> <file> | log erase"
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+	if err := start(); err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "ls" && len(args) == 1:
+		listCtx, cancel := context.WithTimeout(ctx, 10*timeout)
+		defer cancel()
+		entries, err := v.ListLogs(listCtx)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			printResult(entries, "")
+			return nil
+		}
+		for _, entry := range entries {
+			written := "-"
+			if !entry.Time.IsZero() {
+				written = entry.Time.Format(time.RFC3339)
+			}
+			fmt.Fprintf(output, "%5d  %10d  %s\n", entry.ID, entry.Size, written)
+		}
+		return nil
+
+	case args[0] == "get" && len(args) == 3:
+		id, err := strconv.ParseUint(args[1], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid log id %q", args[1])
+		}
+		listCtx, cancel := context.WithTimeout(ctx, 10*timeout)
+		defer cancel()
+		entries, err := v.ListLogs(listCtx)
+		if err != nil {
+			return err
+		}
+		var entry *mavcom.LogEntry
+		for i := range entries {
+			if entries[i].ID == uint16(id) {
+				entry = &entries[i]
+			}
+		}
+		if entry == nil {
+			return fmt.Errorf("no log %d on the vehicle", id)
+		}
+		// a download that stalls fails by itself, so there's no overall
+		// timeout for logs that take minutes
+		progress := func(p mavcom.LogProgress) {
+			if !jsonOutput {
+				fmt.Fprintf(os.Stderr, "\r%d/%d bytes", p.Received, p.Size)
+			}
+		}
+		err = v.DownloadLog(ctx, *entry, args[2], progress)
+		if !jsonOutput {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			return err
+		}
+		type logResult struct {
+			Command string `json:"command"`
+			ID      uint16 `json:"id"`
+			File    string `json:"file"`
+			Bytes   uint32 `json:"bytes"`
+		}
+		printResult(logResult{Command: "get", ID: entry.ID, File: args[2], Bytes: entry.Size}, "downloaded log %d, %d bytes, to %s", entry.ID, entry.Size, args[2])
+		return nil
+
+	case args[0] == "erase" && len(args) == 1:
+		if err := v.EraseLogs(); err != nil {
+			return err
+		}
+		printResult(commandResult{Command: "log erase", Result: "sent"}, "erase requested")
+		return nil
+
+	default:
+		return fmt.Errorf(usage)
+	}
+}
+
+func gimbalCommand(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	const usage = "usage: gimbal ls | gimbal point <pitch> <yaw> | gimbal roi <lat> <lon> <alt> | gimbal roi none"
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+	var numbers []float64
+	for _, arg := range args[1:] {
+		if arg == "none" {
+			break
+		}
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", arg)
+		}
+		numbers = append(numbers, n)
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch {
+	case args[0] == "ls" && len(args) == 1:
+		gimbals, err := v.DiscoverGimbals(ctx)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			printResult(gimbals, "")
+			return nil
+		}
+		for _, g := range gimbals {
+			fmt.Fprintf(output, "%v  pitch %.0f to %.0f, yaw %.0f to %.0f  %v\n",
+				g.ID, g.PitchMin, g.PitchMax, g.YawMin, g.YawMax, g.Capabilities)
+			if g.HasAttitude {
+				fmt.Fprintf(output, "    roll %.1f pitch %.1f yaw %.1f %v\n",
+					g.Attitude.Roll, g.Attitude.Pitch, g.Attitude.Yaw, g.Attitude.Failures)
+			}
+		}
+		return nil
+
+	case args[0] == "point" && len(numbers) == 2 && len(args) == 3:
+		gimbals, err := v.DiscoverGimbals(ctx)
+		if err != nil {
+			return err
+		}
+		if len(gimbals) == 0 {
+			return fmt.Errorf("no gimbal found")
+		}
+		id := gimbals[0].ID
+		if err := v.ControlGimbal(ctx, id); err != nil {
+			return err
+		}
+		if err := v.SetGimbalPitchYaw(id, mavcom.GimbalAngles(numbers[0], numbers[1])); err != nil {
+			return err
+		}
+		printResult(commandResult{Command: "gimbal point", Result: "sent"}, "pointing gimbal %v at pitch %g yaw %g", id, numbers[0], numbers[1])
+		return nil
+
+	case args[0] == "roi" && len(args) == 2 && args[1] == "none":
+		if err := v.ClearROI(ctx, 0); err != nil {
+			return err
+		}
+		printResult(commandResult{Command: "gimbal roi", Result: "cleared"}, "ROI cleared")
+		return nil
+
+	case args[0] == "roi" && len(numbers) == 3 && len(args) == 4:
+		if err := v.SetROILocation(ctx, 0, numbers[0], numbers[1], numbers[2]); err != nil {
+			return err
+		}
+		printResult(commandResult{Command: "gimbal roi", Result: "accepted"}, "ROI set")
+		return nil
+
+	default:
+		return fmt.Errorf(usage)
+	}
+}
+
+func cameraCommand(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	const usage = "usage: camera ls | camera photo | camera interval <seconds> [count] | camera stop | camera video start|stop | camera geotags <file>"
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+
+	if args[0] == "geotags" {
+		if len(args) != 2 {
+			return fmt.Errorf(usage)
+		}
+		file, err := os.Create(args[1])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		// subscribed before starting so that no picture is missed
+		images, unsubscribe := v.SubscribeImageCaptures()
+		defer unsubscribe()
+		if err := start(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "writing geotags to %s, interrupt to stop\n", args[1])
+		geotags := mavcom.NewGeotagWriter(file)
+		count := 0
+		for {
+			select {
+			case <-ctx.Done():
+				type geotagResult struct {
+					File   string `json:"file"`
+					Images int    `json:"images"`
+				}
+				printResult(geotagResult{File: args[1], Images: count}, "wrote %d geotags to %s", count, args[1])
+				return file.Sync()
+			case image, ok := <-images:
+				if !ok {
+					return fmt.Errorf("connection closed")
+				}
+				if err := geotags.Write(image); err != nil {
+					return err
+				}
+				count++
+			}
+		}
+	}
+
+	var numbers []float64
+	if args[0] == "interval" {
+		for _, arg := range args[1:] {
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", arg)
+			}
+			numbers = append(numbers, n)
+		}
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cameras, err := v.DiscoverCameras(ctx)
+	if err != nil {
+		return err
+	}
+	if args[0] == "ls" && len(args) == 1 {
+		if jsonOutput {
+			printResult(cameras, "")
+			return nil
+		}
+		for _, c := range cameras {
+			fmt.Fprintf(output, "%v  %s %s  %dx%d  %v\n", c.ID, c.Vendor, c.Model, c.ResolutionH, c.ResolutionV, c.Capabilities)
+			if c.HasSettings {
+				fmt.Fprintf(output, "    mode %v", c.Mode)
+				if c.HasCaptureStatus {
+					fmt.Fprintf(output, ", %d images, recording %v", c.ImageCount, c.Recording)
+				}
+				fmt.Fprintln(output)
+			}
+		}
+		return nil
+	}
+	if len(cameras) == 0 {
+		return fmt.Errorf("no camera found")
+	}
+	id := cameras[0].ID
+
+	switch {
+	case args[0] == "photo" && len(args) == 1:
+		image, err := v.TakePhoto(ctx, id)
+		if err != nil {
+			return err
+		}
+		printResult(image, "image %d at %.7f, %.7f, %.1f m  %s",
+			image.Index, image.Latitude, image.Longitude, image.AltitudeRelative, image.FileURL)
+		return nil
+
+	case args[0] == "interval" && (len(numbers) == 1 || len(numbers) == 2):
+		count := 0
+		if len(numbers) == 2 {
+			count = int(numbers[1])
+		}
+		interval := time.Duration(numbers[0] * float64(time.Second))
+		if err := v.StartPhotoInterval(ctx, id, interval, count); err != nil {
+			return err
+		}
+		printResult(commandResult{Command: "camera interval", Result: "accepted"}, "taking pictures every %v", interval)
+		return nil
+
+	case args[0] == "stop" && len(args) == 1:
+		if err := v.StopPhotoInterval(ctx, id); err != nil {
+			return err
+		}
+		printResult(commandResult{Command: "camera stop", Result: "accepted"}, "stopped taking pictures")
+		return nil
+
+	case args[0] == "video" && len(args) == 2 && args[1] == "start":
+		if err := v.StartVideo(ctx, id); err != nil {
+			return err
+		}
+		printResult(commandResult{Command: "camera video start", Result: "accepted"}, "recording")
+		return nil
+
+	case args[0] == "video" && len(args) == 2 && args[1] == "stop":
+		if err := v.StopVideo(ctx, id); err != nil {
+			return err
+		}
+		printResult(commandResult{Command: "camera video stop", Result: "accepted"}, "stopped recording")
+		return nil
+
+	default:
+		return fmt.Errorf(usage)
+	}
+}
+
+// Prints traffic alerts as they happen and the aircraft around the vehicle
+// every interval, until interrupted
+func traffic(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	flags := flag.NewFlagSet("traffic", flag.ContinueOnError)
+	interval := flags.Duration("interval", 5*time.Second, "how often to print the aircraft around the vehicle")
+	unmanned := flags.Bool("unmanned", false, "also alert on drones and obstacles")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	v.TrafficAlerts.IncludeUnmanned = *unmanned
+	alerts, unsubscribe := v.SubscribeTrafficAlerts()
+	defer unsubscribe()
+	if err := start(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case alert, ok := <-alerts:
+			if !ok {
+				return fmt.Errorf("connection closed")
+			}
+			e := alert.Encounter
+			printResult(alert, "%s %s (%v): %.0f m at %03.0f°, %+.0f m, closest %.0f m in %v",
+				alert.Level, e.Name(), e.Emitter, e.Range, e.Bearing, e.RelativeAltitude,
+				e.RangeAtCPA, e.TimeToCPA.Round(time.Second))
+		case <-ticker.C:
+			encounters := v.TrafficEncounters()
+			if jsonOutput {
+				printResult(encounters, "")
+				continue
+			}
+			table := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(table, "AIRCRAFT\tTYPE\tRANGE\tBEARING\tREL ALT\tSPEED\tCPA\tCPA IN")
+			for _, e := range encounters {
+				fmt.Fprintf(table, "%s\t%v\t%.0f m\t%03.0f°\t%+.0f m\t%.0f m/s\t%.0f m\t%v\n",
+					e.Name(), e.Emitter, e.Range, e.Bearing, e.RelativeAltitude, e.GroundSpeed,
+					e.RangeAtCPA, e.TimeToCPA.Round(time.Second))
+			}
+			table.Flush()
+			fmt.Fprintln(output)
+		}
+	}
+}
+
+// Injects RTCM corrections from a base station into the vehicle's GPS until
+// the source ends or interrupted, printing what has been sent every interval
+func rtcm(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	flags := flag.NewFlagSet("rtcm", flag.ContinueOnError)
+	interval := flags.Duration("interval", 5*time.Second, "how often to print what has been sent")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: rtcm [-interval 5s] <source>")
+	}
+	source, err := mavcom.OpenRTCMSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	if err := start(); err != nil {
+		return err
+	}
+
+	injector := v.NewRTCMInjector()
+	done := make(chan error, 1)
+	go func() {
+		done <- injector.ReadFrom(ctx, source)
+	}()
+	printStats := func() {
+		stats := injector.Stats()
+		types := make([]int, 0, len(stats.Types))
+		for t := range stats.Types {
+			types = append(types, t)
+		}
+		sort.Ints(types)
+		counts := make([]string, len(types))
+		for i, t := range types {
+			counts[i] = fmt.Sprintf("%d×%d", t, stats.Types[t])
+		}
+		printResult(stats, "%d messages, %d bytes, %d CRC failures, %d too long: %s",
+			stats.Messages, stats.Bytes, stats.CRCFailures, stats.TooLong, strings.Join(counts, " "))
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			printStats()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		case <-ticker.C:
+			printStats()
+		}
+	}
+}
+
+// Forwards frames between the vehicle's link and other endpoints, printing
+// what has been forwarded every interval until interrupted. Endpoints take
+// "allow" and "block" query parameters listing message IDs, such as
+// udpout://127.0.0.1:14550?block=253.
+func route(ctx context.Context, vehicleURL string, args []string) error {
+	flags := flag.NewFlagSet("route", flag.ContinueOnError)
+	interval := flags.Duration("interval", 5*time.Second, "how often to print the statistics")
+	dedup := flags.Duration("dedup", 200*time.Millisecond, "how long to drop copies of a frame for, 0 to forward them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: route [-interval 5s] [-dedup 200ms] <url>...")
+	}
+
+	r := router.New()
+	defer r.Close()
+	r.DedupWindow = *dedup
+	r.Logger = logger
+	for _, endpointURL := range append([]string{vehicleURL}, flags.Args()...) {
+		e, err := routeEndpoint(endpointURL)
+		if err != nil {
+			return err
+		}
+		if err := r.Add(e); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "routing between %d endpoints, interrupt to stop\n", flags.NArg()+1)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			stats := r.Stats()
+			if jsonOutput {
+				printResult(stats, "")
+				continue
+			}
+			table := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(table, "ENDPOINT\tIN\tOUT\tDUPLICATES\tCRC\tFILTERED\tDROPPED\tCOMPONENTS")
+			for _, s := range stats {
+				fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", s.Name, s.FramesIn, s.FramesOut,
+					s.Duplicates, s.CRCFailures, s.Filtered, s.Dropped, strings.Join(s.Components, " "))
+			}
+			table.Flush()
+			fmt.Fprintln(output)
+		}
+	}
+}
+
+// Reads an endpoint's message filters from its URL
+func routeEndpoint(endpointURL string) (router.Endpoint, error) {
+	e := router.Endpoint{Name: endpointURL, URL: endpointURL}
+	u, err := url.Parse(endpointURL)
+	if err != nil {
+		return e, fmt.Errorf("invalid endpoint URL %q: %w", endpointURL, err)
+	}
+	for name, ids := range map[string]*[]uint32{"allow": &e.AllowMessages, "block": &e.BlockMessages} {
+		list := u.Query().Get(name)
+		if list == "" {
+			continue
+		}
+		for _, field := range strings.Split(list, ",") {
+			id, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return e, fmt.Errorf("invalid message ID %q in %s", field, endpointURL)
+			}
+			*ids = append(*ids, uint32(id))
+		}
+	}
+	return e, nil
+}
+
+func version(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: version")
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	version, err := v.RequestAutopilotVersion(ctx)
+	if err != nil {
+		return err
+	}
+	printResult(version, "%v %v (%s), board %d, vendor %04x product %04x, UID %016x\ncapabilities: %v",
+		version.Firmware, version.FlightVersion, version.FlightGitHash, version.Board,
+		version.VendorID, version.ProductID, version.UID, version.Capabilities)
+	return nil
+}
+
+// Prints what is wrong with the vehicle once it has reported its sensors and
+// EKF, or once the timeout has passed without them
+func health(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: health")
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	if err := waitForHealth(ctx, v, timeout); err != nil {
+		return err
+	}
+	problems := v.Unhealthy()
+	if jsonOutput {
+		printResult(problems, "")
+		return nil
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(output, "healthy")
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(output, problem)
+	}
+	return nil
+}
+
+// Waits for the vehicle to report its sensors and EKF, warning if it
+// hasn't within the timeout
+func waitForHealth(ctx context.Context, v *mavcom.Vehicle, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		h := v.Health()
+		if !h.Sensors.Received.IsZero() && !h.Estimator.Received.IsZero() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			fmt.Fprintln(os.Stderr, "mavcom: the vehicle hasn't reported all of its health")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func preflight(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: preflight")
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type checkResult struct {
+		Name    string `json:"name"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	report := v.CheckPreflight(ctx, mavcom.DefaultPreflightConfig())
+	for _, result := range report.Results {
+		printResult(checkResult{Name: result.Name, Status: result.Status.String(), Message: result.Message},
+			"%-4v  %-8s %s", result.Status, result.Name, result.Message)
+	}
+	if !report.Passed() {
+		return fmt.Errorf("pre-flight checks failed")
+	}
+	return nil
+}
+
+func record(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: record <file>")
+	}
+	file, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	started := time.Now()
+	v.Connection.Record(file)
+	if err := start(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "recording to %s, interrupt to stop\n", args[0])
+	<-ctx.Done()
+	v.Connection.Record(nil)
+
+	type recordResult struct {
+		File     string  `json:"file"`
+		Duration float64 `json:"duration"`
+	}
+	duration := time.Since(started)
+	printResult(recordResult{File: args[0], Duration: duration.Seconds()},
+		"recorded %s to %s", duration.Round(time.Second), args[0])
+	return file.Sync()
+}
+
+func inspect(ctx context.Context, v *mavcom.Vehicle, start func() error, timeout time.Duration, args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	interval := flags.Duration("interval", time.Second, "how often to print the statistics")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := start(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			stats := v.Stats()
+			if jsonOutput {
+				printResult(stats, "")
+				continue
+			}
+			printStats(stats)
+		}
+	}
+}
+
+// Prints link statistics as a table of messages, similar to MAVProxy's status
+func printStats(stats mavcom.LinkStats) {
+	fmt.Fprintf(output, "%s: %d bytes in, %d bytes out, %d frames in, %d frames out, %d CRC failures, %d unknown\n",
+		time.Since(stats.Since).Round(time.Second), stats.BytesIn, stats.BytesOut,
+		stats.FramesIn, stats.FramesOut, stats.CRCFailures, stats.UnknownMessages)
+	for _, source := range stats.Sources {
+		fmt.Fprintf(output, "system %d component %d: %d received, %d lost (%.1f%%)\n",
+			source.SystemID, source.ComponentID, source.Received, source.Lost, source.LossPercent)
+	}
+
+	ids := make([]int, 0, len(stats.Messages))
+	for id := range stats.Messages {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	table := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNAME\tCOUNT\tRATE")
+	for _, id := range ids {
+		message := stats.Messages[id]
+		name := message.Name
+		if name == "" {
+			name = "(unknown)"
+		}
+		fmt.Fprintf(table, "%d\t%s\t%d\t%.1f/s\n", id, name, message.Count, message.Rate)
+	}
+	table.Flush()
+	fmt.Fprintln(output)
+}
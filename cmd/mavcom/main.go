@@ -0,0 +1,183 @@
+// Command mavcom connects to a MAVLink vehicle to inspect and command it.
+//
+//	mavcom [flags] <command> [arguments]
+//
+// Commands:
+//
+//	watch                       print decoded telemetry as it arrives
+//	arm [-skip-checks]          arm the vehicle once the pre-flight checks pass
+//	disarm [-force]             disarm the vehicle, -force also works in the air
+//	mode <name>                 change flight mode, e.g. GUIDED
+//	takeoff <altitude>          take off to an altitude in meters
+//	land                        land where the vehicle is
+//	rtl                         return to launch
+//	param get <name>            print a parameter
+//	param set <name> <value>    change a parameter
+//	param dump                  print every parameter
+//	mission upload <file>       upload a QGC WPL 110 waypoint file
+//	mission download <file>     save the vehicle's mission to a waypoint file
+//	fence upload <file>         upload a geofence from a GeoJSON file
+//	fence download <file>       save the vehicle's geofence as GeoJSON
+//	ftp ls <dir>                list a directory on the vehicle
+//	ftp get <remote> <local>    copy a file from the vehicle
+//	ftp put <local> <remote>    copy a file to the vehicle
+//	ftp rm <remote>             delete a file on the vehicle
+//	log ls                      list the dataflash logs on the vehicle
+//	log get <id> <file>         download a log, resuming a failed download
+//	log erase                   erase every log on the vehicle
+//	gimbal ls                   list the vehicle's gimbals and where they point
+//	gimbal point <pitch> <yaw>  point the first gimbal, in degrees
+//	gimbal roi <lat> <lon> <alt>
+//	                            point gimbals at a location, alt above home
+//	gimbal roi none             stop pointing gimbals at a location
+//	camera ls                   list the vehicle's cameras
+//	camera photo                take a picture with the first camera
+//	camera interval <seconds> [count]
+//	                            take pictures at an interval, count 0 for no end
+//	camera stop                 stop taking pictures at an interval
+//	camera video start|stop     start or stop recording video
+//	camera geotags <file>       write where pictures are taken to a CSV file
+//	                            until interrupted
+//	traffic [-interval 5s] [-unmanned]
+//	                            print ADS-B traffic and alerts until interrupted
+//	rtcm [-interval 5s] <source>
+//	                            inject RTCM3 corrections into the vehicle's GPS
+//	                            from a file://, serial:// or tcp:// source until
+//	                            it ends or interrupted
+//	health                      print unhealthy sensors and EKF problems
+//	preflight                   run the pre-flight checks and print the report
+//	version                     print the firmware version and capabilities
+//	record <file>               record telemetry to a .tlog until interrupted
+//	inspect [-interval 1s]      print message rates and link statistics
+//	route [-interval 5s] [-dedup 200ms] <url>...
+//	                            forward frames between the vehicle and other
+//	                            endpoints, such as udpout://127.0.0.1:14550 or
+//	                            tcpin://:5760, until interrupted
+//
+// Flags:
+//
+//	-url      connection URL (default udp://:14550), see mavcom.Connect
+//	-json     print JSON instead of human-readable output
+//	-v        print what the library is doing on stderr
+//	-timeout  how long to wait for the vehicle (default 10s)
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	mavcom "github.com/arducrow/go-mavcom"
+)
+
+// Where the results of commands are written
+var output io.Writer = os.Stdout
+
+var jsonOutput bool
+
+// Where the library reports what it is doing, on stderr so that it stays out
+// of the results. Only warnings and errors unless -v is given.
+var logger *slog.Logger
+
+func main() {
+	url := flag.String("url", "udp://:14550", "connection URL, e.g. tcp://127.0.0.1:5760 or serial:///dev/ttyUSB0:57600")
+	timeout := flag.Duration("timeout", 10*time.Second, "how long to wait for the vehicle")
+	flag.BoolVar(&jsonOutput, "json", false, "print JSON instead of human-readable output")
+	verbose := flag.Bool("v", false, "print what the library is doing on stderr")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	level := slog.LevelWarn
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	if err := run(*url, *timeout, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "mavcom:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: mavcom [-url URL] [-json] [-v] [-timeout DURATION] <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "commands: watch, arm, disarm, mode, takeoff, land, rtl, param, mission, fence, ftp, log, gimbal, camera, traffic, rtcm, health, preflight, version, record, inspect, route")
+	flag.PrintDefaults()
+}
+
+func run(url string, timeout time.Duration, command string, args []string) error {
+	// the router forwards frames as they are rather than talking to the
+	// vehicle itself
+	if command == "route" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return route(ctx, url, args)
+	}
+
+	handler, ok := commands[command]
+	if !ok {
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	v, err := mavcom.Connect(url)
+	if err != nil {
+		return err
+	}
+	defer v.Connection.Close()
+	v.Logger = logger
+
+	// interrupting stops watching and recording, and abandons anything
+	// waiting on the vehicle
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// commands start the vehicle themselves so that anything that needs to
+	// see every message can be set up first
+	start := func() error {
+		v.Start()
+		connectCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return v.WaitConnected(connectCtx)
+	}
+	return handler(ctx, v, start, timeout, args)
+}
+
+// Prints a result, either as JSON or with the human-readable format
+func printResult(value interface{}, format string, args ...interface{}) {
+	if jsonOutput {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "mavcom:", err)
+			return
+		}
+		fmt.Fprintln(output, string(encoded))
+		return
+	}
+	fmt.Fprintf(output, format+"\n", args...)
+}
+
+// Formats decoded message fields as "Name=value" pairs in a stable order
+func formatFields(fields map[string]interface{}) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%v", name, fields[name])
+	}
+	return strings.Join(pairs, " ")
+}
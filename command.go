@@ -0,0 +1,85 @@
+package mavcom
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// CommandResult is the MAV_RESULT a vehicle acknowledges a command with
+type CommandResult uint8
+
+const (
+	ResultAccepted            CommandResult = mavlink.MAV_RESULT_ACCEPTED
+	ResultTemporarilyRejected CommandResult = mavlink.MAV_RESULT_TEMPORARILY_REJECTED
+	ResultDenied              CommandResult = mavlink.MAV_RESULT_DENIED
+	ResultUnsupported         CommandResult = mavlink.MAV_RESULT_UNSUPPORTED
+	ResultFailed              CommandResult = mavlink.MAV_RESULT_FAILED
+	ResultInProgress          CommandResult = mavlink.MAV_RESULT_IN_PROGRESS
+)
+
+func (r CommandResult) String() string {
+	switch r {
+	case ResultAccepted:
+		return "ACCEPTED"
+	case ResultTemporarilyRejected:
+		return "TEMPORARILY_REJECTED"
+	case ResultDenied:
+		return "DENIED"
+	case ResultUnsupported:
+		return "UNSUPPORTED"
+	case ResultFailed:
+		return "FAILED"
+	case ResultInProgress:
+		return "IN_PROGRESS"
+	default:
+		return fmt.Sprintf("RESULT(%d)", uint8(r))
+	}
+}
+
+// Sends a MAV_CMD to the vehicle and waits for it to be acknowledged, resending
+// it until ctx is done. An error is only returned if no acknowledgement
+// arrived, a command the vehicle refused is reported through the result.
+func (v *Vehicle) SendCommand(ctx context.Context, command uint16, params ...float32) (CommandResult, error) {
+	ack, err := v.Connection.SendCommand(ctx, command, params...)
+	if err != nil {
+		return 0, err
+	}
+	return CommandResult(ack.Result), nil
+}
+
+// Like SendCommand, but treats anything other than an accepted command as an
+// error
+func (v *Vehicle) command(ctx context.Context, name string, command uint16, params ...float32) error {
+	result, err := v.SendCommand(ctx, command, params...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if result != ResultAccepted {
+		return fmt.Errorf("%s: vehicle responded %v", name, result)
+	}
+	return nil
+}
+
+// Switches the vehicle into a flight mode by name, such as "GUIDED" or
+// "LOITER". Mode names are ArduPilot's for the vehicle's airframe, or PX4's
+// such as "POSCTL" or "OFFBOARD", see modes.go.
+func (v *Vehicle) SetMode(ctx context.Context, mode string) error {
+	v.lock.Lock()
+	firmware, airframe := v.firmware, v.Airframe
+	v.lock.Unlock()
+
+	customMode, err := modeNumber(firmware, airframe, mode)
+	if err != nil {
+		return err
+	}
+	params := []float32{mavlink.MAV_MODE_FLAG_CUSTOM_MODE_ENABLED, float32(customMode)}
+	if firmware == FirmwarePX4 {
+		// PX4 takes its main and sub mode separately rather than the
+		// custom mode they are packed into
+		params = []float32{mavlink.MAV_MODE_FLAG_CUSTOM_MODE_ENABLED,
+			float32(customMode >> 16 & 0xff), float32(customMode >> 24)}
+	}
+	return v.command(ctx, "set mode "+mode, mavlink.MAV_CMD_DO_SET_MODE, params...)
+}
@@ -0,0 +1,186 @@
+package mavcom
+
+import (
+	"context"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How long the result of a command is kept to acknowledge it again if the
+// sender, having missed the acknowledgement, sends it again
+const commandResultLifetime = 3 * time.Second
+
+// ComponentConfig presents the connection as a MAVLink component of its
+// own, such as a companion computer on the vehicle, rather than as a ground
+// station
+type ComponentConfig struct {
+	// 0 to take the vehicle's system ID once its heartbeat arrives
+	SystemID uint8
+	// MAV_COMP_ID, such as 191 for the first onboard computer
+	ComponentID uint8
+	// MAV_TYPE sent in the heartbeat
+	Type uint8
+	// once a second if 0
+	HeartbeatInterval time.Duration
+}
+
+// The first onboard computer on the vehicle's system, sending a heartbeat
+// once a second
+func DefaultComponentConfig() *ComponentConfig {
+	return &ComponentConfig{
+		ComponentID:       mavlink.MAV_COMP_ID_ONBOARD_COMPUTER,
+		Type:              mavlink.MAV_TYPE_ONBOARD_CONTROLLER,
+		HeartbeatInterval: time.Second,
+	}
+}
+
+// Command is a COMMAND_LONG addressed to the component
+type Command struct {
+	// who sent it
+	SystemID    uint8
+	ComponentID uint8
+	Command     uint16
+	Params      [7]float32
+}
+
+// CommandHandler carries out a command addressed to the component and
+// returns the result to acknowledge it with. Handlers run on their own
+// goroutine, ctx is cancelled when the connection closes. Senders resend
+// commands that aren't acknowledged within a second or so, which are not
+// handled again while the first is still running.
+type CommandHandler func(ctx context.Context, cmd Command) CommandResult
+
+// A command being handled or recently handled, by who sent it
+type commandKey struct {
+	systemID    uint8
+	componentID uint8
+	command     uint16
+}
+
+type handledCommand struct {
+	params   [7]float32
+	done     bool
+	result   CommandResult
+	finished time.Time
+}
+
+// Registers the handler for a command addressed to the component, replacing
+// any already registered, or removes it if handler is nil. Commands without
+// a handler are acknowledged as unsupported.
+func (v *Vehicle) HandleCommand(command uint16, handler CommandHandler) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if handler == nil {
+		delete(v.commandHandlers, command)
+		return
+	}
+	v.commandHandlers[command] = handler
+}
+
+// Sends the component's heartbeat until the connection closes, once the
+// vehicle's system ID is known if the component is to take it
+func (v *Vehicle) runComponent(config ComponentConfig) {
+	if config.SystemID == 0 {
+		select {
+		case <-v.connectedChan:
+		case <-v.closedChan:
+			return
+		}
+	}
+	ticker := time.NewTicker(config.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		v.Connection.Send(mavlink.Heartbeat{
+			Type:           config.Type,
+			Autopilot:      mavlink.MAV_AUTOPILOT_INVALID,
+			SystemStatus:   mavlink.MAV_STATE_ACTIVE,
+			MavlinkVersion: 3,
+		})
+		select {
+		case <-v.closedChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Handles a COMMAND_LONG if it is addressed to the component, which a replay
+// never is. Must be called holding the lock.
+func (v *Vehicle) handleCommandLong(msg *mavlink.CommandLongMessage) {
+	if v.Component == nil || v.replay != nil {
+		return
+	}
+	systemID, componentID := v.Connection.Source()
+	if msg.TargetSystem != 0 && msg.TargetSystem != systemID {
+		return
+	}
+	if msg.TargetComponent != 0 && msg.TargetComponent != componentID {
+		return
+	}
+	handler := v.commandHandlers[msg.Command]
+	// commands addressed to every component are only answered by those that
+	// carry them out
+	if handler == nil && msg.TargetComponent == 0 {
+		return
+	}
+
+	now := time.Now()
+	for key, handled := range v.handledCommands {
+		if handled.done && now.Sub(handled.finished) > commandResultLifetime {
+			delete(v.handledCommands, key)
+		}
+	}
+	key := commandKey{msg.SystemID, msg.ComponentID, msg.Command}
+	params := [7]float32{msg.Param1, msg.Param2, msg.Param3, msg.Param4, msg.Param5, msg.Param6, msg.Param7}
+	if handled, ok := v.handledCommands[key]; ok && handled.params == params {
+		switch {
+		case !handled.done:
+			// still being carried out
+			return
+		case msg.Confirmation > 0:
+			// the acknowledgement was lost, so send it again rather than
+			// carrying the command out twice
+			go v.acknowledgeCommand(msg.SystemID, msg.ComponentID, msg.Command, handled.result)
+			return
+		}
+	}
+
+	if handler == nil {
+		go v.acknowledgeCommand(msg.SystemID, msg.ComponentID, msg.Command, ResultUnsupported)
+		return
+	}
+	handled := &handledCommand{params: params}
+	v.handledCommands[key] = handled
+	cmd := Command{SystemID: msg.SystemID, ComponentID: msg.ComponentID, Command: msg.Command, Params: params}
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-v.closedChan:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		result := handler(ctx, cmd)
+
+		v.lock.Lock()
+		handled.done = true
+		handled.result = result
+		handled.finished = time.Now()
+		v.lock.Unlock()
+		v.acknowledgeCommand(cmd.SystemID, cmd.ComponentID, cmd.Command, result)
+	}()
+}
+
+// Acknowledges a command to whoever sent it, so that other ground stations
+// waiting on the same command don't take it as theirs
+func (v *Vehicle) acknowledgeCommand(systemID uint8, componentID uint8, command uint16, result CommandResult) error {
+	return v.Connection.Send(mavlink.CommandAck{
+		Command:         command,
+		Result:          uint8(result),
+		TargetSystem:    systemID,
+		TargetComponent: componentID,
+	})
+}
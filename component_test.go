@@ -0,0 +1,76 @@
+package mavcom
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// A command in the range MAVLink leaves for users
+const testCommand = 31000
+
+func TestComponentAcknowledgesSender(t *testing.T) {
+	a, _ := newFakeAutopilotWith(t, func(v *Vehicle) {
+		v.Component = DefaultComponentConfig()
+		v.HandleCommand(testCommand, func(ctx context.Context, cmd Command) CommandResult {
+			return ResultAccepted
+		})
+	})
+
+	for _, sender := range []uint8{1, 5} {
+		a.send(sender, mavlink.CommandLong{
+			Command:         testCommand,
+			TargetSystem:    1,
+			TargetComponent: mavlink.MAV_COMP_ID_ONBOARD_COMPUTER,
+		})
+		frame := a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_ACK)
+		if frame[0] != mavlink.FRAME_START_V2 {
+			t.Error("acknowledgement sent as MAVLink 1, without who it is for")
+		}
+		ack := decodeFrame(t, frame).(*mavlink.CommandAckMessage)
+		if ack.Command != testCommand || ack.Result != mavlink.MAV_RESULT_ACCEPTED {
+			t.Errorf("acknowledged command %d with %v", ack.Command, CommandResult(ack.Result))
+		}
+		if ack.TargetSystem != 1 || ack.TargetComponent != sender {
+			t.Errorf("acknowledgement for %d/%d, want 1/%d", ack.TargetSystem, ack.TargetComponent, sender)
+		}
+	}
+}
+
+func TestCommandIgnoresOthersAcknowledgements(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	done := make(chan CommandResult, 1)
+	go func() {
+		result, err := v.SendCommand(testContext(t), testCommand)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}()
+
+	for {
+		cmd := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_LONG)).(*mavlink.CommandLongMessage)
+		if cmd.Command == testCommand {
+			break
+		}
+	}
+	// answering another ground station's copy of the command first
+	a.send(1, mavlink.CommandAck{Command: testCommand, Result: mavlink.MAV_RESULT_DENIED, TargetSystem: 200, TargetComponent: 190})
+	a.send(1, mavlink.CommandAck{Command: testCommand, Result: mavlink.MAV_RESULT_ACCEPTED, TargetSystem: 255, TargetComponent: 190})
+	if result := <-done; result != ResultAccepted {
+		t.Errorf("command %v, want %v", result, ResultAccepted)
+	}
+}
+
+func TestComponentHeartbeatWithoutInterval(t *testing.T) {
+	a, _ := newFakeAutopilotWith(t, func(v *Vehicle) {
+		v.Component = &ComponentConfig{ComponentID: mavlink.MAV_COMP_ID_ONBOARD_COMPUTER}
+	})
+	for {
+		frame := a.nextFrame(mavlink.MAVLINK_MSG_ID_HEARTBEAT)
+		if system, component := mavlink.FrameSource(frame); system == 1 && component == mavlink.MAV_COMP_ID_ONBOARD_COMPUTER {
+			return
+		}
+	}
+}
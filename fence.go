@@ -0,0 +1,369 @@
+package mavcom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// FencePolygon is an area the vehicle must stay inside, or outside of if it
+// is an exclusion zone
+type FencePolygon struct {
+	Exclusion bool
+	Vertices  []Coordinate
+}
+
+// FenceCircle is a circular area the vehicle must stay inside, or outside of
+// if it is an exclusion zone. The radius is in meters.
+type FenceCircle struct {
+	Exclusion bool
+	Center    Coordinate
+	Radius    float64
+}
+
+// Fence is a geofence made of inclusion and exclusion zones. The vehicle has
+// to be inside every inclusion zone and outside every exclusion zone. Fixed
+// wing vehicles fly to the return point, if there is one, when they breach
+// the fence.
+type Fence struct {
+	Polygons    []FencePolygon
+	Circles     []FenceCircle
+	ReturnPoint *Coordinate
+}
+
+// FenceStatus is where a position is relative to a fence
+type FenceStatus struct {
+	// Whether the position is outside an inclusion zone or inside an
+	// exclusion zone
+	Breached bool
+	// Distance in meters to the nearest edge of any zone, which is how far
+	// the vehicle is from breaching the fence, or from being back inside it.
+	// Infinite for a fence with no zones.
+	DistanceToBoundary float64
+}
+
+func (f *Fence) validate() error {
+	for i, polygon := range f.Polygons {
+		if len(polygon.Vertices) < 3 {
+			return fmt.Errorf("fence polygon %d has %d vertices, need at least 3", i, len(polygon.Vertices))
+		}
+	}
+	for i, circle := range f.Circles {
+		if circle.Radius <= 0 {
+			return fmt.Errorf("fence circle %d has invalid radius %v m", i, circle.Radius)
+		}
+	}
+	return nil
+}
+
+// Checks a position against the fence
+func (f *Fence) Check(c Coordinate) FenceStatus {
+	status := FenceStatus{DistanceToBoundary: math.Inf(1)}
+	for _, polygon := range f.Polygons {
+		vertices := make([][2]float64, len(polygon.Vertices))
+		for i, vertex := range polygon.Vertices {
+			north, east := offsetFrom(c, vertex)
+			vertices[i] = [2]float64{north, east}
+		}
+		if insidePolygon(0, 0, vertices) == polygon.Exclusion {
+			status.Breached = true
+		}
+		for i := range vertices {
+			distance := distanceToSegment(0, 0, vertices[i], vertices[(i+1)%len(vertices)])
+			status.DistanceToBoundary = math.Min(status.DistanceToBoundary, distance)
+		}
+	}
+	for _, circle := range f.Circles {
+		distance := Distance(c, circle.Center)
+		if (distance <= circle.Radius) == circle.Exclusion {
+			status.Breached = true
+		}
+		status.DistanceToBoundary = math.Min(status.DistanceToBoundary, math.Abs(distance-circle.Radius))
+	}
+	return status
+}
+
+// Checks the vehicle's current position against a fence. Warn when
+// DistanceToBoundary drops below a margin to catch a breach before the
+// autopilot does.
+func (v *Vehicle) CheckFence(f *Fence) FenceStatus {
+	v.lock.Lock()
+	position := v.Position.Coordinate()
+	v.lock.Unlock()
+	return f.Check(position)
+}
+
+// Fence zones are sent as mission items, with each polygon vertex an item
+// that carries the number of vertices in its polygon
+func (f *Fence) missionItems() []MissionItem {
+	var items []MissionItem
+	for _, polygon := range f.Polygons {
+		command := uint16(mavlink.MAV_CMD_NAV_FENCE_POLYGON_VERTEX_INCLUSION)
+		if polygon.Exclusion {
+			command = mavlink.MAV_CMD_NAV_FENCE_POLYGON_VERTEX_EXCLUSION
+		}
+		for _, vertex := range polygon.Vertices {
+			items = append(items, MissionItem{
+				Frame:   FrameGlobal,
+				Command: command,
+				Param1:  float32(len(polygon.Vertices)),
+				X:       vertex.Latitude,
+				Y:       vertex.Longitude,
+			})
+		}
+	}
+	for _, circle := range f.Circles {
+		command := uint16(mavlink.MAV_CMD_NAV_FENCE_CIRCLE_INCLUSION)
+		if circle.Exclusion {
+			command = mavlink.MAV_CMD_NAV_FENCE_CIRCLE_EXCLUSION
+		}
+		items = append(items, MissionItem{
+			Frame:   FrameGlobal,
+			Command: command,
+			Param1:  float32(circle.Radius),
+			X:       circle.Center.Latitude,
+			Y:       circle.Center.Longitude,
+		})
+	}
+	if f.ReturnPoint != nil {
+		items = append(items, MissionItem{
+			Frame:   FrameGlobalRelativeAlt,
+			Command: mavlink.MAV_CMD_NAV_FENCE_RETURN_POINT,
+			X:       f.ReturnPoint.Latitude,
+			Y:       f.ReturnPoint.Longitude,
+		})
+	}
+	return items
+}
+
+func fenceFromMissionItems(items []MissionItem) (*Fence, error) {
+	fence := &Fence{}
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		center := Coordinate{Latitude: item.X, Longitude: item.Y}
+		switch item.Command {
+		case mavlink.MAV_CMD_NAV_FENCE_POLYGON_VERTEX_INCLUSION, mavlink.MAV_CMD_NAV_FENCE_POLYGON_VERTEX_EXCLUSION:
+			count := int(item.Param1)
+			if count < 3 || i+count > len(items) {
+				return nil, fmt.Errorf("fence item %d: invalid polygon vertex count %d", i, count)
+			}
+			polygon := FencePolygon{Exclusion: item.Command == mavlink.MAV_CMD_NAV_FENCE_POLYGON_VERTEX_EXCLUSION}
+			for _, vertex := range items[i : i+count] {
+				if vertex.Command != item.Command {
+					return nil, fmt.Errorf("fence item %d: polygon ends after %d of %d vertices", i, len(polygon.Vertices), count)
+				}
+				polygon.Vertices = append(polygon.Vertices, Coordinate{Latitude: vertex.X, Longitude: vertex.Y})
+			}
+			fence.Polygons = append(fence.Polygons, polygon)
+			i += count - 1
+		case mavlink.MAV_CMD_NAV_FENCE_CIRCLE_INCLUSION, mavlink.MAV_CMD_NAV_FENCE_CIRCLE_EXCLUSION:
+			fence.Circles = append(fence.Circles, FenceCircle{
+				Exclusion: item.Command == mavlink.MAV_CMD_NAV_FENCE_CIRCLE_EXCLUSION,
+				Center:    center,
+				Radius:    float64(item.Param1),
+			})
+		case mavlink.MAV_CMD_NAV_FENCE_RETURN_POINT:
+			fence.ReturnPoint = &center
+		default:
+			return nil, fmt.Errorf("fence item %d: unexpected command %d", i, item.Command)
+		}
+	}
+	return fence, nil
+}
+
+// Replaces the geofence on the vehicle. Whether the fence is enforced is up
+// to the vehicle's FENCE_ENABLE parameter.
+func (v *Vehicle) UploadFence(ctx context.Context, f *Fence) error {
+	if err := f.validate(); err != nil {
+		return fmt.Errorf("fence upload: %w", err)
+	}
+	return v.uploadMissionItems(ctx, mavlink.MAV_MISSION_TYPE_FENCE, f.missionItems())
+}
+
+// Reads the geofence stored on the vehicle
+func (v *Vehicle) DownloadFence(ctx context.Context) (*Fence, error) {
+	items, err := v.downloadMissionItems(ctx, mavlink.MAV_MISSION_TYPE_FENCE)
+	if err != nil {
+		return nil, err
+	}
+	fence, err := fenceFromMissionItems(items)
+	if err != nil {
+		return nil, fmt.Errorf("fence download: %w", err)
+	}
+	return fence, nil
+}
+
+// The parts of a GeoJSON object a fence is read from. Objects nest, so the
+// same struct holds feature collections, features and geometries.
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Features    []geoJSON       `json:"features,omitempty"`
+	Geometry    *geoJSON        `json:"geometry,omitempty"`
+	Geometries  []geoJSON       `json:"geometries,omitempty"`
+	Properties  map[string]any  `json:"properties,omitempty"`
+	Coordinates json.RawMessage `json:"coordinates,omitempty"`
+}
+
+// Reads a fence from GeoJSON. Polygons are inclusion zones and their holes
+// are exclusion zones. A feature's "fence" property can be "exclusion" to
+// make a whole polygon an exclusion zone. Points need a "radius" property in
+// meters to be a circular zone, or a "fence" property of "return" to be the
+// return point.
+func ReadGeoJSONFence(r io.Reader) (*Fence, error) {
+	var object geoJSON
+	if err := json.NewDecoder(r).Decode(&object); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	fence := &Fence{}
+	if err := fence.addGeoJSON(object, nil); err != nil {
+		return nil, err
+	}
+	if err := fence.validate(); err != nil {
+		return nil, err
+	}
+	return fence, nil
+}
+
+func (f *Fence) addGeoJSON(object geoJSON, properties map[string]any) error {
+	kind, _ := properties["fence"].(string)
+	switch object.Type {
+	case "FeatureCollection":
+		for _, feature := range object.Features {
+			if err := f.addGeoJSON(feature, nil); err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if object.Geometry == nil {
+			return nil
+		}
+		return f.addGeoJSON(*object.Geometry, object.Properties)
+	case "GeometryCollection":
+		for _, geometry := range object.Geometries {
+			if err := f.addGeoJSON(geometry, properties); err != nil {
+				return err
+			}
+		}
+	case "Polygon":
+		var rings [][][]float64
+		if err := json.Unmarshal(object.Coordinates, &rings); err != nil {
+			return fmt.Errorf("invalid polygon: %w", err)
+		}
+		return f.addGeoJSONPolygon(rings, kind)
+	case "MultiPolygon":
+		var polygons [][][][]float64
+		if err := json.Unmarshal(object.Coordinates, &polygons); err != nil {
+			return fmt.Errorf("invalid multipolygon: %w", err)
+		}
+		for _, rings := range polygons {
+			if err := f.addGeoJSONPolygon(rings, kind); err != nil {
+				return err
+			}
+		}
+	case "Point":
+		var position []float64
+		if err := json.Unmarshal(object.Coordinates, &position); err != nil {
+			return fmt.Errorf("invalid point: %w", err)
+		}
+		point, err := geoJSONCoordinate(position)
+		if err != nil {
+			return err
+		}
+		if kind == "return" {
+			f.ReturnPoint = &point
+			return nil
+		}
+		radius, ok := properties["radius"].(float64)
+		if !ok {
+			return fmt.Errorf("point at %v, %v has no radius", point.Latitude, point.Longitude)
+		}
+		f.Circles = append(f.Circles, FenceCircle{Exclusion: kind == "exclusion", Center: point, Radius: radius})
+	default:
+		return fmt.Errorf("unsupported GeoJSON type %q", object.Type)
+	}
+	return nil
+}
+
+func (f *Fence) addGeoJSONPolygon(rings [][][]float64, kind string) error {
+	if len(rings) > 1 && kind == "exclusion" {
+		return fmt.Errorf("exclusion polygons can't have holes")
+	}
+	for i, ring := range rings {
+		polygon := FencePolygon{Exclusion: kind == "exclusion" || i > 0}
+		for _, position := range ring {
+			vertex, err := geoJSONCoordinate(position)
+			if err != nil {
+				return err
+			}
+			polygon.Vertices = append(polygon.Vertices, vertex)
+		}
+		// GeoJSON rings repeat the first vertex at the end
+		if n := len(polygon.Vertices); n > 1 && polygon.Vertices[0] == polygon.Vertices[n-1] {
+			polygon.Vertices = polygon.Vertices[:n-1]
+		}
+		f.Polygons = append(f.Polygons, polygon)
+	}
+	return nil
+}
+
+// GeoJSON positions are longitude first
+func geoJSONCoordinate(position []float64) (Coordinate, error) {
+	if len(position) < 2 {
+		return Coordinate{}, fmt.Errorf("invalid position %v", position)
+	}
+	return Coordinate{Latitude: position[1], Longitude: position[0]}, nil
+}
+
+// Writes a fence as a GeoJSON feature collection that ReadGeoJSONFence can
+// read back
+func WriteGeoJSONFence(w io.Writer, f *Fence) error {
+	collection := geoJSON{Type: "FeatureCollection", Features: []geoJSON{}}
+	feature := func(geometryType string, coordinates any, properties map[string]any) error {
+		raw, err := json.Marshal(coordinates)
+		if err != nil {
+			return err
+		}
+		collection.Features = append(collection.Features, geoJSON{
+			Type:       "Feature",
+			Geometry:   &geoJSON{Type: geometryType, Coordinates: raw},
+			Properties: properties,
+		})
+		return nil
+	}
+	kind := map[bool]string{false: "inclusion", true: "exclusion"}
+
+	for _, polygon := range f.Polygons {
+		ring := make([][]float64, 0, len(polygon.Vertices)+1)
+		for _, vertex := range polygon.Vertices {
+			ring = append(ring, []float64{vertex.Longitude, vertex.Latitude})
+		}
+		if len(ring) > 0 {
+			ring = append(ring, ring[0])
+		}
+		if err := feature("Polygon", [][][]float64{ring}, map[string]any{"fence": kind[polygon.Exclusion]}); err != nil {
+			return err
+		}
+	}
+	for _, circle := range f.Circles {
+		err := feature("Point", []float64{circle.Center.Longitude, circle.Center.Latitude},
+			map[string]any{"fence": kind[circle.Exclusion], "radius": circle.Radius})
+		if err != nil {
+			return err
+		}
+	}
+	if f.ReturnPoint != nil {
+		err := feature("Point", []float64{f.ReturnPoint.Longitude, f.ReturnPoint.Latitude},
+			map[string]any{"fence": "return"})
+		if err != nil {
+			return err
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(collection)
+}
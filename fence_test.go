@@ -0,0 +1,99 @@
+package mavcom
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+func testFence() *Fence {
+	return &Fence{
+		Polygons: []FencePolygon{
+			{Vertices: []Coordinate{
+				{Latitude: -35.3600, Longitude: 149.1620},
+				{Latitude: -35.3600, Longitude: 149.1690},
+				{Latitude: -35.3660, Longitude: 149.1690},
+				{Latitude: -35.3660, Longitude: 149.1620},
+			}},
+		},
+		Circles: []FenceCircle{
+			{Exclusion: true, Center: Coordinate{Latitude: -35.3625, Longitude: 149.1670}, Radius: 50},
+		},
+		ReturnPoint: &Coordinate{Latitude: -35.3632621, Longitude: 149.1652374},
+	}
+}
+
+// Coordinates go over the link as integers, so compare to the nearest 1e-7
+// degree
+func roundFence(f *Fence) {
+	round := func(c *Coordinate) {
+		c.Latitude = math.Round(c.Latitude*1e7) / 1e7
+		c.Longitude = math.Round(c.Longitude*1e7) / 1e7
+	}
+	for _, polygon := range f.Polygons {
+		for i := range polygon.Vertices {
+			round(&polygon.Vertices[i])
+		}
+	}
+	for i := range f.Circles {
+		round(&f.Circles[i].Center)
+	}
+	if f.ReturnPoint != nil {
+		round(f.ReturnPoint)
+	}
+}
+
+func TestFenceRoundTrip(t *testing.T) {
+	_, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+
+	fence := testFence()
+	if err := v.UploadFence(ctx, fence); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := v.DownloadFence(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundFence(downloaded)
+	if !reflect.DeepEqual(downloaded, fence) {
+		t.Errorf("downloaded %+v, want %+v", downloaded, fence)
+	}
+}
+
+func TestFenceCheck(t *testing.T) {
+	fence := testFence()
+	tests := []struct {
+		name     string
+		position Coordinate
+		breached bool
+	}{
+		{"inside", Coordinate{Latitude: -35.3632621, Longitude: 149.1652374}, false},
+		{"outside the polygon", Coordinate{Latitude: -35.3700, Longitude: 149.1652}, true},
+		{"inside the exclusion circle", Coordinate{Latitude: -35.3625, Longitude: 149.1670}, true},
+	}
+	for _, test := range tests {
+		if status := fence.Check(test.position); status.Breached != test.breached {
+			t.Errorf("%s: breached %v, want %v", test.name, status.Breached, test.breached)
+		}
+	}
+}
+
+func TestGeoJSONFence(t *testing.T) {
+	fence := testFence()
+	var buf bytes.Buffer
+	if err := WriteGeoJSONFence(&buf, fence); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadGeoJSONFence(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, fence) {
+		t.Errorf("read %+v, want %+v", read, fence)
+	}
+}
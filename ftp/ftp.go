@@ -0,0 +1,530 @@
+// Package ftp is a client for MAVLink FTP, which ArduPilot and PX4 use to
+// expose the files on their storage, such as logs, scripts, parameter files
+// and terrain data.
+package ftp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/communicator"
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How long to wait for a reply before repeating a request, and how many
+// times to repeat it before giving up
+const (
+	defaultRetryInterval = time.Second
+	defaultRetries       = 5
+)
+
+var (
+	ErrFileNotFound   = errors.New("file not found")
+	ErrFileExists     = errors.New("file exists")
+	ErrFileProtected  = errors.New("file protected")
+	ErrNoSessions     = errors.New("no sessions available")
+	ErrNotResponding  = errors.New("vehicle stopped responding")
+	ErrUnsupported    = errors.New("not supported by the vehicle")
+	errUnexpectedSize = errors.New("unexpected reply size")
+	errPastEnd        = errors.New("vehicle sent data past the end of the file")
+)
+
+// Error is a request the vehicle refused with a NAK
+type Error struct {
+	Op    string
+	Path  string
+	Code  uint8 // one of the MAVLink FTP error codes
+	Errno uint8 // set when Code is FailErrno
+}
+
+func (e *Error) Error() string {
+	var reason string
+	switch e.Code {
+	case mavlink.FTP_ERR_FAIL:
+		reason = "failed"
+	case mavlink.FTP_ERR_FAIL_ERRNO:
+		reason = fmt.Sprintf("failed with errno %d", e.Errno)
+	case mavlink.FTP_ERR_INVALID_DATA_SIZE:
+		reason = "invalid data size"
+	case mavlink.FTP_ERR_INVALID_SESSION:
+		reason = "invalid session"
+	case mavlink.FTP_ERR_EOF:
+		reason = "end of file"
+	case mavlink.FTP_ERR_UNKNOWN_COMMAND:
+		reason = "unknown command"
+	default:
+		if err := e.Unwrap(); err != nil {
+			reason = err.Error()
+		} else {
+			reason = fmt.Sprintf("error %d", e.Code)
+		}
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("ftp %s: %s", e.Op, reason)
+	}
+	return fmt.Sprintf("ftp %s %s: %s", e.Op, e.Path, reason)
+}
+
+// Lets errors.Is match the vehicle's error codes against ErrFileNotFound and
+// friends
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case mavlink.FTP_ERR_FILE_NOT_FOUND:
+		return ErrFileNotFound
+	case mavlink.FTP_ERR_FILE_EXISTS:
+		return ErrFileExists
+	case mavlink.FTP_ERR_FILE_PROTECTED:
+		return ErrFileProtected
+	case mavlink.FTP_ERR_NO_SESSIONS_AVAILABLE:
+		return ErrNoSessions
+	default:
+		return nil
+	}
+}
+
+// Entry is a file or directory in a directory listing. Size is in bytes and
+// only set for files.
+type Entry struct {
+	Name string
+	Dir  bool
+	Size uint32
+}
+
+// Client talks MAVLink FTP to the target of a connection. Operations are run
+// one at a time.
+type Client struct {
+	conn *communicator.MavlinkCommunicator
+	// How long to wait for a reply before repeating a request, and how many
+	// times to repeat it. Default to 1 second and 5.
+	RetryInterval time.Duration
+	Retries       int
+	// Reports whether the vehicle supports MAVLink FTP, checked before every
+	// operation, which fails with ErrUnsupported if not. Nil assumes it does.
+	Supported func() bool
+	lock      sync.Mutex
+	seq       uint16
+}
+
+func NewClient(conn *communicator.MavlinkCommunicator) *Client {
+	return &Client{conn: conn, RetryInterval: defaultRetryInterval, Retries: defaultRetries}
+}
+
+// An operation in progress, holding the subscription its replies arrive on
+type operation struct {
+	c       *Client
+	name    string
+	path    string
+	replies <-chan mavlink.DecodedMessage
+}
+
+// Starts an operation, which must be finished with end unless it fails
+func (c *Client) begin(name string, path string) (*operation, func(), error) {
+	op := &operation{c: c, name: name, path: path}
+	if c.Supported != nil && !c.Supported() {
+		return nil, nil, op.wrap(ErrUnsupported)
+	}
+	c.lock.Lock()
+	replies, unsubscribe := c.conn.Subscribe(mavlink.MAVLINK_MSG_ID_FILE_TRANSFER_PROTOCOL)
+	op.replies = replies
+	end := func() {
+		unsubscribe()
+		c.lock.Unlock()
+	}
+	return op, end, nil
+}
+
+func (op *operation) send(req mavlink.FTPPacket) error {
+	targetSystem, targetComponent := op.c.conn.Target()
+	return op.c.conn.Send(mavlink.FileTransferProtocol{
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		Payload:         req.Encode(),
+	})
+}
+
+// Unpacks a reply meant for us from the vehicle
+func (op *operation) reply(msg mavlink.DecodedMessage) (mavlink.FTPPacket, bool) {
+	ftpMsg, ok := msg.(*mavlink.FileTransferProtocolMessage)
+	if !ok {
+		return mavlink.FTPPacket{}, false
+	}
+	targetSystem, _ := op.c.conn.Target()
+	sourceSystem, _ := op.c.conn.Source()
+	if (targetSystem != 0 && ftpMsg.SystemID != targetSystem) ||
+		(ftpMsg.TargetSystem != 0 && ftpMsg.TargetSystem != sourceSystem) {
+		return mavlink.FTPPacket{}, false
+	}
+	packet, err := mavlink.DecodeFTPPacket(ftpMsg.Payload)
+	return packet, err == nil
+}
+
+// Prefixes an error with the operation and its path
+func (op *operation) wrap(err error) error {
+	if op.path == "" {
+		return fmt.Errorf("ftp %s: %w", op.name, err)
+	}
+	return fmt.Errorf("ftp %s %s: %w", op.name, op.path, err)
+}
+
+func (op *operation) nak(reply mavlink.FTPPacket) *Error {
+	err := &Error{Op: op.name, Path: op.path, Code: mavlink.FTP_ERR_FAIL}
+	if len(reply.Data) > 0 {
+		err.Code = reply.Data[0]
+	}
+	if len(reply.Data) > 1 {
+		err.Errno = reply.Data[1]
+	}
+	return err
+}
+
+// Sends a request and waits for the reply to it, which carries the next
+// sequence number. The request is repeated with the same sequence number if
+// no reply arrives, which the vehicle answers by repeating its last reply
+// if it was the reply that went missing. A NAK is returned as an *Error.
+func (op *operation) transact(ctx context.Context, req mavlink.FTPPacket) (mavlink.FTPPacket, error) {
+	op.c.seq++
+	req.Seq = op.c.seq
+	if err := op.send(req); err != nil {
+		return mavlink.FTPPacket{}, err
+	}
+	retry := time.NewTicker(op.c.RetryInterval)
+	defer retry.Stop()
+	retries := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return mavlink.FTPPacket{}, op.wrap(ctx.Err())
+		case <-retry.C:
+			retries++
+			if retries > op.c.Retries {
+				return mavlink.FTPPacket{}, op.wrap(ErrNotResponding)
+			}
+			if err := op.send(req); err != nil {
+				return mavlink.FTPPacket{}, err
+			}
+		case msg, ok := <-op.replies:
+			if !ok {
+				return mavlink.FTPPacket{}, communicator.ErrConnectionClosed
+			}
+			reply, ok := op.reply(msg)
+			if !ok || reply.Seq != req.Seq+1 || reply.ReqOpcode != req.Opcode {
+				continue
+			}
+			op.c.seq = reply.Seq
+			if reply.Opcode == mavlink.FTP_OPCODE_NAK {
+				return reply, op.nak(reply)
+			}
+			return reply, nil
+		}
+	}
+}
+
+// Closes every session the vehicle has open, including any left behind by
+// an earlier client that went away mid-transfer
+func (c *Client) ResetSessions(ctx context.Context) error {
+	op, end, err := c.begin("reset sessions", "")
+	if err != nil {
+		return err
+	}
+	defer end()
+	_, err = op.transact(ctx, mavlink.FTPPacket{Opcode: mavlink.FTP_OPCODE_RESET_SESSIONS})
+	return err
+}
+
+// Lists a directory
+func (c *Client) List(ctx context.Context, path string) ([]Entry, error) {
+	op, end, err := c.begin("list", path)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
+	var entries []Entry
+	// the offset counts entries rather than bytes, and the listing is
+	// finished when the vehicle reports the end of file
+	offset := uint32(0)
+	for {
+		reply, err := op.transact(ctx, mavlink.FTPPacket{
+			Opcode: mavlink.FTP_OPCODE_LIST_DIRECTORY,
+			Offset: offset,
+			Data:   []byte(path),
+		})
+		var ftpErr *Error
+		if errors.As(err, &ftpErr) && ftpErr.Code == mavlink.FTP_ERR_EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		listed := 0
+		for _, raw := range strings.Split(string(reply.Data), "\x00") {
+			if raw == "" {
+				continue
+			}
+			listed++
+			switch raw[0] {
+			case 'F':
+				name, size, _ := strings.Cut(raw[1:], "\t")
+				n, _ := strconv.ParseUint(size, 10, 32)
+				entries = append(entries, Entry{Name: name, Size: uint32(n)})
+			case 'D':
+				if raw[1:] == "." || raw[1:] == ".." {
+					continue
+				}
+				entries = append(entries, Entry{Name: raw[1:], Dir: true})
+			default:
+				// 'S' marks an entry the vehicle skipped
+			}
+		}
+		if listed == 0 {
+			return entries, nil
+		}
+		offset += uint32(listed)
+	}
+}
+
+// Reads a whole file. The file is streamed with burst reads, and any chunks
+// lost on the way are read again individually.
+func (c *Client) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	op, end, err := c.begin("read", path)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
+	reply, err := op.transact(ctx, mavlink.FTPPacket{Opcode: mavlink.FTP_OPCODE_OPEN_FILE_RO, Data: []byte(path)})
+	if err != nil {
+		return nil, err
+	}
+	session := reply.Session
+	defer op.terminate(session)
+	if len(reply.Data) < 4 {
+		return nil, op.wrap(errUnexpectedSize)
+	}
+	size := binary.LittleEndian.Uint32(reply.Data)
+
+	data := make([]byte, size)
+	gaps, err := op.burstRead(ctx, session, data)
+	if err != nil {
+		return nil, err
+	}
+	for _, gap := range gaps {
+		if err := op.read(ctx, session, data, gap[0], gap[1]); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Streams the file into data, restarting the burst from the first byte not
+// yet received whenever one ends early or stalls. Returns the ranges that
+// were skipped over because chunks went missing.
+func (op *operation) burstRead(ctx context.Context, session uint8, data []byte) ([][2]uint32, error) {
+	var gaps [][2]uint32
+	next := uint32(0)
+	size := uint32(len(data))
+	retries := 0
+
+	for next < size {
+		op.c.seq++
+		req := mavlink.FTPPacket{
+			Seq:     op.c.seq,
+			Session: session,
+			Opcode:  mavlink.FTP_OPCODE_BURST_READ_FILE,
+			Size:    mavlink.FTP_MAX_DATA_LEN,
+			Offset:  next,
+		}
+		if err := op.send(req); err != nil {
+			return nil, err
+		}
+		err := op.receiveBurst(ctx, req, data, &next, &gaps)
+		if errors.Is(err, ErrNotResponding) {
+			retries++
+			if retries > op.c.Retries {
+				return nil, op.wrap(err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		retries = 0
+	}
+	return gaps, nil
+}
+
+// Collects the replies to one burst read until the vehicle marks the burst
+// complete, reaches the end of the file or goes quiet
+func (op *operation) receiveBurst(ctx context.Context, req mavlink.FTPPacket, data []byte, next *uint32, gaps *[][2]uint32) error {
+	quiet := time.NewTimer(op.c.RetryInterval)
+	defer quiet.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return op.wrap(ctx.Err())
+		case <-quiet.C:
+			return ErrNotResponding
+		case msg, ok := <-op.replies:
+			if !ok {
+				return communicator.ErrConnectionClosed
+			}
+			reply, ok := op.reply(msg)
+			// replies to this burst carry sequence numbers counting up
+			// from the request's
+			if !ok || reply.ReqOpcode != req.Opcode || reply.Session != req.Session || int16(reply.Seq-req.Seq) <= 0 {
+				continue
+			}
+			op.c.seq = reply.Seq
+			if reply.Opcode == mavlink.FTP_OPCODE_NAK {
+				nak := op.nak(reply)
+				if nak.Code == mavlink.FTP_ERR_EOF {
+					*next = uint32(len(data))
+					return nil
+				}
+				return nak
+			}
+
+			offset := reply.Offset
+			if offset+uint32(len(reply.Data)) > uint32(len(data)) {
+				return op.wrap(errPastEnd)
+			}
+			if offset > *next {
+				*gaps = append(*gaps, [2]uint32{*next, offset})
+			}
+			if offset >= *next {
+				copy(data[offset:], reply.Data)
+				*next = offset + uint32(len(reply.Data))
+			}
+			if reply.BurstComplete || *next >= uint32(len(data)) {
+				return nil
+			}
+			quiet.Reset(op.c.RetryInterval)
+		}
+	}
+}
+
+// Reads the bytes from start up to end into data one request at a time
+func (op *operation) read(ctx context.Context, session uint8, data []byte, start uint32, end uint32) error {
+	for start < end {
+		reply, err := op.transact(ctx, mavlink.FTPPacket{
+			Session: session,
+			Opcode:  mavlink.FTP_OPCODE_READ_FILE,
+			Size:    uint8(min(end-start, mavlink.FTP_MAX_DATA_LEN)),
+			Offset:  start,
+		})
+		if err != nil {
+			return err
+		}
+		if len(reply.Data) == 0 || reply.Offset != start {
+			return op.wrap(errUnexpectedSize)
+		}
+		start += uint32(copy(data[start:end], reply.Data))
+	}
+	return nil
+}
+
+// Closes a session, ignoring failures as the vehicle times out abandoned
+// sessions by itself and ResetSessions clears them all
+func (op *operation) terminate(session uint8) {
+	ctx, cancel := context.WithTimeout(context.Background(), op.c.RetryInterval*time.Duration(op.c.Retries+1))
+	defer cancel()
+	op.transact(ctx, mavlink.FTPPacket{Session: session, Opcode: mavlink.FTP_OPCODE_TERMINATE_SESSION})
+}
+
+// Creates a file, or replaces it if it exists, and writes data to it
+func (c *Client) WriteFile(ctx context.Context, path string, data []byte) error {
+	op, end, err := c.begin("write", path)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	reply, err := op.transact(ctx, mavlink.FTPPacket{Opcode: mavlink.FTP_OPCODE_CREATE_FILE, Data: []byte(path)})
+	if err != nil {
+		return err
+	}
+	session := reply.Session
+	defer op.terminate(session)
+
+	for offset := 0; offset < len(data); offset += mavlink.FTP_MAX_DATA_LEN {
+		chunk := data[offset:min(offset+mavlink.FTP_MAX_DATA_LEN, len(data))]
+		_, err := op.transact(ctx, mavlink.FTPPacket{
+			Session: session,
+			Opcode:  mavlink.FTP_OPCODE_WRITE_FILE,
+			Offset:  uint32(offset),
+			Data:    chunk,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs a request that takes a path and only needs acknowledging
+func (c *Client) simple(ctx context.Context, name string, opcode uint8, path string, data []byte) (mavlink.FTPPacket, error) {
+	op, end, err := c.begin(name, path)
+	if err != nil {
+		return mavlink.FTPPacket{}, err
+	}
+	defer end()
+	return op.transact(ctx, mavlink.FTPPacket{Opcode: opcode, Data: data})
+}
+
+// Deletes a file
+func (c *Client) Remove(ctx context.Context, path string) error {
+	_, err := c.simple(ctx, "remove", mavlink.FTP_OPCODE_REMOVE_FILE, path, []byte(path))
+	return err
+}
+
+// Creates a directory
+func (c *Client) Mkdir(ctx context.Context, path string) error {
+	_, err := c.simple(ctx, "mkdir", mavlink.FTP_OPCODE_CREATE_DIRECTORY, path, []byte(path))
+	return err
+}
+
+// Deletes an empty directory
+func (c *Client) RemoveDir(ctx context.Context, path string) error {
+	_, err := c.simple(ctx, "rmdir", mavlink.FTP_OPCODE_REMOVE_DIRECTORY, path, []byte(path))
+	return err
+}
+
+// Renames or moves a file or directory
+func (c *Client) Rename(ctx context.Context, from string, to string) error {
+	_, err := c.simple(ctx, "rename", mavlink.FTP_OPCODE_RENAME, from, []byte(from+"\x00"+to))
+	return err
+}
+
+// Asks the vehicle for the checksum of a file, as calculated by CRC32, to
+// check a transfer or whether a file has changed without reading it
+func (c *Client) CRC32(ctx context.Context, path string) (uint32, error) {
+	reply, err := c.simple(ctx, "crc32", mavlink.FTP_OPCODE_CALC_FILE_CRC32, path, []byte(path))
+	if err != nil {
+		return 0, err
+	}
+	if len(reply.Data) < 4 {
+		return 0, fmt.Errorf("ftp crc32 %s: %w", path, errUnexpectedSize)
+	}
+	return binary.LittleEndian.Uint32(reply.Data), nil
+}
+
+// The checksum autopilots calculate for CalcFileCRC32. It is the IEEE
+// polynomial, but starts from zero and isn't inverted at the end, so it
+// doesn't match crc32.ChecksumIEEE.
+func CRC32(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc32.IEEETable[byte(crc)^b] ^ (crc >> 8)
+	}
+	return crc
+}
@@ -0,0 +1,111 @@
+package mavcom
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/ftp"
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// Enough to take several bursts
+func testFile(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestFTPReadWrite(t *testing.T) {
+	s, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+	client := v.FTP()
+
+	data := testFile(5000)
+	s.WriteFile("/APM/scripts/test.lua", data)
+	read, err := client.ReadFile(ctx, "/APM/scripts/test.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Errorf("read %d bytes that differ from the %d written", len(read), len(data))
+	}
+
+	written := testFile(1000)[500:]
+	if err := client.WriteFile(ctx, "/APM/upload.bin", written); err != nil {
+		t.Fatal(err)
+	}
+	if stored, ok := s.ReadFile("/APM/upload.bin"); !ok || !bytes.Equal(stored, written) {
+		t.Errorf("simulator holds %d bytes, want the %d written", len(stored), len(written))
+	}
+	crc, err := client.CRC32(ctx, "/APM/upload.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crc != ftp.CRC32(written) {
+		t.Errorf("CRC32 %08x, want %08x", crc, ftp.CRC32(written))
+	}
+
+	_, err = client.ReadFile(ctx, "/APM/missing.txt")
+	if !errors.Is(err, ftp.ErrFileNotFound) {
+		t.Errorf("reading a missing file returned %v, want %v", err, ftp.ErrFileNotFound)
+	}
+}
+
+func TestFTPDirectories(t *testing.T) {
+	s, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+	client := v.FTP()
+
+	if err := client.Mkdir(ctx, "/logs"); err != nil {
+		t.Fatal(err)
+	}
+	s.WriteFile("/logs/1.BIN", testFile(100))
+	s.WriteFile("/logs/2.BIN", testFile(200))
+	if err := client.Rename(ctx, "/logs/2.BIN", "/logs/3.BIN"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Remove(ctx, "/logs/1.BIN"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := client.List(ctx, "/logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ftp.Entry{{Name: "3.BIN", Size: 200}}
+	if len(entries) != len(want) || entries[0] != want[0] {
+		t.Errorf("listed %+v, want %+v", entries, want)
+	}
+
+	if err := client.Remove(ctx, "/logs/3.BIN"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveDir(ctx, "/logs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.ReadFile("/logs/3.BIN"); ok {
+		t.Error("removed file still on the simulator")
+	}
+}
+
+func TestFTPReadDroppedChunks(t *testing.T) {
+	s, v := newLossySimVehicle(t, sim.DefaultConfig(), dropEvery(5, mavlink.MAVLINK_MSG_ID_FILE_TRANSFER_PROTOCOL))
+	ctx := testContext(t)
+	client := v.FTP()
+	// lost replies to single requests wait this long before repeating them
+	client.RetryInterval = 100 * time.Millisecond
+
+	data := testFile(8000)
+	s.WriteFile("/APM/terrain.dat", data)
+	read, err := client.ReadFile(ctx, "/APM/terrain.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Errorf("read %d bytes that differ from the %d written", len(read), len(data))
+	}
+}
@@ -0,0 +1,60 @@
+package mavcom
+
+import "math"
+
+// Mean radius of the earth in meters
+const earthRadius = 6371000
+
+// Coordinate is a latitude and longitude in degrees
+type Coordinate struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// The coordinate of the vehicle's position
+func (p Position) Coordinate() Coordinate {
+	return Coordinate{Latitude: p.Latitude, Longitude: p.Longitude}
+}
+
+// Great circle distance between two coordinates in meters
+func Distance(a Coordinate, b Coordinate) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Meters north and east of origin. The earth is treated as flat around the
+// origin, which is accurate to well under a meter over a few kilometers.
+func offsetFrom(origin Coordinate, c Coordinate) (north float64, east float64) {
+	north = (c.Latitude - origin.Latitude) * math.Pi / 180 * earthRadius
+	east = (c.Longitude - origin.Longitude) * math.Pi / 180 * earthRadius * math.Cos(origin.Latitude*math.Pi/180)
+	return north, east
+}
+
+// Whether a point is inside a polygon, both given as meters north and east
+// of the same origin
+func insidePolygon(north float64, east float64, vertices [][2]float64) bool {
+	inside := false
+	for i, j := 0, len(vertices)-1; i < len(vertices); j, i = i, i+1 {
+		ni, ei := vertices[i][0], vertices[i][1]
+		nj, ej := vertices[j][0], vertices[j][1]
+		if (ni > north) != (nj > north) && east < (ej-ei)*(north-ni)/(nj-ni)+ei {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Distance from a point to the line segment between a and b, all given as
+// meters north and east of the same origin
+func distanceToSegment(north float64, east float64, a [2]float64, b [2]float64) float64 {
+	dn, de := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if length := dn*dn + de*de; length > 0 {
+		t = math.Max(0, math.Min(1, ((north-a[0])*dn+(east-a[1])*de)/length))
+	}
+	return math.Hypot(north-(a[0]+t*dn), east-(a[1]+t*de))
+}
@@ -0,0 +1,514 @@
+package mavcom
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// How long to wait for a gimbal manager to acknowledge a request for its
+	// information, and then for the information to arrive
+	gimbalRequestTimeout = 2 * time.Second
+	gimbalDiscoveryTime  = time.Second
+
+	// MAV_CMD_DO_GIMBAL_MANAGER_CONFIGURE values for who is in control
+	gimbalControlUnchanged = -1
+	gimbalControlSelf      = -2
+	gimbalControlRelease   = -3
+)
+
+// GimbalID identifies a gimbal by the gimbal manager in charge of it, which
+// is where its setpoints and commands go, and the device ID the manager
+// knows it by
+type GimbalID struct {
+	SystemID    uint8
+	ComponentID uint8
+	// 1 to 6 for gimbals the autopilot drives, or the component ID of a
+	// gimbal that is a MAVLink component of its own
+	DeviceID uint8
+}
+
+func (id GimbalID) String() string {
+	return fmt.Sprintf("%d/%d/%d", id.SystemID, id.ComponentID, id.DeviceID)
+}
+
+// GimbalCapability is the GIMBAL_MANAGER_CAP_FLAGS a gimbal manager reports
+type GimbalCapability uint32
+
+const (
+	GimbalHasRetract              GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_RETRACT
+	GimbalHasNeutral              GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_NEUTRAL
+	GimbalHasRollAxis             GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_ROLL_AXIS
+	GimbalHasRollFollow           GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_ROLL_FOLLOW
+	GimbalHasRollLock             GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_ROLL_LOCK
+	GimbalHasPitchAxis            GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_PITCH_AXIS
+	GimbalHasPitchFollow          GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_PITCH_FOLLOW
+	GimbalHasPitchLock            GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_PITCH_LOCK
+	GimbalHasYawAxis              GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_YAW_AXIS
+	GimbalHasYawFollow            GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_YAW_FOLLOW
+	GimbalHasYawLock              GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_YAW_LOCK
+	GimbalSupportsInfiniteYaw     GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_SUPPORTS_INFINITE_YAW
+	GimbalSupportsYawInEarthFrame GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_SUPPORTS_YAW_IN_EARTH_FRAME
+	GimbalHasRCInputs             GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_RC_INPUTS
+	GimbalCanPointLocationLocal   GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_CAN_POINT_LOCATION_LOCAL
+	GimbalCanPointLocationGlobal  GimbalCapability = mavlink.GIMBAL_MANAGER_CAP_FLAGS_CAN_POINT_LOCATION_GLOBAL
+)
+
+var gimbalCapabilityNames = []struct {
+	capability GimbalCapability
+	name       string
+}{
+	{GimbalHasRetract, "RETRACT"},
+	{GimbalHasNeutral, "NEUTRAL"},
+	{GimbalHasRollAxis, "ROLL_AXIS"},
+	{GimbalHasRollFollow, "ROLL_FOLLOW"},
+	{GimbalHasRollLock, "ROLL_LOCK"},
+	{GimbalHasPitchAxis, "PITCH_AXIS"},
+	{GimbalHasPitchFollow, "PITCH_FOLLOW"},
+	{GimbalHasPitchLock, "PITCH_LOCK"},
+	{GimbalHasYawAxis, "YAW_AXIS"},
+	{GimbalHasYawFollow, "YAW_FOLLOW"},
+	{GimbalHasYawLock, "YAW_LOCK"},
+	{GimbalSupportsInfiniteYaw, "INFINITE_YAW"},
+	{GimbalSupportsYawInEarthFrame, "YAW_IN_EARTH_FRAME"},
+	{GimbalHasRCInputs, "RC_INPUTS"},
+	{GimbalCanPointLocationLocal, "POINT_LOCATION_LOCAL"},
+	{GimbalCanPointLocationGlobal, "POINT_LOCATION_GLOBAL"},
+}
+
+func (c GimbalCapability) String() string {
+	var names []string
+	for _, n := range gimbalCapabilityNames {
+		if c&n.capability != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+func (c GimbalCapability) Has(capability GimbalCapability) bool {
+	return c&capability == capability
+}
+
+// GimbalFailure is the GIMBAL_DEVICE_ERROR_FLAGS a gimbal reports
+type GimbalFailure uint32
+
+const (
+	GimbalAtRollLimit        GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_AT_ROLL_LIMIT
+	GimbalAtPitchLimit       GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_AT_PITCH_LIMIT
+	GimbalAtYawLimit         GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_AT_YAW_LIMIT
+	GimbalEncoderError       GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_ENCODER_ERROR
+	GimbalPowerError         GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_POWER_ERROR
+	GimbalMotorError         GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_MOTOR_ERROR
+	GimbalSoftwareError      GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_SOFTWARE_ERROR
+	GimbalCommunicationError GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_COMMUNICATION_ERROR
+	GimbalCalibrationRunning GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_CALIBRATION_RUNNING
+	GimbalNoManager          GimbalFailure = mavlink.GIMBAL_DEVICE_ERROR_FLAGS_NO_MANAGER
+)
+
+// Failure flags that say what the gimbal is doing rather than that it is
+// broken
+const gimbalStateFlags = GimbalAtRollLimit | GimbalAtPitchLimit | GimbalAtYawLimit | GimbalCalibrationRunning
+
+var gimbalFailureNames = []struct {
+	failure GimbalFailure
+	name    string
+}{
+	{GimbalAtRollLimit, "AT_ROLL_LIMIT"},
+	{GimbalAtPitchLimit, "AT_PITCH_LIMIT"},
+	{GimbalAtYawLimit, "AT_YAW_LIMIT"},
+	{GimbalEncoderError, "ENCODER_ERROR"},
+	{GimbalPowerError, "POWER_ERROR"},
+	{GimbalMotorError, "MOTOR_ERROR"},
+	{GimbalSoftwareError, "SOFTWARE_ERROR"},
+	{GimbalCommunicationError, "COMMUNICATION_ERROR"},
+	{GimbalCalibrationRunning, "CALIBRATION_RUNNING"},
+	{GimbalNoManager, "NO_MANAGER"},
+}
+
+func (f GimbalFailure) String() string {
+	var names []string
+	for _, n := range gimbalFailureNames {
+		if f&n.failure != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Whether the gimbal reports a fault, rather than only being at the limit
+// of its travel or calibrating
+func (f GimbalFailure) Faulty() bool {
+	return f&^gimbalStateFlags != 0
+}
+
+// GimbalController is the system and component in control of a gimbal, both
+// 0 when nobody is
+type GimbalController struct {
+	SystemID    uint8
+	ComponentID uint8
+}
+
+// GimbalAttitude is where a gimbal is pointing, from
+// GIMBAL_DEVICE_ATTITUDE_STATUS. Angles are in degrees and rates in degrees
+// per second, with rates the gimbal doesn't report as 0.
+type GimbalAttitude struct {
+	// the vehicle's clock when the attitude was measured
+	TimeBootMs uint32
+	Roll       float64
+	Pitch      float64
+	// relative to north when YawInEarthFrame, otherwise relative to the
+	// vehicle's heading
+	Yaw             float64
+	YawInEarthFrame bool
+	RollRate        float64
+	PitchRate       float64
+	YawRate         float64
+	// held in the earth frame, rather than following the vehicle
+	RollLock  bool
+	PitchLock bool
+	YawLock   bool
+	Failures  GimbalFailure
+}
+
+// Gimbal is what is known about a gimbal and its manager. Information from
+// GIMBAL_MANAGER_INFORMATION, the manager's status from GIMBAL_MANAGER_STATUS
+// and the attitude from GIMBAL_DEVICE_ATTITUDE_STATUS each arrive separately,
+// and the Has fields say which have.
+type Gimbal struct {
+	ID GimbalID
+
+	HasInformation bool
+	Capabilities   GimbalCapability
+	// range of travel in degrees
+	RollMin  float64
+	RollMax  float64
+	PitchMin float64
+	PitchMax float64
+	YawMin   float64
+	YawMax   float64
+
+	HasStatus        bool
+	PrimaryControl   GimbalController
+	SecondaryControl GimbalController
+
+	HasAttitude bool
+	Attitude    GimbalAttitude
+}
+
+// Gimbals are tracked by the system they are on and the device ID their
+// manager uses, which is the one thing all three messages agree on
+type gimbalKey struct {
+	systemID uint8
+	deviceID uint8
+}
+
+// Must be called holding the lock
+func (v *Vehicle) gimbal(systemID uint8, deviceID uint8) *Gimbal {
+	key := gimbalKey{systemID, deviceID}
+	g, ok := v.gimbals[key]
+	if !ok {
+		g = &Gimbal{ID: GimbalID{SystemID: systemID, DeviceID: deviceID}}
+		v.gimbals[key] = g
+	}
+	return g
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleGimbalManagerInformation(msg *mavlink.GimbalManagerInformationMessage) {
+	g := v.gimbal(msg.SystemID, msg.GimbalDeviceID)
+	g.ID.ComponentID = msg.ComponentID
+	g.HasInformation = true
+	g.Capabilities = GimbalCapability(msg.CapFlags)
+	g.RollMin, g.RollMax = degrees(msg.RollMin), degrees(msg.RollMax)
+	g.PitchMin, g.PitchMax = degrees(msg.PitchMin), degrees(msg.PitchMax)
+	g.YawMin, g.YawMax = degrees(msg.YawMin), degrees(msg.YawMax)
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleGimbalManagerStatus(msg *mavlink.GimbalManagerStatusMessage) {
+	g := v.gimbal(msg.SystemID, msg.GimbalDeviceID)
+	g.ID.ComponentID = msg.ComponentID
+	g.HasStatus = true
+	g.PrimaryControl = GimbalController{msg.PrimaryControlSysid, msg.PrimaryControlCompid}
+	g.SecondaryControl = GimbalController{msg.SecondaryControlSysid, msg.SecondaryControlCompid}
+
+	// a manager that is heard from before it has been asked for its
+	// information is asked once, so that gimbals turn up without having to
+	// be discovered
+	if !g.HasInformation && !v.gimbalInformationRequested[g.ID] && v.replay == nil {
+		v.gimbalInformationRequested[g.ID] = true
+		go v.requestGimbalInformation(g.ID.SystemID, g.ID.ComponentID)
+	}
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleGimbalDeviceAttitudeStatus(msg *mavlink.GimbalDeviceAttitudeStatusMessage) {
+	// a gimbal that is a MAVLink component of its own reports device ID 0,
+	// and its manager knows it by its component ID
+	deviceID := msg.GimbalDeviceID
+	if deviceID == 0 {
+		deviceID = msg.ComponentID
+	}
+	g := v.gimbal(msg.SystemID, deviceID)
+
+	roll, pitch, yaw := mavlink.EulerFromQuaternion(msg.Q)
+	flags := uint32(msg.Flags)
+	yawLock := flags&mavlink.GIMBAL_MANAGER_FLAGS_YAW_LOCK != 0
+	// older gimbals only say which frame the yaw is in through YAW_LOCK
+	earthFrame := flags&mavlink.GIMBAL_DEVICE_FLAGS_YAW_IN_EARTH_FRAME != 0 ||
+		(yawLock && flags&mavlink.GIMBAL_DEVICE_FLAGS_YAW_IN_VEHICLE_FRAME == 0)
+	g.HasAttitude = true
+	g.Attitude = GimbalAttitude{
+		TimeBootMs:      msg.TimeBootMs,
+		Roll:            roll * 180 / math.Pi,
+		Pitch:           pitch * 180 / math.Pi,
+		Yaw:             yaw * 180 / math.Pi,
+		YawInEarthFrame: earthFrame,
+		RollRate:        degrees(msg.AngularVelocityX),
+		PitchRate:       degrees(msg.AngularVelocityY),
+		YawRate:         degrees(msg.AngularVelocityZ),
+		RollLock:        flags&mavlink.GIMBAL_MANAGER_FLAGS_ROLL_LOCK != 0,
+		PitchLock:       flags&mavlink.GIMBAL_MANAGER_FLAGS_PITCH_LOCK != 0,
+		YawLock:         yawLock,
+		Failures:        GimbalFailure(msg.FailureFlags),
+	}
+}
+
+// Converts radians from a message to degrees, with the NaN gimbals send for
+// values they don't know as 0
+func degrees(radians float32) float64 {
+	if math.IsNaN(float64(radians)) {
+		return 0
+	}
+	return float64(radians) * 180 / math.Pi
+}
+
+// Returns every gimbal heard from, ordered by system and device ID
+func (v *Vehicle) Gimbals() []Gimbal {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	gimbals := make([]Gimbal, 0, len(v.gimbals))
+	for _, g := range v.gimbals {
+		gimbals = append(gimbals, *g)
+	}
+	sort.Slice(gimbals, func(i, j int) bool {
+		if gimbals[i].ID.SystemID != gimbals[j].ID.SystemID {
+			return gimbals[i].ID.SystemID < gimbals[j].ID.SystemID
+		}
+		return gimbals[i].ID.DeviceID < gimbals[j].ID.DeviceID
+	})
+	return gimbals
+}
+
+// Returns a gimbal on the vehicle by its device ID, and false if it hasn't
+// been heard from
+func (v *Vehicle) Gimbal(deviceID uint8) (Gimbal, bool) {
+	targetSystem, _ := v.Connection.Target()
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	g, ok := v.gimbals[gimbalKey{targetSystem, deviceID}]
+	if !ok {
+		return Gimbal{}, false
+	}
+	return *g, true
+}
+
+func (v *Vehicle) requestGimbalInformation(systemID uint8, componentID uint8) {
+	ctx, cancel := context.WithTimeout(context.Background(), gimbalRequestTimeout)
+	defer cancel()
+	v.Connection.SendCommandTo(ctx, systemID, componentID, mavlink.MAV_CMD_REQUEST_MESSAGE,
+		mavlink.MAVLINK_MSG_ID_GIMBAL_MANAGER_INFORMATION)
+}
+
+// Asks every component on the vehicle for GIMBAL_MANAGER_INFORMATION and
+// returns the gimbals whose managers answered, along with any already known.
+// A vehicle without gimbals returns none rather than an error.
+func (v *Vehicle) DiscoverGimbals(ctx context.Context) ([]Gimbal, error) {
+	targetSystem, _ := v.Connection.Target()
+	requestCtx, cancel := context.WithTimeout(ctx, gimbalRequestTimeout)
+	defer cancel()
+	// addressed to component 0 so that gimbal managers other than the
+	// autopilot answer too
+	_, err := v.Connection.SendCommandTo(requestCtx, targetSystem, 0, mavlink.MAV_CMD_REQUEST_MESSAGE,
+		mavlink.MAVLINK_MSG_ID_GIMBAL_MANAGER_INFORMATION)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("discover gimbals: %w", ctx.Err())
+	}
+	if err == nil {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("discover gimbals: %w", ctx.Err())
+		case <-time.After(gimbalDiscoveryTime):
+		}
+	}
+
+	var gimbals []Gimbal
+	for _, g := range v.Gimbals() {
+		if g.HasInformation && g.ID.SystemID == targetSystem {
+			gimbals = append(gimbals, g)
+		}
+	}
+	return gimbals, nil
+}
+
+// GimbalSetpointMask says which parts of a GimbalSetpoint the gimbal should
+// follow
+type GimbalSetpointMask uint8
+
+const (
+	UseGimbalAngles GimbalSetpointMask = 1 << iota
+	UseGimbalRates
+)
+
+// GimbalSetpoint is where to point a gimbal, in degrees, and or how fast to
+// turn it, in degrees per second. Pitch is positive up and yaw positive to
+// the right.
+type GimbalSetpoint struct {
+	Use GimbalSetpointMask
+
+	Roll  float64
+	Pitch float64
+	Yaw   float64
+
+	RollRate  float64
+	PitchRate float64
+	YawRate   float64
+
+	// Holds the yaw relative to north, rather than relative to the
+	// vehicle's heading so that the gimbal turns with the vehicle
+	YawLock bool
+}
+
+// A setpoint that points a gimbal at a pitch and yaw in degrees
+func GimbalAngles(pitch float64, yaw float64) GimbalSetpoint {
+	return GimbalSetpoint{Use: UseGimbalAngles, Pitch: pitch, Yaw: yaw}
+}
+
+// A setpoint that turns a gimbal at a pitch and yaw rate in degrees per
+// second
+func GimbalRates(pitchRate float64, yawRate float64) GimbalSetpoint {
+	return GimbalSetpoint{Use: UseGimbalRates, PitchRate: pitchRate, YawRate: yawRate}
+}
+
+func (sp GimbalSetpoint) flags() uint32 {
+	var flags uint32 = mavlink.GIMBAL_MANAGER_FLAGS_ROLL_LOCK | mavlink.GIMBAL_MANAGER_FLAGS_PITCH_LOCK
+	if sp.YawLock {
+		flags |= mavlink.GIMBAL_MANAGER_FLAGS_YAW_LOCK
+	}
+	return flags
+}
+
+// Converts degrees to radians for a message, or NaN to leave the value alone
+func radiansIf(use bool, degrees float64) float32 {
+	if !use {
+		return float32(math.NaN())
+	}
+	return float32(degrees * math.Pi / 180)
+}
+
+// Points or turns a gimbal by pitch and yaw with GIMBAL_MANAGER_SET_PITCHYAW,
+// ignoring roll. The setpoint is sent once, without waiting for an
+// acknowledgement, so it can be sent repeatedly to steer the gimbal.
+func (v *Vehicle) SetGimbalPitchYaw(id GimbalID, sp GimbalSetpoint) error {
+	angles, rates := sp.Use&UseGimbalAngles != 0, sp.Use&UseGimbalRates != 0
+	return v.Connection.Send(mavlink.GimbalManagerSetPitchyaw{
+		Flags:           sp.flags(),
+		Pitch:           radiansIf(angles, sp.Pitch),
+		Yaw:             radiansIf(angles, sp.Yaw),
+		PitchRate:       radiansIf(rates, sp.PitchRate),
+		YawRate:         radiansIf(rates, sp.YawRate),
+		TargetSystem:    id.SystemID,
+		TargetComponent: id.ComponentID,
+		GimbalDeviceID:  id.DeviceID,
+	})
+}
+
+// Like SetGimbalPitchYaw, but sent as a full attitude with
+// GIMBAL_MANAGER_SET_ATTITUDE so that roll can be set as well
+func (v *Vehicle) SetGimbalAttitude(id GimbalID, sp GimbalSetpoint) error {
+	q := [4]float32{float32(math.NaN()), float32(math.NaN()), float32(math.NaN()), float32(math.NaN())}
+	if sp.Use&UseGimbalAngles != 0 {
+		q = mavlink.QuaternionFromEuler(sp.Roll*math.Pi/180, sp.Pitch*math.Pi/180, sp.Yaw*math.Pi/180)
+	}
+	rates := sp.Use&UseGimbalRates != 0
+	return v.Connection.Send(mavlink.GimbalManagerSetAttitude{
+		Flags:            sp.flags(),
+		Q:                q,
+		AngularVelocityX: radiansIf(rates, sp.RollRate),
+		AngularVelocityY: radiansIf(rates, sp.PitchRate),
+		AngularVelocityZ: radiansIf(rates, sp.YawRate),
+		TargetSystem:     id.SystemID,
+		TargetComponent:  id.ComponentID,
+		GimbalDeviceID:   id.DeviceID,
+	})
+}
+
+// Takes primary control of a gimbal, which gimbal managers such as PX4's
+// require before they follow setpoints from a ground station
+func (v *Vehicle) ControlGimbal(ctx context.Context, id GimbalID) error {
+	return v.configureGimbal(ctx, "control gimbal", id, gimbalControlSelf)
+}
+
+// Hands primary control of a gimbal back, for instance to the autopilot's
+// mission or the pilot's RC
+func (v *Vehicle) ReleaseGimbal(ctx context.Context, id GimbalID) error {
+	return v.configureGimbal(ctx, "release gimbal", id, gimbalControlRelease)
+}
+
+func (v *Vehicle) configureGimbal(ctx context.Context, name string, id GimbalID, primary float32) error {
+	result, err := v.Connection.SendCommandTo(ctx, id.SystemID, id.ComponentID, mavlink.MAV_CMD_DO_GIMBAL_MANAGER_CONFIGURE,
+		primary, primary, gimbalControlUnchanged, gimbalControlUnchanged, 0, 0, float32(id.DeviceID))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if CommandResult(result.Result) != ResultAccepted {
+		return fmt.Errorf("%s: vehicle responded %v", name, CommandResult(result.Result))
+	}
+	return nil
+}
+
+// Points a gimbal at a location, tracking it as the vehicle moves, with the
+// altitude in meters above home. A device ID of 0 points every gimbal. It is
+// sent as COMMAND_INT when the vehicle has CapabilityCommandInt, otherwise
+// as COMMAND_LONG, which carries the coordinates as 32 bit floats, good to
+// about a meter.
+func (v *Vehicle) SetROILocation(ctx context.Context, deviceID uint8, latitude float64, longitude float64, altitude float64) error {
+	if !v.HasCapability(CapabilityCommandInt) {
+		return v.command(ctx, "set ROI", mavlink.MAV_CMD_DO_SET_ROI_LOCATION,
+			float32(deviceID), 0, 0, 0, float32(latitude), float32(longitude), float32(altitude))
+	}
+	ack, err := v.Connection.SendCommandInt(ctx, mavlink.CommandInt{
+		Param1:  float32(deviceID),
+		X:       int32(math.Round(latitude * 1e7)),
+		Y:       int32(math.Round(longitude * 1e7)),
+		Z:       float32(altitude),
+		Command: mavlink.MAV_CMD_DO_SET_ROI_LOCATION,
+		Frame:   mavlink.MAV_FRAME_GLOBAL_RELATIVE_ALT,
+	})
+	if err != nil {
+		return fmt.Errorf("set ROI: %w", err)
+	}
+	if CommandResult(ack.Result) != ResultAccepted {
+		return fmt.Errorf("set ROI: vehicle responded %v", CommandResult(ack.Result))
+	}
+	return nil
+}
+
+// Points a gimbal at another MAVLink system, tracking it from the position
+// it reports. A device ID of 0 points every gimbal.
+func (v *Vehicle) SetROISystem(ctx context.Context, deviceID uint8, systemID uint8) error {
+	return v.command(ctx, "set ROI", mavlink.MAV_CMD_DO_SET_ROI_SYSID, float32(systemID), float32(deviceID))
+}
+
+// Stops a gimbal tracking a region of interest, returning it to its default
+// attitude. A device ID of 0 clears every gimbal.
+func (v *Vehicle) ClearROI(ctx context.Context, deviceID uint8) error {
+	return v.command(ctx, "clear ROI", mavlink.MAV_CMD_DO_SET_ROI_NONE, float32(deviceID))
+}
@@ -0,0 +1,73 @@
+package mavcom
+
+import (
+	"testing"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// Decodes a frame the vehicle sent
+func decodeFrame(t *testing.T, frame []byte) mavlink.DecodedMessage {
+	t.Helper()
+	raw, err := mavlink.NewRawMessage(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mavlink.DecodeMessage(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestSetROILocation(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	const latitude, longitude, altitude = -35.3632621, 149.1652374, 20
+
+	setROI := func() <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- v.SetROILocation(testContext(t), 1, latitude, longitude, altitude)
+		}()
+		return done
+	}
+	ack := func(done <-chan error) {
+		t.Helper()
+		a.send(1, mavlink.CommandAck{Command: mavlink.MAV_CMD_DO_SET_ROI_LOCATION})
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// without COMMAND_INT the coordinates go as floats
+	done := setROI()
+	// skipping the vehicle's request for AUTOPILOT_VERSION
+	long := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_LONG)).(*mavlink.CommandLongMessage)
+	for long.Command != mavlink.MAV_CMD_DO_SET_ROI_LOCATION {
+		long = decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_LONG)).(*mavlink.CommandLongMessage)
+	}
+	if long.Param5 != float32(latitude) {
+		t.Errorf("sent latitude %v, want %v", long.Param5, float32(latitude))
+	}
+	ack(done)
+
+	a.send(1, mavlink.AutopilotVersion{Capabilities: mavlink.MAV_PROTOCOL_CAPABILITY_COMMAND_INT})
+	err := v.waitFor(testContext(t), "autopilot version", "AUTOPILOT_VERSION", func() bool {
+		return v.autopilotVersion != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done = setROI()
+	cmd := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_INT)).(*mavlink.CommandIntMessage)
+	if cmd.Command != mavlink.MAV_CMD_DO_SET_ROI_LOCATION || cmd.Frame != mavlink.MAV_FRAME_GLOBAL_RELATIVE_ALT {
+		t.Errorf("sent command %d in frame %d", cmd.Command, cmd.Frame)
+	}
+	if cmd.X != -353632621 || cmd.Y != 1491652374 || cmd.Z != altitude || cmd.Param1 != 1 {
+		t.Errorf("sent %d, %d at %v m for gimbal %v", cmd.X, cmd.Y, cmd.Z, cmd.Param1)
+	}
+	if cmd.TargetSystem != 1 || cmd.TargetComponent != 1 {
+		t.Errorf("sent to %d/%d", cmd.TargetSystem, cmd.TargetComponent)
+	}
+	ack(done)
+}
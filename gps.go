@@ -0,0 +1,174 @@
+package mavcom
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How long to wait for the vehicle to answer a request for its home position
+const homeRequestTimeout = 3 * time.Second
+
+// GPSFix is the kind of position fix the GPS has, from GPSNoGPS for no GPS
+// at all up to GPSRTKFixed. Better fixes compare greater, apart from
+// GPSStatic and GPSPPP which come after for historical reasons.
+type GPSFix uint8
+
+const (
+	GPSNoGPS    GPSFix = mavlink.GPS_FIX_TYPE_NO_GPS
+	GPSNoFix    GPSFix = mavlink.GPS_FIX_TYPE_NO_FIX
+	GPSFix2D    GPSFix = mavlink.GPS_FIX_TYPE_2D_FIX
+	GPSFix3D    GPSFix = mavlink.GPS_FIX_TYPE_3D_FIX
+	GPSDGPS     GPSFix = mavlink.GPS_FIX_TYPE_DGPS
+	GPSRTKFloat GPSFix = mavlink.GPS_FIX_TYPE_RTK_FLOAT
+	GPSRTKFixed GPSFix = mavlink.GPS_FIX_TYPE_RTK_FIXED
+	GPSStatic   GPSFix = mavlink.GPS_FIX_TYPE_STATIC
+	GPSPPP      GPSFix = mavlink.GPS_FIX_TYPE_PPP
+)
+
+func (f GPSFix) String() string {
+	switch f {
+	case GPSNoGPS:
+		return "no GPS"
+	case GPSNoFix:
+		return "no fix"
+	case GPSFix2D:
+		return "2D fix"
+	case GPSFix3D:
+		return "3D fix"
+	case GPSDGPS:
+		return "DGPS"
+	case GPSRTKFloat:
+		return "RTK float"
+	case GPSRTKFixed:
+		return "RTK fixed"
+	case GPSStatic:
+		return "static"
+	case GPSPPP:
+		return "PPP"
+	default:
+		return fmt.Sprintf("fix type %d", uint8(f))
+	}
+}
+
+// GPS is what the vehicle's primary GPS reports in GPS_RAW_INT, unfiltered
+// by the EKF
+type GPS struct {
+	Fix GPSFix
+	// -1 if the GPS doesn't know
+	Satellites int
+	HDOP       float64
+	VDOP       float64
+	// Estimated position uncertainty in meters, -1 if the GPS doesn't
+	// report it
+	HorizontalAccuracy float64
+	VerticalAccuracy   float64
+	// degrees, and meters above mean sea level
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Received  time.Time
+}
+
+// Home is where the vehicle returns to and the altitudes of missions and
+// setpoints are relative to. ArduPilot sets it on arming, or where the GPS
+// first gets a fix.
+type Home struct {
+	// degrees, and meters above mean sea level
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Received  time.Time
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleGpsRawInt(msg *mavlink.GpsRawIntMessage) {
+	gps := GPS{
+		Fix:        GPSFix(msg.FixType),
+		Satellites: int(msg.SatellitesVisible),
+		HDOP:       float64(msg.Eph) / 100,
+		VDOP:       float64(msg.Epv) / 100,
+		// MAVLink 1 senders leave these out, and they decode as 0
+		HorizontalAccuracy: float64(msg.HAcc) / 1000,
+		VerticalAccuracy:   float64(msg.VAcc) / 1000,
+		Latitude:           float64(msg.Lat) / 1e7,
+		Longitude:          float64(msg.Lon) / 1e7,
+		Altitude:           float64(msg.Alt) / 1000,
+		Received:           v.now(),
+	}
+	if msg.SatellitesVisible == 255 {
+		gps.Satellites = -1
+	}
+	if msg.Eph == mavlink.GPS_UNKNOWN {
+		gps.HDOP = -1
+	}
+	if msg.Epv == mavlink.GPS_UNKNOWN {
+		gps.VDOP = -1
+	}
+	if msg.HAcc == 0 {
+		gps.HorizontalAccuracy = -1
+	}
+	if msg.VAcc == 0 {
+		gps.VerticalAccuracy = -1
+	}
+	v.gps = gps
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleHomePosition(msg *mavlink.HomePositionMessage) {
+	v.home = newHome(msg, v.now())
+}
+
+func newHome(msg *mavlink.HomePositionMessage, received time.Time) Home {
+	return Home{
+		Latitude:  float64(msg.Latitude) / 1e7,
+		Longitude: float64(msg.Longitude) / 1e7,
+		Altitude:  float64(msg.Altitude) / 1000,
+		Received:  received,
+	}
+}
+
+// Returns the latest GPS report, and false if there hasn't been one
+func (v *Vehicle) GPS() (GPS, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.gps, !v.gps.Received.IsZero()
+}
+
+// Returns the home position, and false if the vehicle hasn't reported one.
+// Vehicles send HOME_POSITION when home is set or moved, so one connected to
+// after that may need RequestHome.
+func (v *Vehicle) Home() (Home, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.home, !v.home.Received.IsZero()
+}
+
+// Asks the vehicle for its home position and waits for it. Vehicles refuse
+// while home isn't set, such as before the GPS has had a fix.
+func (v *Vehicle) RequestHome(ctx context.Context) (Home, error) {
+	homes, unsubscribe := v.Connection.Subscribe(mavlink.MAVLINK_MSG_ID_HOME_POSITION)
+	defer unsubscribe()
+
+	commandCtx, cancel := context.WithTimeout(ctx, homeRequestTimeout)
+	defer cancel()
+	result, err := v.SendCommand(commandCtx, mavlink.MAV_CMD_REQUEST_MESSAGE, mavlink.MAVLINK_MSG_ID_HOME_POSITION)
+	if err != nil {
+		return Home{}, fmt.Errorf("home position: %w", err)
+	}
+	if result != ResultAccepted {
+		return Home{}, fmt.Errorf("home position: vehicle responded %v", result)
+	}
+
+	select {
+	case <-ctx.Done():
+		return Home{}, fmt.Errorf("home position: %w", ctx.Err())
+	case msg, ok := <-homes:
+		if !ok {
+			return Home{}, fmt.Errorf("home position: connection closed")
+		}
+		return newHome(msg.(*mavlink.HomePositionMessage), v.now()), nil
+	}
+}
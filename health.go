@@ -0,0 +1,330 @@
+package mavcom
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// EKF test ratios above this are shown as bad by ground stations, well
+	// before the EKF starts rejecting measurements at 1
+	estimatorRatioLimit = 0.8
+	// Vibration above this, in m/s², often causes problems with the EKF's
+	// altitude and position
+	vibrationLimit = 30
+	// How long accelerometer clipping is reported for after it last
+	// happened
+	clippingHoldTime = 10 * time.Second
+	// How long a health report is trusted for. Health isn't known once the
+	// messages it comes from stop.
+	healthTimeout = 5 * time.Second
+)
+
+// SensorFlags are sensors and subsystems as reported in SYS_STATUS. The
+// bits are those of MAV_SYS_STATUS_SENSOR, with the extended ones from bit
+// 32.
+type SensorFlags uint64
+
+const (
+	SensorGyro                  SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_3D_GYRO
+	SensorAccel                 SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_3D_ACCEL
+	SensorMag                   SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_3D_MAG
+	SensorAbsolutePressure      SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_ABSOLUTE_PRESSURE
+	SensorDifferentialPressure  SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_DIFFERENTIAL_PRESSURE
+	SensorGPS                   SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_GPS
+	SensorOpticalFlow           SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_OPTICAL_FLOW
+	SensorVisionPosition        SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_VISION_POSITION
+	SensorLaserPosition         SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_LASER_POSITION
+	SensorExternalGroundTruth   SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_EXTERNAL_GROUND_TRUTH
+	SensorAngularRateControl    SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_ANGULAR_RATE_CONTROL
+	SensorAttitudeStabilization SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_ATTITUDE_STABILIZATION
+	SensorYawPosition           SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_YAW_POSITION
+	SensorAltitudeControl       SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_Z_ALTITUDE_CONTROL
+	SensorPositionControl       SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_XY_POSITION_CONTROL
+	SensorMotorOutputs          SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_MOTOR_OUTPUTS
+	SensorRCReceiver            SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_RC_RECEIVER
+	SensorGyro2                 SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_3D_GYRO2
+	SensorAccel2                SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_3D_ACCEL2
+	SensorMag2                  SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_3D_MAG2
+	SensorGeofence              SensorFlags = mavlink.MAV_SYS_STATUS_GEOFENCE
+	SensorAHRS                  SensorFlags = mavlink.MAV_SYS_STATUS_AHRS
+	SensorTerrain               SensorFlags = mavlink.MAV_SYS_STATUS_TERRAIN
+	SensorReverseMotor          SensorFlags = mavlink.MAV_SYS_STATUS_REVERSE_MOTOR
+	SensorLogging               SensorFlags = mavlink.MAV_SYS_STATUS_LOGGING
+	SensorBattery               SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_BATTERY
+	SensorProximity             SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_PROXIMITY
+	SensorSatcom                SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_SATCOM
+	// the autopilot's own pre-arm checks, healthy once they all pass
+	SensorPrearmCheck       SensorFlags = mavlink.MAV_SYS_STATUS_PREARM_CHECK
+	SensorObstacleAvoidance SensorFlags = mavlink.MAV_SYS_STATUS_OBSTACLE_AVOIDANCE
+	SensorPropulsion        SensorFlags = mavlink.MAV_SYS_STATUS_SENSOR_PROPULSION
+	SensorRecoverySystem    SensorFlags = mavlink.MAV_SYS_STATUS_RECOVERY_SYSTEM << sensorExtendedShift
+	// says the extended fields are in use, not a sensor
+	sensorExtensionUsed SensorFlags = mavlink.MAV_SYS_STATUS_EXTENSION_USED
+)
+
+// Where the extended MAV_SYS_STATUS_SENSOR bits start in SensorFlags
+const sensorExtendedShift = 32
+
+var sensorNames = map[SensorFlags]string{
+	SensorGyro:                  "gyro",
+	SensorAccel:                 "accelerometer",
+	SensorMag:                   "compass",
+	SensorAbsolutePressure:      "barometer",
+	SensorDifferentialPressure:  "airspeed",
+	SensorGPS:                   "GPS",
+	SensorOpticalFlow:           "optical flow",
+	SensorVisionPosition:        "vision position",
+	SensorLaserPosition:         "laser position",
+	SensorExternalGroundTruth:   "external ground truth",
+	SensorAngularRateControl:    "angular rate control",
+	SensorAttitudeStabilization: "attitude stabilization",
+	SensorYawPosition:           "yaw position",
+	SensorAltitudeControl:       "altitude control",
+	SensorPositionControl:       "position control",
+	SensorMotorOutputs:          "motor outputs",
+	SensorRCReceiver:            "RC receiver",
+	SensorGyro2:                 "gyro 2",
+	SensorAccel2:                "accelerometer 2",
+	SensorMag2:                  "compass 2",
+	SensorGeofence:              "geofence",
+	SensorAHRS:                  "AHRS",
+	SensorTerrain:               "terrain",
+	SensorReverseMotor:          "reverse motor",
+	SensorLogging:               "logging",
+	SensorBattery:               "battery",
+	SensorProximity:             "proximity",
+	SensorSatcom:                "satcom",
+	SensorPrearmCheck:           "pre-arm checks",
+	SensorObstacleAvoidance:     "obstacle avoidance",
+	SensorPropulsion:            "propulsion",
+	SensorRecoverySystem:        "recovery system",
+}
+
+// Whether every one of flags is set
+func (f SensorFlags) Has(flags SensorFlags) bool {
+	return f&flags == flags
+}
+
+// Returns the flags set, one per element, lowest bit first
+func (f SensorFlags) Split() []SensorFlags {
+	var flags []SensorFlags
+	for f != 0 {
+		flag := SensorFlags(1) << bits.TrailingZeros64(uint64(f))
+		flags = append(flags, flag)
+		f &^= flag
+	}
+	return flags
+}
+
+// Names the flags set, such as "gyro, GPS"
+func (f SensorFlags) String() string {
+	var names []string
+	for _, flag := range f.Split() {
+		name, ok := sensorNames[flag]
+		if !ok {
+			name = fmt.Sprintf("sensor %#x", uint64(flag))
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Sensors is what SYS_STATUS says about the vehicle's sensors and
+// subsystems. A sensor's health only means something if it is present and
+// enabled.
+type Sensors struct {
+	Present  SensorFlags
+	Enabled  SensorFlags
+	Healthy  SensorFlags
+	Received time.Time
+}
+
+// The sensors that are present and enabled but not healthy
+func (s Sensors) Unhealthy() SensorFlags {
+	return s.Present & s.Enabled &^ s.Healthy
+}
+
+// Vibration is how much the vehicle's accelerometers are shaking, from
+// VIBRATION
+type Vibration struct {
+	// m/s² along each axis
+	X float64
+	Y float64
+	Z float64
+	// times each accelerometer has clipped since boot, which means the
+	// vibration has gone past what it can measure
+	Clipping [3]uint32
+	// when any of them last clipped, zero if they haven't since the first
+	// report
+	LastClipped time.Time
+	Received    time.Time
+}
+
+// Health is everything the vehicle reports about whether it is fit to fly.
+// Each part is zero, with a zero Received time, until its message has
+// arrived.
+type Health struct {
+	// from SYS_STATUS
+	Sensors Sensors
+	// from EKF_STATUS_REPORT or ESTIMATOR_STATUS
+	Estimator EstimatorStatus
+	// from VIBRATION
+	Vibration Vibration
+}
+
+// HealthProblem is a subsystem that isn't healthy, and why
+type HealthProblem struct {
+	Subsystem string
+	Reason    string
+}
+
+func (p HealthProblem) String() string {
+	return p.Subsystem + ": " + p.Reason
+}
+
+// Returns what is wrong with the vehicle as of now, an empty list if
+// nothing is. Parts of the report that have never arrived aren't counted as
+// problems, those that have stopped arriving are. Vehicle.Unhealthy goes by
+// the time in the log for a replay.
+func (h Health) Unhealthy() []HealthProblem {
+	return h.unhealthy(time.Now())
+}
+
+func (h Health) unhealthy(now time.Time) []HealthProblem {
+	var problems []HealthProblem
+	stale := func(received time.Time) bool {
+		return !received.IsZero() && now.Sub(received) > healthTimeout
+	}
+
+	switch s := h.Sensors; {
+	case stale(s.Received):
+		problems = append(problems, HealthProblem{"sensors", "no SYS_STATUS for " + now.Sub(s.Received).Round(time.Second).String()})
+	case !s.Received.IsZero():
+		for _, sensor := range s.Unhealthy().Split() {
+			problems = append(problems, HealthProblem{sensor.String(), "unhealthy"})
+		}
+	}
+
+	switch e := h.Estimator; {
+	case stale(e.Received):
+		problems = append(problems, HealthProblem{"EKF", "no status for " + now.Sub(e.Received).Round(time.Second).String()})
+	case !e.Received.IsZero():
+		problems = append(problems, e.problems()...)
+	}
+
+	switch v := h.Vibration; {
+	case stale(v.Received):
+		problems = append(problems, HealthProblem{"vibration", "no VIBRATION for " + now.Sub(v.Received).Round(time.Second).String()})
+	case !v.Received.IsZero():
+		if level := max(v.X, v.Y, v.Z); level > vibrationLimit {
+			problems = append(problems, HealthProblem{"vibration", fmt.Sprintf("%.0f m/s² is above %d m/s²", level, vibrationLimit)})
+		}
+		if !v.LastClipped.IsZero() && now.Sub(v.LastClipped) < clippingHoldTime {
+			problems = append(problems, HealthProblem{"vibration", "accelerometer clipping"})
+		}
+	}
+	return problems
+}
+
+// What is wrong with the EKF's solution
+func (s EstimatorStatus) problems() []HealthProblem {
+	var problems []HealthProblem
+	add := func(reason string) {
+		problems = append(problems, HealthProblem{"EKF", reason})
+	}
+	if s.Flags.Has(EstimatorUninitialized) {
+		add("not initialized")
+		return problems
+	}
+	if !s.Flags.Has(EstimatorAttitude) {
+		add("no attitude")
+	}
+	if !s.Flags.Has(EstimatorVelocityHoriz) {
+		add("no horizontal velocity")
+	}
+	if !s.Flags.Has(EstimatorVelocityVert) {
+		add("no vertical velocity")
+	}
+	if !s.HasPosition() {
+		add("no horizontal position")
+	}
+	if !s.Flags.Has(EstimatorPosVertAbs) {
+		add("no altitude")
+	}
+	if s.Flags.Has(EstimatorGPSGlitch) {
+		add("GPS glitch")
+	}
+	if s.Flags.Has(EstimatorAccelError) {
+		add("accelerometer error")
+	}
+	ratios := []struct {
+		name  string
+		ratio float64
+	}{
+		{"velocity", s.VelocityRatio},
+		{"horizontal position", s.PosHorizRatio},
+		{"vertical position", s.PosVertRatio},
+		{"compass", s.CompassRatio},
+		{"terrain", s.TerrainRatio},
+	}
+	for _, r := range ratios {
+		if r.ratio > estimatorRatioLimit {
+			add(fmt.Sprintf("%s variance %.2f", r.name, r.ratio))
+		}
+	}
+	return problems
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleSysStatusSensors(msg *mavlink.SysStatusMessage) {
+	sensors := Sensors{
+		Present:  SensorFlags(uint32(msg.SensorsPresent)) &^ sensorExtensionUsed,
+		Enabled:  SensorFlags(uint32(msg.SensorsEnabled)) &^ sensorExtensionUsed,
+		Healthy:  SensorFlags(uint32(msg.SensorsHealth)) &^ sensorExtensionUsed,
+		Received: v.now(),
+	}
+	if uint32(msg.SensorsPresent)&mavlink.MAV_SYS_STATUS_EXTENSION_USED != 0 {
+		sensors.Present |= SensorFlags(uint32(msg.SensorsPresentExtended)) << sensorExtendedShift
+		sensors.Enabled |= SensorFlags(uint32(msg.SensorsEnabledExtended)) << sensorExtendedShift
+		sensors.Healthy |= SensorFlags(uint32(msg.SensorsHealthExtended)) << sensorExtendedShift
+	}
+	v.health.Sensors = sensors
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleVibration(msg *mavlink.VibrationMessage) {
+	previous := v.health.Vibration
+	vibration := Vibration{
+		X:           float64(msg.VibrationX),
+		Y:           float64(msg.VibrationY),
+		Z:           float64(msg.VibrationZ),
+		Clipping:    msg.Clipping,
+		LastClipped: previous.LastClipped,
+		Received:    v.now(),
+	}
+	// the counts are since boot, so clipping shows as them going up
+	if !previous.Received.IsZero() && vibration.Clipping != previous.Clipping {
+		vibration.LastClipped = vibration.Received
+	}
+	v.health.Vibration = vibration
+}
+
+// Returns the latest of everything the vehicle reports about its health
+func (v *Vehicle) Health() Health {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.health
+}
+
+// Returns what is wrong with the vehicle, such as unhealthy sensors, a bad
+// EKF solution or too much vibration, for refusing to take off. An empty
+// list means nothing reported is wrong, which includes nothing having been
+// reported yet. Replays are judged as of the time in the log.
+func (v *Vehicle) Unhealthy() []HealthProblem {
+	return v.Health().unhealthy(v.now())
+}
@@ -0,0 +1,191 @@
+package mavcom
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+func TestSensorFlags(t *testing.T) {
+	flags := SensorGPS | SensorGyro | SensorRecoverySystem | SensorFlags(1)<<40
+	if split := flags.Split(); !slices.Equal(split, []SensorFlags{SensorGyro, SensorGPS, SensorRecoverySystem, 1 << 40}) {
+		t.Errorf("split into %v", split)
+	}
+	if name, want := flags.String(), "gyro, GPS, recovery system, sensor 0x10000000000"; name != want {
+		t.Errorf("named %q, want %q", name, want)
+	}
+	if !flags.Has(SensorGPS|SensorGyro) || flags.Has(SensorGPS|SensorMag) {
+		t.Error("Has doesn't want every flag")
+	}
+}
+
+func TestSysStatusSensors(t *testing.T) {
+	v := &Vehicle{}
+	v.handleSysStatusSensors(&mavlink.SysStatusMessage{
+		SensorsPresent:         float64(mavlink.MAV_SYS_STATUS_SENSOR_GPS | mavlink.MAV_SYS_STATUS_SENSOR_3D_MAG | mavlink.MAV_SYS_STATUS_EXTENSION_USED),
+		SensorsEnabled:         float64(mavlink.MAV_SYS_STATUS_SENSOR_GPS | mavlink.MAV_SYS_STATUS_EXTENSION_USED),
+		SensorsHealth:          float64(mavlink.MAV_SYS_STATUS_SENSOR_3D_MAG),
+		SensorsPresentExtended: float64(mavlink.MAV_SYS_STATUS_RECOVERY_SYSTEM),
+		SensorsEnabledExtended: float64(mavlink.MAV_SYS_STATUS_RECOVERY_SYSTEM),
+	})
+	sensors := v.health.Sensors
+	if sensors.Present != SensorGPS|SensorMag|SensorRecoverySystem {
+		t.Errorf("present %v, want GPS, compass and recovery system", sensors.Present)
+	}
+	// the compass is healthy but disabled, so isn't counted
+	if unhealthy := sensors.Unhealthy(); unhealthy != SensorGPS|SensorRecoverySystem {
+		t.Errorf("unhealthy %v, want GPS and recovery system", unhealthy)
+	}
+}
+
+func TestHealthUnhealthy(t *testing.T) {
+	now := time.Now()
+	received := now.Add(-time.Second)
+	goodEstimator := EstimatorStatus{
+		Flags:    EstimatorAttitude | EstimatorVelocityHoriz | EstimatorVelocityVert | EstimatorPosHorizAbs | EstimatorPosVertAbs,
+		Received: received,
+	}
+	tests := []struct {
+		name   string
+		health Health
+		want   []HealthProblem
+	}{
+		{name: "nothing received"},
+		{
+			name: "healthy",
+			health: Health{
+				Sensors:   Sensors{Present: SensorGPS, Enabled: SensorGPS, Healthy: SensorGPS, Received: received},
+				Estimator: goodEstimator,
+				Vibration: Vibration{X: 10, Y: 10, Z: 10, Received: received},
+			},
+		},
+		{
+			name:   "unhealthy sensors",
+			health: Health{Sensors: Sensors{Present: SensorGPS | SensorMag, Enabled: SensorGPS | SensorMag, Received: received}},
+			want:   []HealthProblem{{"compass", "unhealthy"}, {"GPS", "unhealthy"}},
+		},
+		{
+			name: "stale",
+			health: Health{
+				Sensors:   Sensors{Present: SensorGPS, Enabled: SensorGPS, Received: now.Add(-6 * time.Second)},
+				Estimator: EstimatorStatus{Received: now.Add(-10 * time.Second)},
+				Vibration: Vibration{Received: now.Add(-healthTimeout - time.Millisecond)},
+			},
+			want: []HealthProblem{{"sensors", "no SYS_STATUS for 6s"}, {"EKF", "no status for 10s"}, {"vibration", "no VIBRATION for 5s"}},
+		},
+		{
+			name:   "EKF not initialized",
+			health: Health{Estimator: EstimatorStatus{Flags: EstimatorUninitialized | EstimatorGPSGlitch, Received: received}},
+			want:   []HealthProblem{{"EKF", "not initialized"}},
+		},
+		{
+			name:   "EKF holding position",
+			health: Health{Estimator: EstimatorStatus{Flags: goodEstimator.Flags | EstimatorConstPosMode, Received: received}},
+			want:   []HealthProblem{{"EKF", "no horizontal position"}},
+		},
+		{
+			name: "EKF rejecting measurements",
+			health: Health{Estimator: EstimatorStatus{
+				Flags:        EstimatorAttitude | EstimatorVelocityHoriz | EstimatorPosHorizRel | EstimatorGPSGlitch,
+				CompassRatio: 0.9,
+				PosVertRatio: estimatorRatioLimit,
+				Received:     received,
+			}},
+			want: []HealthProblem{
+				{"EKF", "no vertical velocity"},
+				{"EKF", "no altitude"},
+				{"EKF", "GPS glitch"},
+				{"EKF", "compass variance 0.90"},
+			},
+		},
+		{
+			name:   "vibration",
+			health: Health{Vibration: Vibration{X: 10, Z: 45, LastClipped: now.Add(-clippingHoldTime + time.Second), Received: received}},
+			want:   []HealthProblem{{"vibration", "45 m/s² is above 30 m/s²"}, {"vibration", "accelerometer clipping"}},
+		},
+		{
+			name:   "clipping a while ago",
+			health: Health{Vibration: Vibration{LastClipped: now.Add(-clippingHoldTime), Received: received}},
+		},
+	}
+	for _, test := range tests {
+		if problems := test.health.unhealthy(now); !slices.Equal(problems, test.want) {
+			t.Errorf("%s: problems %v, want %v", test.name, problems, test.want)
+		}
+	}
+}
+
+func TestVibrationClipping(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	ctx := testContext(t)
+	sendVibration := func(clipping uint32) {
+		t.Helper()
+		before := v.Health().Vibration.Received
+		a.send(1, mavlink.Vibration{VibrationX: 5, Clipping1: clipping})
+		err := v.waitFor(ctx, "test", "vibration", func() bool {
+			return v.health.Vibration.Received != before
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// clipping before the first report isn't news
+	sendVibration(7)
+	if vibration := v.Health().Vibration; !vibration.LastClipped.IsZero() || vibration.Clipping != [3]uint32{0, 7, 0} {
+		t.Errorf("first report clipped %v at %v, want 0 7 0 and not since", vibration.Clipping, vibration.LastClipped)
+	}
+	sendVibration(7)
+	if problems := v.Unhealthy(); len(problems) != 0 {
+		t.Errorf("problems %v without new clipping", problems)
+	}
+	sendVibration(8)
+	vibration := v.Health().Vibration
+	if !vibration.LastClipped.Equal(vibration.Received) {
+		t.Errorf("last clipped at %v, want when the count went up at %v", vibration.LastClipped, vibration.Received)
+	}
+	// and it is remembered once the count stops going up
+	sendVibration(8)
+	if last := v.Health().Vibration.LastClipped; !last.Equal(vibration.LastClipped) {
+		t.Errorf("last clipped at %v after the count stopped, want %v", last, vibration.LastClipped)
+	}
+	if problems := v.Unhealthy(); !slices.Equal(problems, []HealthProblem{{"vibration", "accelerometer clipping"}}) {
+		t.Errorf("problems %v, want accelerometer clipping", problems)
+	}
+}
+
+func TestHealthWithSimulator(t *testing.T) {
+	s, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+	waitForProblems := func(what string, want ...HealthProblem) {
+		t.Helper()
+		err := v.waitFor(ctx, "test", what, func() bool {
+			health := v.health
+			if health.Sensors.Received.IsZero() || health.Estimator.Received.IsZero() || health.Vibration.Received.IsZero() {
+				return false
+			}
+			return slices.Equal(health.unhealthy(time.Now()), want)
+		})
+		if err != nil {
+			t.Fatalf("%v: problems %v, want %v", err, v.Unhealthy(), want)
+		}
+	}
+	waitForProblems("a healthy report")
+
+	s.SetSensorsUnhealthy(mavlink.MAV_SYS_STATUS_SENSOR_GPS)
+	s.SetVibration(12, 40, 20, true)
+	waitForProblems("problems to be reported",
+		HealthProblem{"GPS", "unhealthy"},
+		HealthProblem{"pre-arm checks", "unhealthy"},
+		HealthProblem{"vibration", "40 m/s² is above 30 m/s²"},
+		HealthProblem{"vibration", "accelerometer clipping"},
+	)
+
+	// clipping is remembered for a while after it stops
+	s.SetSensorsUnhealthy(0)
+	s.SetVibration(12, 10, 20, false)
+	waitForProblems("problems to clear", HealthProblem{"vibration", "accelerometer clipping"})
+}
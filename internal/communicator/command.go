@@ -0,0 +1,142 @@
+package communicator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How long to wait for a COMMAND_ACK before sending a command again
+const commandRetryInterval = time.Second
+
+var ErrConnectionClosed = errors.New("connection closed")
+
+// Sends a message to the vehicle over whatever transport the connection uses
+func (mc *MavlinkCommunicator) Send(msg mavlink.MavlinkMessage) error {
+	systemID, componentID := mc.Source()
+	mc.writeLock.Lock()
+	defer mc.writeLock.Unlock()
+	return mc.Encoder.EncodePacket(countingWriter{mc.transport, mc.stats}, systemID, componentID, msg)
+}
+
+// Sends a COMMAND_LONG to the target vehicle and waits for it to be
+// acknowledged. Following the command protocol, the command is resent with
+// an increasing confirmation number until a COMMAND_ACK arrives or ctx is
+// done. Acknowledgements that say the command is still in progress are
+// waited out.
+func (mc *MavlinkCommunicator) SendCommand(ctx context.Context, command uint16, params ...float32) (*mavlink.CommandAckMessage, error) {
+	targetSystem, targetComponent := mc.Target()
+	return mc.SendCommandTo(ctx, targetSystem, targetComponent, command, params...)
+}
+
+// Like SendCommand, but addressed to a particular component, such as a
+// camera or gimbal, rather than the target vehicle's autopilot
+func (mc *MavlinkCommunicator) SendCommandTo(ctx context.Context, targetSystem uint8, targetComponent uint8, command uint16, params ...float32) (*mavlink.CommandAckMessage, error) {
+	msg, err := mc.commandLong(command, params...)
+	if err != nil {
+		return nil, err
+	}
+	msg.TargetSystem, msg.TargetComponent = targetSystem, targetComponent
+
+	return mc.sendUntilAcked(ctx, targetSystem, targetComponent, command, func(retry bool) error {
+		if retry && msg.Confirmation < 255 {
+			msg.Confirmation++
+		}
+		return mc.Send(msg)
+	})
+}
+
+// Like SendCommand, but sends a COMMAND_INT, which carries params 5 and 6 as
+// integers in the given frame so that a latitude and longitude keep their
+// precision. Its target is replaced with the connection's. Having no
+// confirmation number, it is resent unchanged.
+func (mc *MavlinkCommunicator) SendCommandInt(ctx context.Context, msg mavlink.CommandInt) (*mavlink.CommandAckMessage, error) {
+	msg.TargetSystem, msg.TargetComponent = mc.Target()
+	return mc.sendUntilAcked(ctx, msg.TargetSystem, msg.TargetComponent, msg.Command, func(bool) error {
+		return mc.Send(msg)
+	})
+}
+
+// Calls send, and again with retry set every commandRetryInterval, until the
+// command is acknowledged by the component it was sent to
+func (mc *MavlinkCommunicator) sendUntilAcked(ctx context.Context, targetSystem uint8, targetComponent uint8, command uint16, send func(retry bool) error) (*mavlink.CommandAckMessage, error) {
+	acks, unsubscribe := mc.Subscribe(mavlink.MAVLINK_MSG_ID_COMMAND_ACK)
+	defer unsubscribe()
+
+	if err := send(false); err != nil {
+		return nil, err
+	}
+	retry := time.NewTicker(commandRetryInterval)
+	defer retry.Stop()
+	inProgress := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no acknowledgement for command %d: %w", command, ctx.Err())
+		case <-retry.C:
+			if inProgress {
+				continue
+			}
+			if err := send(true); err != nil {
+				return nil, err
+			}
+		case m, ok := <-acks:
+			if !ok {
+				return nil, ErrConnectionClosed
+			}
+			ack := m.(*mavlink.CommandAckMessage)
+			if ack.Command != command || (targetSystem != 0 && ack.SystemID != targetSystem) ||
+				(targetComponent != 0 && ack.ComponentID != targetComponent) {
+				continue
+			}
+			// acknowledgements saying who they are for, which older
+			// autopilots leave out, may be for another ground station
+			sourceSystem, sourceComponent := mc.Source()
+			if (ack.TargetSystem != 0 && ack.TargetSystem != sourceSystem) ||
+				(ack.TargetComponent != 0 && ack.TargetComponent != sourceComponent) {
+				continue
+			}
+			if ack.Result == mavlink.MAV_RESULT_IN_PROGRESS {
+				inProgress = true
+				continue
+			}
+			return ack, nil
+		}
+	}
+}
+
+// Builds a COMMAND_LONG addressed to the target vehicle
+func (mc *MavlinkCommunicator) commandLong(command uint16, params ...float32) (mavlink.CommandLong, error) {
+	if len(params) > 7 {
+		return mavlink.CommandLong{}, fmt.Errorf("COMMAND_LONG takes at most 7 params, got %d", len(params))
+	}
+	var p [7]float32
+	copy(p[:], params)
+	targetSystem, targetComponent := mc.Target()
+	return mavlink.CommandLong{
+		Param1:          p[0],
+		Param2:          p[1],
+		Param3:          p[2],
+		Param4:          p[3],
+		Param5:          p[4],
+		Param6:          p[5],
+		Param7:          p[6],
+		Command:         command,
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		Confirmation:    0,
+	}, nil
+}
+
+// Sends a COMMAND_LONG once without waiting for it to be acknowledged
+func (mc *MavlinkCommunicator) sendCommandOnce(command uint16, params ...float32) error {
+	msg, err := mc.commandLong(command, params...)
+	if err != nil {
+		return err
+	}
+	return mc.Send(msg)
+}
@@ -0,0 +1,68 @@
+package communicator
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tarm/serial"
+)
+
+const defaultBaud = 57600
+
+// Opens a transport from a connection URL:
+//
+//	serial:///dev/ttyUSB0:57600  serial port, the baud rate defaults to 57600
+//	serial://COM3:115200         serial port on Windows
+//	tcp://127.0.0.1:5760         TCP client, e.g. ArduPilot SITL
+//	udp://:14550                 listen for UDP, replying to whoever sent last
+//	udpout://192.168.1.10:14550  send UDP to a fixed address
+//	tlog:///path/to/flight.tlog  replay a telemetry log, ?speed=0 replays
+//	                             as fast as possible
+func Dial(connection string) (Transport, error) {
+	u, err := url.Parse(connection)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection URL %q: %w", connection, err)
+	}
+
+	switch u.Scheme {
+	case "serial":
+		name, baud, err := splitBaud(u.Host + u.Path)
+		if err != nil {
+			return nil, err
+		}
+		return serial.OpenPort(&serial.Config{Name: name, Baud: baud})
+	case "tcp":
+		return net.Dial("tcp", u.Host)
+	case "udp":
+		return ListenUDP(u.Host)
+	case "udpout":
+		return net.Dial("udp", u.Host)
+	case "tlog":
+		speed := ReplayRealTime
+		if s := u.Query().Get("speed"); s != "" {
+			speed, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid replay speed %q", s)
+			}
+		}
+		return NewTlogReplay(u.Host+u.Path, speed)
+	default:
+		return nil, fmt.Errorf("unsupported connection type %q, use serial, tcp, udp, udpout or tlog", u.Scheme)
+	}
+}
+
+// Splits "/dev/ttyUSB0:57600" into the port name and baud rate
+func splitBaud(port string) (string, int, error) {
+	i := strings.LastIndex(port, ":")
+	if i < 0 {
+		return port, defaultBaud, nil
+	}
+	baud, err := strconv.Atoi(port[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid baud rate %q", port[i+1:])
+	}
+	return port[:i], baud, nil
+}
@@ -1,9 +1,13 @@
 package communicator
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
+	"os"
+	"sync"
 
 	"github.com/arducrow/go-mavcom/internal/mavlink"
 
@@ -15,53 +19,125 @@ type MavlinkCommunicator struct {
 	listenPort    string
 	Conn          net.Conn
 	useNetwork    bool
+	transport     Transport
+	frameReader   *mavlink.FrameReader
 	msgChan       chan mavlink.DecodedMessage
 	CurrentStates CurrentStates
 	SeqNumber     uint8
 	Encoder       *mavlink.Encoder
-	// readWriteLock sync.Mutex
+	// IDs this end of the link sends as, by default those of a ground station
+	SystemID    uint8
+	ComponentID uint8
+	// kept apart from writeLock so that the read loop can look up the source
+	// while a write is stuck on a slow link
+	sourceLock sync.Mutex
+	// IDs of the vehicle that commands are sent to
+	targetSystem    uint8
+	targetComponent uint8
+	targetLock      sync.Mutex
+	subscriptions   map[*subscription]bool
+	subscribeLock   sync.Mutex
+	recorder        io.Writer
+	recordLock      sync.Mutex
+	writeLock       sync.Mutex
+	stats           *statsCollector
+	// Where problems reading the link are reported, set before calling
+	// Start
+	Logger *slog.Logger
 }
 
 type CurrentStates struct {
 	GlobalPositionIntState mavlink.DecodedPayload
 	VFRHUDState            mavlink.DecodedPayload
 	Heartbeat              mavlink.DecodedPayload
+	SysStatusState         mavlink.DecodedPayload
+	ExtendedSysState       mavlink.DecodedPayload
 }
 
 func NewMavlinkCommunicator(portName string, baud int, useNetwork bool) (*MavlinkCommunicator, error) {
-	var port *serial.Port
-	var conn net.Conn
-	var err error
-
 	if useNetwork {
 		// udpAddr, err := net.ResolveUDPAddr("udp", portName)
-		conn, err = net.Dial("tcp", portName)
+		conn, err := net.Dial("tcp", portName)
 		if err != nil {
 			return nil, err
 		}
 		// conn, err = net.ListenUDP("udp", udpAddr)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		port, err = serial.OpenPort(&serial.Config{Name: portName, Baud: baud})
-		if err != nil {
-			return nil, err
-		}
+		return NewMavlinkCommunicatorFromTransport(conn), nil
+	}
+
+	port, err := serial.OpenPort(&serial.Config{Name: portName, Baud: baud})
+	if err != nil {
+		return nil, err
 	}
+	return NewMavlinkCommunicatorFromTransport(port), nil
+}
+
+// Creates a communicator on top of an already opened transport. Network
+// connections keep being exposed through Conn so that commands can be sent
+// over them.
+func NewMavlinkCommunicatorFromTransport(transport Transport) *MavlinkCommunicator {
 	NewMavlinkCommunicator := &MavlinkCommunicator{
-		serialPort: port,
-		Conn:       conn,
-		useNetwork: useNetwork,
-		msgChan:    make(chan mavlink.DecodedMessage),
-		SeqNumber:  uint8(0),
+		transport:   transport,
+		frameReader: mavlink.NewFrameReader(transport),
+		msgChan:     make(chan mavlink.DecodedMessage),
+		SeqNumber:   uint8(0),
+		// MAV_COMP_ID_MISSIONPLANNER on the conventional ground station system
+		SystemID:        255,
+		ComponentID:     190,
+		targetSystem:    1,
+		targetComponent: 1,
+		subscriptions:   make(map[*subscription]bool),
+		stats:           newStatsCollector(),
+		Logger:          slog.Default(),
+	}
+	NewMavlinkCommunicator.frameReader.OnCRCFailure = func([]byte) {
+		NewMavlinkCommunicator.stats.crcFailure()
+	}
+	switch t := transport.(type) {
+	case net.Conn:
+		NewMavlinkCommunicator.Conn = t
+		NewMavlinkCommunicator.useNetwork = true
+	case *serial.Port:
+		NewMavlinkCommunicator.serialPort = t
 	}
 
 	encoder := mavlink.NewEncoder()
 	NewMavlinkCommunicator.Encoder = encoder
 	encoder.MavComInterface = NewMavlinkCommunicator
 
-	return NewMavlinkCommunicator, nil
+	return NewMavlinkCommunicator
+}
+
+// Sets the system and component that commands are addressed to, normally
+// learnt from the vehicle's heartbeat
+func (mc *MavlinkCommunicator) SetTarget(systemID uint8, componentID uint8) {
+	mc.targetLock.Lock()
+	defer mc.targetLock.Unlock()
+	mc.targetSystem = systemID
+	mc.targetComponent = componentID
+}
+
+// Returns the system and component that commands are addressed to
+func (mc *MavlinkCommunicator) Target() (uint8, uint8) {
+	mc.targetLock.Lock()
+	defer mc.targetLock.Unlock()
+	return mc.targetSystem, mc.targetComponent
+}
+
+// Sets the system and component this end of the link sends as, such as
+// those of a companion computer on the vehicle
+func (mc *MavlinkCommunicator) SetSource(systemID uint8, componentID uint8) {
+	mc.sourceLock.Lock()
+	defer mc.sourceLock.Unlock()
+	mc.SystemID = systemID
+	mc.ComponentID = componentID
+}
+
+// Returns the system and component this end of the link sends as
+func (mc *MavlinkCommunicator) Source() (uint8, uint8) {
+	mc.sourceLock.Lock()
+	defer mc.sourceLock.Unlock()
+	return mc.SystemID, mc.ComponentID
 }
 
 func (mc *MavlinkCommunicator) GetSequenceNumber() uint8 {
@@ -72,40 +148,21 @@ func (mc *MavlinkCommunicator) IncrementSequenceNumber() {
 	seqNumber := mc.SeqNumber
 	if seqNumber == 0xFF {
 		mc.SeqNumber = 0
-		fmt.Println("Sequence number reset")
 	} else {
 		mc.SeqNumber++
 	}
 }
 
+// Reads the next whole frame from the transport
 func (mc *MavlinkCommunicator) readMessage() ([]byte, error) {
-	var source io.Reader
-	const minMsgLength = 8
-
-	if mc.useNetwork {
-		source = mc.Conn
-	} else {
-		source = mc.serialPort
-	}
-
-	buf := make([]byte, 1024)
-	n, err := source.Read(buf)
-	if n < minMsgLength {
-		return nil, fmt.Errorf("message too short")
-	}
-	if err != nil {
-		return nil, err
-	}
-
 	// TODO - Check if the message is a valid mavlink message and parse it
-
-	return buf[:n], nil
+	return mc.frameReader.ReadFrame()
 }
 
 // Close the connection
 func (mc *MavlinkCommunicator) Close() error {
-	if mc.serialPort != nil {
-		return mc.serialPort.Close()
+	if mc.transport != nil {
+		return mc.transport.Close()
 	}
 	return nil
 }
@@ -117,7 +174,7 @@ func (mc *MavlinkCommunicator) Start() {
 	if mc.useNetwork {
 		mc.listenPort = mc.Conn.LocalAddr().String()
 	} else {
-		mc.listenPort = fmt.Sprintf("%v", mc.serialPort)
+		mc.listenPort = fmt.Sprintf("%v", mc.transport)
 	}
 
 	// streamIDs := []uint8{0, 1, 2, 3, 4, 6, 10} // Add other stream IDs as needed
@@ -127,38 +184,50 @@ func (mc *MavlinkCommunicator) Start() {
 	// 		fmt.Println("Error requesting data stream: ", err)
 	// 	}
 	// }
-	fmt.Printf("Starting MavlinkCommunicator, listening on %v\n", mc.listenPort)
+	mc.Logger.Debug("starting MavlinkCommunicator", "listening", mc.listenPort)
 	go func() {
+		// the transport has run dry (closed connection or end of a log
+		// replay), let the consumer of Messages know there is nothing more
+		defer close(mc.msgChan)
+		defer mc.closeSubscriptions()
 		for {
 			msg, err := mc.readMessage()
 			// v := mc.Encoder.GetSequenceNumber()
 			// fmt.Println("Sequence number in read loop: ", v)
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) || errors.Is(err, os.ErrClosed) {
+				mc.Logger.Info("connection closed", "err", err)
+				return
+			}
 			if err != nil {
-				fmt.Println("Error reading message: ", err)
+				mc.Logger.Warn("error reading message", "err", err)
 				continue
 			}
+			mc.record(msg)
 			m, err := mavlink.NewRawMessage(msg)
 			if err != nil {
-				fmt.Println("Error parsing message:", err)
+				mc.Logger.Warn("error parsing message", "err", err)
 				continue
 			}
 
 			// fmt.Println("Message ID: ", m.MessageID)
 
 			if m.MessageID == 0 {
-				fmt.Println("Heartbeat received")
+				mc.Logger.Debug("heartbeat received", "system", m.SystemID, "component", m.ComponentID)
 			}
-			// if the message ID is not 0, 33 or 74 then ignore it
-			if m.MessageID != 0 && m.MessageID != 33 && m.MessageID != 74 {
+			decodedMessage, err := mavlink.DecodeMessage(m)
+			// ignore messages that there is no decoder for
+			if errors.Is(err, mavlink.ErrUnknownMessage) {
+				mc.stats.received(m, len(msg), "")
 				continue
 			}
-			decodedMessage, err := mavlink.DecodeMessage(m)
 			if err != nil {
-				fmt.Println("Error decoding message: ", err)
+				mc.Logger.Warn("error decoding message", "id", m.MessageID, "err", err)
 				continue
 			}
+			mc.stats.received(m, len(msg), decodedMessage.GetMessageName())
 			// fmt.Println(decodedMessage.GetMessageName())
 
+			mc.publish(decodedMessage)
 			mc.msgChan <- decodedMessage
 
 		}
@@ -166,93 +235,45 @@ func (mc *MavlinkCommunicator) Start() {
 
 }
 
-func (mc *MavlinkCommunicator) SendArm() {
-	msg := mavlink.CommandLong{
-		Param1:          1,
-		Param2:          0,
-		Param3:          0,
-		Param4:          0,
-		Param5:          0,
-		Param6:          0,
-		Param7:          0,
-		Command:         400,
-		TargetSystem:    1,
-		TargetComponent: 1,
-		Confirmation:    0,
-	}
-	fmt.Println("Connection: ", mc.Conn.LocalAddr())
-	err := mc.Encoder.EncodePacket(mc.Conn, 1, 0, msg)
-	if err != nil {
-		fmt.Println("Error sending message: ", err)
-	}
-
+// Sends an arm command without waiting for it to be acknowledged.
+//
+// Deprecated: use Vehicle.Arm, which checks that the vehicle armed.
+func (mc *MavlinkCommunicator) SendArm() error {
+	return mc.sendCommandOnce(mavlink.MAV_CMD_COMPONENT_ARM_DISARM, 1)
 }
 
-func (mc *MavlinkCommunicator) SendTakeoff(alt float32) {
-	msg := mavlink.CommandLong{
-		Param1:          0,
-		Param2:          0,
-		Param3:          0,
-		Param4:          0,
-		Param5:          0,
-		Param6:          0,
-		Param7:          alt,
-		Command:         mavlink.MAV_CMD_NAV_TAKEOFF,
-		TargetSystem:    1,
-		TargetComponent: 1,
-		Confirmation:    0,
-	}
-	err := mc.Encoder.EncodePacket(mc.Conn, 1, 0, msg)
-	if err != nil {
-		fmt.Println("Error sending message: ", err)
-	}
+// Sends a takeoff command without waiting for it to be acknowledged.
+//
+// Deprecated: use Vehicle.Takeoff, which checks that the vehicle climbed.
+func (mc *MavlinkCommunicator) SendTakeoff(alt float32) error {
+	return mc.sendCommandOnce(mavlink.MAV_CMD_NAV_TAKEOFF, 0, 0, 0, 0, 0, 0, alt)
 }
 
-func (mc *MavlinkCommunicator) SendSetModeGuidedArmed() {
-	const MAV_MODE_FLAG_CUSTOM_MODE_ENABLED = 1 << 7
-	const MAV_MODE_FLAG_SAFETY_ARMED = 1 << 6
-	const GUIDED_MODE = 4
-
-	baseMode := MAV_MODE_FLAG_CUSTOM_MODE_ENABLED | MAV_MODE_FLAG_SAFETY_ARMED
-
-	msg := mavlink.CommandLong{
-		Param1:          float32(baseMode),
-		Param2:          GUIDED_MODE,
-		Param3:          0,
-		Param4:          0,
-		Param5:          0,
-		Param6:          0,
-		Param7:          0,
-		Command:         176, // MAV_CMD_DO_SET_MODE
-		TargetSystem:    1,
-		TargetComponent: 0,
-		Confirmation:    0,
-	}
-	fmt.Printf("Sending GUIDED mode command with baseMode: %d, customMode: %d\n", baseMode, GUIDED_MODE)
-	err := mc.Encoder.EncodePacket(mc.Conn, 1, 0, msg)
-	if err != nil {
-		fmt.Println("Error sending message: ", err)
-	}
+// Switches an ArduCopter into GUIDED without waiting for it to be
+// acknowledged. Despite the name it does not arm the vehicle.
+//
+// Deprecated: use Vehicle.SetMode and Vehicle.Arm.
+func (mc *MavlinkCommunicator) SendSetModeGuidedArmed() error {
+	const guidedMode = 4
+	return mc.sendCommandOnce(mavlink.MAV_CMD_DO_SET_MODE, mavlink.MAV_MODE_FLAG_CUSTOM_MODE_ENABLED, guidedMode)
 }
 
-func (mc *MavlinkCommunicator) RequestDataStream(streamID uint8, rate uint16) {
-	msg := mavlink.CommandLong{
-		Param1:          float32(streamID),
-		Param2:          float32(rate),
-		Param3:          0,
-		Param4:          0,
-		Param5:          0,
-		Param6:          0,
-		Param7:          0,
-		Command:         mavlink.MAV_CMD_SET_MESSAGE_INTERVAL,
-		TargetSystem:    1,
-		TargetComponent: 1,
-		Confirmation:    0,
+// Asks for one of the legacy MAV_DATA_STREAM groups of messages to be sent
+// at rate Hz, or stops it if rate is 0. This predates
+// MAV_CMD_SET_MESSAGE_INTERVAL and is only needed for older firmware. The
+// vehicle does not acknowledge it.
+func (mc *MavlinkCommunicator) RequestDataStream(streamID uint8, rate uint16) error {
+	targetSystem, targetComponent := mc.Target()
+	msg := mavlink.RequestDataStream{
+		ReqMessageRate:  rate,
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		ReqStreamID:     streamID,
 	}
-	err := mc.Encoder.EncodePacket(mc.Conn, 1, 0, msg)
-	if err != nil {
-		fmt.Println("Error sending message: ", err)
+	if rate > 0 {
+		msg.StartStop = 1
 	}
+	return mc.Send(msg)
 }
 
 func (mc *MavlinkCommunicator) Messages() <-chan mavlink.DecodedMessage {
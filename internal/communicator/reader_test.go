@@ -0,0 +1,62 @@
+package communicator
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// A link whose writes don't complete until it is closed, like a serial port
+// with a full buffer
+type stalledTransport struct {
+	writing chan struct{}
+	closed  chan struct{}
+}
+
+func newStalledTransport() *stalledTransport {
+	return &stalledTransport{writing: make(chan struct{}, 1), closed: make(chan struct{})}
+}
+
+func (s *stalledTransport) Read([]byte) (int, error) {
+	<-s.closed
+	return 0, io.EOF
+}
+
+func (s *stalledTransport) Write([]byte) (int, error) {
+	select {
+	case s.writing <- struct{}{}:
+	default:
+	}
+	<-s.closed
+	return 0, io.ErrClosedPipe
+}
+
+func (s *stalledTransport) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestSourceWhileWriteStalled(t *testing.T) {
+	transport := newStalledTransport()
+	mc := NewMavlinkCommunicatorFromTransport(transport)
+	defer transport.Close()
+	go mc.Send(mavlink.Heartbeat{})
+	<-transport.writing
+
+	done := make(chan struct{})
+	go func() {
+		mc.SetSource(1, 191)
+		mc.Source()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("source blocked by a stalled write")
+	}
+	if system, component := mc.Source(); system != 1 || component != 191 {
+		t.Errorf("source %d/%d, want 1/191", system, component)
+	}
+}
@@ -0,0 +1,223 @@
+package communicator
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// Rates are worked out over windows of this length, so a message that stops
+// arriving drops towards zero after a window or two
+const rateWindow = time.Second
+
+// Gaps in a sender's sequence numbers of this many frames or more are taken
+// to be duplicates or reordering rather than loss
+const maxSequenceGap = 128
+
+// LinkStats is a snapshot of everything that has crossed a connection since
+// it was created
+type LinkStats struct {
+	Since     time.Time
+	BytesIn   uint64
+	BytesOut  uint64
+	FramesIn  uint64
+	FramesOut uint64
+	// Frames of decoded messages whose checksum was wrong, these are dropped
+	// and reading resyncs from the byte after their start
+	CRCFailures uint64
+	// Frames with a message ID that there is no decoder for
+	UnknownMessages uint64
+	// Keyed by message ID, including those that could not be decoded
+	Messages map[int]MessageStats
+	// One entry for every system and component heard from, ordered by
+	// system then component
+	Sources []SourceStats
+}
+
+type MessageStats struct {
+	Name  string // empty if the message could not be decoded
+	Count uint64
+	Rate  float64 // messages per second
+}
+
+// Loss is worked out from the gaps in each sender's sequence numbers
+type SourceStats struct {
+	SystemID    uint8
+	ComponentID uint8
+	Received    uint64
+	Lost        uint64
+	LossPercent float64
+}
+
+type messageCounter struct {
+	name        string
+	count       uint64
+	windowStart time.Time
+	windowCount uint64
+	rate        float64
+}
+
+type sourceKey struct {
+	systemID    uint8
+	componentID uint8
+}
+
+type sourceCounter struct {
+	lastSequence uint8
+	received     uint64
+	lost         uint64
+}
+
+type statsCollector struct {
+	since       time.Time
+	bytesIn     uint64
+	bytesOut    uint64
+	framesIn    uint64
+	framesOut   uint64
+	crcFailures uint64
+	unknown     uint64
+	messages    map[int]*messageCounter
+	sources     map[sourceKey]*sourceCounter
+	lock        sync.Mutex
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		since:    time.Now(),
+		messages: make(map[int]*messageCounter),
+		sources:  make(map[sourceKey]*sourceCounter),
+	}
+}
+
+// Counts a frame that arrived intact. name is empty for messages that could
+// not be decoded.
+func (s *statsCollector) received(msg *mavlink.RawMessage, frameLength int, name string) {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.bytesIn += uint64(frameLength)
+	s.framesIn++
+	if name == "" {
+		s.unknown++
+	}
+
+	counter, ok := s.messages[msg.MessageID]
+	if !ok {
+		counter = &messageCounter{windowStart: now}
+		s.messages[msg.MessageID] = counter
+	}
+	if name != "" {
+		counter.name = name
+	}
+	counter.count++
+	counter.windowCount++
+	if elapsed := now.Sub(counter.windowStart); elapsed >= rateWindow {
+		counter.rate = float64(counter.windowCount) / elapsed.Seconds()
+		counter.windowStart = now
+		counter.windowCount = 0
+	}
+
+	key := sourceKey{msg.SystemID, msg.ComponentID}
+	source, ok := s.sources[key]
+	if !ok {
+		s.sources[key] = &sourceCounter{lastSequence: msg.Sequence, received: 1}
+		return
+	}
+	source.received++
+	// the sequence number wraps at 256, anything skipped over was lost. A
+	// frame that seems to skip over more than half of the sequence is far
+	// more likely a duplicate or one that arrived out of order, those don't
+	// lose anything and the newest sequence number is kept.
+	skipped := msg.Sequence - source.lastSequence - 1
+	if skipped >= maxSequenceGap {
+		return
+	}
+	source.lost += uint64(skipped)
+	source.lastSequence = msg.Sequence
+}
+
+// Counts a frame that was dropped because its checksum was wrong
+// The bytes of a dropped frame are read again while resyncing, so only the
+// failure is counted
+func (s *statsCollector) crcFailure() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.crcFailures++
+}
+
+func (s *statsCollector) sent(frameLength int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bytesOut += uint64(frameLength)
+	s.framesOut++
+}
+
+func (s *statsCollector) snapshot() LinkStats {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := LinkStats{
+		Since:           s.since,
+		BytesIn:         s.bytesIn,
+		BytesOut:        s.bytesOut,
+		FramesIn:        s.framesIn,
+		FramesOut:       s.framesOut,
+		CRCFailures:     s.crcFailures,
+		UnknownMessages: s.unknown,
+		Messages:        make(map[int]MessageStats, len(s.messages)),
+		Sources:         make([]SourceStats, 0, len(s.sources)),
+	}
+	for id, counter := range s.messages {
+		rate := counter.rate
+		if elapsed := now.Sub(counter.windowStart); elapsed >= rateWindow {
+			// nothing has arrived for a while, so the last window is stale
+			rate = float64(counter.windowCount) / elapsed.Seconds()
+		}
+		stats.Messages[id] = MessageStats{Name: counter.name, Count: counter.count, Rate: rate}
+	}
+	for key, source := range s.sources {
+		var loss float64
+		if total := source.received + source.lost; total > 0 {
+			loss = 100 * float64(source.lost) / float64(total)
+		}
+		stats.Sources = append(stats.Sources, SourceStats{
+			SystemID:    key.systemID,
+			ComponentID: key.componentID,
+			Received:    source.received,
+			Lost:        source.lost,
+			LossPercent: loss,
+		})
+	}
+	sort.Slice(stats.Sources, func(i, j int) bool {
+		a, b := stats.Sources[i], stats.Sources[j]
+		if a.SystemID != b.SystemID {
+			return a.SystemID < b.SystemID
+		}
+		return a.ComponentID < b.ComponentID
+	})
+	return stats
+}
+
+// Returns a snapshot of the connection's statistics
+func (mc *MavlinkCommunicator) Stats() LinkStats {
+	return mc.stats.snapshot()
+}
+
+// Counts the bytes of each frame written through it
+type countingWriter struct {
+	writer io.Writer
+	stats  *statsCollector
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	if err == nil {
+		w.stats.sent(n)
+	}
+	return n, err
+}
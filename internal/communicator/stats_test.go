@@ -0,0 +1,113 @@
+package communicator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+func TestStatsLoss(t *testing.T) {
+	tests := []struct {
+		name      string
+		sequences []uint8
+		lost      uint64
+	}{
+		{name: "in order", sequences: []uint8{10, 11, 12, 13}, lost: 0},
+		{name: "gaps", sequences: []uint8{10, 12, 13, 17}, lost: 4},
+		{name: "wrapping", sequences: []uint8{253, 254, 1, 2}, lost: 2},
+		{name: "duplicates", sequences: []uint8{10, 11, 11, 12, 12, 12}, lost: 0},
+		{name: "reordered", sequences: []uint8{10, 12, 11, 13}, lost: 1},
+		{name: "reordered over the wrap", sequences: []uint8{254, 0, 255, 1}, lost: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newStatsCollector()
+			for _, seq := range test.sequences {
+				s.received(&mavlink.RawMessage{Sequence: seq, SystemID: 1, ComponentID: 1}, 17, "HEARTBEAT")
+			}
+			stats := s.snapshot()
+			if len(stats.Sources) != 1 {
+				t.Fatalf("%d sources, want 1", len(stats.Sources))
+			}
+			source := stats.Sources[0]
+			if source.Received != uint64(len(test.sequences)) || source.Lost != test.lost {
+				t.Errorf("%d received and %d lost, want %d and %d", source.Received, source.Lost, len(test.sequences), test.lost)
+			}
+			want := 100 * float64(test.lost) / float64(uint64(len(test.sequences))+test.lost)
+			if source.LossPercent != want {
+				t.Errorf("%v%% loss, want %v%%", source.LossPercent, want)
+			}
+		})
+	}
+}
+
+func TestStatsSourcesCountedSeparately(t *testing.T) {
+	s := newStatsCollector()
+	for seq := uint8(0); seq < 4; seq++ {
+		s.received(&mavlink.RawMessage{Sequence: seq, SystemID: 1, ComponentID: 1}, 17, "HEARTBEAT")
+		// the camera's sequence numbers are its own, and it loses every
+		// other frame
+		s.received(&mavlink.RawMessage{Sequence: 2 * seq, SystemID: 1, ComponentID: 100}, 17, "HEARTBEAT")
+	}
+	stats := s.snapshot()
+	if len(stats.Sources) != 2 {
+		t.Fatalf("%d sources, want 2", len(stats.Sources))
+	}
+	if autopilot := stats.Sources[0]; autopilot.ComponentID != 1 || autopilot.Lost != 0 {
+		t.Errorf("first source %d with %d lost, want the autopilot with none", autopilot.ComponentID, autopilot.Lost)
+	}
+	if camera := stats.Sources[1]; camera.ComponentID != 100 || camera.Lost != 3 {
+		t.Errorf("second source %d with %d lost, want the camera with 3", camera.ComponentID, camera.Lost)
+	}
+}
+
+func TestStatsUnknownMessages(t *testing.T) {
+	s := newStatsCollector()
+	s.received(&mavlink.RawMessage{MessageID: 0, Sequence: 0}, 17, "HEARTBEAT")
+	s.received(&mavlink.RawMessage{MessageID: 50000, Sequence: 1}, 14, "")
+	s.received(&mavlink.RawMessage{MessageID: 50000, Sequence: 2}, 14, "")
+
+	stats := s.snapshot()
+	if stats.FramesIn != 3 || stats.BytesIn != 45 {
+		t.Errorf("%d frames and %d bytes in, want 3 and 45", stats.FramesIn, stats.BytesIn)
+	}
+	if stats.UnknownMessages != 2 {
+		t.Errorf("%d unknown messages, want 2", stats.UnknownMessages)
+	}
+	if unknown := stats.Messages[50000]; unknown.Name != "" || unknown.Count != 2 {
+		t.Errorf("message 50000 counted as %q %d times, want unnamed and 2", unknown.Name, unknown.Count)
+	}
+	if heartbeat := stats.Messages[0]; heartbeat.Name != "HEARTBEAT" || heartbeat.Count != 1 {
+		t.Errorf("message 0 counted as %q %d times, want HEARTBEAT once", heartbeat.Name, heartbeat.Count)
+	}
+}
+
+func TestStatsRate(t *testing.T) {
+	s := newStatsCollector()
+	for seq := uint8(0); seq < 10; seq++ {
+		s.received(&mavlink.RawMessage{MessageID: 0, Sequence: seq}, 17, "HEARTBEAT")
+	}
+	if rate := s.snapshot().Messages[0].Rate; rate != 0 {
+		t.Errorf("rate %v before a window has passed, want 0", rate)
+	}
+
+	time.Sleep(rateWindow)
+	// the window is stale, so the snapshot works the rate out itself
+	rate := s.snapshot().Messages[0].Rate
+	if rate <= 5 || rate > 10 {
+		t.Errorf("rate %v after 10 messages in a window, want close to 10", rate)
+	}
+
+	// the message that ends the window sets the rate until the next one ends
+	s.received(&mavlink.RawMessage{MessageID: 0, Sequence: 10}, 17, "HEARTBEAT")
+	rate = s.snapshot().Messages[0].Rate
+	if rate <= 5 || rate > 11 {
+		t.Errorf("rate %v after 11 messages in a window, want close to 11", rate)
+	}
+
+	time.Sleep(rateWindow)
+	if rate := s.snapshot().Messages[0].Rate; rate != 0 {
+		t.Errorf("rate %v after the message stopped, want 0", rate)
+	}
+}
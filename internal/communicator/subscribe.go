@@ -0,0 +1,72 @@
+package communicator
+
+import "github.com/arducrow/go-mavcom/internal/mavlink"
+
+// How many messages a subscriber can fall behind by before messages are
+// dropped. Large enough to hold a burst of parameters or mission items.
+const subscriptionBuffer = 256
+
+type subscription struct {
+	ids      map[int]bool
+	messages chan mavlink.DecodedMessage
+}
+
+// Returns a channel that receives every decoded message with one of the
+// given IDs, or every message if no IDs are given, along with a function that
+// ends the subscription. Messages keep flowing to Messages as well, so
+// request/response exchanges can wait for their replies without taking them
+// away from the vehicle. The channel is closed when the subscription ends or
+// the connection closes.
+func (mc *MavlinkCommunicator) Subscribe(ids ...int) (<-chan mavlink.DecodedMessage, func()) {
+	sub := &subscription{
+		ids:      make(map[int]bool),
+		messages: make(chan mavlink.DecodedMessage, subscriptionBuffer),
+	}
+	for _, id := range ids {
+		sub.ids[id] = true
+	}
+
+	mc.subscribeLock.Lock()
+	if mc.subscriptions == nil {
+		// the connection has already closed
+		close(sub.messages)
+	} else {
+		mc.subscriptions[sub] = true
+	}
+	mc.subscribeLock.Unlock()
+
+	unsubscribe := func() {
+		mc.subscribeLock.Lock()
+		defer mc.subscribeLock.Unlock()
+		if mc.subscriptions[sub] {
+			delete(mc.subscriptions, sub)
+			close(sub.messages)
+		}
+	}
+	return sub.messages, unsubscribe
+}
+
+// Hands a message to every interested subscriber, dropping it for any that
+// have fallen too far behind
+func (mc *MavlinkCommunicator) publish(msg mavlink.DecodedMessage) {
+	mc.subscribeLock.Lock()
+	defer mc.subscribeLock.Unlock()
+	for sub := range mc.subscriptions {
+		if len(sub.ids) > 0 && !sub.ids[msg.GetMessageID()] {
+			continue
+		}
+		select {
+		case sub.messages <- msg:
+		default:
+		}
+	}
+}
+
+func (mc *MavlinkCommunicator) closeSubscriptions() {
+	mc.subscribeLock.Lock()
+	defer mc.subscribeLock.Unlock()
+	for sub := range mc.subscriptions {
+		close(sub.messages)
+	}
+	mc.subscriptions = nil
+}
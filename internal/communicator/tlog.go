@@ -0,0 +1,287 @@
+package communicator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// Replay a log at the speed it was recorded
+	ReplayRealTime = 1.0
+	// Replay a log without waiting between frames
+	ReplayAsFastAsPossible = 0.0
+)
+
+// A single frame in a telemetry log. Stamp is the time the frame was
+// recorded in microseconds since the unix epoch.
+type tlogRecord struct {
+	stamp  uint64
+	offset int64
+	length int
+}
+
+// TlogReplay is a Transport that plays back a recorded .tlog file. Each call
+// to Read returns exactly one MAVLink frame, paced according to the time it
+// was recorded and the replay speed. Anything written to it is discarded.
+// Vehicles reading from a replay send nothing of their own accord and take
+// the time from the log, see Now.
+type TlogReplay struct {
+	path  string
+	file  *os.File
+	index []tlogRecord
+	next  int
+	// the time in the log, in microseconds since the unix epoch
+	now      uint64
+	speed    float64
+	anchored bool
+	// wall clock time and log time that the current pacing is measured from
+	anchorWall  time.Time
+	anchorStamp uint64
+	closed      bool
+	wake        chan struct{}
+	lock        sync.Mutex
+}
+
+// Opens a telemetry log for replay. A speed of 1 replays in real time, 2 at
+// double speed and so on, while 0 replays as fast as the reader consumes it.
+func NewTlogReplay(path string, speed float64) (*TlogReplay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	index, err := indexTlog(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if len(index) == 0 {
+		file.Close()
+		return nil, fmt.Errorf("no frames found in %s", path)
+	}
+	return &TlogReplay{
+		path:  path,
+		file:  file,
+		index: index,
+		now:   index[0].stamp,
+		speed: speed,
+		wake:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Each tlog entry is an 8 byte big endian timestamp followed by the raw frame
+func indexTlog(file *os.File) ([]tlogRecord, error) {
+	var index []tlogRecord
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+	stamp := make([]byte, 8)
+	header := make([]byte, 3)
+
+	for {
+		if _, err := io.ReadFull(reader, stamp); err != nil {
+			// a truncated final entry is expected if recording was cut short
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return index, nil
+			}
+			return nil, err
+		}
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return index, nil
+			}
+			return nil, err
+		}
+		length := mavlink.FrameLength(header[0], header[1], header[2])
+		if length == 0 {
+			return nil, fmt.Errorf("no frame start at offset %d", offset+8)
+		}
+		if _, err := reader.Discard(length - len(header)); err != nil {
+			return index, nil
+		}
+		index = append(index, tlogRecord{
+			stamp:  binary.BigEndian.Uint64(stamp),
+			offset: offset + 8,
+			length: length,
+		})
+		offset += 8 + int64(length)
+	}
+}
+
+// Returns the next frame in the log once it is due
+func (r *TlogReplay) Read(p []byte) (int, error) {
+	for {
+		r.lock.Lock()
+		if r.closed || r.next >= len(r.index) {
+			r.lock.Unlock()
+			return 0, io.EOF
+		}
+		position := r.next
+		record := r.index[position]
+		wait := r.untilDue(record.stamp)
+		r.lock.Unlock()
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-r.wake:
+				// the speed or position changed while waiting, start over
+				timer.Stop()
+				continue
+			}
+		}
+
+		r.lock.Lock()
+		if r.closed || r.next != position {
+			r.lock.Unlock()
+			continue
+		}
+		if len(p) < record.length {
+			r.lock.Unlock()
+			return 0, io.ErrShortBuffer
+		}
+		n, err := r.file.ReadAt(p[:record.length], record.offset)
+		if err != nil {
+			r.lock.Unlock()
+			return n, err
+		}
+		r.next++
+		r.now = record.stamp
+		r.lock.Unlock()
+		return n, nil
+	}
+}
+
+// How long until the frame recorded at stamp should be handed out. The first
+// frame after opening, seeking or changing speed is due immediately and
+// everything after it is paced relative to that frame.
+func (r *TlogReplay) untilDue(stamp uint64) time.Duration {
+	if r.speed <= 0 {
+		return 0
+	}
+	if !r.anchored {
+		r.anchorWall = time.Now()
+		r.anchorStamp = stamp
+		r.anchored = true
+		return 0
+	}
+	elapsed := time.Duration(int64(stamp)-int64(r.anchorStamp)) * time.Microsecond
+	return time.Until(r.anchorWall.Add(time.Duration(float64(elapsed) / r.speed)))
+}
+
+// Replays don't go anywhere, commands sent to the vehicle are dropped
+func (r *TlogReplay) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (r *TlogReplay) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.interrupt()
+	return r.file.Close()
+}
+
+// Changes the replay speed, taking effect from the next frame
+func (r *TlogReplay) SetSpeed(speed float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.speed = speed
+	r.anchored = false
+	r.interrupt()
+}
+
+// Moves the replay to the first frame recorded at or after t. Seeking past
+// the end of the log means the next Read returns io.EOF.
+func (r *TlogReplay) Seek(t time.Time) {
+	stamp := uint64(t.UnixMicro())
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.next = sort.Search(len(r.index), func(i int) bool {
+		return r.index[i].stamp >= stamp
+	})
+	r.now = stamp
+	r.anchored = false
+	r.interrupt()
+}
+
+// The time the first frame in the log was recorded
+func (r *TlogReplay) StartTime() time.Time {
+	return time.UnixMicro(int64(r.index[0].stamp))
+}
+
+// The time the last frame in the log was recorded
+func (r *TlogReplay) EndTime() time.Time {
+	return time.UnixMicro(int64(r.index[len(r.index)-1].stamp))
+}
+
+// The time in the log: when the last frame read was recorded, or the time
+// sought to. Before the first frame is read it is the start of the log.
+func (r *TlogReplay) Now() time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return time.UnixMicro(int64(r.now))
+}
+
+// The time the next frame to be replayed was recorded
+func (r *TlogReplay) Position() time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.next >= len(r.index) {
+		return r.EndTime()
+	}
+	return time.UnixMicro(int64(r.index[r.next].stamp))
+}
+
+func (r *TlogReplay) String() string {
+	return fmt.Sprintf("tlog replay %s", r.path)
+}
+
+// Wakes a Read that is waiting for its frame to come due
+func (r *TlogReplay) interrupt() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Returns the replay the connection reads from, or nil if it is a live link
+func (mc *MavlinkCommunicator) Replay() *TlogReplay {
+	replay, _ := mc.transport.(*TlogReplay)
+	return replay
+}
+
+// Starts writing every frame received to w in .tlog format so that it can be
+// replayed later, replacing any previous recording. Passing nil stops
+// recording.
+func (mc *MavlinkCommunicator) Record(w io.Writer) {
+	mc.recordLock.Lock()
+	defer mc.recordLock.Unlock()
+	mc.recorder = w
+}
+
+func (mc *MavlinkCommunicator) record(frame []byte) {
+	mc.recordLock.Lock()
+	defer mc.recordLock.Unlock()
+	if mc.recorder == nil {
+		return
+	}
+	entry := make([]byte, 8, 8+len(frame))
+	binary.BigEndian.PutUint64(entry, uint64(time.Now().UnixMicro()))
+	entry = append(entry, frame...)
+	if _, err := mc.recorder.Write(entry); err != nil {
+		mc.Logger.Error("error recording message, recording stopped", "err", err)
+		mc.recorder = nil
+	}
+}
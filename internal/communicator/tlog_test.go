@@ -0,0 +1,155 @@
+package communicator
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// A few seconds of the simulator, connecting and arming
+const testTlog = "testdata/flight.tlog"
+
+// The longest MAVLink 2 frame, signed with a full payload
+const maxFrameLength = 280
+
+func openTestTlog(t *testing.T, speed float64) *TlogReplay {
+	t.Helper()
+	replay, err := NewTlogReplay(testTlog, speed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { replay.Close() })
+	return replay
+}
+
+func readTlogFrame(t *testing.T, replay *TlogReplay) []byte {
+	t.Helper()
+	frame := make([]byte, maxFrameLength)
+	n, err := replay.Read(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame[:n]
+}
+
+// Reads frames until one recorded logTime after the first, returning how
+// long that took and how much log time it covered
+func replayFor(t *testing.T, replay *TlogReplay, logTime time.Duration) (wall time.Duration, covered time.Duration) {
+	t.Helper()
+	started := time.Now()
+	readTlogFrame(t, replay)
+	first := replay.Now()
+	for replay.Now().Sub(first) < logTime {
+		readTlogFrame(t, replay)
+	}
+	return time.Since(started), replay.Now().Sub(first)
+}
+
+func TestTlogReplaySpeeds(t *testing.T) {
+	for _, speed := range []float64{ReplayRealTime, 4} {
+		replay := openTestTlog(t, speed)
+		wall, covered := replayFor(t, replay, time.Second)
+		want := time.Duration(float64(covered) / speed)
+		if wall < want-10*time.Millisecond || wall > want+200*time.Millisecond {
+			t.Errorf("replayed %v of the log in %v at speed %v, want %v", covered, wall, speed, want)
+		}
+	}
+}
+
+func TestTlogReplayAsFastAsPossible(t *testing.T) {
+	replay := openTestTlog(t, ReplayAsFastAsPossible)
+	if !replay.Now().Equal(replay.StartTime()) {
+		t.Errorf("time %v before reading, want the start of the log %v", replay.Now(), replay.StartTime())
+	}
+	started := time.Now()
+	frames := 0
+	buffer := make([]byte, maxFrameLength)
+	for {
+		n, err := replay.Read(buffer)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mavlink.NewRawMessage(buffer[:n]); err != nil {
+			t.Fatalf("frame %d: %v", frames, err)
+		}
+		frames++
+	}
+	if frames != len(replay.index) {
+		t.Errorf("read %d frames, want %d", frames, len(replay.index))
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("replaying %v of log took %v", replay.EndTime().Sub(replay.StartTime()), elapsed)
+	}
+	if !replay.Now().Equal(replay.EndTime()) {
+		t.Errorf("time %v at the end, want the end of the log %v", replay.Now(), replay.EndTime())
+	}
+}
+
+func TestTlogReplaySpeedChange(t *testing.T) {
+	replay := openTestTlog(t, ReplayRealTime)
+	replayFor(t, replay, 200*time.Millisecond)
+	replay.SetSpeed(4)
+	wall, covered := replayFor(t, replay, time.Second)
+	if want := covered / 4; wall < want-10*time.Millisecond || wall > want+200*time.Millisecond {
+		t.Errorf("replayed %v of the log in %v after speeding up, want %v", covered, wall, want)
+	}
+}
+
+func TestTlogReplaySeek(t *testing.T) {
+	replay := openTestTlog(t, ReplayRealTime)
+	first := readTlogFrame(t, replay)
+
+	// forwards, to between two frames
+	target := replay.StartTime().Add(2*time.Second + 500*time.Microsecond)
+	replay.Seek(target)
+	if !replay.Now().Equal(target) {
+		t.Errorf("time %v after seeking, want %v", replay.Now(), target)
+	}
+	position := replay.Position()
+	if position.Before(target) || !time.UnixMicro(int64(replay.index[replay.next-1].stamp)).Before(target) {
+		t.Errorf("next frame recorded at %v after seeking to %v, want the first one after", position, target)
+	}
+	// the first frame after seeking is due straight away
+	started := time.Now()
+	readTlogFrame(t, replay)
+	if elapsed := time.Since(started); elapsed > 50*time.Millisecond {
+		t.Errorf("first frame after seeking took %v", elapsed)
+	}
+	if !replay.Now().Equal(position) {
+		t.Errorf("time %v after reading, want %v", replay.Now(), position)
+	}
+
+	// back to the start
+	replay.Seek(replay.StartTime())
+	if frame := readTlogFrame(t, replay); !bytes.Equal(frame, first) {
+		t.Errorf("read % x after seeking to the start, want % x", frame, first)
+	}
+
+	// past the end
+	replay.Seek(replay.EndTime().Add(time.Second))
+	if !replay.Position().Equal(replay.EndTime()) {
+		t.Errorf("position %v after seeking past the end, want %v", replay.Position(), replay.EndTime())
+	}
+	if _, err := replay.Read(make([]byte, maxFrameLength)); !errors.Is(err, io.EOF) {
+		t.Errorf("read after seeking past the end returned %v, want EOF", err)
+	}
+}
+
+func TestReplayOfConnection(t *testing.T) {
+	replay := openTestTlog(t, ReplayAsFastAsPossible)
+	if mc := NewMavlinkCommunicatorFromTransport(replay); mc.Replay() != replay {
+		t.Error("connection over a replay doesn't return it")
+	}
+	transport := newStalledTransport()
+	defer transport.Close()
+	if mc := NewMavlinkCommunicatorFromTransport(transport); mc.Replay() != nil {
+		t.Error("live connection returns a replay")
+	}
+}
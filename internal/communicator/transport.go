@@ -0,0 +1,10 @@
+package communicator
+
+import "io"
+
+// Transport is the byte stream a MavlinkCommunicator reads frames from and
+// writes packets to. Serial ports, network connections and telemetry log
+// replays all satisfy it.
+type Transport interface {
+	io.ReadWriteCloser
+}
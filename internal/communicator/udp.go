@@ -0,0 +1,71 @@
+package communicator
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// UDPTransport listens for MAVLink on a UDP port, as autopilots and routers
+// usually send telemetry to a ground station port rather than accepting
+// connections. Packets are sent back to whichever address was heard from
+// last, and dropped until something has been heard.
+type UDPTransport struct {
+	conn *net.UDPConn
+	peer *net.UDPAddr
+	// a datagram can hold several frames, leftovers are kept for the next Read
+	pending []byte
+	buf     []byte
+	lock    sync.Mutex
+}
+
+func ListenUDP(address string) (*UDPTransport, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPTransport{conn: conn, buf: make([]byte, 65535)}, nil
+}
+
+func (u *UDPTransport) Read(p []byte) (int, error) {
+	if len(u.pending) == 0 {
+		n, addr, err := u.conn.ReadFromUDP(u.buf)
+		if err != nil {
+			return 0, err
+		}
+		u.lock.Lock()
+		u.peer = addr
+		u.lock.Unlock()
+		u.pending = u.buf[:n]
+	}
+	n := copy(p, u.pending)
+	u.pending = u.pending[n:]
+	return n, nil
+}
+
+func (u *UDPTransport) Write(p []byte) (int, error) {
+	u.lock.Lock()
+	peer := u.peer
+	u.lock.Unlock()
+	if peer == nil {
+		return len(p), nil
+	}
+	return u.conn.WriteToUDP(p, peer)
+}
+
+func (u *UDPTransport) Close() error {
+	return u.conn.Close()
+}
+
+// The address being listened on
+func (u *UDPTransport) LocalAddr() net.Addr {
+	return u.conn.LocalAddr()
+}
+
+func (u *UDPTransport) String() string {
+	return fmt.Sprintf("udp %v", u.conn.LocalAddr())
+}
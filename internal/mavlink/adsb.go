@@ -0,0 +1,139 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Which fields of ADSB_VEHICLE hold something
+	ADSB_FLAGS_VALID_COORDS            = 1 << 0
+	ADSB_FLAGS_VALID_ALTITUDE          = 1 << 1
+	ADSB_FLAGS_VALID_HEADING           = 1 << 2
+	ADSB_FLAGS_VALID_VELOCITY          = 1 << 3
+	ADSB_FLAGS_VALID_CALLSIGN          = 1 << 4
+	ADSB_FLAGS_VALID_SQUAWK            = 1 << 5
+	ADSB_FLAGS_SIMULATED               = 1 << 6
+	ADSB_FLAGS_VERTICAL_VELOCITY_VALID = 1 << 7
+	ADSB_FLAGS_BARO_VALID              = 1 << 8
+	ADSB_FLAGS_SOURCE_UAT              = 1 << 15
+
+	// What the altitude in ADSB_VEHICLE is measured by
+	ADSB_ALTITUDE_TYPE_PRESSURE_QNH = 0
+	ADSB_ALTITUDE_TYPE_GEOMETRIC    = 1
+
+	// The kind of aircraft or obstacle sending ADS-B
+	ADSB_EMITTER_TYPE_NO_INFO           = 0
+	ADSB_EMITTER_TYPE_LIGHT             = 1
+	ADSB_EMITTER_TYPE_SMALL             = 2
+	ADSB_EMITTER_TYPE_LARGE             = 3
+	ADSB_EMITTER_TYPE_HIGH_VORTEX_LARGE = 4
+	ADSB_EMITTER_TYPE_HEAVY             = 5
+	ADSB_EMITTER_TYPE_HIGHLY_MANUV      = 6
+	ADSB_EMITTER_TYPE_ROTOCRAFT         = 7
+	ADSB_EMITTER_TYPE_GLIDER            = 9
+	ADSB_EMITTER_TYPE_LIGHTER_AIR       = 10
+	ADSB_EMITTER_TYPE_PARACHUTE         = 11
+	ADSB_EMITTER_TYPE_ULTRA_LIGHT       = 12
+	ADSB_EMITTER_TYPE_UAV               = 14
+	ADSB_EMITTER_TYPE_SPACE             = 15
+	ADSB_EMITTER_TYPE_EMERGENCY_SURFACE = 17
+	ADSB_EMITTER_TYPE_SERVICE_SURFACE   = 18
+	ADSB_EMITTER_TYPE_POINT_OBSTACLE    = 19
+)
+
+// An aircraft heard by the vehicle's ADS-B receiver. Lat and Lon are in
+// degrees * 1e7, Altitude in millimeters, Heading in centidegrees and the
+// velocities in cm/s with VerVelocity positive up. Tslc is the seconds since
+// the aircraft was last heard from.
+type AdsbVehicle struct {
+	ICAOAddress  uint32
+	Lat          int32
+	Lon          int32
+	Altitude     int32
+	Heading      uint16
+	HorVelocity  uint16
+	VerVelocity  int16
+	Flags        uint16
+	Squawk       uint16
+	AltitudeType uint8
+	Callsign     [9]byte
+	EmitterType  uint8
+	Tslc         uint8
+}
+
+func (msg AdsbVehicle) MessageID() uint32 {
+	return MAVLINK_MSG_ID_ADSB_VEHICLE
+}
+
+func (msg AdsbVehicle) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_ADSB_VEHICLE
+}
+
+func decodeAdsbVehicle(data *RawMessage) (*AdsbVehicleMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_ADSB_VEHICLE)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for ADSB_VEHICLE message")
+	}
+	newMessage := &AdsbVehicleMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "ADSB_VEHICLE"),
+		ICAOAddress:           binary.LittleEndian.Uint32(payload[0:4]),
+		Lat:                   int32(binary.LittleEndian.Uint32(payload[4:8])),
+		Lon:                   int32(binary.LittleEndian.Uint32(payload[8:12])),
+		Altitude:              int32(binary.LittleEndian.Uint32(payload[12:16])),
+		Heading:               binary.LittleEndian.Uint16(payload[16:18]),
+		HorVelocity:           binary.LittleEndian.Uint16(payload[18:20]),
+		VerVelocity:           int16(binary.LittleEndian.Uint16(payload[20:22])),
+		Flags:                 binary.LittleEndian.Uint16(payload[22:24]),
+		Squawk:                binary.LittleEndian.Uint16(payload[24:26]),
+		AltitudeType:          payload[26],
+		Callsign:              nulTerminated(payload[27:36]),
+		EmitterType:           payload[36],
+		Tslc:                  payload[37],
+	}
+	return newMessage, nil
+}
+
+// Callsigns are padded with spaces as well as NULs
+type AdsbVehicleMessage struct {
+	DecodedMavlinkMessage
+	ICAOAddress  uint32
+	Lat          int32
+	Lon          int32
+	Altitude     int32
+	Heading      uint16
+	HorVelocity  uint16
+	VerVelocity  int16
+	Flags        uint16
+	Squawk       uint16
+	AltitudeType uint8
+	Callsign     string
+	EmitterType  uint8
+	Tslc         uint8
+}
+
+func (m *AdsbVehicleMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *AdsbVehicleMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *AdsbVehicleMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"ICAOAddress":  m.ICAOAddress,
+		"Lat":          m.Lat,
+		"Lon":          m.Lon,
+		"Altitude":     m.Altitude,
+		"Heading":      m.Heading,
+		"HorVelocity":  m.HorVelocity,
+		"VerVelocity":  m.VerVelocity,
+		"Flags":        m.Flags,
+		"Squawk":       m.Squawk,
+		"AltitudeType": m.AltitudeType,
+		"Callsign":     m.Callsign,
+		"EmitterType":  m.EmitterType,
+		"Tslc":         m.Tslc,
+	}
+}
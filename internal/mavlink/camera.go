@@ -0,0 +1,362 @@
+package mavlink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Capabilities in CAMERA_INFORMATION
+	CAMERA_CAP_FLAGS_CAPTURE_VIDEO                   = 1 << 0
+	CAMERA_CAP_FLAGS_CAPTURE_IMAGE                   = 1 << 1
+	CAMERA_CAP_FLAGS_HAS_MODES                       = 1 << 2
+	CAMERA_CAP_FLAGS_CAN_CAPTURE_IMAGE_IN_VIDEO_MODE = 1 << 3
+	CAMERA_CAP_FLAGS_CAN_CAPTURE_VIDEO_IN_IMAGE_MODE = 1 << 4
+	CAMERA_CAP_FLAGS_HAS_IMAGE_SURVEY_MODE           = 1 << 5
+	CAMERA_CAP_FLAGS_HAS_BASIC_ZOOM                  = 1 << 6
+	CAMERA_CAP_FLAGS_HAS_BASIC_FOCUS                 = 1 << 7
+	CAMERA_CAP_FLAGS_HAS_VIDEO_STREAM                = 1 << 8
+
+	// Modes in CAMERA_SETTINGS and MAV_CMD_SET_CAMERA_MODE
+	CAMERA_MODE_IMAGE        = 0
+	CAMERA_MODE_VIDEO        = 1
+	CAMERA_MODE_IMAGE_SURVEY = 2
+)
+
+// What a camera is and can do. The names are NUL padded.
+type CameraInformation struct {
+	TimeBootMs           uint32
+	FirmwareVersion      uint32
+	FocalLength          float32
+	SensorSizeH          float32
+	SensorSizeV          float32
+	Flags                uint32
+	ResolutionH          uint16
+	ResolutionV          uint16
+	CamDefinitionVersion uint16
+	VendorName           [32]byte
+	ModelName            [32]byte
+	LensID               uint8
+	CamDefinitionURI     [140]byte
+	// extensions
+	GimbalDeviceID uint8
+	CameraDeviceID uint8
+}
+
+func (msg CameraInformation) MessageID() uint32 {
+	return MAVLINK_MSG_ID_CAMERA_INFORMATION
+}
+
+func (msg CameraInformation) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_CAMERA_INFORMATION + 2
+}
+
+// The mode a camera is in, and its zoom and focus in percent or NaN when it
+// has neither
+type CameraSettings struct {
+	TimeBootMs uint32
+	ModeID     uint8
+	// extensions
+	ZoomLevel      float32
+	FocusLevel     float32
+	CameraDeviceID uint8
+}
+
+func (msg CameraSettings) MessageID() uint32 {
+	return MAVLINK_MSG_ID_CAMERA_SETTINGS
+}
+
+func (msg CameraSettings) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_CAMERA_SETTINGS + 9
+}
+
+// Whether a camera is taking pictures or recording. ImageStatus is 0 when
+// idle, 1 while taking a picture, 2 while an interval is set and 3 while
+// taking one of its pictures. VideoStatus is 0 when idle and 1 while
+// recording. AvailableCapacity is in MiB.
+type CameraCaptureStatus struct {
+	TimeBootMs        uint32
+	ImageInterval     float32
+	RecordingTimeMs   uint32
+	AvailableCapacity float32
+	ImageStatus       uint8
+	VideoStatus       uint8
+	// extensions
+	ImageCount     int32
+	CameraDeviceID uint8
+}
+
+func (msg CameraCaptureStatus) MessageID() uint32 {
+	return MAVLINK_MSG_ID_CAMERA_CAPTURE_STATUS
+}
+
+func (msg CameraCaptureStatus) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_CAMERA_CAPTURE_STATUS + 5
+}
+
+// A picture a camera took and where it was taken. Lat and Lon are in
+// degrees * 1e7, Alt above mean sea level and RelativeAlt above home in
+// millimeters. CaptureResult is 1 when the picture was taken.
+type CameraImageCaptured struct {
+	TimeUTC       uint64
+	TimeBootMs    uint32
+	Lat           int32
+	Lon           int32
+	Alt           int32
+	RelativeAlt   int32
+	Q             [4]float32
+	ImageIndex    int32
+	CameraID      uint8
+	CaptureResult int8
+	FileURL       [205]byte
+}
+
+func (msg CameraImageCaptured) MessageID() uint32 {
+	return MAVLINK_MSG_ID_CAMERA_IMAGE_CAPTURED
+}
+
+func (msg CameraImageCaptured) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_CAMERA_IMAGE_CAPTURED
+}
+
+// Returns the text of a NUL padded string field
+func nulTerminated(field []byte) string {
+	if end := bytes.IndexByte(field, 0); end >= 0 {
+		field = field[:end]
+	}
+	return string(field)
+}
+
+func decodeCameraInformation(data *RawMessage) (*CameraInformationMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_CAMERA_INFORMATION + 2)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for CAMERA_INFORMATION message")
+	}
+	newMessage := &CameraInformationMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "CAMERA_INFORMATION"),
+		TimeBootMs:            binary.LittleEndian.Uint32(payload[0:4]),
+		FirmwareVersion:       binary.LittleEndian.Uint32(payload[4:8]),
+		FocalLength:           float32At(payload, 8),
+		SensorSizeH:           float32At(payload, 12),
+		SensorSizeV:           float32At(payload, 16),
+		Flags:                 binary.LittleEndian.Uint32(payload[20:24]),
+		ResolutionH:           binary.LittleEndian.Uint16(payload[24:26]),
+		ResolutionV:           binary.LittleEndian.Uint16(payload[26:28]),
+		CamDefinitionVersion:  binary.LittleEndian.Uint16(payload[28:30]),
+		VendorName:            nulTerminated(payload[30:62]),
+		ModelName:             nulTerminated(payload[62:94]),
+		LensID:                payload[94],
+		CamDefinitionURI:      nulTerminated(payload[95:235]),
+		GimbalDeviceID:        payload[235],
+		CameraDeviceID:        payload[236],
+	}
+	return newMessage, nil
+}
+
+type CameraInformationMessage struct {
+	DecodedMavlinkMessage
+	TimeBootMs           uint32
+	FirmwareVersion      uint32
+	FocalLength          float32
+	SensorSizeH          float32
+	SensorSizeV          float32
+	Flags                uint32
+	ResolutionH          uint16
+	ResolutionV          uint16
+	CamDefinitionVersion uint16
+	VendorName           string
+	ModelName            string
+	LensID               uint8
+	CamDefinitionURI     string
+	GimbalDeviceID       uint8
+	CameraDeviceID       uint8
+}
+
+func (m *CameraInformationMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *CameraInformationMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *CameraInformationMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeBootMs":           m.TimeBootMs,
+		"FirmwareVersion":      m.FirmwareVersion,
+		"FocalLength":          m.FocalLength,
+		"SensorSizeH":          m.SensorSizeH,
+		"SensorSizeV":          m.SensorSizeV,
+		"Flags":                m.Flags,
+		"ResolutionH":          m.ResolutionH,
+		"ResolutionV":          m.ResolutionV,
+		"CamDefinitionVersion": m.CamDefinitionVersion,
+		"VendorName":           m.VendorName,
+		"ModelName":            m.ModelName,
+		"LensID":               m.LensID,
+		"CamDefinitionURI":     m.CamDefinitionURI,
+		"GimbalDeviceID":       m.GimbalDeviceID,
+		"CameraDeviceID":       m.CameraDeviceID,
+	}
+}
+
+func decodeCameraSettings(data *RawMessage) (*CameraSettingsMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_CAMERA_SETTINGS + 9)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for CAMERA_SETTINGS message")
+	}
+	newMessage := &CameraSettingsMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "CAMERA_SETTINGS"),
+		TimeBootMs:            binary.LittleEndian.Uint32(payload[0:4]),
+		ModeID:                payload[4],
+		ZoomLevel:             float32At(payload, 5),
+		FocusLevel:            float32At(payload, 9),
+		CameraDeviceID:        payload[13],
+	}
+	return newMessage, nil
+}
+
+// ZoomLevel and FocusLevel are 0 rather than NaN when a MAVLink 1 camera
+// leaves them out
+type CameraSettingsMessage struct {
+	DecodedMavlinkMessage
+	TimeBootMs     uint32
+	ModeID         uint8
+	ZoomLevel      float32
+	FocusLevel     float32
+	CameraDeviceID uint8
+}
+
+func (m *CameraSettingsMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *CameraSettingsMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *CameraSettingsMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeBootMs":     m.TimeBootMs,
+		"ModeID":         m.ModeID,
+		"ZoomLevel":      m.ZoomLevel,
+		"FocusLevel":     m.FocusLevel,
+		"CameraDeviceID": m.CameraDeviceID,
+	}
+}
+
+func decodeCameraCaptureStatus(data *RawMessage) (*CameraCaptureStatusMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_CAMERA_CAPTURE_STATUS + 5)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for CAMERA_CAPTURE_STATUS message")
+	}
+	newMessage := &CameraCaptureStatusMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "CAMERA_CAPTURE_STATUS"),
+		TimeBootMs:            binary.LittleEndian.Uint32(payload[0:4]),
+		ImageInterval:         float32At(payload, 4),
+		RecordingTimeMs:       binary.LittleEndian.Uint32(payload[8:12]),
+		AvailableCapacity:     float32At(payload, 12),
+		ImageStatus:           payload[16],
+		VideoStatus:           payload[17],
+		ImageCount:            int32(binary.LittleEndian.Uint32(payload[18:22])),
+		CameraDeviceID:        payload[22],
+	}
+	return newMessage, nil
+}
+
+type CameraCaptureStatusMessage struct {
+	DecodedMavlinkMessage
+	TimeBootMs        uint32
+	ImageInterval     float32
+	RecordingTimeMs   uint32
+	AvailableCapacity float32
+	ImageStatus       uint8
+	VideoStatus       uint8
+	ImageCount        int32
+	CameraDeviceID    uint8
+}
+
+func (m *CameraCaptureStatusMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *CameraCaptureStatusMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *CameraCaptureStatusMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeBootMs":        m.TimeBootMs,
+		"ImageInterval":     m.ImageInterval,
+		"RecordingTimeMs":   m.RecordingTimeMs,
+		"AvailableCapacity": m.AvailableCapacity,
+		"ImageStatus":       m.ImageStatus,
+		"VideoStatus":       m.VideoStatus,
+		"ImageCount":        m.ImageCount,
+		"CameraDeviceID":    m.CameraDeviceID,
+	}
+}
+
+func decodeCameraImageCaptured(data *RawMessage) (*CameraImageCapturedMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_CAMERA_IMAGE_CAPTURED)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for CAMERA_IMAGE_CAPTURED message")
+	}
+	newMessage := &CameraImageCapturedMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "CAMERA_IMAGE_CAPTURED"),
+		TimeUTC:               binary.LittleEndian.Uint64(payload[0:8]),
+		TimeBootMs:            binary.LittleEndian.Uint32(payload[8:12]),
+		Lat:                   int32(binary.LittleEndian.Uint32(payload[12:16])),
+		Lon:                   int32(binary.LittleEndian.Uint32(payload[16:20])),
+		Alt:                   int32(binary.LittleEndian.Uint32(payload[20:24])),
+		RelativeAlt:           int32(binary.LittleEndian.Uint32(payload[24:28])),
+		ImageIndex:            int32(binary.LittleEndian.Uint32(payload[44:48])),
+		CameraID:              payload[48],
+		CaptureResult:         int8(payload[49]),
+		FileURL:               nulTerminated(payload[50:255]),
+	}
+	for i := range newMessage.Q {
+		newMessage.Q[i] = float32At(payload, 28+4*i)
+	}
+	return newMessage, nil
+}
+
+type CameraImageCapturedMessage struct {
+	DecodedMavlinkMessage
+	TimeUTC       uint64
+	TimeBootMs    uint32
+	Lat           int32
+	Lon           int32
+	Alt           int32
+	RelativeAlt   int32
+	Q             [4]float32
+	ImageIndex    int32
+	CameraID      uint8
+	CaptureResult int8
+	FileURL       string
+}
+
+func (m *CameraImageCapturedMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *CameraImageCapturedMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *CameraImageCapturedMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeUTC":       m.TimeUTC,
+		"TimeBootMs":    m.TimeBootMs,
+		"Lat":           m.Lat,
+		"Lon":           m.Lon,
+		"Alt":           m.Alt,
+		"RelativeAlt":   m.RelativeAlt,
+		"Q":             m.Q,
+		"ImageIndex":    m.ImageIndex,
+		"CameraID":      m.CameraID,
+		"CaptureResult": m.CaptureResult,
+		"FileURL":       m.FileURL,
+	}
+}
@@ -2,6 +2,7 @@ package mavlink
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 )
@@ -19,73 +20,222 @@ type RawMessage struct {
 	ComponentID uint8
 	MessageID   int
 	Payload     []byte
-	CRC         uint8
+	CRC         uint16
 }
 
+// SystemID and ComponentID are those of the sender
 type DecodedMavlinkMessage struct {
 	MessageID   int
 	MessageName string
+	SystemID    uint8
+	ComponentID uint8
 	Payload     DecodedPayload
 }
 
+func newDecodedMavlinkMessage(data *RawMessage, name string) DecodedMavlinkMessage {
+	return DecodedMavlinkMessage{
+		MessageID:   data.MessageID,
+		MessageName: name,
+		SystemID:    data.SystemID,
+		ComponentID: data.ComponentID,
+	}
+}
+
 type DecodedPayload map[string]interface{}
 
+// Returned by DecodeMessage for messages that there is no decoder for yet
+var ErrUnknownMessage = errors.New("unknown message ID")
+
+// Whether DecodeMessage handles a message, and so whether ValidCRC can check
+// its frames
+func Decodable(messageID uint32) bool {
+	// every decoder pads out a short payload, so only an unknown ID fails
+	_, err := DecodeMessage(&RawMessage{MessageID: int(messageID)})
+	return !errors.Is(err, ErrUnknownMessage)
+}
+
+// Parses a MAVLink 1 or MAVLink 2 frame
 func NewRawMessage(data []byte) (*RawMessage, error) {
 	if len(data) < 8 {
 		return nil, fmt.Errorf("insufficient data for MAVLink message")
 	}
+	length := FrameLength(data[0], data[1], data[2])
+	if length == 0 {
+		return nil, fmt.Errorf("no frame start in MAVLink message")
+	}
+	if len(data) < length {
+		return nil, fmt.Errorf("insufficient data for MAVLink message")
+	}
 	payloadLength := int(data[1])
-	messageID := binary.LittleEndian.Uint16(data[7:9])
 
+	if data[0] == FRAME_START {
+		newMessage := &RawMessage{
+			Length:      data[1],
+			Sequence:    data[2],
+			SystemID:    data[3],
+			ComponentID: data[4],
+			MessageID:   int(data[5]),
+			Payload:     data[6 : 6+payloadLength],
+			CRC:         binary.LittleEndian.Uint16(data[6+payloadLength:]),
+		}
+		return newMessage, nil
+	}
+
+	messageID := uint32(data[7]) | uint32(data[8])<<8 | uint32(data[9])<<16
 	newMessage := &RawMessage{
 		Length:      data[1],
 		Sequence:    data[4],
 		SystemID:    data[5],
 		ComponentID: data[6],
 		MessageID:   int(messageID),
-		Payload:     data[9 : 9+payloadLength],
-		CRC:         data[len(data)-1],
+		Payload:     data[10 : 10+payloadLength],
+		CRC:         binary.LittleEndian.Uint16(data[10+payloadLength:]),
 	}
 	return newMessage, nil
 }
 
+// MAVLink 2 trims the zero bytes off the end of a payload before sending it,
+// so pad the payload back out to the full size of the message
+func (r *RawMessage) paddedPayload(size int) ([]byte, bool) {
+	if len(r.Payload) > size {
+		return nil, false
+	}
+	payload := make([]byte, size)
+	copy(payload, r.Payload)
+	return payload, true
+}
+
 func DecodeMessage(data *RawMessage) (DecodedMessage, error) {
 	switch data.MessageID {
 	case 0:
 		return decodeHeartbeat(data)
+	case 1:
+		return decodeSysStatus(data)
+	case 20:
+		return decodeParamRequestRead(data)
+	case 21:
+		return decodeParamRequestList(data)
+	case 22:
+		return decodeParamValue(data)
+	case 23:
+		return decodeParamSet(data)
+	case 24:
+		return decodeGpsRawInt(data)
 	case 33:
 		return decodeGlobalPositionInt(data)
+	case 36:
+		return decodeServoOutputRaw(data)
+	case 40, 51:
+		return decodeMissionRequest(data)
+	case 43:
+		return decodeMissionRequestList(data)
+	case 44:
+		return decodeMissionCount(data)
+	case 47:
+		return decodeMissionAck(data)
+	case 65:
+		return decodeRcChannels(data)
+	case 66:
+		return decodeRequestDataStream(data)
+	case 69:
+		return decodeManualControl(data)
+	case 70:
+		return decodeRcChannelsOverride(data)
+	case 73:
+		return decodeMissionItemInt(data)
 	case 74:
 		return decodeVfrHud(data)
+	case 75:
+		return decodeCommandInt(data)
+	case 76:
+		return decodeCommandLong(data)
 	case 77:
-		fmt.Println("COMMAND ACK RECEIVED!")
 		return decodeCommandAck(data)
+	case 84:
+		return decodeSetPositionTargetLocalNed(data)
+	case 86:
+		return decodeSetPositionTargetGlobalInt(data)
+	case 102:
+		return decodeVisionPositionEstimate(data)
+	case 103:
+		return decodeVisionSpeedEstimate(data)
+	case 110:
+		return decodeFileTransferProtocol(data)
+	case 111:
+		return decodeTimeSync(data)
+	case 117:
+		return decodeLogRequestList(data)
+	case 118:
+		return decodeLogEntry(data)
+	case 119:
+		return decodeLogRequestData(data)
+	case 120:
+		return decodeLogData(data)
+	case 121, 122:
+		return decodeLogTarget(data)
+	case 148:
+		return decodeAutopilotVersion(data)
+	case 193:
+		return decodeEkfStatusReport(data)
+	case 230:
+		return decodeEstimatorStatus(data)
+	case 233:
+		return decodeGpsRtcmData(data)
+	case 241:
+		return decodeVibration(data)
+	case 242:
+		return decodeHomePosition(data)
+	case 245:
+		return decodeExtendedSysState(data)
+	case 246:
+		return decodeAdsbVehicle(data)
+	case 253:
+		return decodeStatusText(data)
+	case 259:
+		return decodeCameraInformation(data)
+	case 260:
+		return decodeCameraSettings(data)
+	case 262:
+		return decodeCameraCaptureStatus(data)
+	case 263:
+		return decodeCameraImageCaptured(data)
+	case 280:
+		return decodeGimbalManagerInformation(data)
+	case 281:
+		return decodeGimbalManagerStatus(data)
+	case 282:
+		return decodeGimbalManagerSetAttitude(data)
+	case 285:
+		return decodeGimbalDeviceAttitudeStatus(data)
+	case 287:
+		return decodeGimbalManagerSetPitchyaw(data)
+	case 331:
+		return decodeOdometry(data)
 	default:
-		return nil, fmt.Errorf("unknown message ID: %d", data.MessageID)
+		return nil, fmt.Errorf("%w: %d", ErrUnknownMessage, data.MessageID)
 	}
 }
 
 func decodeHeartbeat(data *RawMessage) (*HeartbeatMessage, error) {
-	payload := data.Payload
-	if len(payload) != 9 {
+	payload, ok := data.paddedPayload(9)
+	if !ok {
 		return nil, fmt.Errorf("invalid payload length for HEARTBEAT message")
 	}
 	// fmt.Printf("sys id: %v, comp id: %v, sequence %v\n", data.SystemID, data.SystemID, data.Sequence)
 	newMessage := &HeartbeatMessage{
-		DecodedMavlinkMessage: DecodedMavlinkMessage{
-			MessageID:   data.MessageID,
-			MessageName: "HEARTBEAT",
-		},
-		Type:         float64(payload[5]),
-		Autopilot:    float64(payload[6]),
-		BaseMode:     float64(payload[7]),
-		SystemStatus: float64(payload[8]),
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "HEARTBEAT"),
+		CustomMode:            float64(binary.LittleEndian.Uint32(payload[0:4])),
+		Type:                  float64(payload[4]),
+		Autopilot:             float64(payload[5]),
+		BaseMode:              float64(payload[6]),
+		SystemStatus:          float64(payload[7]),
 	}
 	return newMessage, nil
 }
 
 type HeartbeatMessage struct {
 	DecodedMavlinkMessage
+	CustomMode   float64
 	Type         float64
 	Autopilot    float64
 	BaseMode     float64
@@ -103,6 +253,7 @@ func (h *HeartbeatMessage) GetMessageName() string {
 // return all the fields of the message as a DecodedPayload
 func (h *HeartbeatMessage) MessageData() DecodedPayload {
 	return DecodedPayload{
+		"CustomMode":   h.CustomMode,
 		"Type":         h.Type,
 		"Autopilot":    h.Autopilot,
 		"BaseMode":     h.BaseMode,
@@ -111,25 +262,31 @@ func (h *HeartbeatMessage) MessageData() DecodedPayload {
 }
 
 func decodeCommandAck(data *RawMessage) (*CommandAckMessage, error) {
-	payload := data.Payload
-	if len(payload) != 3 {
+	// 3 bytes of the base message and 7 of MAVLink 2 extensions
+	payload, ok := data.paddedPayload(10)
+	if !ok {
 		return nil, fmt.Errorf("invalid payload length for COMMAND_ACK message")
 	}
 	newMessage := &CommandAckMessage{
-		DecodedMavlinkMessage: DecodedMavlinkMessage{
-			MessageID:   data.MessageID,
-			MessageName: "COMMAND_ACK",
-		},
-		Command: binary.LittleEndian.Uint16(payload[1:3]),
-		Result:  payload[3],
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "COMMAND_ACK"),
+		Command:               binary.LittleEndian.Uint16(payload[0:2]),
+		Result:                payload[2],
+		Progress:              payload[3],
+		ResultParam2:          int32(binary.LittleEndian.Uint32(payload[4:8])),
+		TargetSystem:          payload[8],
+		TargetComponent:       payload[9],
 	}
 	return newMessage, nil
 }
 
 type CommandAckMessage struct {
 	DecodedMavlinkMessage
-	Command uint16
-	Result  uint8
+	Command         uint16
+	Result          uint8
+	Progress        uint8
+	ResultParam2    int32
+	TargetSystem    uint8
+	TargetComponent uint8
 }
 
 func (c *CommandAckMessage) GetMessageID() int {
@@ -142,28 +299,32 @@ func (c *CommandAckMessage) GetMessageName() string {
 
 func (c *CommandAckMessage) MessageData() DecodedPayload {
 	return DecodedPayload{
-		"Command": c.Command,
-		"Result":  c.Result,
+		"Command":         c.Command,
+		"Result":          c.Result,
+		"Progress":        c.Progress,
+		"ResultParam2":    c.ResultParam2,
+		"TargetSystem":    c.TargetSystem,
+		"TargetComponent": c.TargetComponent,
 	}
 }
 
 func decodeGlobalPositionInt(data *RawMessage) (*GlobalPositionIntMessage, error) {
-	payload := data.Payload
-	if len(payload) != 28 {
+	payload, ok := data.paddedPayload(28)
+	if !ok {
 		return nil, fmt.Errorf("invalid payload length for GLOBAL_POSITION_INT message")
 	}
 	newMessage := &GlobalPositionIntMessage{
 		MessageID:   data.MessageID,
 		MessageName: "GLOBAL_POSITION_INT",
-		TimeBootMs:  float64(binary.LittleEndian.Uint32(payload[1:5])),
-		Lat:         float64(int32(binary.LittleEndian.Uint32(payload[5:9]))) / 10000000,
-		Lon:         float64(int32(binary.LittleEndian.Uint32(payload[9:13]))) / 10000000,
-		Alt:         float64(int32(binary.LittleEndian.Uint32(payload[13:17]))) / 1000,
-		RelativeAlt: float64(int32(binary.LittleEndian.Uint32(payload[17:21]))) / 1000,
-		Vx:          float64(int16(binary.LittleEndian.Uint16(payload[21:23]))) / 100,
-		Vy:          float64(int16(binary.LittleEndian.Uint16(payload[23:25]))) / 100,
-		Vz:          float64(int16(binary.LittleEndian.Uint16(payload[25:27]))) / 100,
-		Hdg:         float64(binary.LittleEndian.Uint16(payload[27:29])) / 100,
+		TimeBootMs:  float64(binary.LittleEndian.Uint32(payload[0:4])),
+		Lat:         float64(int32(binary.LittleEndian.Uint32(payload[4:8]))) / 10000000,
+		Lon:         float64(int32(binary.LittleEndian.Uint32(payload[8:12]))) / 10000000,
+		Alt:         float64(int32(binary.LittleEndian.Uint32(payload[12:16]))) / 1000,
+		RelativeAlt: float64(int32(binary.LittleEndian.Uint32(payload[16:20]))) / 1000,
+		Vx:          float64(int16(binary.LittleEndian.Uint16(payload[20:22]))) / 100,
+		Vy:          float64(int16(binary.LittleEndian.Uint16(payload[22:24]))) / 100,
+		Vz:          float64(int16(binary.LittleEndian.Uint16(payload[24:26]))) / 100,
+		Hdg:         float64(binary.LittleEndian.Uint16(payload[26:28])) / 100,
 	}
 	return newMessage, nil
 }
@@ -205,18 +366,20 @@ func (g *GlobalPositionIntMessage) MessageData() DecodedPayload {
 }
 
 func decodeVfrHud(data *RawMessage) (*VfrHudMessage, error) {
-	payload := data.Payload
+	payload, ok := data.paddedPayload(20)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for VFR_HUD message")
+	}
 
 	newMessage := &VfrHudMessage{
 		MessageID:   data.MessageID,
 		MessageName: "VFR_HUD",
-		Airspeed:    float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[1:5]))),
-		Groundspeed: float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[5:9]))),
-		// Throttle:    float64(uint16(binary.LittleEndian.Uint16(payload[9:11]))),
-		Alt:      float64(uint16(binary.LittleEndian.Uint32(payload[9:13]))),
-		Throttle: float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[11:17]))),
-		Climb:    float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[13:17]))),
-		Heading:  float64(uint16(binary.LittleEndian.Uint16(payload[17:19]))),
+		Airspeed:    float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[0:4]))),
+		Groundspeed: float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[4:8]))),
+		Alt:         float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[8:12]))),
+		Climb:       float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[12:16]))),
+		Heading:     float64(int16(binary.LittleEndian.Uint16(payload[16:18]))),
+		Throttle:    float64(binary.LittleEndian.Uint16(payload[18:20])),
 	}
 	return newMessage, nil
 }
@@ -250,3 +413,233 @@ func (v *VfrHudMessage) MessageData() DecodedPayload {
 		"Throttle":    v.Throttle,
 	}
 }
+
+func decodeSysStatus(data *RawMessage) (*SysStatusMessage, error) {
+	// 31 bytes of the base message and 12 of MAVLink 2 extensions
+	payload, ok := data.paddedPayload(43)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for SYS_STATUS message")
+	}
+	newMessage := &SysStatusMessage{
+		MessageID:              data.MessageID,
+		MessageName:            "SYS_STATUS",
+		SensorsPresent:         float64(binary.LittleEndian.Uint32(payload[0:4])),
+		SensorsEnabled:         float64(binary.LittleEndian.Uint32(payload[4:8])),
+		SensorsHealth:          float64(binary.LittleEndian.Uint32(payload[8:12])),
+		Load:                   float64(binary.LittleEndian.Uint16(payload[12:14])) / 10,
+		VoltageBattery:         float64(binary.LittleEndian.Uint16(payload[14:16])) / 1000,
+		CurrentBattery:         float64(int16(binary.LittleEndian.Uint16(payload[16:18]))) / 100,
+		DropRateComm:           float64(binary.LittleEndian.Uint16(payload[18:20])) / 100,
+		ErrorsComm:             float64(binary.LittleEndian.Uint16(payload[20:22])),
+		BatteryRemaining:       float64(int8(payload[30])),
+		SensorsPresentExtended: float64(binary.LittleEndian.Uint32(payload[31:35])),
+		SensorsEnabledExtended: float64(binary.LittleEndian.Uint32(payload[35:39])),
+		SensorsHealthExtended:  float64(binary.LittleEndian.Uint32(payload[39:43])),
+	}
+	return newMessage, nil
+}
+
+// Voltage is in volts, current in amps and load and the remaining battery
+// are percentages. A current or remaining battery of -1 means the autopilot
+// doesn't know.
+type SysStatusMessage struct {
+	MessageID        int
+	MessageName      string
+	SensorsPresent   float64
+	SensorsEnabled   float64
+	SensorsHealth    float64
+	Load             float64
+	VoltageBattery   float64
+	CurrentBattery   float64
+	DropRateComm     float64
+	ErrorsComm       float64
+	BatteryRemaining float64
+	// MAV_SYS_STATUS_SENSOR_EXTENDED bits, used when the
+	// MAV_SYS_STATUS_EXTENSION_USED bit is set
+	SensorsPresentExtended float64
+	SensorsEnabledExtended float64
+	SensorsHealthExtended  float64
+}
+
+func (s *SysStatusMessage) GetMessageID() int {
+	return s.MessageID
+}
+
+func (s *SysStatusMessage) GetMessageName() string {
+	return s.MessageName
+}
+
+func (s *SysStatusMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"SensorsPresent":         s.SensorsPresent,
+		"SensorsEnabled":         s.SensorsEnabled,
+		"SensorsHealth":          s.SensorsHealth,
+		"Load":                   s.Load,
+		"VoltageBattery":         s.VoltageBattery,
+		"CurrentBattery":         s.CurrentBattery,
+		"DropRateComm":           s.DropRateComm,
+		"ErrorsComm":             s.ErrorsComm,
+		"BatteryRemaining":       s.BatteryRemaining,
+		"SensorsPresentExtended": s.SensorsPresentExtended,
+		"SensorsEnabledExtended": s.SensorsEnabledExtended,
+		"SensorsHealthExtended":  s.SensorsHealthExtended,
+	}
+}
+
+// Commands are normally sent to the vehicle, but are decoded so that
+// simulated vehicles and companion computers can act on them
+func decodeCommandLong(data *RawMessage) (*CommandLongMessage, error) {
+	payload, ok := data.paddedPayload(33)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for COMMAND_LONG message")
+	}
+	newMessage := &CommandLongMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "COMMAND_LONG"),
+		Param1:                math.Float32frombits(binary.LittleEndian.Uint32(payload[0:4])),
+		Param2:                math.Float32frombits(binary.LittleEndian.Uint32(payload[4:8])),
+		Param3:                math.Float32frombits(binary.LittleEndian.Uint32(payload[8:12])),
+		Param4:                math.Float32frombits(binary.LittleEndian.Uint32(payload[12:16])),
+		Param5:                math.Float32frombits(binary.LittleEndian.Uint32(payload[16:20])),
+		Param6:                math.Float32frombits(binary.LittleEndian.Uint32(payload[20:24])),
+		Param7:                math.Float32frombits(binary.LittleEndian.Uint32(payload[24:28])),
+		Command:               binary.LittleEndian.Uint16(payload[28:30]),
+		TargetSystem:          payload[30],
+		TargetComponent:       payload[31],
+		Confirmation:          payload[32],
+	}
+	return newMessage, nil
+}
+
+func decodeCommandInt(data *RawMessage) (*CommandIntMessage, error) {
+	payload, ok := data.paddedPayload(35)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for COMMAND_INT message")
+	}
+	newMessage := &CommandIntMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "COMMAND_INT"),
+		Param1:                math.Float32frombits(binary.LittleEndian.Uint32(payload[0:4])),
+		Param2:                math.Float32frombits(binary.LittleEndian.Uint32(payload[4:8])),
+		Param3:                math.Float32frombits(binary.LittleEndian.Uint32(payload[8:12])),
+		Param4:                math.Float32frombits(binary.LittleEndian.Uint32(payload[12:16])),
+		X:                     int32(binary.LittleEndian.Uint32(payload[16:20])),
+		Y:                     int32(binary.LittleEndian.Uint32(payload[20:24])),
+		Z:                     math.Float32frombits(binary.LittleEndian.Uint32(payload[24:28])),
+		Command:               binary.LittleEndian.Uint16(payload[28:30]),
+		TargetSystem:          payload[30],
+		TargetComponent:       payload[31],
+		Frame:                 payload[32],
+	}
+	return newMessage, nil
+}
+
+type CommandIntMessage struct {
+	DecodedMavlinkMessage
+	Param1          float32
+	Param2          float32
+	Param3          float32
+	Param4          float32
+	X               int32
+	Y               int32
+	Z               float32
+	Command         uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	Frame           uint8
+}
+
+func (c *CommandIntMessage) GetMessageID() int {
+	return c.MessageID
+}
+
+func (c *CommandIntMessage) GetMessageName() string {
+	return c.MessageName
+}
+
+func (c *CommandIntMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Param1":          c.Param1,
+		"Param2":          c.Param2,
+		"Param3":          c.Param3,
+		"Param4":          c.Param4,
+		"X":               c.X,
+		"Y":               c.Y,
+		"Z":               c.Z,
+		"Command":         c.Command,
+		"TargetSystem":    c.TargetSystem,
+		"TargetComponent": c.TargetComponent,
+		"Frame":           c.Frame,
+	}
+}
+
+type CommandLongMessage struct {
+	DecodedMavlinkMessage
+	Param1          float32
+	Param2          float32
+	Param3          float32
+	Param4          float32
+	Param5          float32
+	Param6          float32
+	Param7          float32
+	Command         uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	Confirmation    uint8
+}
+
+func (c *CommandLongMessage) GetMessageID() int {
+	return c.MessageID
+}
+
+func (c *CommandLongMessage) GetMessageName() string {
+	return c.MessageName
+}
+
+func (c *CommandLongMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Param1":          c.Param1,
+		"Param2":          c.Param2,
+		"Param3":          c.Param3,
+		"Param4":          c.Param4,
+		"Param5":          c.Param5,
+		"Param6":          c.Param6,
+		"Param7":          c.Param7,
+		"Command":         c.Command,
+		"TargetSystem":    c.TargetSystem,
+		"TargetComponent": c.TargetComponent,
+		"Confirmation":    c.Confirmation,
+	}
+}
+
+func decodeExtendedSysState(data *RawMessage) (*ExtendedSysStateMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_EXTENDED_SYS_STATE)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for EXTENDED_SYS_STATE message")
+	}
+	newMessage := &ExtendedSysStateMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "EXTENDED_SYS_STATE"),
+		VtolState:             float64(payload[0]),
+		LandedState:           float64(payload[1]),
+	}
+	return newMessage, nil
+}
+
+type ExtendedSysStateMessage struct {
+	DecodedMavlinkMessage
+	VtolState   float64
+	LandedState float64
+}
+
+func (e *ExtendedSysStateMessage) GetMessageID() int {
+	return e.MessageID
+}
+
+func (e *ExtendedSysStateMessage) GetMessageName() string {
+	return e.MessageName
+}
+
+func (e *ExtendedSysStateMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"VtolState":   e.VtolState,
+		"LandedState": e.LandedState,
+	}
+}
@@ -0,0 +1,59 @@
+package mavlink
+
+import (
+	"testing"
+)
+
+func decodeFrame(t *testing.T, frame []byte) DecodedMessage {
+	t.Helper()
+	raw, err := NewRawMessage(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := DecodeMessage(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestDecodeGpsRawIntExtensions(t *testing.T) {
+	sent := GpsRawInt{
+		TimeUsec: 1234, Lat: -353632610, Lon: 1491652300, Alt: 584000,
+		Eph: 80, Epv: 120, Vel: 250, Cog: 9000,
+		FixType: GPS_FIX_TYPE_RTK_FIXED, SatellitesVisible: 22,
+		AltEllipsoid: 604000, HAcc: 15, VAcc: 25, VelAcc: 40, HdgAcc: 120000, Yaw: 36000,
+	}
+	frame := testFrames(t, sent)[0]
+	if frame[0] != FRAME_START_V2 || frame[1] != MAVLINK_MSG_SIZE_GPS_RAW_INT+22 {
+		t.Fatalf("sent a %d byte payload in a frame starting %#x, want all 52 bytes over MAVLink 2", frame[1], frame[0])
+	}
+	got, ok := decodeFrame(t, frame).(*GpsRawIntMessage)
+	if !ok {
+		t.Fatalf("decoded %T", got)
+	}
+	if got.Lat != sent.Lat || got.SatellitesVisible != sent.SatellitesVisible || got.AltEllipsoid != sent.AltEllipsoid ||
+		got.HAcc != sent.HAcc || got.VAcc != sent.VAcc || got.VelAcc != sent.VelAcc ||
+		got.HdgAcc != sent.HdgAcc || got.Yaw != sent.Yaw {
+		t.Errorf("decoded %+v, want %+v", got, sent)
+	}
+}
+
+func TestDecodeHomePositionExtensions(t *testing.T) {
+	sent := HomePosition{
+		Latitude: -353632610, Longitude: 1491652300, Altitude: 584000,
+		Q: [4]float32{1, 0, 0, 0}, TimeUsec: 90_000_000,
+	}
+	frame := testFrames(t, sent)[0]
+	// MAVLink 2 trims the timestamp's zero high bytes, which decoding restores
+	if frame[0] != FRAME_START_V2 || frame[1] <= MAVLINK_MSG_SIZE_HOME_POSITION {
+		t.Fatalf("sent a %d byte payload in a frame starting %#x, want the extensions over MAVLink 2", frame[1], frame[0])
+	}
+	got, ok := decodeFrame(t, frame).(*HomePositionMessage)
+	if !ok {
+		t.Fatalf("decoded %T", got)
+	}
+	if got.Latitude != sent.Latitude || got.Altitude != sent.Altitude || got.TimeUsec != sent.TimeUsec {
+		t.Errorf("decoded %+v, want %+v", got, sent)
+	}
+}
@@ -1,6 +1,9 @@
 package mavlink
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"io"
 )
 
@@ -25,7 +28,12 @@ func (e *Encoder) IncrementSequenceNumber() {
 	e.MavComInterface.IncrementSequenceNumber()
 }
 
+// Creates a MAVLink 1 packet. Messages with IDs above 255 can only be sent
+// as MAVLink 2, which EncodePacket does.
 func (e *Encoder) CreatePacket(systemID uint8, componentID uint8, message MavlinkMessage) (*MavlinkPacket, error) {
+	if message.MessageID() > MAVLINK_V1_MAX_MESSAGE_ID {
+		return nil, fmt.Errorf("message %d does not fit in a MAVLink 1 packet", message.MessageID())
+	}
 	packet := &MavlinkPacket{
 		Header: MavlinkHeader{
 			FrameStart:     FRAME_START,
@@ -33,7 +41,7 @@ func (e *Encoder) CreatePacket(systemID uint8, componentID uint8, message Mavlin
 			PacketSequence: e.GetSequenceNumber(),
 			SystemID:       systemID,
 			ComponentID:    componentID,
-			MessageID:      message.MessageID(),
+			MessageID:      uint8(message.MessageID()),
 		},
 		Message: message,
 	}
@@ -42,13 +50,67 @@ func (e *Encoder) CreatePacket(systemID uint8, componentID uint8, message Mavlin
 	return packet, nil
 }
 
+// Creates an unsigned MAVLink 2 frame. The payload has its trailing zeros
+// removed, as MAVLink 2 senders do, and is padded back out by the receiver.
+func (e *Encoder) CreatePacketV2(systemID uint8, componentID uint8, message MavlinkMessage) ([]byte, error) {
+	crc, ok := crcExtra(message.MessageID())
+	if !ok {
+		return nil, fmt.Errorf("no CRC extra for message %d", message.MessageID())
+	}
+	var payload bytes.Buffer
+	if err := binary.Write(&payload, binary.LittleEndian, message); err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimRight(payload.Bytes(), "\x00")
+	// the first byte is always sent, even when it is zero
+	if len(trimmed) == 0 {
+		trimmed = payload.Bytes()[:1]
+	}
+
+	id := message.MessageID()
+	frame := []byte{
+		FRAME_START_V2,
+		uint8(len(trimmed)),
+		0, // incompatibility flags
+		0, // compatibility flags
+		e.GetSequenceNumber(),
+		systemID,
+		componentID,
+		uint8(id), uint8(id >> 8), uint8(id >> 16),
+	}
+	frame = append(frame, trimmed...)
+
+	var mp MavlinkPacket
+	mp.crcInit()
+	for _, b := range frame[1:] {
+		mp.crcAccumulate(b)
+	}
+	mp.crcAccumulate(crc)
+	return binary.LittleEndian.AppendUint16(frame, mp.Checksum), nil
+}
+
+// Writes a message as MAVLink 1, or as MAVLink 2 if its ID is too large for
+// MAVLink 1 or it uses extension fields
 func (e *Encoder) EncodePacket(writer io.Writer, systemID uint8, componentID uint8, message MavlinkMessage) error {
-	packet, err := e.CreatePacket(systemID, componentID, message)
+	var packetBytes []byte
+	if needsMavlink2(message) {
+		frame, err := e.CreatePacketV2(systemID, componentID, message)
+		if err != nil {
+			return err
+		}
+		packetBytes = frame
+	} else {
+		packet, err := e.CreatePacket(systemID, componentID, message)
+		if err != nil {
+			return err
+		}
+		packetBytes = packet.Bytes()
+	}
+	_, err := writer.Write(packetBytes)
 	if err != nil {
 		return err
 	}
-	packetBytes := packet.Bytes()
-	_, err = writer.Write(packetBytes)
-	return err
+	e.IncrementSequenceNumber()
+	return nil
 
 }
@@ -0,0 +1,103 @@
+package mavlink
+
+import "io"
+
+// Returns the total number of bytes in the frame that begins with the given
+// start byte, payload length and (MAVLink 2 only) incompatibility flags, or 0
+// if the start byte does not begin a frame
+func FrameLength(frameStart uint8, payloadLen uint8, incompatFlags uint8) int {
+	switch frameStart {
+	case FRAME_START:
+		return 6 + int(payloadLen) + 2
+	case FRAME_START_V2:
+		length := 10 + int(payloadLen) + 2
+		if incompatFlags&MAVLINK_IFLAG_SIGNED != 0 {
+			length += 13
+		}
+		return length
+	default:
+		return 0
+	}
+}
+
+// FrameReader splits a byte stream into MAVLink frames. A single read from a
+// serial port or socket can hold several frames, or only part of one, so
+// bytes are buffered until a whole frame is available.
+//
+// A frame of a message DecodeMessage handles whose CRC doesn't match is
+// dropped and the search for a frame start carries on from the byte after its
+// start, the way pymavlink resyncs, as a corrupted length or a stray start
+// byte would otherwise swallow the frames that follow. Frames of other
+// messages aren't checked, as ValidCRC can't be trusted with them, and are
+// returned as they are.
+type FrameReader struct {
+	source  io.Reader
+	pending []byte
+	buf     []byte
+	// called with each frame dropped for failing its CRC check
+	OnCRCFailure func(frame []byte)
+}
+
+func NewFrameReader(source io.Reader) *FrameReader {
+	return &FrameReader{source: source, buf: make([]byte, 1024)}
+}
+
+// Blocks until a complete frame has been read and returns it. Any bytes that
+// come before a frame start are skipped.
+func (fr *FrameReader) ReadFrame() ([]byte, error) {
+	for {
+		if frame := fr.nextFrame(); frame != nil {
+			return frame, nil
+		}
+		n, err := fr.source.Read(fr.buf)
+		fr.pending = append(fr.pending, fr.buf[:n]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (fr *FrameReader) nextFrame() []byte {
+	for {
+		frame, complete := fr.candidateFrame()
+		if !complete {
+			return nil
+		}
+		if Decodable(FrameMessageID(frame)) && !ValidCRC(frame) {
+			if fr.OnCRCFailure != nil {
+				fr.OnCRCFailure(frame)
+			}
+			fr.pending = fr.pending[1:]
+			continue
+		}
+		fr.pending = fr.pending[len(frame):]
+		return frame
+	}
+}
+
+// Returns a copy of the frame at the first frame start in pending, without
+// consuming it, and false if there isn't a whole one yet
+func (fr *FrameReader) candidateFrame() ([]byte, bool) {
+	start := -1
+	for i, b := range fr.pending {
+		if b == FRAME_START || b == FRAME_START_V2 {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		fr.pending = fr.pending[:0]
+		return nil, false
+	}
+	fr.pending = fr.pending[start:]
+	if len(fr.pending) < 3 {
+		return nil, false
+	}
+	length := FrameLength(fr.pending[0], fr.pending[1], fr.pending[2])
+	if len(fr.pending) < length {
+		return nil, false
+	}
+	frame := make([]byte, length)
+	copy(frame, fr.pending)
+	return frame, true
+}
@@ -0,0 +1,127 @@
+package mavlink
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+type testSequence struct {
+	seq uint8
+}
+
+func (s *testSequence) GetSequenceNumber() uint8 {
+	return s.seq
+}
+
+func (s *testSequence) IncrementSequenceNumber() {
+	s.seq++
+}
+
+func testFrames(t *testing.T, messages ...MavlinkMessage) [][]byte {
+	t.Helper()
+	encoder := NewEncoder()
+	encoder.MavComInterface = &testSequence{}
+	var frames [][]byte
+	for _, msg := range messages {
+		var frame bytes.Buffer
+		if err := encoder.EncodePacket(&frame, 1, 1, msg); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame.Bytes())
+	}
+	return frames
+}
+
+func readAllFrames(t *testing.T, fr *FrameReader) [][]byte {
+	t.Helper()
+	var frames [][]byte
+	for {
+		frame, err := fr.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return frames
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func TestFrameReaderSplitsStream(t *testing.T) {
+	frames := testFrames(t,
+		Heartbeat{Type: 6, Autopilot: 8},
+		CommandLong{Command: MAV_CMD_COMPONENT_ARM_DISARM, Param1: 1, TargetSystem: 1, TargetComponent: 1},
+	)
+	stream := append([]byte{0x00, 0x42}, bytes.Join(frames, nil)...)
+	got := readAllFrames(t, NewFrameReader(bytes.NewReader(stream)))
+	if len(got) != len(frames) {
+		t.Fatalf("read %d frames, want %d", len(got), len(frames))
+	}
+	for i := range frames {
+		if !bytes.Equal(got[i], frames[i]) {
+			t.Errorf("frame %d is % x, want % x", i, got[i], frames[i])
+		}
+	}
+}
+
+func TestFrameReaderResyncsAfterCRCFailure(t *testing.T) {
+	frames := testFrames(t,
+		Heartbeat{Type: 6, Autopilot: 8},
+		Heartbeat{Type: 6, Autopilot: 8},
+	)
+	// a stray start byte whose length swallows the start of the next frame,
+	// which would otherwise be lost with it
+	corrupt := []byte{FRAME_START, 3, 0, 1, 1, MAVLINK_MSG_ID_HEARTBEAT}
+	stream := bytes.Join([][]byte{frames[0], corrupt, frames[1]}, nil)
+
+	fr := NewFrameReader(bytes.NewReader(stream))
+	failures := 0
+	fr.OnCRCFailure = func([]byte) { failures++ }
+	got := readAllFrames(t, fr)
+	if len(got) != 2 || !bytes.Equal(got[0], frames[0]) || !bytes.Equal(got[1], frames[1]) {
+		t.Fatalf("read % x, want both heartbeats", got)
+	}
+	if failures != 1 {
+		t.Errorf("%d CRC failures, want 1", failures)
+	}
+}
+
+func TestFrameReaderPassesUnknownMessages(t *testing.T) {
+	// nothing can check the CRC of a message whose CRC extra isn't known
+	frame := []byte{FRAME_START_V2, 1, 0, 0, 0, 1, 1, 0xff, 0xff, 0xff, 7, 0xab, 0xcd}
+	got := readAllFrames(t, NewFrameReader(bytes.NewReader(frame)))
+	if len(got) != 1 || !bytes.Equal(got[0], frame) {
+		t.Errorf("read % x, want % x", got, frame)
+	}
+}
+
+func TestFrameReaderOnlyChecksDecodedMessages(t *testing.T) {
+	// BATTERY_STATUS isn't decoded, so its CRC extra isn't trusted and the
+	// frame is passed on without checking its CRC
+	frame := []byte{FRAME_START_V2, 2, 0, 0, 0, 1, 1, 147, 0, 0, 0x05, 0x01, 0x12, 0x34}
+	fr := NewFrameReader(bytes.NewReader(frame))
+	failures := 0
+	fr.OnCRCFailure = func([]byte) { failures++ }
+	got := readAllFrames(t, fr)
+	if len(got) != 1 || !bytes.Equal(got[0], frame) {
+		t.Errorf("read % x, want % x", got, frame)
+	}
+	if failures != 0 {
+		t.Errorf("%d CRC failures, want none", failures)
+	}
+}
+
+func TestValidCRCWithDialectCRCExtras(t *testing.T) {
+	// RADIO_STATUS from a SiK radio, checked with the CRC extra from
+	// common.xml
+	radio := []byte{0xfe, 0x09, 0x00, 0x01, 0x01, 0x6d, 0x03, 0x00, 0x00, 0x00, 0xb4, 0xaa, 0x5f, 0x00, 0x00, 0x4d, 0x8d}
+	if !ValidCRC(radio) {
+		t.Error("RADIO_STATUS failed its CRC check")
+	}
+	// IDs that aren't in any dialect have no CRC extra
+	if _, ok := crcExtra(3); ok {
+		t.Error("CRC extra known for message 3")
+	}
+}
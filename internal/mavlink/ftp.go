@@ -0,0 +1,160 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Length of the payload carried by FILE_TRANSFER_PROTOCOL, which holds the
+// MAVLink FTP header and data
+const FTP_PAYLOAD_LEN = 251
+
+// Carries one MAVLink FTP request or reply. A target network of 0 means the
+// local network.
+type FileTransferProtocol struct {
+	TargetNetwork   uint8
+	TargetSystem    uint8
+	TargetComponent uint8
+	Payload         [FTP_PAYLOAD_LEN]byte
+}
+
+func (msg FileTransferProtocol) MessageID() uint32 {
+	return MAVLINK_MSG_ID_FILE_TRANSFER_PROTOCOL
+}
+
+func (msg FileTransferProtocol) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_FILE_TRANSFER_PROTOCOL
+}
+
+func decodeFileTransferProtocol(data *RawMessage) (*FileTransferProtocolMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_FILE_TRANSFER_PROTOCOL)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for FILE_TRANSFER_PROTOCOL message")
+	}
+	newMessage := &FileTransferProtocolMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "FILE_TRANSFER_PROTOCOL"),
+		TargetNetwork:         payload[0],
+		TargetSystem:          payload[1],
+		TargetComponent:       payload[2],
+		Payload:               payload[3:],
+	}
+	return newMessage, nil
+}
+
+type FileTransferProtocolMessage struct {
+	DecodedMavlinkMessage
+	TargetNetwork   uint8
+	TargetSystem    uint8
+	TargetComponent uint8
+	Payload         []byte
+}
+
+func (m *FileTransferProtocolMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *FileTransferProtocolMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *FileTransferProtocolMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TargetNetwork":   m.TargetNetwork,
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+		"Payload":         m.Payload,
+	}
+}
+
+// MAVLink FTP opcodes
+const (
+	FTP_OPCODE_NONE              = 0
+	FTP_OPCODE_TERMINATE_SESSION = 1
+	FTP_OPCODE_RESET_SESSIONS    = 2
+	FTP_OPCODE_LIST_DIRECTORY    = 3
+	FTP_OPCODE_OPEN_FILE_RO      = 4
+	FTP_OPCODE_READ_FILE         = 5
+	FTP_OPCODE_CREATE_FILE       = 6
+	FTP_OPCODE_WRITE_FILE        = 7
+	FTP_OPCODE_REMOVE_FILE       = 8
+	FTP_OPCODE_CREATE_DIRECTORY  = 9
+	FTP_OPCODE_REMOVE_DIRECTORY  = 10
+	FTP_OPCODE_OPEN_FILE_WO      = 11
+	FTP_OPCODE_TRUNCATE_FILE     = 12
+	FTP_OPCODE_RENAME            = 13
+	FTP_OPCODE_CALC_FILE_CRC32   = 14
+	FTP_OPCODE_BURST_READ_FILE   = 15
+	FTP_OPCODE_ACK               = 128
+	FTP_OPCODE_NAK               = 129
+)
+
+// Error codes carried in the first data byte of a NAK
+const (
+	FTP_ERR_NONE                  = 0
+	FTP_ERR_FAIL                  = 1
+	FTP_ERR_FAIL_ERRNO            = 2
+	FTP_ERR_INVALID_DATA_SIZE     = 3
+	FTP_ERR_INVALID_SESSION       = 4
+	FTP_ERR_NO_SESSIONS_AVAILABLE = 5
+	FTP_ERR_EOF                   = 6
+	FTP_ERR_UNKNOWN_COMMAND       = 7
+	FTP_ERR_FILE_EXISTS           = 8
+	FTP_ERR_FILE_PROTECTED        = 9
+	FTP_ERR_FILE_NOT_FOUND        = 10
+)
+
+// The header takes 12 bytes of the payload, leaving the rest for data
+const (
+	ftpHeaderLen     = 12
+	FTP_MAX_DATA_LEN = FTP_PAYLOAD_LEN - ftpHeaderLen
+)
+
+// FTPPacket is the MAVLink FTP header and data inside a
+// FILE_TRANSFER_PROTOCOL payload
+type FTPPacket struct {
+	Seq           uint16
+	Session       uint8
+	Opcode        uint8
+	Size          uint8 // how much to read for read requests, otherwise the length of Data
+	ReqOpcode     uint8 // the request an ACK or NAK answers
+	BurstComplete bool
+	Offset        uint32
+	Data          []byte // at most FTP_MAX_DATA_LEN bytes
+}
+
+func (p FTPPacket) Encode() [FTP_PAYLOAD_LEN]byte {
+	var payload [FTP_PAYLOAD_LEN]byte
+	binary.LittleEndian.PutUint16(payload[0:2], p.Seq)
+	payload[2] = p.Session
+	payload[3] = p.Opcode
+	payload[4] = p.Size
+	if len(p.Data) > 0 {
+		payload[4] = uint8(copy(payload[ftpHeaderLen:], p.Data))
+	}
+	payload[5] = p.ReqOpcode
+	if p.BurstComplete {
+		payload[6] = 1
+	}
+	binary.LittleEndian.PutUint32(payload[8:12], p.Offset)
+	return payload
+}
+
+func DecodeFTPPacket(payload []byte) (FTPPacket, error) {
+	if len(payload) < ftpHeaderLen {
+		return FTPPacket{}, fmt.Errorf("FTP payload too short")
+	}
+	size := int(payload[4])
+	if ftpHeaderLen+size > len(payload) {
+		return FTPPacket{}, fmt.Errorf("FTP data size %d too large", size)
+	}
+	return FTPPacket{
+		Seq:           binary.LittleEndian.Uint16(payload[0:2]),
+		Session:       payload[2],
+		Opcode:        payload[3],
+		Size:          payload[4],
+		ReqOpcode:     payload[5],
+		BurstComplete: payload[6] != 0,
+		Offset:        binary.LittleEndian.Uint32(payload[8:12]),
+		Data:          append([]byte(nil), payload[ftpHeaderLen:ftpHeaderLen+size]...),
+	}, nil
+}
@@ -0,0 +1,463 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	// Flags of GIMBAL_MANAGER_SET_ATTITUDE, GIMBAL_MANAGER_SET_PITCHYAW,
+	// GIMBAL_MANAGER_STATUS and GIMBAL_DEVICE_ATTITUDE_STATUS. Without
+	// YAW_LOCK the yaw is relative to the vehicle's heading, with it the yaw
+	// is relative to north.
+	GIMBAL_MANAGER_FLAGS_RETRACT    = 1 << 0
+	GIMBAL_MANAGER_FLAGS_NEUTRAL    = 1 << 1
+	GIMBAL_MANAGER_FLAGS_ROLL_LOCK  = 1 << 2
+	GIMBAL_MANAGER_FLAGS_PITCH_LOCK = 1 << 3
+	GIMBAL_MANAGER_FLAGS_YAW_LOCK   = 1 << 4
+	// Set by newer gimbals alongside or instead of YAW_LOCK to say which
+	// frame the yaw in GIMBAL_DEVICE_ATTITUDE_STATUS is in
+	GIMBAL_DEVICE_FLAGS_YAW_IN_VEHICLE_FRAME = 1 << 5
+	GIMBAL_DEVICE_FLAGS_YAW_IN_EARTH_FRAME   = 1 << 6
+
+	// Capabilities in GIMBAL_MANAGER_INFORMATION
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_RETRACT                 = 1 << 0
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_NEUTRAL                 = 1 << 1
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_ROLL_AXIS               = 1 << 2
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_ROLL_FOLLOW             = 1 << 3
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_ROLL_LOCK               = 1 << 4
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_PITCH_AXIS              = 1 << 5
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_PITCH_FOLLOW            = 1 << 6
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_PITCH_LOCK              = 1 << 7
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_YAW_AXIS                = 1 << 8
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_YAW_FOLLOW              = 1 << 9
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_YAW_LOCK                = 1 << 10
+	GIMBAL_MANAGER_CAP_FLAGS_SUPPORTS_INFINITE_YAW       = 1 << 11
+	GIMBAL_MANAGER_CAP_FLAGS_SUPPORTS_YAW_IN_EARTH_FRAME = 1 << 12
+	GIMBAL_MANAGER_CAP_FLAGS_HAS_RC_INPUTS               = 1 << 13
+	GIMBAL_MANAGER_CAP_FLAGS_CAN_POINT_LOCATION_LOCAL    = 1 << 16
+	GIMBAL_MANAGER_CAP_FLAGS_CAN_POINT_LOCATION_GLOBAL   = 1 << 17
+
+	// Failures in GIMBAL_DEVICE_ATTITUDE_STATUS
+	GIMBAL_DEVICE_ERROR_FLAGS_AT_ROLL_LIMIT       = 1 << 0
+	GIMBAL_DEVICE_ERROR_FLAGS_AT_PITCH_LIMIT      = 1 << 1
+	GIMBAL_DEVICE_ERROR_FLAGS_AT_YAW_LIMIT        = 1 << 2
+	GIMBAL_DEVICE_ERROR_FLAGS_ENCODER_ERROR       = 1 << 3
+	GIMBAL_DEVICE_ERROR_FLAGS_POWER_ERROR         = 1 << 4
+	GIMBAL_DEVICE_ERROR_FLAGS_MOTOR_ERROR         = 1 << 5
+	GIMBAL_DEVICE_ERROR_FLAGS_SOFTWARE_ERROR      = 1 << 6
+	GIMBAL_DEVICE_ERROR_FLAGS_COMMUNICATION_ERROR = 1 << 7
+	GIMBAL_DEVICE_ERROR_FLAGS_CALIBRATION_RUNNING = 1 << 8
+	GIMBAL_DEVICE_ERROR_FLAGS_NO_MANAGER          = 1 << 9
+)
+
+// What a gimbal manager can do and the angles, in radians, its gimbal can
+// reach
+type GimbalManagerInformation struct {
+	TimeBootMs     uint32
+	CapFlags       uint32
+	RollMin        float32
+	RollMax        float32
+	PitchMin       float32
+	PitchMax       float32
+	YawMin         float32
+	YawMax         float32
+	GimbalDeviceID uint8
+}
+
+func (msg GimbalManagerInformation) MessageID() uint32 {
+	return MAVLINK_MSG_ID_GIMBAL_MANAGER_INFORMATION
+}
+
+func (msg GimbalManagerInformation) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_GIMBAL_MANAGER_INFORMATION
+}
+
+// The flags a gimbal manager is running its gimbal with and who is in
+// control of it. A control system and component of 0 means nobody.
+type GimbalManagerStatus struct {
+	TimeBootMs             uint32
+	Flags                  uint32
+	GimbalDeviceID         uint8
+	PrimaryControlSysid    uint8
+	PrimaryControlCompid   uint8
+	SecondaryControlSysid  uint8
+	SecondaryControlCompid uint8
+}
+
+func (msg GimbalManagerStatus) MessageID() uint32 {
+	return MAVLINK_MSG_ID_GIMBAL_MANAGER_STATUS
+}
+
+func (msg GimbalManagerStatus) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_GIMBAL_MANAGER_STATUS
+}
+
+// Points a gimbal at an attitude given as a quaternion, and or turns it at
+// angular rates in radians per second. NaN in Q or a rate leaves it alone.
+type GimbalManagerSetAttitude struct {
+	Flags            uint32
+	Q                [4]float32
+	AngularVelocityX float32
+	AngularVelocityY float32
+	AngularVelocityZ float32
+	TargetSystem     uint8
+	TargetComponent  uint8
+	GimbalDeviceID   uint8
+}
+
+func (msg GimbalManagerSetAttitude) MessageID() uint32 {
+	return MAVLINK_MSG_ID_GIMBAL_MANAGER_SET_ATTITUDE
+}
+
+func (msg GimbalManagerSetAttitude) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_GIMBAL_MANAGER_SET_ATTITUDE
+}
+
+// The attitude a gimbal is at, as a quaternion, and how fast it is turning
+type GimbalDeviceAttitudeStatus struct {
+	TimeBootMs       uint32
+	Q                [4]float32
+	AngularVelocityX float32
+	AngularVelocityY float32
+	AngularVelocityZ float32
+	FailureFlags     uint32
+	Flags            uint16
+	TargetSystem     uint8
+	TargetComponent  uint8
+	// extensions
+	DeltaYaw         float32
+	DeltaYawVelocity float32
+	GimbalDeviceID   uint8
+}
+
+func (msg GimbalDeviceAttitudeStatus) MessageID() uint32 {
+	return MAVLINK_MSG_ID_GIMBAL_DEVICE_ATTITUDE_STATUS
+}
+
+func (msg GimbalDeviceAttitudeStatus) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_GIMBAL_DEVICE_ATTITUDE_STATUS + 9
+}
+
+// Points a gimbal by pitch and yaw in radians, and or turns it at rates in
+// radians per second. NaN leaves an angle or rate alone.
+type GimbalManagerSetPitchyaw struct {
+	Flags           uint32
+	Pitch           float32
+	Yaw             float32
+	PitchRate       float32
+	YawRate         float32
+	TargetSystem    uint8
+	TargetComponent uint8
+	GimbalDeviceID  uint8
+}
+
+func (msg GimbalManagerSetPitchyaw) MessageID() uint32 {
+	return MAVLINK_MSG_ID_GIMBAL_MANAGER_SET_PITCHYAW
+}
+
+func (msg GimbalManagerSetPitchyaw) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_GIMBAL_MANAGER_SET_PITCHYAW
+}
+
+func decodeGimbalManagerInformation(data *RawMessage) (*GimbalManagerInformationMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_GIMBAL_MANAGER_INFORMATION)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for GIMBAL_MANAGER_INFORMATION message")
+	}
+	newMessage := &GimbalManagerInformationMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "GIMBAL_MANAGER_INFORMATION"),
+		TimeBootMs:            binary.LittleEndian.Uint32(payload[0:4]),
+		CapFlags:              binary.LittleEndian.Uint32(payload[4:8]),
+		RollMin:               float32At(payload, 8),
+		RollMax:               float32At(payload, 12),
+		PitchMin:              float32At(payload, 16),
+		PitchMax:              float32At(payload, 20),
+		YawMin:                float32At(payload, 24),
+		YawMax:                float32At(payload, 28),
+		GimbalDeviceID:        payload[32],
+	}
+	return newMessage, nil
+}
+
+type GimbalManagerInformationMessage struct {
+	DecodedMavlinkMessage
+	TimeBootMs     uint32
+	CapFlags       uint32
+	RollMin        float32
+	RollMax        float32
+	PitchMin       float32
+	PitchMax       float32
+	YawMin         float32
+	YawMax         float32
+	GimbalDeviceID uint8
+}
+
+func (m *GimbalManagerInformationMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *GimbalManagerInformationMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *GimbalManagerInformationMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeBootMs":     m.TimeBootMs,
+		"CapFlags":       m.CapFlags,
+		"RollMin":        m.RollMin,
+		"RollMax":        m.RollMax,
+		"PitchMin":       m.PitchMin,
+		"PitchMax":       m.PitchMax,
+		"YawMin":         m.YawMin,
+		"YawMax":         m.YawMax,
+		"GimbalDeviceID": m.GimbalDeviceID,
+	}
+}
+
+func decodeGimbalManagerStatus(data *RawMessage) (*GimbalManagerStatusMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_GIMBAL_MANAGER_STATUS)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for GIMBAL_MANAGER_STATUS message")
+	}
+	newMessage := &GimbalManagerStatusMessage{
+		DecodedMavlinkMessage:  newDecodedMavlinkMessage(data, "GIMBAL_MANAGER_STATUS"),
+		TimeBootMs:             binary.LittleEndian.Uint32(payload[0:4]),
+		Flags:                  binary.LittleEndian.Uint32(payload[4:8]),
+		GimbalDeviceID:         payload[8],
+		PrimaryControlSysid:    payload[9],
+		PrimaryControlCompid:   payload[10],
+		SecondaryControlSysid:  payload[11],
+		SecondaryControlCompid: payload[12],
+	}
+	return newMessage, nil
+}
+
+type GimbalManagerStatusMessage struct {
+	DecodedMavlinkMessage
+	TimeBootMs             uint32
+	Flags                  uint32
+	GimbalDeviceID         uint8
+	PrimaryControlSysid    uint8
+	PrimaryControlCompid   uint8
+	SecondaryControlSysid  uint8
+	SecondaryControlCompid uint8
+}
+
+func (m *GimbalManagerStatusMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *GimbalManagerStatusMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *GimbalManagerStatusMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeBootMs":             m.TimeBootMs,
+		"Flags":                  m.Flags,
+		"GimbalDeviceID":         m.GimbalDeviceID,
+		"PrimaryControlSysid":    m.PrimaryControlSysid,
+		"PrimaryControlCompid":   m.PrimaryControlCompid,
+		"SecondaryControlSysid":  m.SecondaryControlSysid,
+		"SecondaryControlCompid": m.SecondaryControlCompid,
+	}
+}
+
+func decodeGimbalManagerSetAttitude(data *RawMessage) (*GimbalManagerSetAttitudeMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_GIMBAL_MANAGER_SET_ATTITUDE)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for GIMBAL_MANAGER_SET_ATTITUDE message")
+	}
+	newMessage := &GimbalManagerSetAttitudeMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "GIMBAL_MANAGER_SET_ATTITUDE"),
+		Flags:                 binary.LittleEndian.Uint32(payload[0:4]),
+		AngularVelocityX:      float32At(payload, 20),
+		AngularVelocityY:      float32At(payload, 24),
+		AngularVelocityZ:      float32At(payload, 28),
+		TargetSystem:          payload[32],
+		TargetComponent:       payload[33],
+		GimbalDeviceID:        payload[34],
+	}
+	for i := range newMessage.Q {
+		newMessage.Q[i] = float32At(payload, 4+4*i)
+	}
+	return newMessage, nil
+}
+
+type GimbalManagerSetAttitudeMessage struct {
+	DecodedMavlinkMessage
+	Flags            uint32
+	Q                [4]float32
+	AngularVelocityX float32
+	AngularVelocityY float32
+	AngularVelocityZ float32
+	TargetSystem     uint8
+	TargetComponent  uint8
+	GimbalDeviceID   uint8
+}
+
+func (m *GimbalManagerSetAttitudeMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *GimbalManagerSetAttitudeMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *GimbalManagerSetAttitudeMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Flags":            m.Flags,
+		"Q":                m.Q,
+		"AngularVelocityX": m.AngularVelocityX,
+		"AngularVelocityY": m.AngularVelocityY,
+		"AngularVelocityZ": m.AngularVelocityZ,
+		"TargetSystem":     m.TargetSystem,
+		"TargetComponent":  m.TargetComponent,
+		"GimbalDeviceID":   m.GimbalDeviceID,
+	}
+}
+
+func decodeGimbalDeviceAttitudeStatus(data *RawMessage) (*GimbalDeviceAttitudeStatusMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_GIMBAL_DEVICE_ATTITUDE_STATUS + 9)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for GIMBAL_DEVICE_ATTITUDE_STATUS message")
+	}
+	newMessage := &GimbalDeviceAttitudeStatusMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "GIMBAL_DEVICE_ATTITUDE_STATUS"),
+		TimeBootMs:            binary.LittleEndian.Uint32(payload[0:4]),
+		AngularVelocityX:      float32At(payload, 20),
+		AngularVelocityY:      float32At(payload, 24),
+		AngularVelocityZ:      float32At(payload, 28),
+		FailureFlags:          binary.LittleEndian.Uint32(payload[32:36]),
+		Flags:                 binary.LittleEndian.Uint16(payload[36:38]),
+		TargetSystem:          payload[38],
+		TargetComponent:       payload[39],
+		DeltaYaw:              float32At(payload, 40),
+		DeltaYawVelocity:      float32At(payload, 44),
+		GimbalDeviceID:        payload[48],
+	}
+	for i := range newMessage.Q {
+		newMessage.Q[i] = float32At(payload, 4+4*i)
+	}
+	return newMessage, nil
+}
+
+// GimbalDeviceID is 0 when the gimbal is a MAVLink component of its own, and
+// from 1 to 6 when it is driven by the autopilot
+type GimbalDeviceAttitudeStatusMessage struct {
+	DecodedMavlinkMessage
+	TimeBootMs       uint32
+	Q                [4]float32
+	AngularVelocityX float32
+	AngularVelocityY float32
+	AngularVelocityZ float32
+	FailureFlags     uint32
+	Flags            uint16
+	TargetSystem     uint8
+	TargetComponent  uint8
+	DeltaYaw         float32
+	DeltaYawVelocity float32
+	GimbalDeviceID   uint8
+}
+
+func (m *GimbalDeviceAttitudeStatusMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *GimbalDeviceAttitudeStatusMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *GimbalDeviceAttitudeStatusMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeBootMs":       m.TimeBootMs,
+		"Q":                m.Q,
+		"AngularVelocityX": m.AngularVelocityX,
+		"AngularVelocityY": m.AngularVelocityY,
+		"AngularVelocityZ": m.AngularVelocityZ,
+		"FailureFlags":     m.FailureFlags,
+		"Flags":            m.Flags,
+		"TargetSystem":     m.TargetSystem,
+		"TargetComponent":  m.TargetComponent,
+		"DeltaYaw":         m.DeltaYaw,
+		"DeltaYawVelocity": m.DeltaYawVelocity,
+		"GimbalDeviceID":   m.GimbalDeviceID,
+	}
+}
+
+func decodeGimbalManagerSetPitchyaw(data *RawMessage) (*GimbalManagerSetPitchyawMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_GIMBAL_MANAGER_SET_PITCHYAW)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for GIMBAL_MANAGER_SET_PITCHYAW message")
+	}
+	newMessage := &GimbalManagerSetPitchyawMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "GIMBAL_MANAGER_SET_PITCHYAW"),
+		Flags:                 binary.LittleEndian.Uint32(payload[0:4]),
+		Pitch:                 float32At(payload, 4),
+		Yaw:                   float32At(payload, 8),
+		PitchRate:             float32At(payload, 12),
+		YawRate:               float32At(payload, 16),
+		TargetSystem:          payload[20],
+		TargetComponent:       payload[21],
+		GimbalDeviceID:        payload[22],
+	}
+	return newMessage, nil
+}
+
+type GimbalManagerSetPitchyawMessage struct {
+	DecodedMavlinkMessage
+	Flags           uint32
+	Pitch           float32
+	Yaw             float32
+	PitchRate       float32
+	YawRate         float32
+	TargetSystem    uint8
+	TargetComponent uint8
+	GimbalDeviceID  uint8
+}
+
+func (m *GimbalManagerSetPitchyawMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *GimbalManagerSetPitchyawMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *GimbalManagerSetPitchyawMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Flags":           m.Flags,
+		"Pitch":           m.Pitch,
+		"Yaw":             m.Yaw,
+		"PitchRate":       m.PitchRate,
+		"YawRate":         m.YawRate,
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+		"GimbalDeviceID":  m.GimbalDeviceID,
+	}
+}
+
+// Converts a roll, pitch and yaw in radians to the w, x, y, z quaternion
+// MAVLink messages carry attitudes in
+func QuaternionFromEuler(roll float64, pitch float64, yaw float64) [4]float32 {
+	cr, sr := math.Cos(roll/2), math.Sin(roll/2)
+	cp, sp := math.Cos(pitch/2), math.Sin(pitch/2)
+	cy, sy := math.Cos(yaw/2), math.Sin(yaw/2)
+	return [4]float32{
+		float32(cr*cp*cy + sr*sp*sy),
+		float32(sr*cp*cy - cr*sp*sy),
+		float32(cr*sp*cy + sr*cp*sy),
+		float32(cr*cp*sy - sr*sp*cy),
+	}
+}
+
+// Converts a w, x, y, z quaternion to a roll, pitch and yaw in radians
+func EulerFromQuaternion(q [4]float32) (roll float64, pitch float64, yaw float64) {
+	w, x, y, z := float64(q[0]), float64(q[1]), float64(q[2]), float64(q[3])
+	roll = math.Atan2(2*(w*x+y*z), 1-2*(x*x+y*y))
+	pitch = math.Asin(math.Max(-1, math.Min(1, 2*(w*y-z*x))))
+	yaw = math.Atan2(2*(w*z+x*y), 1-2*(y*y+z*z))
+	return roll, pitch, yaw
+}
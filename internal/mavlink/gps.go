@@ -0,0 +1,212 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// GPS_FIX_TYPE, the kind of fix in GPS_RAW_INT
+const (
+	GPS_FIX_TYPE_NO_GPS    = 0
+	GPS_FIX_TYPE_NO_FIX    = 1
+	GPS_FIX_TYPE_2D_FIX    = 2
+	GPS_FIX_TYPE_3D_FIX    = 3
+	GPS_FIX_TYPE_DGPS      = 4
+	GPS_FIX_TYPE_RTK_FLOAT = 5
+	GPS_FIX_TYPE_RTK_FIXED = 6
+	GPS_FIX_TYPE_STATIC    = 7
+	GPS_FIX_TYPE_PPP       = 8
+)
+
+// Sent in GPS_RAW_INT's dilutions, speed and course when they are unknown
+const GPS_UNKNOWN = 0xffff
+
+type GpsRawInt struct {
+	TimeUsec          uint64
+	Lat               int32  // degE7
+	Lon               int32  // degE7
+	Alt               int32  // mm above mean sea level
+	Eph               uint16 // HDOP * 100
+	Epv               uint16 // VDOP * 100
+	Vel               uint16 // cm/s
+	Cog               uint16 // cdeg
+	FixType           uint8
+	SatellitesVisible uint8 // 255 if unknown
+	// extensions
+	AltEllipsoid int32  // mm above the WGS84 ellipsoid
+	HAcc         uint32 // mm
+	VAcc         uint32 // mm
+	VelAcc       uint32 // mm/s
+	HdgAcc       uint32 // degE5
+	Yaw          uint16 // cdeg from north, 0 if unknown and 36000 for north
+}
+
+func (msg GpsRawInt) MessageID() uint32 {
+	return MAVLINK_MSG_ID_GPS_RAW_INT
+}
+
+func (msg GpsRawInt) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_GPS_RAW_INT
+}
+
+// Always sent as MAVLink 2 with the extensions, as autopilots do
+func (msg GpsRawInt) UsesExtensions() bool {
+	return true
+}
+
+func decodeGpsRawInt(data *RawMessage) (*GpsRawIntMessage, error) {
+	// the base message and 22 bytes of MAVLink 2 extensions
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_GPS_RAW_INT + 22)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for GPS_RAW_INT message")
+	}
+	newMessage := &GpsRawIntMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "GPS_RAW_INT"),
+		TimeUsec:              binary.LittleEndian.Uint64(payload[0:8]),
+		Lat:                   int32(binary.LittleEndian.Uint32(payload[8:12])),
+		Lon:                   int32(binary.LittleEndian.Uint32(payload[12:16])),
+		Alt:                   int32(binary.LittleEndian.Uint32(payload[16:20])),
+		Eph:                   binary.LittleEndian.Uint16(payload[20:22]),
+		Epv:                   binary.LittleEndian.Uint16(payload[22:24]),
+		Vel:                   binary.LittleEndian.Uint16(payload[24:26]),
+		Cog:                   binary.LittleEndian.Uint16(payload[26:28]),
+		FixType:               payload[28],
+		SatellitesVisible:     payload[29],
+		AltEllipsoid:          int32(binary.LittleEndian.Uint32(payload[30:34])),
+		HAcc:                  binary.LittleEndian.Uint32(payload[34:38]),
+		VAcc:                  binary.LittleEndian.Uint32(payload[38:42]),
+		VelAcc:                binary.LittleEndian.Uint32(payload[42:46]),
+		HdgAcc:                binary.LittleEndian.Uint32(payload[46:50]),
+		Yaw:                   binary.LittleEndian.Uint16(payload[50:52]),
+	}
+	return newMessage, nil
+}
+
+type GpsRawIntMessage struct {
+	DecodedMavlinkMessage
+	TimeUsec          uint64
+	Lat               int32
+	Lon               int32
+	Alt               int32
+	Eph               uint16
+	Epv               uint16
+	Vel               uint16
+	Cog               uint16
+	FixType           uint8
+	SatellitesVisible uint8
+	AltEllipsoid      int32
+	HAcc              uint32
+	VAcc              uint32
+	VelAcc            uint32
+	HdgAcc            uint32
+	Yaw               uint16
+}
+
+func (m *GpsRawIntMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *GpsRawIntMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *GpsRawIntMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeUsec":          m.TimeUsec,
+		"Lat":               m.Lat,
+		"Lon":               m.Lon,
+		"Alt":               m.Alt,
+		"Eph":               m.Eph,
+		"Epv":               m.Epv,
+		"Vel":               m.Vel,
+		"Cog":               m.Cog,
+		"FixType":           m.FixType,
+		"SatellitesVisible": m.SatellitesVisible,
+		"AltEllipsoid":      m.AltEllipsoid,
+		"HAcc":              m.HAcc,
+		"VAcc":              m.VAcc,
+		"VelAcc":            m.VelAcc,
+		"HdgAcc":            m.HdgAcc,
+		"Yaw":               m.Yaw,
+	}
+}
+
+type HomePosition struct {
+	Latitude  int32 // degE7
+	Longitude int32 // degE7
+	Altitude  int32 // mm above mean sea level
+	// local position of home, and the direction and point the vehicle
+	// approaches it from when landing
+	X         float32
+	Y         float32
+	Z         float32
+	Q         [4]float32
+	ApproachX float32
+	ApproachY float32
+	ApproachZ float32
+	// extensions
+	TimeUsec uint64 // since boot or the epoch
+}
+
+func (msg HomePosition) MessageID() uint32 {
+	return MAVLINK_MSG_ID_HOME_POSITION
+}
+
+func (msg HomePosition) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_HOME_POSITION
+}
+
+// Always sent as MAVLink 2 with the extensions, as autopilots do
+func (msg HomePosition) UsesExtensions() bool {
+	return true
+}
+
+func decodeHomePosition(data *RawMessage) (*HomePositionMessage, error) {
+	// the base message and 8 bytes of MAVLink 2 extensions
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_HOME_POSITION + 8)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for HOME_POSITION message")
+	}
+	newMessage := &HomePositionMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "HOME_POSITION"),
+		Latitude:              int32(binary.LittleEndian.Uint32(payload[0:4])),
+		Longitude:             int32(binary.LittleEndian.Uint32(payload[4:8])),
+		Altitude:              int32(binary.LittleEndian.Uint32(payload[8:12])),
+		X:                     float32At(payload, 12),
+		Y:                     float32At(payload, 16),
+		Z:                     float32At(payload, 20),
+		TimeUsec:              binary.LittleEndian.Uint64(payload[52:60]),
+	}
+	return newMessage, nil
+}
+
+type HomePositionMessage struct {
+	DecodedMavlinkMessage
+	Latitude  int32
+	Longitude int32
+	Altitude  int32
+	X         float32
+	Y         float32
+	Z         float32
+	TimeUsec  uint64
+}
+
+func (m *HomePositionMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *HomePositionMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *HomePositionMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Latitude":  m.Latitude,
+		"Longitude": m.Longitude,
+		"Altitude":  m.Altitude,
+		"X":         m.X,
+		"Y":         m.Y,
+		"Z":         m.Z,
+		"TimeUsec":  m.TimeUsec,
+	}
+}
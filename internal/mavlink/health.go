@@ -0,0 +1,114 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MAV_SYS_STATUS_SENSOR bits of SYS_STATUS's sensors present, enabled and
+// health
+const (
+	MAV_SYS_STATUS_SENSOR_3D_GYRO                = 1 << 0
+	MAV_SYS_STATUS_SENSOR_3D_ACCEL               = 1 << 1
+	MAV_SYS_STATUS_SENSOR_3D_MAG                 = 1 << 2
+	MAV_SYS_STATUS_SENSOR_ABSOLUTE_PRESSURE      = 1 << 3
+	MAV_SYS_STATUS_SENSOR_DIFFERENTIAL_PRESSURE  = 1 << 4
+	MAV_SYS_STATUS_SENSOR_GPS                    = 1 << 5
+	MAV_SYS_STATUS_SENSOR_OPTICAL_FLOW           = 1 << 6
+	MAV_SYS_STATUS_SENSOR_VISION_POSITION        = 1 << 7
+	MAV_SYS_STATUS_SENSOR_LASER_POSITION         = 1 << 8
+	MAV_SYS_STATUS_SENSOR_EXTERNAL_GROUND_TRUTH  = 1 << 9
+	MAV_SYS_STATUS_SENSOR_ANGULAR_RATE_CONTROL   = 1 << 10
+	MAV_SYS_STATUS_SENSOR_ATTITUDE_STABILIZATION = 1 << 11
+	MAV_SYS_STATUS_SENSOR_YAW_POSITION           = 1 << 12
+	MAV_SYS_STATUS_SENSOR_Z_ALTITUDE_CONTROL     = 1 << 13
+	MAV_SYS_STATUS_SENSOR_XY_POSITION_CONTROL    = 1 << 14
+	MAV_SYS_STATUS_SENSOR_MOTOR_OUTPUTS          = 1 << 15
+	MAV_SYS_STATUS_SENSOR_RC_RECEIVER            = 1 << 16
+	MAV_SYS_STATUS_SENSOR_3D_GYRO2               = 1 << 17
+	MAV_SYS_STATUS_SENSOR_3D_ACCEL2              = 1 << 18
+	MAV_SYS_STATUS_SENSOR_3D_MAG2                = 1 << 19
+	MAV_SYS_STATUS_GEOFENCE                      = 1 << 20
+	MAV_SYS_STATUS_AHRS                          = 1 << 21
+	MAV_SYS_STATUS_TERRAIN                       = 1 << 22
+	MAV_SYS_STATUS_REVERSE_MOTOR                 = 1 << 23
+	MAV_SYS_STATUS_LOGGING                       = 1 << 24
+	MAV_SYS_STATUS_SENSOR_BATTERY                = 1 << 25
+	MAV_SYS_STATUS_SENSOR_PROXIMITY              = 1 << 26
+	MAV_SYS_STATUS_SENSOR_SATCOM                 = 1 << 27
+	MAV_SYS_STATUS_PREARM_CHECK                  = 1 << 28
+	MAV_SYS_STATUS_OBSTACLE_AVOIDANCE            = 1 << 29
+	MAV_SYS_STATUS_SENSOR_PROPULSION             = 1 << 30
+	MAV_SYS_STATUS_EXTENSION_USED                = 1 << 31
+
+	// MAV_SYS_STATUS_SENSOR_EXTENDED bits of the extended fields
+	MAV_SYS_STATUS_RECOVERY_SYSTEM = 1 << 0
+)
+
+// Vibration levels of the vehicle's accelerometers in m/s², and how many
+// times each accelerometer has clipped since boot
+type Vibration struct {
+	TimeUsec   uint64
+	VibrationX float32
+	VibrationY float32
+	VibrationZ float32
+	Clipping0  uint32
+	Clipping1  uint32
+	Clipping2  uint32
+}
+
+func (msg Vibration) MessageID() uint32 {
+	return MAVLINK_MSG_ID_VIBRATION
+}
+
+func (msg Vibration) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_VIBRATION
+}
+
+func decodeVibration(data *RawMessage) (*VibrationMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_VIBRATION)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for VIBRATION message")
+	}
+	newMessage := &VibrationMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "VIBRATION"),
+		TimeUsec:              binary.LittleEndian.Uint64(payload[0:8]),
+		VibrationX:            float32At(payload, 8),
+		VibrationY:            float32At(payload, 12),
+		VibrationZ:            float32At(payload, 16),
+		Clipping: [3]uint32{
+			binary.LittleEndian.Uint32(payload[20:24]),
+			binary.LittleEndian.Uint32(payload[24:28]),
+			binary.LittleEndian.Uint32(payload[28:32]),
+		},
+	}
+	return newMessage, nil
+}
+
+type VibrationMessage struct {
+	DecodedMavlinkMessage
+	TimeUsec   uint64
+	VibrationX float32
+	VibrationY float32
+	VibrationZ float32
+	// by accelerometer
+	Clipping [3]uint32
+}
+
+func (m *VibrationMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *VibrationMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *VibrationMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeUsec":   m.TimeUsec,
+		"VibrationX": m.VibrationX,
+		"VibrationY": m.VibrationY,
+		"VibrationZ": m.VibrationZ,
+		"Clipping":   m.Clipping,
+	}
+}
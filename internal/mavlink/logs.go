@@ -0,0 +1,315 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Most bytes of a log a single LOG_DATA carries
+const LOG_DATA_LEN = 90
+
+// Asks for the entries of the logs numbered from Start to End
+type LogRequestList struct {
+	Start           uint16
+	End             uint16 // 0xffff for the last log
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (msg LogRequestList) MessageID() uint32 {
+	return MAVLINK_MSG_ID_LOG_REQUEST_LIST
+}
+
+func (msg LogRequestList) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_LOG_REQUEST_LIST
+}
+
+// One log stored on the vehicle. TimeUtc is seconds since 1970, or 0 if the
+// vehicle didn't know the time when it was written.
+type LogEntry struct {
+	TimeUtc    uint32
+	Size       uint32
+	ID         uint16
+	NumLogs    uint16
+	LastLogNum uint16
+}
+
+func (msg LogEntry) MessageID() uint32 {
+	return MAVLINK_MSG_ID_LOG_ENTRY
+}
+
+func (msg LogEntry) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_LOG_ENTRY
+}
+
+// Asks for Count bytes of a log starting at Ofs
+type LogRequestData struct {
+	Ofs             uint32
+	Count           uint32
+	ID              uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (msg LogRequestData) MessageID() uint32 {
+	return MAVLINK_MSG_ID_LOG_REQUEST_DATA
+}
+
+func (msg LogRequestData) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_LOG_REQUEST_DATA
+}
+
+// A chunk of a log. A Count of 0 means Ofs is past the end of the log.
+type LogData struct {
+	Ofs   uint32
+	ID    uint16
+	Count uint8
+	Data  [LOG_DATA_LEN]byte
+}
+
+func (msg LogData) MessageID() uint32 {
+	return MAVLINK_MSG_ID_LOG_DATA
+}
+
+func (msg LogData) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_LOG_DATA
+}
+
+// Erases every log on the vehicle
+type LogErase struct {
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (msg LogErase) MessageID() uint32 {
+	return MAVLINK_MSG_ID_LOG_ERASE
+}
+
+func (msg LogErase) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_LOG_ERASE
+}
+
+// Ends a log transfer, so that the vehicle can go back to logging
+type LogRequestEnd struct {
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (msg LogRequestEnd) MessageID() uint32 {
+	return MAVLINK_MSG_ID_LOG_REQUEST_END
+}
+
+func (msg LogRequestEnd) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_LOG_REQUEST_END
+}
+
+func decodeLogRequestList(data *RawMessage) (*LogRequestListMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_LOG_REQUEST_LIST)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for LOG_REQUEST_LIST message")
+	}
+	newMessage := &LogRequestListMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "LOG_REQUEST_LIST"),
+		Start:                 binary.LittleEndian.Uint16(payload[0:2]),
+		End:                   binary.LittleEndian.Uint16(payload[2:4]),
+		TargetSystem:          payload[4],
+		TargetComponent:       payload[5],
+	}
+	return newMessage, nil
+}
+
+type LogRequestListMessage struct {
+	DecodedMavlinkMessage
+	Start           uint16
+	End             uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (m *LogRequestListMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *LogRequestListMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *LogRequestListMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Start":           m.Start,
+		"End":             m.End,
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+	}
+}
+
+func decodeLogEntry(data *RawMessage) (*LogEntryMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_LOG_ENTRY)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for LOG_ENTRY message")
+	}
+	newMessage := &LogEntryMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "LOG_ENTRY"),
+		TimeUtc:               binary.LittleEndian.Uint32(payload[0:4]),
+		Size:                  binary.LittleEndian.Uint32(payload[4:8]),
+		ID:                    binary.LittleEndian.Uint16(payload[8:10]),
+		NumLogs:               binary.LittleEndian.Uint16(payload[10:12]),
+		LastLogNum:            binary.LittleEndian.Uint16(payload[12:14]),
+	}
+	return newMessage, nil
+}
+
+type LogEntryMessage struct {
+	DecodedMavlinkMessage
+	TimeUtc    uint32
+	Size       uint32
+	ID         uint16
+	NumLogs    uint16
+	LastLogNum uint16
+}
+
+func (m *LogEntryMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *LogEntryMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *LogEntryMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeUtc":    m.TimeUtc,
+		"Size":       m.Size,
+		"ID":         m.ID,
+		"NumLogs":    m.NumLogs,
+		"LastLogNum": m.LastLogNum,
+	}
+}
+
+func decodeLogRequestData(data *RawMessage) (*LogRequestDataMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_LOG_REQUEST_DATA)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for LOG_REQUEST_DATA message")
+	}
+	newMessage := &LogRequestDataMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "LOG_REQUEST_DATA"),
+		Ofs:                   binary.LittleEndian.Uint32(payload[0:4]),
+		Count:                 binary.LittleEndian.Uint32(payload[4:8]),
+		ID:                    binary.LittleEndian.Uint16(payload[8:10]),
+		TargetSystem:          payload[10],
+		TargetComponent:       payload[11],
+	}
+	return newMessage, nil
+}
+
+type LogRequestDataMessage struct {
+	DecodedMavlinkMessage
+	Ofs             uint32
+	Count           uint32
+	ID              uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (m *LogRequestDataMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *LogRequestDataMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *LogRequestDataMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Ofs":             m.Ofs,
+		"Count":           m.Count,
+		"ID":              m.ID,
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+	}
+}
+
+func decodeLogData(data *RawMessage) (*LogDataMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_LOG_DATA)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for LOG_DATA message")
+	}
+	count := payload[6]
+	if count > LOG_DATA_LEN {
+		return nil, fmt.Errorf("invalid count %d in LOG_DATA message", count)
+	}
+	newMessage := &LogDataMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "LOG_DATA"),
+		Ofs:                   binary.LittleEndian.Uint32(payload[0:4]),
+		ID:                    binary.LittleEndian.Uint16(payload[4:6]),
+		Count:                 count,
+		Data:                  payload[7 : 7+count],
+	}
+	return newMessage, nil
+}
+
+// Data only holds the Count bytes of the log the message carries
+type LogDataMessage struct {
+	DecodedMavlinkMessage
+	Ofs   uint32
+	ID    uint16
+	Count uint8
+	Data  []byte
+}
+
+func (m *LogDataMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *LogDataMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *LogDataMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Ofs":   m.Ofs,
+		"ID":    m.ID,
+		"Count": m.Count,
+		"Data":  m.Data,
+	}
+}
+
+// LOG_ERASE and LOG_REQUEST_END only carry their target, so they share a
+// decoder
+func decodeLogTarget(data *RawMessage) (*LogTargetMessage, error) {
+	name := "LOG_ERASE"
+	if data.MessageID == MAVLINK_MSG_ID_LOG_REQUEST_END {
+		name = "LOG_REQUEST_END"
+	}
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_LOG_ERASE)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for %s message", name)
+	}
+	newMessage := &LogTargetMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, name),
+		TargetSystem:          payload[0],
+		TargetComponent:       payload[1],
+	}
+	return newMessage, nil
+}
+
+type LogTargetMessage struct {
+	DecodedMavlinkMessage
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (m *LogTargetMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *LogTargetMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *LogTargetMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+	}
+}
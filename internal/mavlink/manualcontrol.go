@@ -0,0 +1,99 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Full deflection of a MANUAL_CONTROL axis
+	MANUAL_CONTROL_AXIS_MAX = 1000
+	// Value of an axis that isn't being sent
+	MANUAL_CONTROL_AXIS_UNUSED = 32767
+
+	// Bits of EnabledExtensions saying S and T are in use
+	MANUAL_CONTROL_EXTENSION_S = 1 << 0
+	MANUAL_CONTROL_EXTENSION_T = 1 << 1
+)
+
+// Joystick input. X is pitch, Y roll, Z thrust and R yaw, each from -1000 to
+// 1000, except that autopilots take Z from 0 to 1000 for throttle.
+type ManualControl struct {
+	X       int16
+	Y       int16
+	Z       int16
+	R       int16
+	Buttons uint16 // buttons 1 to 16, one bit each
+	Target  uint8
+	// extensions
+	Buttons2          uint16 // buttons 17 to 32
+	EnabledExtensions uint8
+	S                 int16
+	T                 int16
+}
+
+func (msg ManualControl) MessageID() uint32 {
+	return MAVLINK_MSG_ID_MANUAL_CONTROL
+}
+
+func (msg ManualControl) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_MANUAL_CONTROL + 7
+}
+
+func decodeManualControl(data *RawMessage) (*ManualControlMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_MANUAL_CONTROL + 7)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for MANUAL_CONTROL message")
+	}
+	newMessage := &ManualControlMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "MANUAL_CONTROL"),
+		X:                     int16(binary.LittleEndian.Uint16(payload[0:2])),
+		Y:                     int16(binary.LittleEndian.Uint16(payload[2:4])),
+		Z:                     int16(binary.LittleEndian.Uint16(payload[4:6])),
+		R:                     int16(binary.LittleEndian.Uint16(payload[6:8])),
+		Buttons:               binary.LittleEndian.Uint16(payload[8:10]),
+		Target:                payload[10],
+		Buttons2:              binary.LittleEndian.Uint16(payload[11:13]),
+		EnabledExtensions:     payload[13],
+		S:                     int16(binary.LittleEndian.Uint16(payload[14:16])),
+		T:                     int16(binary.LittleEndian.Uint16(payload[16:18])),
+	}
+	return newMessage, nil
+}
+
+type ManualControlMessage struct {
+	DecodedMavlinkMessage
+	X                 int16
+	Y                 int16
+	Z                 int16
+	R                 int16
+	Buttons           uint16
+	Target            uint8
+	Buttons2          uint16
+	EnabledExtensions uint8
+	S                 int16
+	T                 int16
+}
+
+func (m *ManualControlMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *ManualControlMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *ManualControlMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"X":                 m.X,
+		"Y":                 m.Y,
+		"Z":                 m.Z,
+		"R":                 m.R,
+		"Buttons":           m.Buttons,
+		"Target":            m.Target,
+		"Buttons2":          m.Buttons2,
+		"EnabledExtensions": m.EnabledExtensions,
+		"S":                 m.S,
+		"T":                 m.T,
+	}
+}
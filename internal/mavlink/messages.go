@@ -2,22 +2,423 @@ package mavlink
 
 const (
 	// Message IDs
-	MAVLINK_MSG_ID_COMMAND_LONG = 76
+	MAVLINK_MSG_ID_HEARTBEAT                      = 0
+	MAVLINK_MSG_ID_SYS_STATUS                     = 1
+	MAVLINK_MSG_ID_SET_MODE                       = 11
+	MAVLINK_MSG_ID_PARAM_REQUEST_READ             = 20
+	MAVLINK_MSG_ID_PARAM_REQUEST_LIST             = 21
+	MAVLINK_MSG_ID_PARAM_VALUE                    = 22
+	MAVLINK_MSG_ID_PARAM_SET                      = 23
+	MAVLINK_MSG_ID_GPS_RAW_INT                    = 24
+	MAVLINK_MSG_ID_GLOBAL_POSITION_INT            = 33
+	MAVLINK_MSG_ID_SERVO_OUTPUT_RAW               = 36
+	MAVLINK_MSG_ID_MISSION_ITEM                   = 39
+	MAVLINK_MSG_ID_MISSION_REQUEST                = 40
+	MAVLINK_MSG_ID_MISSION_SET_CURRENT            = 41
+	MAVLINK_MSG_ID_MISSION_REQUEST_LIST           = 43
+	MAVLINK_MSG_ID_MISSION_COUNT                  = 44
+	MAVLINK_MSG_ID_MISSION_CLEAR_ALL              = 45
+	MAVLINK_MSG_ID_MISSION_ACK                    = 47
+	MAVLINK_MSG_ID_MISSION_REQUEST_INT            = 51
+	MAVLINK_MSG_ID_RC_CHANNELS                    = 65
+	MAVLINK_MSG_ID_REQUEST_DATA_STREAM            = 66
+	MAVLINK_MSG_ID_MANUAL_CONTROL                 = 69
+	MAVLINK_MSG_ID_RC_CHANNELS_OVERRIDE           = 70
+	MAVLINK_MSG_ID_MISSION_ITEM_INT               = 73
+	MAVLINK_MSG_ID_VFR_HUD                        = 74
+	MAVLINK_MSG_ID_COMMAND_INT                    = 75
+	MAVLINK_MSG_ID_COMMAND_LONG                   = 76
+	MAVLINK_MSG_ID_COMMAND_ACK                    = 77
+	MAVLINK_MSG_ID_SET_ATTITUDE_TARGET            = 82
+	MAVLINK_MSG_ID_SET_POSITION_TARGET_LOCAL_NED  = 84
+	MAVLINK_MSG_ID_SET_POSITION_TARGET_GLOBAL_INT = 86
+	MAVLINK_MSG_ID_VISION_POSITION_ESTIMATE       = 102
+	MAVLINK_MSG_ID_VISION_SPEED_ESTIMATE          = 103
+	MAVLINK_MSG_ID_FILE_TRANSFER_PROTOCOL         = 110
+	MAVLINK_MSG_ID_TIMESYNC                       = 111
+	MAVLINK_MSG_ID_LOG_REQUEST_LIST               = 117
+	MAVLINK_MSG_ID_LOG_ENTRY                      = 118
+	MAVLINK_MSG_ID_LOG_REQUEST_DATA               = 119
+	MAVLINK_MSG_ID_LOG_DATA                       = 120
+	MAVLINK_MSG_ID_LOG_ERASE                      = 121
+	MAVLINK_MSG_ID_LOG_REQUEST_END                = 122
+	MAVLINK_MSG_ID_GPS_INJECT_DATA                = 123
+	MAVLINK_MSG_ID_AUTOPILOT_VERSION              = 148
+	MAVLINK_MSG_ID_AUTOPILOT_VERSION_REQUEST      = 183
+	MAVLINK_MSG_ID_EKF_STATUS_REPORT              = 193
+	MAVLINK_MSG_ID_ESTIMATOR_STATUS               = 230
+	MAVLINK_MSG_ID_GPS_RTCM_DATA                  = 233
+	MAVLINK_MSG_ID_VIBRATION                      = 241
+	MAVLINK_MSG_ID_HOME_POSITION                  = 242
+	MAVLINK_MSG_ID_EXTENDED_SYS_STATE             = 245
+	MAVLINK_MSG_ID_ADSB_VEHICLE                   = 246
+	MAVLINK_MSG_ID_STATUSTEXT                     = 253
+	MAVLINK_MSG_ID_CAMERA_INFORMATION             = 259
+	MAVLINK_MSG_ID_CAMERA_SETTINGS                = 260
+	MAVLINK_MSG_ID_CAMERA_CAPTURE_STATUS          = 262
+	MAVLINK_MSG_ID_CAMERA_IMAGE_CAPTURED          = 263
+	MAVLINK_MSG_ID_GIMBAL_MANAGER_INFORMATION     = 280
+	MAVLINK_MSG_ID_GIMBAL_MANAGER_STATUS          = 281
+	MAVLINK_MSG_ID_GIMBAL_MANAGER_SET_ATTITUDE    = 282
+	MAVLINK_MSG_ID_GIMBAL_DEVICE_ATTITUDE_STATUS  = 285
+	MAVLINK_MSG_ID_GIMBAL_MANAGER_SET_PITCHYAW    = 287
+	MAVLINK_MSG_ID_ODOMETRY                       = 331
 
 	// Message sizes
-	MAVLINK_MSG_SIZE_COMMAND_LONG = 33
+	MAVLINK_MSG_SIZE_HEARTBEAT                      = 9
+	MAVLINK_MSG_SIZE_SYS_STATUS                     = 31
+	MAVLINK_MSG_SIZE_PARAM_REQUEST_READ             = 20
+	MAVLINK_MSG_SIZE_PARAM_REQUEST_LIST             = 2
+	MAVLINK_MSG_SIZE_PARAM_VALUE                    = 25
+	MAVLINK_MSG_SIZE_PARAM_SET                      = 23
+	MAVLINK_MSG_SIZE_GPS_RAW_INT                    = 30
+	MAVLINK_MSG_SIZE_GLOBAL_POSITION_INT            = 28
+	MAVLINK_MSG_SIZE_SERVO_OUTPUT_RAW               = 21
+	MAVLINK_MSG_SIZE_MISSION_REQUEST                = 4
+	MAVLINK_MSG_SIZE_MISSION_REQUEST_LIST           = 2
+	MAVLINK_MSG_SIZE_MISSION_COUNT                  = 4
+	MAVLINK_MSG_SIZE_MISSION_ACK                    = 3
+	MAVLINK_MSG_SIZE_MISSION_REQUEST_INT            = 4
+	MAVLINK_MSG_SIZE_RC_CHANNELS                    = 42
+	MAVLINK_MSG_SIZE_REQUEST_DATA_STREAM            = 6
+	MAVLINK_MSG_SIZE_MANUAL_CONTROL                 = 11
+	MAVLINK_MSG_SIZE_RC_CHANNELS_OVERRIDE           = 18
+	MAVLINK_MSG_SIZE_MISSION_ITEM_INT               = 37
+	MAVLINK_MSG_SIZE_VFR_HUD                        = 20
+	MAVLINK_MSG_SIZE_COMMAND_INT                    = 35
+	MAVLINK_MSG_SIZE_COMMAND_LONG                   = 33
+	MAVLINK_MSG_SIZE_COMMAND_ACK                    = 3
+	MAVLINK_MSG_SIZE_SET_POSITION_TARGET_LOCAL_NED  = 53
+	MAVLINK_MSG_SIZE_SET_POSITION_TARGET_GLOBAL_INT = 53
+	MAVLINK_MSG_SIZE_VISION_POSITION_ESTIMATE       = 32
+	MAVLINK_MSG_SIZE_VISION_SPEED_ESTIMATE          = 20
+	MAVLINK_MSG_SIZE_FILE_TRANSFER_PROTOCOL         = 254
+	MAVLINK_MSG_SIZE_TIMESYNC                       = 16
+	MAVLINK_MSG_SIZE_LOG_REQUEST_LIST               = 6
+	MAVLINK_MSG_SIZE_LOG_ENTRY                      = 14
+	MAVLINK_MSG_SIZE_LOG_REQUEST_DATA               = 12
+	MAVLINK_MSG_SIZE_LOG_DATA                       = 97
+	MAVLINK_MSG_SIZE_LOG_ERASE                      = 2
+	MAVLINK_MSG_SIZE_LOG_REQUEST_END                = 2
+	MAVLINK_MSG_SIZE_AUTOPILOT_VERSION              = 60
+	MAVLINK_MSG_SIZE_EKF_STATUS_REPORT              = 22
+	MAVLINK_MSG_SIZE_ESTIMATOR_STATUS               = 42
+	MAVLINK_MSG_SIZE_GPS_RTCM_DATA                  = 182
+	MAVLINK_MSG_SIZE_VIBRATION                      = 32
+	MAVLINK_MSG_SIZE_HOME_POSITION                  = 52
+	MAVLINK_MSG_SIZE_EXTENDED_SYS_STATE             = 2
+	MAVLINK_MSG_SIZE_ADSB_VEHICLE                   = 38
+	MAVLINK_MSG_SIZE_STATUSTEXT                     = 51
+	MAVLINK_MSG_SIZE_CAMERA_INFORMATION             = 235
+	MAVLINK_MSG_SIZE_CAMERA_SETTINGS                = 5
+	MAVLINK_MSG_SIZE_CAMERA_CAPTURE_STATUS          = 18
+	MAVLINK_MSG_SIZE_CAMERA_IMAGE_CAPTURED          = 255
+	MAVLINK_MSG_SIZE_GIMBAL_MANAGER_INFORMATION     = 33
+	MAVLINK_MSG_SIZE_GIMBAL_MANAGER_STATUS          = 13
+	MAVLINK_MSG_SIZE_GIMBAL_MANAGER_SET_ATTITUDE    = 35
+	MAVLINK_MSG_SIZE_GIMBAL_DEVICE_ATTITUDE_STATUS  = 40
+	MAVLINK_MSG_SIZE_GIMBAL_MANAGER_SET_PITCHYAW    = 23
+	MAVLINK_MSG_SIZE_ODOMETRY                       = 230
 
 	// Command IDs
 	MAV_CMD_COMPONENT_ARM_DISARM = 400
+	MAV_CMD_NAV_RETURN_TO_LAUNCH = 20
+	MAV_CMD_NAV_LAND             = 21
 	MAV_CMD_NAV_TAKEOFF          = 22
+	MAV_CMD_DO_SET_MODE          = 176
+	MAV_CMD_DO_SET_ROI_LOCATION  = 195
+	MAV_CMD_DO_SET_ROI_NONE      = 197
+	MAV_CMD_DO_SET_ROI_SYSID     = 198
 	MAV_CMD_SET_MESSAGE_INTERVAL = 511
+	MAV_CMD_REQUEST_MESSAGE      = 512
+	// asks for AUTOPILOT_VERSION on firmware too old for MAV_CMD_REQUEST_MESSAGE
+	MAV_CMD_REQUEST_AUTOPILOT_CAPABILITIES = 520
+	MAV_CMD_SET_CAMERA_MODE                = 530
+	// takes control of a gimbal, and points it by pitch and yaw
+	MAV_CMD_DO_GIMBAL_MANAGER_PITCHYAW  = 1000
+	MAV_CMD_DO_GIMBAL_MANAGER_CONFIGURE = 1001
+	// camera capture, sent to the camera component
+	MAV_CMD_IMAGE_START_CAPTURE = 2000
+	MAV_CMD_IMAGE_STOP_CAPTURE  = 2001
+	MAV_CMD_VIDEO_START_CAPTURE = 2500
+	MAV_CMD_VIDEO_STOP_CAPTURE  = 2501
+
+	// Geofence items
+	MAV_CMD_NAV_FENCE_RETURN_POINT             = 5000
+	MAV_CMD_NAV_FENCE_POLYGON_VERTEX_INCLUSION = 5001
+	MAV_CMD_NAV_FENCE_POLYGON_VERTEX_EXCLUSION = 5002
+	MAV_CMD_NAV_FENCE_CIRCLE_INCLUSION         = 5003
+	MAV_CMD_NAV_FENCE_CIRCLE_EXCLUSION         = 5004
+	MAV_CMD_NAV_RALLY_POINT                    = 5100
+
+	// Legacy groups of messages for REQUEST_DATA_STREAM
+	MAV_DATA_STREAM_ALL             = 0
+	MAV_DATA_STREAM_RAW_SENSORS     = 1
+	MAV_DATA_STREAM_EXTENDED_STATUS = 2
+	MAV_DATA_STREAM_RC_CHANNELS     = 3
+	MAV_DATA_STREAM_RAW_CONTROLLER  = 4
+	MAV_DATA_STREAM_POSITION        = 6
+	MAV_DATA_STREAM_EXTRA1          = 10
+	MAV_DATA_STREAM_EXTRA2          = 11
+	MAV_DATA_STREAM_EXTRA3          = 12
+
+	// Command results
+	MAV_RESULT_ACCEPTED             = 0
+	MAV_RESULT_TEMPORARILY_REJECTED = 1
+	MAV_RESULT_DENIED               = 2
+	MAV_RESULT_UNSUPPORTED          = 3
+	MAV_RESULT_FAILED               = 4
+	MAV_RESULT_IN_PROGRESS          = 5
+
+	// Status text severities
+	MAV_SEVERITY_EMERGENCY = 0
+	MAV_SEVERITY_ALERT     = 1
+	MAV_SEVERITY_CRITICAL  = 2
+	MAV_SEVERITY_ERROR     = 3
+	MAV_SEVERITY_WARNING   = 4
+	MAV_SEVERITY_NOTICE    = 5
+	MAV_SEVERITY_INFO      = 6
+	MAV_SEVERITY_DEBUG     = 7
+
+	// Mission results
+	MAV_MISSION_ACCEPTED            = 0
+	MAV_MISSION_ERROR               = 1
+	MAV_MISSION_UNSUPPORTED         = 3
+	MAV_MISSION_NO_SPACE            = 4
+	MAV_MISSION_INVALID_SEQUENCE    = 13
+	MAV_MISSION_DENIED              = 14
+	MAV_MISSION_OPERATION_CANCELLED = 15
+
+	// Mission types, a MAVLink 2 extension to the mission messages
+	MAV_MISSION_TYPE_MISSION = 0
+	MAV_MISSION_TYPE_FENCE   = 1
+	MAV_MISSION_TYPE_RALLY   = 2
+
+	// Parameter types
+	MAV_PARAM_TYPE_UINT8  = 1
+	MAV_PARAM_TYPE_INT8   = 2
+	MAV_PARAM_TYPE_UINT16 = 3
+	MAV_PARAM_TYPE_INT16  = 4
+	MAV_PARAM_TYPE_UINT32 = 5
+	MAV_PARAM_TYPE_INT32  = 6
+	MAV_PARAM_TYPE_REAL32 = 9
+
+	// Base mode flags
+	MAV_MODE_FLAG_CUSTOM_MODE_ENABLED  = 1 << 0
+	MAV_MODE_FLAG_GUIDED_ENABLED       = 1 << 3
+	MAV_MODE_FLAG_STABILIZE_ENABLED    = 1 << 4
+	MAV_MODE_FLAG_MANUAL_INPUT_ENABLED = 1 << 6
+	MAV_MODE_FLAG_SAFETY_ARMED         = 1 << 7
+
+	// Coordinate frames for position targets and mission items
+	MAV_FRAME_GLOBAL                  = 0
+	MAV_FRAME_LOCAL_NED               = 1
+	MAV_FRAME_GLOBAL_RELATIVE_ALT     = 3
+	MAV_FRAME_GLOBAL_INT              = 5
+	MAV_FRAME_GLOBAL_RELATIVE_ALT_INT = 6
+	MAV_FRAME_LOCAL_OFFSET_NED        = 7
+	MAV_FRAME_BODY_OFFSET_NED         = 9
+	MAV_FRAME_GLOBAL_TERRAIN_ALT      = 10
+	MAV_FRAME_GLOBAL_TERRAIN_ALT_INT  = 11
+	MAV_FRAME_BODY_FRD                = 12
+	MAV_FRAME_LOCAL_FRD               = 20
+
+	// Parts of a position target for the vehicle to ignore
+	POSITION_TARGET_TYPEMASK_X_IGNORE        = 1 << 0
+	POSITION_TARGET_TYPEMASK_Y_IGNORE        = 1 << 1
+	POSITION_TARGET_TYPEMASK_Z_IGNORE        = 1 << 2
+	POSITION_TARGET_TYPEMASK_VX_IGNORE       = 1 << 3
+	POSITION_TARGET_TYPEMASK_VY_IGNORE       = 1 << 4
+	POSITION_TARGET_TYPEMASK_VZ_IGNORE       = 1 << 5
+	POSITION_TARGET_TYPEMASK_AX_IGNORE       = 1 << 6
+	POSITION_TARGET_TYPEMASK_AY_IGNORE       = 1 << 7
+	POSITION_TARGET_TYPEMASK_AZ_IGNORE       = 1 << 8
+	POSITION_TARGET_TYPEMASK_FORCE_SET       = 1 << 9
+	POSITION_TARGET_TYPEMASK_YAW_IGNORE      = 1 << 10
+	POSITION_TARGET_TYPEMASK_YAW_RATE_IGNORE = 1 << 11
+
+	// Whether the vehicle is on the ground, from EXTENDED_SYS_STATE
+	MAV_LANDED_STATE_UNDEFINED = 0
+	MAV_LANDED_STATE_ON_GROUND = 1
+	MAV_LANDED_STATE_IN_AIR    = 2
+	MAV_LANDED_STATE_TAKEOFF   = 3
+	MAV_LANDED_STATE_LANDING   = 4
+
+	// Autopilot types and system states reported in the heartbeat
+	MAV_AUTOPILOT_GENERIC       = 0
+	MAV_AUTOPILOT_ARDUPILOTMEGA = 3
+	MAV_AUTOPILOT_PX4           = 12
+	MAV_STATE_STANDBY           = 3
+	MAV_STATE_ACTIVE            = 4
+	// Sent by components that are not autopilots, such as cameras and
+	// ground stations
+	MAV_AUTOPILOT_INVALID       = 8
+	MAV_TYPE_GCS                = 6
+	MAV_TYPE_ONBOARD_CONTROLLER = 18
+	MAV_TYPE_CAMERA             = 30
+
+	// Component IDs cameras and companion computers use
+	MAV_COMP_ID_CAMERA           = 100
+	MAV_COMP_ID_CAMERA6          = 105
+	MAV_COMP_ID_ONBOARD_COMPUTER = 191
+
+	// Capability flags in AUTOPILOT_VERSION
+	MAV_PROTOCOL_CAPABILITY_MISSION_FLOAT                  = 1 << 0
+	MAV_PROTOCOL_CAPABILITY_PARAM_FLOAT                    = 1 << 1
+	MAV_PROTOCOL_CAPABILITY_MISSION_INT                    = 1 << 2
+	MAV_PROTOCOL_CAPABILITY_COMMAND_INT                    = 1 << 3
+	MAV_PROTOCOL_CAPABILITY_PARAM_ENCODE_BYTEWISE          = 1 << 4
+	MAV_PROTOCOL_CAPABILITY_FTP                            = 1 << 5
+	MAV_PROTOCOL_CAPABILITY_SET_ATTITUDE_TARGET            = 1 << 6
+	MAV_PROTOCOL_CAPABILITY_SET_POSITION_TARGET_LOCAL_NED  = 1 << 7
+	MAV_PROTOCOL_CAPABILITY_SET_POSITION_TARGET_GLOBAL_INT = 1 << 8
+	MAV_PROTOCOL_CAPABILITY_TERRAIN                        = 1 << 9
+	MAV_PROTOCOL_CAPABILITY_FLIGHT_TERMINATION             = 1 << 11
+	MAV_PROTOCOL_CAPABILITY_COMPASS_CALIBRATION            = 1 << 12
+	MAV_PROTOCOL_CAPABILITY_MAVLINK2                       = 1 << 13
+	MAV_PROTOCOL_CAPABILITY_MISSION_FENCE                  = 1 << 14
+	MAV_PROTOCOL_CAPABILITY_MISSION_RALLY                  = 1 << 15
+	MAV_PROTOCOL_CAPABILITY_PARAM_ENCODE_C_CAST            = 1 << 17
+
+	// Release type in the low byte of a version in AUTOPILOT_VERSION
+	FIRMWARE_VERSION_TYPE_DEV      = 0
+	FIRMWARE_VERSION_TYPE_ALPHA    = 64
+	FIRMWARE_VERSION_TYPE_BETA     = 128
+	FIRMWARE_VERSION_TYPE_RC       = 192
+	FIRMWARE_VERSION_TYPE_OFFICIAL = 255
 )
 
 type MavlinkMessage interface {
-	MessageID() uint8
+	MessageID() uint32
 	MessageSize() uint8
 }
 
+// ExtendedMessage is a message whose MAVLink 2 extension fields are only sent
+// when they are in use. Its MessageSize stops short of the extensions, which
+// MAVLink 1 frames can't carry, and it is sent as MAVLink 2 when
+// UsesExtensions says so.
+type ExtendedMessage interface {
+	MavlinkMessage
+	UsesExtensions() bool
+}
+
+// Whether a message has to be sent as MAVLink 2, because its ID doesn't fit
+// in MAVLink 1 or it has extension fields in use
+func needsMavlink2(message MavlinkMessage) bool {
+	if message.MessageID() > MAVLINK_V1_MAX_MESSAGE_ID {
+		return true
+	}
+	extended, ok := message.(ExtendedMessage)
+	return ok && extended.UsesExtensions()
+}
+
+// Fields of every message are declared in the order they go on the wire,
+// which is largest type first
+
+type Heartbeat struct {
+	CustomMode     uint32
+	Type           uint8
+	Autopilot      uint8
+	BaseMode       uint8
+	SystemStatus   uint8
+	MavlinkVersion uint8
+}
+
+func (msg Heartbeat) MessageID() uint32 {
+	return MAVLINK_MSG_ID_HEARTBEAT
+}
+
+func (msg Heartbeat) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_HEARTBEAT
+}
+
+type SysStatus struct {
+	SensorsPresent   uint32
+	SensorsEnabled   uint32
+	SensorsHealth    uint32
+	Load             uint16 // d%
+	VoltageBattery   uint16 // mV
+	CurrentBattery   int16  // cA, -1 if unknown
+	DropRateComm     uint16 // c%
+	ErrorsComm       uint16
+	ErrorsCount1     uint16
+	ErrorsCount2     uint16
+	ErrorsCount3     uint16
+	ErrorsCount4     uint16
+	BatteryRemaining int8 // %, -1 if unknown
+}
+
+func (msg SysStatus) MessageID() uint32 {
+	return MAVLINK_MSG_ID_SYS_STATUS
+}
+
+func (msg SysStatus) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_SYS_STATUS
+}
+
+type GlobalPositionInt struct {
+	TimeBootMs  uint32
+	Lat         int32  // degE7
+	Lon         int32  // degE7
+	Alt         int32  // mm above mean sea level
+	RelativeAlt int32  // mm above home
+	Vx          int16  // cm/s north
+	Vy          int16  // cm/s east
+	Vz          int16  // cm/s down
+	Hdg         uint16 // cdeg
+}
+
+func (msg GlobalPositionInt) MessageID() uint32 {
+	return MAVLINK_MSG_ID_GLOBAL_POSITION_INT
+}
+
+func (msg GlobalPositionInt) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_GLOBAL_POSITION_INT
+}
+
+type VfrHud struct {
+	Airspeed    float32
+	Groundspeed float32
+	Alt         float32
+	Climb       float32
+	Heading     int16
+	Throttle    uint16 // %
+}
+
+func (msg VfrHud) MessageID() uint32 {
+	return MAVLINK_MSG_ID_VFR_HUD
+}
+
+func (msg VfrHud) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_VFR_HUD
+}
+
+// Like COMMAND_LONG, but with params 5 and 6 as integers, such as a latitude
+// and longitude in degrees * 1e7, and the frame they are in
+type CommandInt struct {
+	Param1          float32
+	Param2          float32
+	Param3          float32
+	Param4          float32
+	X               int32
+	Y               int32
+	Z               float32
+	Command         uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	Frame           uint8
+	Current         uint8 // unused
+	Autocontinue    uint8 // unused
+}
+
+func (msg CommandInt) MessageID() uint32 {
+	return MAVLINK_MSG_ID_COMMAND_INT
+}
+
+func (msg CommandInt) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_COMMAND_INT
+}
+
 type CommandLong struct {
 	Param1          float32
 	Param2          float32
@@ -32,10 +433,45 @@ type CommandLong struct {
 	Confirmation    uint8
 }
 
-func (msg CommandLong) MessageID() uint8 {
+func (msg CommandLong) MessageID() uint32 {
 	return MAVLINK_MSG_ID_COMMAND_LONG
 }
 
 func (msg CommandLong) MessageSize() uint8 {
 	return MAVLINK_MSG_SIZE_COMMAND_LONG
 }
+
+type CommandAck struct {
+	Command uint16
+	Result  uint8
+	// extensions
+	Progress        uint8 // percent done while IN_PROGRESS, 255 if unknown
+	ResultParam2    int32
+	TargetSystem    uint8 // system that sent the command, 0 for any
+	TargetComponent uint8
+}
+
+func (msg CommandAck) MessageID() uint32 {
+	return MAVLINK_MSG_ID_COMMAND_ACK
+}
+
+func (msg CommandAck) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_COMMAND_ACK
+}
+
+func (msg CommandAck) UsesExtensions() bool {
+	return msg.Progress != 0 || msg.ResultParam2 != 0 || msg.TargetSystem != 0 || msg.TargetComponent != 0
+}
+
+type ExtendedSysState struct {
+	VtolState   uint8
+	LandedState uint8
+}
+
+func (msg ExtendedSysState) MessageID() uint32 {
+	return MAVLINK_MSG_ID_EXTENDED_SYS_STATE
+}
+
+func (msg ExtendedSysState) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_EXTENDED_SYS_STATE
+}
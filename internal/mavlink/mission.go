@@ -0,0 +1,337 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// The mission type is a MAVLink 2 extension on the end of each mission
+// message. It is always sent, as autopilots read extension fields from
+// MAVLink 1 frames that are long enough to carry them.
+const missionTypeSize = 1
+
+type MissionRequestList struct {
+	TargetSystem    uint8
+	TargetComponent uint8
+	MissionType     uint8
+}
+
+func (msg MissionRequestList) MessageID() uint32 {
+	return MAVLINK_MSG_ID_MISSION_REQUEST_LIST
+}
+
+func (msg MissionRequestList) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_MISSION_REQUEST_LIST + missionTypeSize
+}
+
+type MissionCount struct {
+	Count           uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	MissionType     uint8
+}
+
+func (msg MissionCount) MessageID() uint32 {
+	return MAVLINK_MSG_ID_MISSION_COUNT
+}
+
+func (msg MissionCount) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_MISSION_COUNT + missionTypeSize
+}
+
+type MissionRequestInt struct {
+	Seq             uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	MissionType     uint8
+}
+
+func (msg MissionRequestInt) MessageID() uint32 {
+	return MAVLINK_MSG_ID_MISSION_REQUEST_INT
+}
+
+func (msg MissionRequestInt) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_MISSION_REQUEST_INT + missionTypeSize
+}
+
+type MissionAck struct {
+	TargetSystem    uint8
+	TargetComponent uint8
+	Type            uint8 // MAV_MISSION_RESULT
+	MissionType     uint8
+}
+
+func (msg MissionAck) MessageID() uint32 {
+	return MAVLINK_MSG_ID_MISSION_ACK
+}
+
+func (msg MissionAck) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_MISSION_ACK + missionTypeSize
+}
+
+// X and Y are latitude and longitude in degE7 for global frames, or meters
+// times 1e4 for local ones
+type MissionItemInt struct {
+	Param1          float32
+	Param2          float32
+	Param3          float32
+	Param4          float32
+	X               int32
+	Y               int32
+	Z               float32
+	Seq             uint16
+	Command         uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	Frame           uint8
+	Current         uint8
+	Autocontinue    uint8
+	MissionType     uint8
+}
+
+func (msg MissionItemInt) MessageID() uint32 {
+	return MAVLINK_MSG_ID_MISSION_ITEM_INT
+}
+
+func (msg MissionItemInt) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_MISSION_ITEM_INT + missionTypeSize
+}
+
+// MISSION_REQUEST and MISSION_REQUEST_INT only differ in which message the
+// requester wants back, so they share a decoder
+func decodeMissionRequest(data *RawMessage) (*MissionRequestMessage, error) {
+	name := "MISSION_REQUEST_INT"
+	if data.MessageID == MAVLINK_MSG_ID_MISSION_REQUEST {
+		name = "MISSION_REQUEST"
+	}
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_MISSION_REQUEST_INT + 1)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for %s message", name)
+	}
+	newMessage := &MissionRequestMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, name),
+		Seq:                   binary.LittleEndian.Uint16(payload[0:2]),
+		TargetSystem:          payload[2],
+		TargetComponent:       payload[3],
+		MissionType:           payload[4],
+	}
+	return newMessage, nil
+}
+
+type MissionRequestMessage struct {
+	DecodedMavlinkMessage
+	Seq             uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	MissionType     uint8
+}
+
+func (m *MissionRequestMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *MissionRequestMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *MissionRequestMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Seq":             m.Seq,
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+		"MissionType":     m.MissionType,
+	}
+}
+
+func decodeMissionRequestList(data *RawMessage) (*MissionRequestListMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_MISSION_REQUEST_LIST + 1)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for MISSION_REQUEST_LIST message")
+	}
+	newMessage := &MissionRequestListMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "MISSION_REQUEST_LIST"),
+		TargetSystem:          payload[0],
+		TargetComponent:       payload[1],
+		MissionType:           payload[2],
+	}
+	return newMessage, nil
+}
+
+type MissionRequestListMessage struct {
+	DecodedMavlinkMessage
+	TargetSystem    uint8
+	TargetComponent uint8
+	MissionType     uint8
+}
+
+func (m *MissionRequestListMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *MissionRequestListMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *MissionRequestListMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+		"MissionType":     m.MissionType,
+	}
+}
+
+func decodeMissionCount(data *RawMessage) (*MissionCountMessage, error) {
+	// the mission type and opaque ID are MAVLink 2 extensions
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_MISSION_COUNT + 5)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for MISSION_COUNT message")
+	}
+	newMessage := &MissionCountMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "MISSION_COUNT"),
+		Count:                 binary.LittleEndian.Uint16(payload[0:2]),
+		TargetSystem:          payload[2],
+		TargetComponent:       payload[3],
+		MissionType:           payload[4],
+	}
+	return newMessage, nil
+}
+
+type MissionCountMessage struct {
+	DecodedMavlinkMessage
+	Count           uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	MissionType     uint8
+}
+
+func (m *MissionCountMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *MissionCountMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *MissionCountMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Count":           m.Count,
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+		"MissionType":     m.MissionType,
+	}
+}
+
+func decodeMissionAck(data *RawMessage) (*MissionAckMessage, error) {
+	// the mission type and opaque ID are MAVLink 2 extensions
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_MISSION_ACK + 5)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for MISSION_ACK message")
+	}
+	newMessage := &MissionAckMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "MISSION_ACK"),
+		TargetSystem:          payload[0],
+		TargetComponent:       payload[1],
+		Type:                  payload[2],
+		MissionType:           payload[3],
+	}
+	return newMessage, nil
+}
+
+type MissionAckMessage struct {
+	DecodedMavlinkMessage
+	TargetSystem    uint8
+	TargetComponent uint8
+	Type            uint8
+	MissionType     uint8
+}
+
+func (m *MissionAckMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *MissionAckMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *MissionAckMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+		"Type":            m.Type,
+		"MissionType":     m.MissionType,
+	}
+}
+
+func decodeMissionItemInt(data *RawMessage) (*MissionItemIntMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_MISSION_ITEM_INT + 1)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for MISSION_ITEM_INT message")
+	}
+	newMessage := &MissionItemIntMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "MISSION_ITEM_INT"),
+		Param1:                math.Float32frombits(binary.LittleEndian.Uint32(payload[0:4])),
+		Param2:                math.Float32frombits(binary.LittleEndian.Uint32(payload[4:8])),
+		Param3:                math.Float32frombits(binary.LittleEndian.Uint32(payload[8:12])),
+		Param4:                math.Float32frombits(binary.LittleEndian.Uint32(payload[12:16])),
+		X:                     int32(binary.LittleEndian.Uint32(payload[16:20])),
+		Y:                     int32(binary.LittleEndian.Uint32(payload[20:24])),
+		Z:                     math.Float32frombits(binary.LittleEndian.Uint32(payload[24:28])),
+		Seq:                   binary.LittleEndian.Uint16(payload[28:30]),
+		Command:               binary.LittleEndian.Uint16(payload[30:32]),
+		TargetSystem:          payload[32],
+		TargetComponent:       payload[33],
+		Frame:                 payload[34],
+		Current:               payload[35],
+		Autocontinue:          payload[36],
+		MissionType:           payload[37],
+	}
+	return newMessage, nil
+}
+
+type MissionItemIntMessage struct {
+	DecodedMavlinkMessage
+	Param1          float32
+	Param2          float32
+	Param3          float32
+	Param4          float32
+	X               int32
+	Y               int32
+	Z               float32
+	Seq             uint16
+	Command         uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	Frame           uint8
+	Current         uint8
+	Autocontinue    uint8
+	MissionType     uint8
+}
+
+func (m *MissionItemIntMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *MissionItemIntMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *MissionItemIntMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Param1":          m.Param1,
+		"Param2":          m.Param2,
+		"Param3":          m.Param3,
+		"Param4":          m.Param4,
+		"X":               m.X,
+		"Y":               m.Y,
+		"Z":               m.Z,
+		"Seq":             m.Seq,
+		"Command":         m.Command,
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+		"Frame":           m.Frame,
+		"Current":         m.Current,
+		"Autocontinue":    m.Autocontinue,
+		"MissionType":     m.MissionType,
+	}
+}
@@ -12,13 +12,37 @@ const (
 	X25_VALIDATE_CRC  = uint16(0xf0b8)
 	CRC_EXTRA_ENABLED = true
 	FRAME_START       = 0xFE
+	FRAME_START_V2    = 0xFD
+
+	// MAVLink 2 incompatibility flag set when a frame carries a signature
+	MAVLINK_IFLAG_SIGNED = 0x01
+
+	// Highest message ID that fits in a MAVLink 1 frame. Messages above it
+	// are sent as MAVLink 2.
+	MAVLINK_V1_MAX_MESSAGE_ID = 255
 )
 
-// Each Message's ID will be the index in this slice, the value of which is that message's CRC
+// Each Message's ID will be the index in this slice, the value of which is that message's CRC, or 0 if there is no such message
 var (
-	messageCrcs = []byte{50, 124, 137, 0, 237, 217, 104, 119, 0, 0, 0, 89, 0, 0, 0, 0, 0, 0, 0, 0, 214, 159, 220, 168, 24, 23, 170, 144, 67, 115, 39, 246, 185, 104, 237, 244, 222, 212, 9, 254, 230, 28, 28, 132, 221, 232, 11, 153, 41, 39, 214, 223, 141, 33, 15, 3, 100, 24, 239, 238, 30, 240, 183, 130, 130, 0, 148, 21, 0, 243, 124, 0, 0, 0, 20, 0, 152, 143, 0, 0, 127, 106, 0, 0, 0, 0, 0, 0, 0, 231, 183, 63, 54, 0, 0, 0, 0, 0, 0, 0, 175, 102, 158, 208, 56, 93, 0, 0, 0, 0, 235, 93, 124, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 42, 241, 15, 134, 219, 208, 188, 84, 22, 19, 21, 134, 0, 78, 68, 189, 127, 111, 21, 21, 144, 1, 234, 73, 181, 22, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 204, 49, 170, 44, 83, 46, 0}
+	messageCrcs = []byte{50, 124, 137, 0, 237, 217, 104, 119, 0, 0, 0, 89, 0, 0, 0, 0, 0, 0, 0, 0, 214, 159, 220, 168, 24, 23, 170, 144, 67, 115, 39, 246, 185, 104, 237, 244, 222, 212, 9, 254, 230, 28, 28, 132, 221, 232, 11, 153, 41, 39, 78, 196, 0, 0, 15, 3, 0, 0, 0, 0, 0, 167, 183, 119, 191, 118, 148, 21, 0, 243, 124, 0, 0, 38, 20, 158, 152, 143, 0, 0, 14, 106, 49, 22, 143, 140, 5, 150, 0, 231, 183, 63, 54, 47, 0, 0, 0, 0, 0, 0, 175, 102, 158, 208, 56, 93, 138, 108, 32, 185, 84, 34, 174, 124, 237, 4, 76, 128, 56, 116, 134, 237, 203, 250, 87, 203, 220, 25, 226, 46, 29, 223, 85, 6, 229, 203, 1, 195, 109, 168, 181, 47, 72, 131, 127, 0, 103, 154, 178, 200, 134, 219, 208, 188, 84, 22, 19, 21, 134, 0, 78, 68, 189, 127, 154, 21, 21, 144, 1, 234, 73, 181, 22, 83, 167, 138, 234, 240, 47, 189, 52, 174, 229, 85, 159, 186, 72, 0, 0, 0, 0, 92, 36, 71, 98, 120, 0, 0, 0, 0, 134, 205, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 69, 101, 50, 202, 17, 162, 0, 0, 0, 0, 0, 208, 207, 0, 0, 0, 163, 105, 151, 35, 150, 179, 0, 0, 0, 0, 0, 90, 104, 85, 95, 130, 184, 81, 8, 204, 49, 170, 44, 83, 46, 0}
+
+	// CRC extra bytes of messages whose IDs don't fit in messageCrcs
+	messageCrcsV2 = map[uint32]byte{
+		259: 92, 260: 146, 262: 12, 263: 133,
+		280: 70, 281: 48, 282: 123, 285: 137, 287: 1, 331: 91,
+	}
 )
 
+// Returns the CRC extra byte of a message, and false if it isn't known
+func crcExtra(messageID uint32) (byte, bool) {
+	if messageID < uint32(len(messageCrcs)) {
+		crc := messageCrcs[messageID]
+		return crc, crc != 0
+	}
+	crc, ok := messageCrcsV2[messageID]
+	return crc, ok
+}
+
 // RawMavlinkPacket is a struct that contains a MavlinkPacket and a buffer that contains the raw bytes of the packet
 type RawMavlinkPacket struct {
 	Packet    *MavlinkPacket
@@ -47,12 +71,13 @@ func (h *MavlinkHeader) HeaderSize() uint8 {
 func (rmp *RawMavlinkPacket) computeChecksum() uint16 {
 	rmp.Packet.crcInit()
 	/* 1 represents indexOf header.PayloadLength */
-	for _, v := range rmp.RawBuffer.Bytes()[1 : rmp.Packet.Header.HeaderSize()+rmp.Packet.Message.MessageSize()] {
+	for _, v := range rmp.RawBuffer.Bytes()[1 : int(rmp.Packet.Header.HeaderSize())+int(rmp.Packet.Message.MessageSize())] {
 		rmp.Packet.crcAccumulate(v)
 	}
 
 	if CRC_EXTRA_ENABLED {
-		rmp.Packet.crcAccumulate(messageCrcs[rmp.Packet.Message.MessageID()])
+		crc, _ := crcExtra(rmp.Packet.Message.MessageID())
+		rmp.Packet.crcAccumulate(crc)
 	}
 	return rmp.Packet.Checksum
 }
@@ -79,13 +104,16 @@ func (mp *MavlinkPacket) computeChecksum() uint16 {
 	mp.crcInit()
 
 	// loop over the header and payload bytes and update the checksum
-	for _, packetByte := range mp.Bytes()[1 : mp.Header.HeaderSize()+mp.Message.MessageSize()] {
+	// sizes are added as ints, as the header and a large payload overflow
+	// a uint8
+	for _, packetByte := range mp.Bytes()[1 : int(mp.Header.HeaderSize())+int(mp.Message.MessageSize())] {
 		mp.crcAccumulate(packetByte)
 	}
 
 	if CRC_EXTRA_ENABLED {
 		// Add the message ID to the checksum
-		mp.crcAccumulate(messageCrcs[mp.Header.MessageID])
+		crc, _ := crcExtra(uint32(mp.Header.MessageID))
+		mp.crcAccumulate(crc)
 	}
 	return mp.Checksum
 }
@@ -99,11 +127,47 @@ func (mp *MavlinkPacket) Bytes() []byte {
 		return []byte{}
 	}
 
-	if err = binary.Write(&r, binary.LittleEndian, mp.Message); err != nil {
+	// extension fields beyond MessageSize are left out
+	var payload bytes.Buffer
+	if err = binary.Write(&payload, binary.LittleEndian, mp.Message); err != nil {
 		return []byte{}
 	}
+	r.Write(payload.Bytes()[:mp.Message.MessageSize()])
 	if err = binary.Write(&r, binary.LittleEndian, mp.Checksum); err != nil {
 		return []byte{}
 	}
 	return r.Bytes()
 }
+
+// Reports whether the checksum at the end of a MAVLink 1 or 2 frame matches
+// its contents. The CRC extra bytes are only known to be right for messages
+// that DecodeMessage handles, so frames of other messages should not be
+// checked.
+func ValidCRC(frame []byte) bool {
+	if len(frame) < 3 {
+		return false
+	}
+	length := FrameLength(frame[0], frame[1], frame[2])
+	if length == 0 || len(frame) < length {
+		return false
+	}
+	headerSize := 6
+	messageID := uint32(frame[5])
+	if frame[0] == FRAME_START_V2 {
+		headerSize = 10
+		messageID = uint32(frame[7]) | uint32(frame[8])<<8 | uint32(frame[9])<<16
+	}
+	crc, ok := crcExtra(messageID)
+	if !ok {
+		return false
+	}
+
+	end := headerSize + int(frame[1])
+	var mp MavlinkPacket
+	mp.crcInit()
+	for _, b := range frame[1:end] {
+		mp.crcAccumulate(b)
+	}
+	mp.crcAccumulate(crc)
+	return mp.Checksum == binary.LittleEndian.Uint16(frame[end:])
+}
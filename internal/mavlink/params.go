@@ -0,0 +1,247 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Parameter names are sent as a fixed 16 byte field, only null terminated if
+// they are shorter than that
+type ParamID [16]byte
+
+func NewParamID(name string) ParamID {
+	var id ParamID
+	copy(id[:], name)
+	return id
+}
+
+func (id ParamID) String() string {
+	for i, b := range id {
+		if b == 0 {
+			return string(id[:i])
+		}
+	}
+	return string(id[:])
+}
+
+// A ParamIndex of -1 requests the parameter by name instead of index
+type ParamRequestRead struct {
+	ParamIndex      int16
+	TargetSystem    uint8
+	TargetComponent uint8
+	ParamID         ParamID
+}
+
+func (msg ParamRequestRead) MessageID() uint32 {
+	return MAVLINK_MSG_ID_PARAM_REQUEST_READ
+}
+
+func (msg ParamRequestRead) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_PARAM_REQUEST_READ
+}
+
+type ParamRequestList struct {
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (msg ParamRequestList) MessageID() uint32 {
+	return MAVLINK_MSG_ID_PARAM_REQUEST_LIST
+}
+
+func (msg ParamRequestList) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_PARAM_REQUEST_LIST
+}
+
+type ParamValue struct {
+	ParamValue float32
+	ParamCount uint16
+	ParamIndex uint16
+	ParamID    ParamID
+	ParamType  uint8
+}
+
+func (msg ParamValue) MessageID() uint32 {
+	return MAVLINK_MSG_ID_PARAM_VALUE
+}
+
+func (msg ParamValue) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_PARAM_VALUE
+}
+
+type ParamSet struct {
+	ParamValue      float32
+	TargetSystem    uint8
+	TargetComponent uint8
+	ParamID         ParamID
+	ParamType       uint8
+}
+
+func (msg ParamSet) MessageID() uint32 {
+	return MAVLINK_MSG_ID_PARAM_SET
+}
+
+func (msg ParamSet) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_PARAM_SET
+}
+
+func decodeParamRequestRead(data *RawMessage) (*ParamRequestReadMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_PARAM_REQUEST_READ)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for PARAM_REQUEST_READ message")
+	}
+	newMessage := &ParamRequestReadMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "PARAM_REQUEST_READ"),
+		ParamIndex:            int16(binary.LittleEndian.Uint16(payload[0:2])),
+		TargetSystem:          payload[2],
+		TargetComponent:       payload[3],
+	}
+	copy(newMessage.ParamID[:], payload[4:20])
+	return newMessage, nil
+}
+
+type ParamRequestReadMessage struct {
+	DecodedMavlinkMessage
+	ParamIndex      int16
+	TargetSystem    uint8
+	TargetComponent uint8
+	ParamID         ParamID
+}
+
+func (p *ParamRequestReadMessage) GetMessageID() int {
+	return p.MessageID
+}
+
+func (p *ParamRequestReadMessage) GetMessageName() string {
+	return p.MessageName
+}
+
+func (p *ParamRequestReadMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"ParamIndex":      p.ParamIndex,
+		"TargetSystem":    p.TargetSystem,
+		"TargetComponent": p.TargetComponent,
+		"ParamID":         p.ParamID.String(),
+	}
+}
+
+func decodeParamRequestList(data *RawMessage) (*ParamRequestListMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_PARAM_REQUEST_LIST)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for PARAM_REQUEST_LIST message")
+	}
+	newMessage := &ParamRequestListMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "PARAM_REQUEST_LIST"),
+		TargetSystem:          payload[0],
+		TargetComponent:       payload[1],
+	}
+	return newMessage, nil
+}
+
+type ParamRequestListMessage struct {
+	DecodedMavlinkMessage
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (p *ParamRequestListMessage) GetMessageID() int {
+	return p.MessageID
+}
+
+func (p *ParamRequestListMessage) GetMessageName() string {
+	return p.MessageName
+}
+
+func (p *ParamRequestListMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TargetSystem":    p.TargetSystem,
+		"TargetComponent": p.TargetComponent,
+	}
+}
+
+func decodeParamValue(data *RawMessage) (*ParamValueMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_PARAM_VALUE)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for PARAM_VALUE message")
+	}
+	newMessage := &ParamValueMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "PARAM_VALUE"),
+		ParamValue:            math.Float32frombits(binary.LittleEndian.Uint32(payload[0:4])),
+		ParamCount:            binary.LittleEndian.Uint16(payload[4:6]),
+		ParamIndex:            binary.LittleEndian.Uint16(payload[6:8]),
+		ParamType:             payload[24],
+	}
+	copy(newMessage.ParamID[:], payload[8:24])
+	return newMessage, nil
+}
+
+type ParamValueMessage struct {
+	DecodedMavlinkMessage
+	ParamValue float32
+	ParamCount uint16
+	ParamIndex uint16
+	ParamID    ParamID
+	ParamType  uint8
+}
+
+func (p *ParamValueMessage) GetMessageID() int {
+	return p.MessageID
+}
+
+func (p *ParamValueMessage) GetMessageName() string {
+	return p.MessageName
+}
+
+func (p *ParamValueMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"ParamValue": p.ParamValue,
+		"ParamCount": p.ParamCount,
+		"ParamIndex": p.ParamIndex,
+		"ParamID":    p.ParamID.String(),
+		"ParamType":  p.ParamType,
+	}
+}
+
+func decodeParamSet(data *RawMessage) (*ParamSetMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_PARAM_SET)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for PARAM_SET message")
+	}
+	newMessage := &ParamSetMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "PARAM_SET"),
+		ParamValue:            math.Float32frombits(binary.LittleEndian.Uint32(payload[0:4])),
+		TargetSystem:          payload[4],
+		TargetComponent:       payload[5],
+		ParamType:             payload[22],
+	}
+	copy(newMessage.ParamID[:], payload[6:22])
+	return newMessage, nil
+}
+
+type ParamSetMessage struct {
+	DecodedMavlinkMessage
+	ParamValue      float32
+	TargetSystem    uint8
+	TargetComponent uint8
+	ParamID         ParamID
+	ParamType       uint8
+}
+
+func (p *ParamSetMessage) GetMessageID() int {
+	return p.MessageID
+}
+
+func (p *ParamSetMessage) GetMessageName() string {
+	return p.MessageName
+}
+
+func (p *ParamSetMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"ParamValue":      p.ParamValue,
+		"TargetSystem":    p.TargetSystem,
+		"TargetComponent": p.TargetComponent,
+		"ParamID":         p.ParamID.String(),
+		"ParamType":       p.ParamType,
+	}
+}
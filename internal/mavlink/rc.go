@@ -0,0 +1,205 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Most channels RC_CHANNELS and RC_CHANNELS_OVERRIDE carry
+	RC_CHANNELS_MAX = 18
+	// Servo outputs SERVO_OUTPUT_RAW carries per port
+	SERVO_OUTPUT_MAX = 16
+
+	// RC_CHANNELS_OVERRIDE values that aren't a PWM. Channels 1 to 8 and 9
+	// to 18 use different values to ignore a channel and to hand it back to
+	// the transmitter.
+	RC_OVERRIDE_IGNORE         = 65535
+	RC_OVERRIDE_RELEASE        = 0
+	RC_OVERRIDE_IGNORE_EXT     = 0
+	RC_OVERRIDE_RELEASE_EXT    = 65534
+	RC_CHANNELS_OVERRIDE_BASIC = 8
+
+	// RSSI when the receiver doesn't report it
+	RC_RSSI_UNKNOWN = 255
+)
+
+// The PWM of the pilot's transmitter channels in microseconds, with 65535 for
+// channels the receiver doesn't have
+type RcChannels struct {
+	TimeBootMs uint32
+	Chan       [RC_CHANNELS_MAX]uint16
+	ChanCount  uint8
+	Rssi       uint8
+}
+
+func (msg RcChannels) MessageID() uint32 {
+	return MAVLINK_MSG_ID_RC_CHANNELS
+}
+
+func (msg RcChannels) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_RC_CHANNELS
+}
+
+// The PWM the autopilot outputs to servos and motors in microseconds. Port
+// 0 is outputs 1 to 16, port 1 is 17 to 32.
+type ServoOutputRaw struct {
+	TimeUsec uint32
+	Servo    [8]uint16
+	Port     uint8
+	// extensions
+	ServoExt [8]uint16
+}
+
+func (msg ServoOutputRaw) MessageID() uint32 {
+	return MAVLINK_MSG_ID_SERVO_OUTPUT_RAW
+}
+
+func (msg ServoOutputRaw) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_SERVO_OUTPUT_RAW + 16
+}
+
+// Replaces the transmitter's channels with these PWM values until released
+type RcChannelsOverride struct {
+	Chan            [RC_CHANNELS_OVERRIDE_BASIC]uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	// extensions
+	ChanExt [RC_CHANNELS_MAX - RC_CHANNELS_OVERRIDE_BASIC]uint16
+}
+
+func (msg RcChannelsOverride) MessageID() uint32 {
+	return MAVLINK_MSG_ID_RC_CHANNELS_OVERRIDE
+}
+
+func (msg RcChannelsOverride) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_RC_CHANNELS_OVERRIDE + 20
+}
+
+func decodeRcChannels(data *RawMessage) (*RcChannelsMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_RC_CHANNELS)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for RC_CHANNELS message")
+	}
+	newMessage := &RcChannelsMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "RC_CHANNELS"),
+		TimeBootMs:            binary.LittleEndian.Uint32(payload[0:4]),
+		ChanCount:             payload[40],
+		Rssi:                  payload[41],
+	}
+	for i := range newMessage.Chan {
+		newMessage.Chan[i] = binary.LittleEndian.Uint16(payload[4+2*i:])
+	}
+	return newMessage, nil
+}
+
+type RcChannelsMessage struct {
+	DecodedMavlinkMessage
+	TimeBootMs uint32
+	Chan       [RC_CHANNELS_MAX]uint16
+	ChanCount  uint8
+	Rssi       uint8
+}
+
+func (m *RcChannelsMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *RcChannelsMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *RcChannelsMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeBootMs": m.TimeBootMs,
+		"Chan":       m.Chan,
+		"ChanCount":  m.ChanCount,
+		"Rssi":       m.Rssi,
+	}
+}
+
+func decodeServoOutputRaw(data *RawMessage) (*ServoOutputRawMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_SERVO_OUTPUT_RAW + 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for SERVO_OUTPUT_RAW message")
+	}
+	newMessage := &ServoOutputRawMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "SERVO_OUTPUT_RAW"),
+		TimeUsec:              binary.LittleEndian.Uint32(payload[0:4]),
+		Port:                  payload[20],
+	}
+	for i := 0; i < 8; i++ {
+		newMessage.Servo[i] = binary.LittleEndian.Uint16(payload[4+2*i:])
+		newMessage.Servo[8+i] = binary.LittleEndian.Uint16(payload[21+2*i:])
+	}
+	return newMessage, nil
+}
+
+// Servo holds all 16 outputs of the port, 9 to 16 are 0 if the sender
+// didn't include them
+type ServoOutputRawMessage struct {
+	DecodedMavlinkMessage
+	TimeUsec uint32
+	Servo    [SERVO_OUTPUT_MAX]uint16
+	Port     uint8
+}
+
+func (m *ServoOutputRawMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *ServoOutputRawMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *ServoOutputRawMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeUsec": m.TimeUsec,
+		"Servo":    m.Servo,
+		"Port":     m.Port,
+	}
+}
+
+func decodeRcChannelsOverride(data *RawMessage) (*RcChannelsOverrideMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_RC_CHANNELS_OVERRIDE + 20)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for RC_CHANNELS_OVERRIDE message")
+	}
+	newMessage := &RcChannelsOverrideMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "RC_CHANNELS_OVERRIDE"),
+		TargetSystem:          payload[16],
+		TargetComponent:       payload[17],
+	}
+	for i := 0; i < RC_CHANNELS_OVERRIDE_BASIC; i++ {
+		newMessage.Chan[i] = binary.LittleEndian.Uint16(payload[2*i:])
+	}
+	for i := RC_CHANNELS_OVERRIDE_BASIC; i < RC_CHANNELS_MAX; i++ {
+		newMessage.Chan[i] = binary.LittleEndian.Uint16(payload[18+2*(i-RC_CHANNELS_OVERRIDE_BASIC):])
+	}
+	return newMessage, nil
+}
+
+// Chan holds all 18 channels, with the special values of RC_OVERRIDE_IGNORE
+// and friends as they were sent
+type RcChannelsOverrideMessage struct {
+	DecodedMavlinkMessage
+	Chan            [RC_CHANNELS_MAX]uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (m *RcChannelsOverrideMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *RcChannelsOverrideMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *RcChannelsOverrideMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Chan":            m.Chan,
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+	}
+}
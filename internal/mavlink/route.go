@@ -0,0 +1,84 @@
+package mavlink
+
+// Where target_system and target_component are in the payloads of messages
+// addressed to a particular system or component, -1 for messages that only
+// name a system. Messages that aren't listed are sent to everyone.
+var messageTargets = map[uint32][2]int{
+	MAVLINK_MSG_ID_SET_MODE:                       {4, -1},
+	MAVLINK_MSG_ID_PARAM_REQUEST_READ:             {2, 3},
+	MAVLINK_MSG_ID_PARAM_REQUEST_LIST:             {0, 1},
+	MAVLINK_MSG_ID_PARAM_SET:                      {4, 5},
+	MAVLINK_MSG_ID_MISSION_ITEM:                   {32, 33},
+	MAVLINK_MSG_ID_MISSION_REQUEST:                {2, 3},
+	MAVLINK_MSG_ID_MISSION_SET_CURRENT:            {2, 3},
+	MAVLINK_MSG_ID_MISSION_REQUEST_LIST:           {0, 1},
+	MAVLINK_MSG_ID_MISSION_COUNT:                  {2, 3},
+	MAVLINK_MSG_ID_MISSION_CLEAR_ALL:              {0, 1},
+	MAVLINK_MSG_ID_MISSION_ACK:                    {0, 1},
+	MAVLINK_MSG_ID_MISSION_REQUEST_INT:            {2, 3},
+	MAVLINK_MSG_ID_REQUEST_DATA_STREAM:            {2, 3},
+	MAVLINK_MSG_ID_MANUAL_CONTROL:                 {10, -1},
+	MAVLINK_MSG_ID_RC_CHANNELS_OVERRIDE:           {16, 17},
+	MAVLINK_MSG_ID_MISSION_ITEM_INT:               {32, 33},
+	MAVLINK_MSG_ID_COMMAND_INT:                    {30, 31},
+	MAVLINK_MSG_ID_COMMAND_LONG:                   {30, 31},
+	MAVLINK_MSG_ID_COMMAND_ACK:                    {8, 9},
+	MAVLINK_MSG_ID_SET_ATTITUDE_TARGET:            {36, 37},
+	MAVLINK_MSG_ID_SET_POSITION_TARGET_LOCAL_NED:  {50, 51},
+	MAVLINK_MSG_ID_SET_POSITION_TARGET_GLOBAL_INT: {50, 51},
+	MAVLINK_MSG_ID_FILE_TRANSFER_PROTOCOL:         {1, 2},
+	MAVLINK_MSG_ID_TIMESYNC:                       {16, 17},
+	MAVLINK_MSG_ID_LOG_REQUEST_LIST:               {4, 5},
+	MAVLINK_MSG_ID_LOG_REQUEST_DATA:               {10, 11},
+	MAVLINK_MSG_ID_LOG_ERASE:                      {0, 1},
+	MAVLINK_MSG_ID_LOG_REQUEST_END:                {0, 1},
+	MAVLINK_MSG_ID_GPS_INJECT_DATA:                {0, 1},
+	MAVLINK_MSG_ID_AUTOPILOT_VERSION_REQUEST:      {0, 1},
+	MAVLINK_MSG_ID_GIMBAL_MANAGER_SET_ATTITUDE:    {32, 33},
+	MAVLINK_MSG_ID_GIMBAL_MANAGER_SET_PITCHYAW:    {20, 21},
+}
+
+// Returns the payload of a whole frame
+func framePayload(frame []byte) []byte {
+	headerSize := 6
+	if frame[0] == FRAME_START_V2 {
+		headerSize = 10
+	}
+	return frame[headerSize : headerSize+int(frame[1])]
+}
+
+// Returns the ID of the message a whole frame holds
+func FrameMessageID(frame []byte) uint32 {
+	if frame[0] == FRAME_START_V2 {
+		return uint32(frame[7]) | uint32(frame[8])<<8 | uint32(frame[9])<<16
+	}
+	return uint32(frame[5])
+}
+
+// Returns the system and component that sent a whole frame
+func FrameSource(frame []byte) (uint8, uint8) {
+	if frame[0] == FRAME_START_V2 {
+		return frame[5], frame[6]
+	}
+	return frame[3], frame[4]
+}
+
+// Returns the system and component a whole frame is addressed to, with 0
+// meaning every system or component. Telemetry and other messages without
+// a target are addressed to everyone.
+func FrameTarget(frame []byte) (uint8, uint8) {
+	offsets, ok := messageTargets[FrameMessageID(frame)]
+	if !ok {
+		return 0, 0
+	}
+	// MAVLink 2 trims zeros off the end of the payload, and those that are
+	// gone are the broadcast address
+	payload := framePayload(frame)
+	at := func(offset int) uint8 {
+		if offset < 0 || offset >= len(payload) {
+			return 0
+		}
+		return payload[offset]
+	}
+	return at(offsets[0]), at(offsets[1])
+}
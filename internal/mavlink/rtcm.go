@@ -0,0 +1,85 @@
+package mavlink
+
+import "fmt"
+
+const (
+	// How much RTCM data fits in one GPS_RTCM_DATA, and how many of them a
+	// message can be split across
+	GPS_RTCM_DATA_LEN           = 180
+	GPS_RTCM_DATA_MAX_FRAGMENTS = 4
+
+	// GPS_RTCM_DATA flags. The fragment ID is in bits 1 and 2 and the
+	// sequence ID in bits 3 to 7.
+	GPS_RTCM_DATA_FRAGMENTED     = 1 << 0
+	GPS_RTCM_DATA_FRAGMENT_SHIFT = 1
+	GPS_RTCM_DATA_SEQUENCE_SHIFT = 3
+)
+
+// RTCM corrections for the vehicle's GPS. A message longer than the data
+// field is split across several, which share a sequence ID.
+type GpsRtcmData struct {
+	Flags uint8
+	Len   uint8
+	Data  [GPS_RTCM_DATA_LEN]byte
+}
+
+func (msg GpsRtcmData) MessageID() uint32 {
+	return MAVLINK_MSG_ID_GPS_RTCM_DATA
+}
+
+func (msg GpsRtcmData) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_GPS_RTCM_DATA
+}
+
+func decodeGpsRtcmData(data *RawMessage) (*GpsRtcmDataMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_GPS_RTCM_DATA)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for GPS_RTCM_DATA message")
+	}
+	newMessage := &GpsRtcmDataMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "GPS_RTCM_DATA"),
+		Flags:                 payload[0],
+		Len:                   payload[1],
+	}
+	length := min(int(newMessage.Len), GPS_RTCM_DATA_LEN)
+	newMessage.Data = append([]byte(nil), payload[2:2+length]...)
+	return newMessage, nil
+}
+
+type GpsRtcmDataMessage struct {
+	DecodedMavlinkMessage
+	Flags uint8
+	Len   uint8
+	Data  []byte
+}
+
+func (m *GpsRtcmDataMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *GpsRtcmDataMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *GpsRtcmDataMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Flags": m.Flags,
+		"Len":   m.Len,
+		"Data":  m.Data,
+	}
+}
+
+// Whether the message is one fragment of a longer one
+func (m *GpsRtcmDataMessage) Fragmented() bool {
+	return m.Flags&GPS_RTCM_DATA_FRAGMENTED != 0
+}
+
+// Which fragment of a longer message this is, from 0
+func (m *GpsRtcmDataMessage) FragmentID() int {
+	return int(m.Flags>>GPS_RTCM_DATA_FRAGMENT_SHIFT) & 0x3
+}
+
+// The sequence ID the fragments of one message share
+func (m *GpsRtcmDataMessage) SequenceID() int {
+	return int(m.Flags >> GPS_RTCM_DATA_SEQUENCE_SHIFT)
+}
@@ -0,0 +1,221 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Position, velocity and acceleration are north, east and down in meters,
+// m/s and m/s². Yaw is in radians and yaw rate in rad/s.
+type SetPositionTargetLocalNed struct {
+	TimeBootMs      uint32
+	X               float32
+	Y               float32
+	Z               float32
+	Vx              float32
+	Vy              float32
+	Vz              float32
+	Afx             float32
+	Afy             float32
+	Afz             float32
+	Yaw             float32
+	YawRate         float32
+	TypeMask        uint16 // POSITION_TARGET_TYPEMASK_*
+	TargetSystem    uint8
+	TargetComponent uint8
+	CoordinateFrame uint8 // MAV_FRAME_*
+}
+
+func (msg SetPositionTargetLocalNed) MessageID() uint32 {
+	return MAVLINK_MSG_ID_SET_POSITION_TARGET_LOCAL_NED
+}
+
+func (msg SetPositionTargetLocalNed) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_SET_POSITION_TARGET_LOCAL_NED
+}
+
+// Like SetPositionTargetLocalNed, but the position is a latitude and
+// longitude in degE7 and an altitude in meters
+type SetPositionTargetGlobalInt struct {
+	TimeBootMs      uint32
+	LatInt          int32
+	LonInt          int32
+	Alt             float32
+	Vx              float32
+	Vy              float32
+	Vz              float32
+	Afx             float32
+	Afy             float32
+	Afz             float32
+	Yaw             float32
+	YawRate         float32
+	TypeMask        uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	CoordinateFrame uint8
+}
+
+func (msg SetPositionTargetGlobalInt) MessageID() uint32 {
+	return MAVLINK_MSG_ID_SET_POSITION_TARGET_GLOBAL_INT
+}
+
+func (msg SetPositionTargetGlobalInt) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_SET_POSITION_TARGET_GLOBAL_INT
+}
+
+func float32At(payload []byte, offset int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(payload[offset : offset+4]))
+}
+
+func decodeSetPositionTargetLocalNed(data *RawMessage) (*SetPositionTargetLocalNedMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_SET_POSITION_TARGET_LOCAL_NED)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for SET_POSITION_TARGET_LOCAL_NED message")
+	}
+	newMessage := &SetPositionTargetLocalNedMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "SET_POSITION_TARGET_LOCAL_NED"),
+		TimeBootMs:            binary.LittleEndian.Uint32(payload[0:4]),
+		X:                     float32At(payload, 4),
+		Y:                     float32At(payload, 8),
+		Z:                     float32At(payload, 12),
+		Vx:                    float32At(payload, 16),
+		Vy:                    float32At(payload, 20),
+		Vz:                    float32At(payload, 24),
+		Afx:                   float32At(payload, 28),
+		Afy:                   float32At(payload, 32),
+		Afz:                   float32At(payload, 36),
+		Yaw:                   float32At(payload, 40),
+		YawRate:               float32At(payload, 44),
+		TypeMask:              binary.LittleEndian.Uint16(payload[48:50]),
+		TargetSystem:          payload[50],
+		TargetComponent:       payload[51],
+		CoordinateFrame:       payload[52],
+	}
+	return newMessage, nil
+}
+
+type SetPositionTargetLocalNedMessage struct {
+	DecodedMavlinkMessage
+	TimeBootMs      uint32
+	X               float32
+	Y               float32
+	Z               float32
+	Vx              float32
+	Vy              float32
+	Vz              float32
+	Afx             float32
+	Afy             float32
+	Afz             float32
+	Yaw             float32
+	YawRate         float32
+	TypeMask        uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	CoordinateFrame uint8
+}
+
+func (s *SetPositionTargetLocalNedMessage) GetMessageID() int {
+	return s.MessageID
+}
+
+func (s *SetPositionTargetLocalNedMessage) GetMessageName() string {
+	return s.MessageName
+}
+
+func (s *SetPositionTargetLocalNedMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeBootMs":      s.TimeBootMs,
+		"X":               s.X,
+		"Y":               s.Y,
+		"Z":               s.Z,
+		"Vx":              s.Vx,
+		"Vy":              s.Vy,
+		"Vz":              s.Vz,
+		"Afx":             s.Afx,
+		"Afy":             s.Afy,
+		"Afz":             s.Afz,
+		"Yaw":             s.Yaw,
+		"YawRate":         s.YawRate,
+		"TypeMask":        s.TypeMask,
+		"TargetSystem":    s.TargetSystem,
+		"TargetComponent": s.TargetComponent,
+		"CoordinateFrame": s.CoordinateFrame,
+	}
+}
+
+func decodeSetPositionTargetGlobalInt(data *RawMessage) (*SetPositionTargetGlobalIntMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_SET_POSITION_TARGET_GLOBAL_INT)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for SET_POSITION_TARGET_GLOBAL_INT message")
+	}
+	newMessage := &SetPositionTargetGlobalIntMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "SET_POSITION_TARGET_GLOBAL_INT"),
+		TimeBootMs:            binary.LittleEndian.Uint32(payload[0:4]),
+		LatInt:                int32(binary.LittleEndian.Uint32(payload[4:8])),
+		LonInt:                int32(binary.LittleEndian.Uint32(payload[8:12])),
+		Alt:                   float32At(payload, 12),
+		Vx:                    float32At(payload, 16),
+		Vy:                    float32At(payload, 20),
+		Vz:                    float32At(payload, 24),
+		Afx:                   float32At(payload, 28),
+		Afy:                   float32At(payload, 32),
+		Afz:                   float32At(payload, 36),
+		Yaw:                   float32At(payload, 40),
+		YawRate:               float32At(payload, 44),
+		TypeMask:              binary.LittleEndian.Uint16(payload[48:50]),
+		TargetSystem:          payload[50],
+		TargetComponent:       payload[51],
+		CoordinateFrame:       payload[52],
+	}
+	return newMessage, nil
+}
+
+type SetPositionTargetGlobalIntMessage struct {
+	DecodedMavlinkMessage
+	TimeBootMs      uint32
+	LatInt          int32
+	LonInt          int32
+	Alt             float32
+	Vx              float32
+	Vy              float32
+	Vz              float32
+	Afx             float32
+	Afy             float32
+	Afz             float32
+	Yaw             float32
+	YawRate         float32
+	TypeMask        uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	CoordinateFrame uint8
+}
+
+func (s *SetPositionTargetGlobalIntMessage) GetMessageID() int {
+	return s.MessageID
+}
+
+func (s *SetPositionTargetGlobalIntMessage) GetMessageName() string {
+	return s.MessageName
+}
+
+func (s *SetPositionTargetGlobalIntMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeBootMs":      s.TimeBootMs,
+		"LatInt":          s.LatInt,
+		"LonInt":          s.LonInt,
+		"Alt":             s.Alt,
+		"Vx":              s.Vx,
+		"Vy":              s.Vy,
+		"Vz":              s.Vz,
+		"Afx":             s.Afx,
+		"Afy":             s.Afy,
+		"Afz":             s.Afz,
+		"Yaw":             s.Yaw,
+		"YawRate":         s.YawRate,
+		"TypeMask":        s.TypeMask,
+		"TargetSystem":    s.TargetSystem,
+		"TargetComponent": s.TargetComponent,
+		"CoordinateFrame": s.CoordinateFrame,
+	}
+}
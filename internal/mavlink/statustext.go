@@ -0,0 +1,77 @@
+package mavlink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Longest text a single STATUSTEXT can carry
+const STATUSTEXT_MAX_LEN = 50
+
+// A human readable message. Texts longer than 50 characters are split across
+// several messages that share a non-zero ID, numbered by ChunkSeq. The ID and
+// chunk number are MAVLink 2 extensions, so chunks are sent as MAVLink 2 and
+// whole texts as MAVLink 1.
+type StatusText struct {
+	Severity uint8
+	Text     [STATUSTEXT_MAX_LEN]byte // NUL terminated unless all 50 are used
+	ID       uint16
+	ChunkSeq uint8
+}
+
+func (msg StatusText) MessageID() uint32 {
+	return MAVLINK_MSG_ID_STATUSTEXT
+}
+
+func (msg StatusText) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_STATUSTEXT
+}
+
+func (msg StatusText) UsesExtensions() bool {
+	return msg.ID != 0
+}
+
+func decodeStatusText(data *RawMessage) (*StatusTextMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_STATUSTEXT + 3)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for STATUSTEXT message")
+	}
+	text := payload[1 : 1+STATUSTEXT_MAX_LEN]
+	if end := bytes.IndexByte(text, 0); end >= 0 {
+		text = text[:end]
+	}
+	newMessage := &StatusTextMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "STATUSTEXT"),
+		Severity:              payload[0],
+		Text:                  string(text),
+		ID:                    binary.LittleEndian.Uint16(payload[51:53]),
+		ChunkSeq:              payload[53],
+	}
+	return newMessage, nil
+}
+
+type StatusTextMessage struct {
+	DecodedMavlinkMessage
+	Severity uint8
+	Text     string
+	ID       uint16
+	ChunkSeq uint8
+}
+
+func (m *StatusTextMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *StatusTextMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *StatusTextMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Severity": m.Severity,
+		"Text":     m.Text,
+		"ID":       m.ID,
+		"ChunkSeq": m.ChunkSeq,
+	}
+}
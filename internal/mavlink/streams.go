@@ -0,0 +1,67 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Asks for a legacy group of messages to be sent at a rate in Hz. Superseded
+// by MAV_CMD_SET_MESSAGE_INTERVAL, but older firmware only understands this.
+type RequestDataStream struct {
+	ReqMessageRate  uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	ReqStreamID     uint8
+	StartStop       uint8 // 1 to start sending, 0 to stop
+}
+
+func (msg RequestDataStream) MessageID() uint32 {
+	return MAVLINK_MSG_ID_REQUEST_DATA_STREAM
+}
+
+func (msg RequestDataStream) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_REQUEST_DATA_STREAM
+}
+
+func decodeRequestDataStream(data *RawMessage) (*RequestDataStreamMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_REQUEST_DATA_STREAM)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for REQUEST_DATA_STREAM message")
+	}
+	newMessage := &RequestDataStreamMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "REQUEST_DATA_STREAM"),
+		ReqMessageRate:        binary.LittleEndian.Uint16(payload[0:2]),
+		TargetSystem:          payload[2],
+		TargetComponent:       payload[3],
+		ReqStreamID:           payload[4],
+		StartStop:             payload[5],
+	}
+	return newMessage, nil
+}
+
+type RequestDataStreamMessage struct {
+	DecodedMavlinkMessage
+	ReqMessageRate  uint16
+	TargetSystem    uint8
+	TargetComponent uint8
+	ReqStreamID     uint8
+	StartStop       uint8
+}
+
+func (r *RequestDataStreamMessage) GetMessageID() int {
+	return r.MessageID
+}
+
+func (r *RequestDataStreamMessage) GetMessageName() string {
+	return r.MessageName
+}
+
+func (r *RequestDataStreamMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"ReqMessageRate":  r.ReqMessageRate,
+		"TargetSystem":    r.TargetSystem,
+		"TargetComponent": r.TargetComponent,
+		"ReqStreamID":     r.ReqStreamID,
+		"StartStop":       r.StartStop,
+	}
+}
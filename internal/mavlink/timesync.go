@@ -0,0 +1,65 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A time synchronisation request or response. A request has Tc1 set to 0
+// and Ts1 to the sender's time, the response echoes Ts1 and sets Tc1 to the
+// responder's time, both in nanoseconds.
+type TimeSync struct {
+	Tc1 int64
+	Ts1 int64
+	// extensions
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (msg TimeSync) MessageID() uint32 {
+	return MAVLINK_MSG_ID_TIMESYNC
+}
+
+func (msg TimeSync) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_TIMESYNC + 2
+}
+
+func decodeTimeSync(data *RawMessage) (*TimeSyncMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_TIMESYNC + 2)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for TIMESYNC message")
+	}
+	newMessage := &TimeSyncMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "TIMESYNC"),
+		Tc1:                   int64(binary.LittleEndian.Uint64(payload[0:8])),
+		Ts1:                   int64(binary.LittleEndian.Uint64(payload[8:16])),
+		TargetSystem:          payload[16],
+		TargetComponent:       payload[17],
+	}
+	return newMessage, nil
+}
+
+type TimeSyncMessage struct {
+	DecodedMavlinkMessage
+	Tc1             int64
+	Ts1             int64
+	TargetSystem    uint8
+	TargetComponent uint8
+}
+
+func (m *TimeSyncMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *TimeSyncMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *TimeSyncMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Tc1":             m.Tc1,
+		"Ts1":             m.Ts1,
+		"TargetSystem":    m.TargetSystem,
+		"TargetComponent": m.TargetComponent,
+	}
+}
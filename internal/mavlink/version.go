@@ -0,0 +1,96 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The firmware's version and what the autopilot supports. Versions are
+// encoded as 0xMMmmPPTT, major, minor, patch and FIRMWARE_VERSION_TYPE.
+type AutopilotVersion struct {
+	Capabilities            uint64
+	UID                     uint64
+	FlightSwVersion         uint32
+	MiddlewareSwVersion     uint32
+	OsSwVersion             uint32
+	BoardVersion            uint32
+	VendorID                uint16
+	ProductID               uint16
+	FlightCustomVersion     [8]byte // first bytes of the git hash
+	MiddlewareCustomVersion [8]byte
+	OsCustomVersion         [8]byte
+	// extensions
+	UID2 [18]byte
+}
+
+func (msg AutopilotVersion) MessageID() uint32 {
+	return MAVLINK_MSG_ID_AUTOPILOT_VERSION
+}
+
+func (msg AutopilotVersion) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_AUTOPILOT_VERSION + 18
+}
+
+func decodeAutopilotVersion(data *RawMessage) (*AutopilotVersionMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_AUTOPILOT_VERSION + 18)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for AUTOPILOT_VERSION message")
+	}
+	newMessage := &AutopilotVersionMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "AUTOPILOT_VERSION"),
+		Capabilities:          binary.LittleEndian.Uint64(payload[0:8]),
+		UID:                   binary.LittleEndian.Uint64(payload[8:16]),
+		FlightSwVersion:       binary.LittleEndian.Uint32(payload[16:20]),
+		MiddlewareSwVersion:   binary.LittleEndian.Uint32(payload[20:24]),
+		OsSwVersion:           binary.LittleEndian.Uint32(payload[24:28]),
+		BoardVersion:          binary.LittleEndian.Uint32(payload[28:32]),
+		VendorID:              binary.LittleEndian.Uint16(payload[32:34]),
+		ProductID:             binary.LittleEndian.Uint16(payload[34:36]),
+	}
+	copy(newMessage.FlightCustomVersion[:], payload[36:44])
+	copy(newMessage.MiddlewareCustomVersion[:], payload[44:52])
+	copy(newMessage.OsCustomVersion[:], payload[52:60])
+	copy(newMessage.UID2[:], payload[60:78])
+	return newMessage, nil
+}
+
+type AutopilotVersionMessage struct {
+	DecodedMavlinkMessage
+	Capabilities            uint64
+	UID                     uint64
+	FlightSwVersion         uint32
+	MiddlewareSwVersion     uint32
+	OsSwVersion             uint32
+	BoardVersion            uint32
+	VendorID                uint16
+	ProductID               uint16
+	FlightCustomVersion     [8]byte
+	MiddlewareCustomVersion [8]byte
+	OsCustomVersion         [8]byte
+	UID2                    [18]byte
+}
+
+func (m *AutopilotVersionMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *AutopilotVersionMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *AutopilotVersionMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Capabilities":            m.Capabilities,
+		"UID":                     m.UID,
+		"FlightSwVersion":         m.FlightSwVersion,
+		"MiddlewareSwVersion":     m.MiddlewareSwVersion,
+		"OsSwVersion":             m.OsSwVersion,
+		"BoardVersion":            m.BoardVersion,
+		"VendorID":                m.VendorID,
+		"ProductID":               m.ProductID,
+		"FlightCustomVersion":     m.FlightCustomVersion,
+		"MiddlewareCustomVersion": m.MiddlewareCustomVersion,
+		"OsCustomVersion":         m.OsCustomVersion,
+		"UID2":                    m.UID2,
+	}
+}
@@ -0,0 +1,430 @@
+package mavlink
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// What produced an ODOMETRY estimate
+	MAV_ESTIMATOR_TYPE_UNKNOWN = 0
+	MAV_ESTIMATOR_TYPE_VISION  = 2
+	MAV_ESTIMATOR_TYPE_VIO     = 3
+	MAV_ESTIMATOR_TYPE_MOCAP   = 6
+
+	// Which parts of the solution an EKF_STATUS_REPORT says are good
+	EKF_ATTITUDE           = 1 << 0
+	EKF_VELOCITY_HORIZ     = 1 << 1
+	EKF_VELOCITY_VERT      = 1 << 2
+	EKF_POS_HORIZ_REL      = 1 << 3
+	EKF_POS_HORIZ_ABS      = 1 << 4
+	EKF_POS_VERT_ABS       = 1 << 5
+	EKF_POS_VERT_AGL       = 1 << 6
+	EKF_CONST_POS_MODE     = 1 << 7
+	EKF_PRED_POS_HORIZ_REL = 1 << 8
+	EKF_PRED_POS_HORIZ_ABS = 1 << 9
+	EKF_UNINITIALIZED      = 1 << 10
+	EKF_GPS_GLITCH         = 1 << 15
+
+	// ESTIMATOR_STATUS flags are the same up to bit 9, after which they
+	// differ
+	ESTIMATOR_GPS_GLITCH  = 1 << 10
+	ESTIMATOR_ACCEL_ERROR = 1 << 11
+)
+
+// An external estimate of the vehicle's position in meters and attitude in
+// radians, in MAV_FRAME_LOCAL_NED. The covariance is the upper triangle of
+// the 6x6 matrix of x, y, z, roll, pitch and yaw, row by row, with NaN first
+// when unknown.
+type VisionPositionEstimate struct {
+	Usec  uint64
+	X     float32
+	Y     float32
+	Z     float32
+	Roll  float32
+	Pitch float32
+	Yaw   float32
+	// extensions
+	Covariance   [21]float32
+	ResetCounter uint8
+}
+
+func (msg VisionPositionEstimate) MessageID() uint32 {
+	return MAVLINK_MSG_ID_VISION_POSITION_ESTIMATE
+}
+
+func (msg VisionPositionEstimate) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_VISION_POSITION_ESTIMATE + 85
+}
+
+// An external estimate of the vehicle's velocity in m/s, in
+// MAV_FRAME_LOCAL_NED. The covariance is the whole 3x3 matrix, row by row.
+type VisionSpeedEstimate struct {
+	Usec uint64
+	X    float32
+	Y    float32
+	Z    float32
+	// extensions
+	Covariance   [9]float32
+	ResetCounter uint8
+}
+
+func (msg VisionSpeedEstimate) MessageID() uint32 {
+	return MAVLINK_MSG_ID_VISION_SPEED_ESTIMATE
+}
+
+func (msg VisionSpeedEstimate) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_VISION_SPEED_ESTIMATE + 37
+}
+
+// Position and attitude in FrameID, velocity and angular rates in
+// ChildFrameID. Quality is 0 to 100, -1 for a failed estimate.
+type Odometry struct {
+	TimeUsec           uint64
+	X                  float32
+	Y                  float32
+	Z                  float32
+	Q                  [4]float32
+	Vx                 float32
+	Vy                 float32
+	Vz                 float32
+	Rollspeed          float32
+	Pitchspeed         float32
+	Yawspeed           float32
+	PoseCovariance     [21]float32
+	VelocityCovariance [21]float32
+	FrameID            uint8 // MAV_FRAME_*
+	ChildFrameID       uint8
+	// extensions
+	ResetCounter  uint8
+	EstimatorType uint8 // MAV_ESTIMATOR_TYPE_*
+	Quality       int8
+}
+
+func (msg Odometry) MessageID() uint32 {
+	return MAVLINK_MSG_ID_ODOMETRY
+}
+
+func (msg Odometry) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_ODOMETRY + 3
+}
+
+// How well ArduPilot's EKF is doing. Variances are test ratios, where
+// anything above 1 means measurements are being rejected.
+type EkfStatusReport struct {
+	VelocityVariance   float32
+	PosHorizVariance   float32
+	PosVertVariance    float32
+	CompassVariance    float32
+	TerrainAltVariance float32
+	Flags              uint16 // EKF_*
+	// extensions
+	AirspeedVariance float32
+}
+
+func (msg EkfStatusReport) MessageID() uint32 {
+	return MAVLINK_MSG_ID_EKF_STATUS_REPORT
+}
+
+func (msg EkfStatusReport) MessageSize() uint8 {
+	return MAVLINK_MSG_SIZE_EKF_STATUS_REPORT + 4
+}
+
+func float32Array(payload []byte, offset int, values []float32) {
+	for i := range values {
+		values[i] = float32At(payload, offset+4*i)
+	}
+}
+
+func decodeVisionPositionEstimate(data *RawMessage) (*VisionPositionEstimateMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_VISION_POSITION_ESTIMATE + 85)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for VISION_POSITION_ESTIMATE message")
+	}
+	newMessage := &VisionPositionEstimateMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "VISION_POSITION_ESTIMATE"),
+		Usec:                  binary.LittleEndian.Uint64(payload[0:8]),
+		X:                     float32At(payload, 8),
+		Y:                     float32At(payload, 12),
+		Z:                     float32At(payload, 16),
+		Roll:                  float32At(payload, 20),
+		Pitch:                 float32At(payload, 24),
+		Yaw:                   float32At(payload, 28),
+		ResetCounter:          payload[116],
+	}
+	float32Array(payload, 32, newMessage.Covariance[:])
+	return newMessage, nil
+}
+
+type VisionPositionEstimateMessage struct {
+	DecodedMavlinkMessage
+	Usec         uint64
+	X            float32
+	Y            float32
+	Z            float32
+	Roll         float32
+	Pitch        float32
+	Yaw          float32
+	Covariance   [21]float32
+	ResetCounter uint8
+}
+
+func (m *VisionPositionEstimateMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *VisionPositionEstimateMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *VisionPositionEstimateMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Usec":         m.Usec,
+		"X":            m.X,
+		"Y":            m.Y,
+		"Z":            m.Z,
+		"Roll":         m.Roll,
+		"Pitch":        m.Pitch,
+		"Yaw":          m.Yaw,
+		"Covariance":   m.Covariance,
+		"ResetCounter": m.ResetCounter,
+	}
+}
+
+func decodeVisionSpeedEstimate(data *RawMessage) (*VisionSpeedEstimateMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_VISION_SPEED_ESTIMATE + 37)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for VISION_SPEED_ESTIMATE message")
+	}
+	newMessage := &VisionSpeedEstimateMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "VISION_SPEED_ESTIMATE"),
+		Usec:                  binary.LittleEndian.Uint64(payload[0:8]),
+		X:                     float32At(payload, 8),
+		Y:                     float32At(payload, 12),
+		Z:                     float32At(payload, 16),
+		ResetCounter:          payload[56],
+	}
+	float32Array(payload, 20, newMessage.Covariance[:])
+	return newMessage, nil
+}
+
+type VisionSpeedEstimateMessage struct {
+	DecodedMavlinkMessage
+	Usec         uint64
+	X            float32
+	Y            float32
+	Z            float32
+	Covariance   [9]float32
+	ResetCounter uint8
+}
+
+func (m *VisionSpeedEstimateMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *VisionSpeedEstimateMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *VisionSpeedEstimateMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"Usec":         m.Usec,
+		"X":            m.X,
+		"Y":            m.Y,
+		"Z":            m.Z,
+		"Covariance":   m.Covariance,
+		"ResetCounter": m.ResetCounter,
+	}
+}
+
+func decodeEkfStatusReport(data *RawMessage) (*EkfStatusReportMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_EKF_STATUS_REPORT + 4)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for EKF_STATUS_REPORT message")
+	}
+	newMessage := &EkfStatusReportMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "EKF_STATUS_REPORT"),
+		VelocityVariance:      float32At(payload, 0),
+		PosHorizVariance:      float32At(payload, 4),
+		PosVertVariance:       float32At(payload, 8),
+		CompassVariance:       float32At(payload, 12),
+		TerrainAltVariance:    float32At(payload, 16),
+		Flags:                 binary.LittleEndian.Uint16(payload[20:22]),
+		AirspeedVariance:      float32At(payload, 22),
+	}
+	return newMessage, nil
+}
+
+type EkfStatusReportMessage struct {
+	DecodedMavlinkMessage
+	VelocityVariance   float32
+	PosHorizVariance   float32
+	PosVertVariance    float32
+	CompassVariance    float32
+	TerrainAltVariance float32
+	Flags              uint16
+	AirspeedVariance   float32
+}
+
+func (m *EkfStatusReportMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *EkfStatusReportMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *EkfStatusReportMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"VelocityVariance":   m.VelocityVariance,
+		"PosHorizVariance":   m.PosHorizVariance,
+		"PosVertVariance":    m.PosVertVariance,
+		"CompassVariance":    m.CompassVariance,
+		"TerrainAltVariance": m.TerrainAltVariance,
+		"Flags":              m.Flags,
+		"AirspeedVariance":   m.AirspeedVariance,
+	}
+}
+
+// PX4's equivalent of EKF_STATUS_REPORT. Ratios are test ratios, where
+// anything above 1 means measurements are being rejected, and accuracies
+// are in meters.
+func decodeEstimatorStatus(data *RawMessage) (*EstimatorStatusMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_ESTIMATOR_STATUS)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for ESTIMATOR_STATUS message")
+	}
+	newMessage := &EstimatorStatusMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "ESTIMATOR_STATUS"),
+		TimeUsec:              binary.LittleEndian.Uint64(payload[0:8]),
+		VelRatio:              float32At(payload, 8),
+		PosHorizRatio:         float32At(payload, 12),
+		PosVertRatio:          float32At(payload, 16),
+		MagRatio:              float32At(payload, 20),
+		HaglRatio:             float32At(payload, 24),
+		TasRatio:              float32At(payload, 28),
+		PosHorizAccuracy:      float32At(payload, 32),
+		PosVertAccuracy:       float32At(payload, 36),
+		Flags:                 binary.LittleEndian.Uint16(payload[40:42]),
+	}
+	return newMessage, nil
+}
+
+type EstimatorStatusMessage struct {
+	DecodedMavlinkMessage
+	TimeUsec         uint64
+	VelRatio         float32
+	PosHorizRatio    float32
+	PosVertRatio     float32
+	MagRatio         float32
+	HaglRatio        float32
+	TasRatio         float32
+	PosHorizAccuracy float32
+	PosVertAccuracy  float32
+	Flags            uint16
+}
+
+func (m *EstimatorStatusMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *EstimatorStatusMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *EstimatorStatusMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeUsec":         m.TimeUsec,
+		"VelRatio":         m.VelRatio,
+		"PosHorizRatio":    m.PosHorizRatio,
+		"PosVertRatio":     m.PosVertRatio,
+		"MagRatio":         m.MagRatio,
+		"HaglRatio":        m.HaglRatio,
+		"TasRatio":         m.TasRatio,
+		"PosHorizAccuracy": m.PosHorizAccuracy,
+		"PosVertAccuracy":  m.PosVertAccuracy,
+		"Flags":            m.Flags,
+	}
+}
+
+func decodeOdometry(data *RawMessage) (*OdometryMessage, error) {
+	payload, ok := data.paddedPayload(MAVLINK_MSG_SIZE_ODOMETRY + 3)
+	if !ok {
+		return nil, fmt.Errorf("invalid payload length for ODOMETRY message")
+	}
+	newMessage := &OdometryMessage{
+		DecodedMavlinkMessage: newDecodedMavlinkMessage(data, "ODOMETRY"),
+		TimeUsec:              binary.LittleEndian.Uint64(payload[0:8]),
+		X:                     float32At(payload, 8),
+		Y:                     float32At(payload, 12),
+		Z:                     float32At(payload, 16),
+		Vx:                    float32At(payload, 36),
+		Vy:                    float32At(payload, 40),
+		Vz:                    float32At(payload, 44),
+		Rollspeed:             float32At(payload, 48),
+		Pitchspeed:            float32At(payload, 52),
+		Yawspeed:              float32At(payload, 56),
+		FrameID:               payload[228],
+		ChildFrameID:          payload[229],
+		ResetCounter:          payload[230],
+		EstimatorType:         payload[231],
+		Quality:               int8(payload[232]),
+	}
+	float32Array(payload, 20, newMessage.Q[:])
+	float32Array(payload, 60, newMessage.PoseCovariance[:])
+	float32Array(payload, 144, newMessage.VelocityCovariance[:])
+	return newMessage, nil
+}
+
+type OdometryMessage struct {
+	DecodedMavlinkMessage
+	TimeUsec           uint64
+	X                  float32
+	Y                  float32
+	Z                  float32
+	Q                  [4]float32
+	Vx                 float32
+	Vy                 float32
+	Vz                 float32
+	Rollspeed          float32
+	Pitchspeed         float32
+	Yawspeed           float32
+	PoseCovariance     [21]float32
+	VelocityCovariance [21]float32
+	FrameID            uint8
+	ChildFrameID       uint8
+	ResetCounter       uint8
+	EstimatorType      uint8
+	Quality            int8
+}
+
+func (m *OdometryMessage) GetMessageID() int {
+	return m.MessageID
+}
+
+func (m *OdometryMessage) GetMessageName() string {
+	return m.MessageName
+}
+
+func (m *OdometryMessage) MessageData() DecodedPayload {
+	return DecodedPayload{
+		"TimeUsec":           m.TimeUsec,
+		"X":                  m.X,
+		"Y":                  m.Y,
+		"Z":                  m.Z,
+		"Q":                  m.Q,
+		"Vx":                 m.Vx,
+		"Vy":                 m.Vy,
+		"Vz":                 m.Vz,
+		"Rollspeed":          m.Rollspeed,
+		"Pitchspeed":         m.Pitchspeed,
+		"Yawspeed":           m.Yawspeed,
+		"PoseCovariance":     m.PoseCovariance,
+		"VelocityCovariance": m.VelocityCovariance,
+		"FrameID":            m.FrameID,
+		"ChildFrameID":       m.ChildFrameID,
+		"ResetCounter":       m.ResetCounter,
+		"EstimatorType":      m.EstimatorType,
+		"Quality":            m.Quality,
+	}
+}
@@ -0,0 +1,91 @@
+package mavcom
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Linux joystick API events, see linux/joystick.h
+const (
+	jsEventButton = 0x01
+	jsEventAxis   = 0x02
+	// set on the events sent when the device is opened, which report the
+	// state it starts in
+	jsEventInit = 0x80
+	jsEventSize = 8
+	jsAxisMax   = 32767
+)
+
+// Joystick is an InputSource reading a Linux joystick device such as
+// /dev/input/js0
+type Joystick struct {
+	file  *os.File
+	lock  sync.Mutex
+	state InputState
+	err   error
+}
+
+// Opens a Linux joystick device and starts reading it
+func OpenJoystick(path string) (*Joystick, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &Joystick{file: file}
+	go j.read()
+	return j, nil
+}
+
+func (j *Joystick) read() {
+	event := make([]byte, jsEventSize)
+	for {
+		if _, err := io.ReadFull(j.file, event); err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				err = io.EOF
+			}
+			j.lock.Lock()
+			j.err = err
+			j.lock.Unlock()
+			return
+		}
+		value := int16(binary.LittleEndian.Uint16(event[4:6]))
+		kind := event[6] &^ jsEventInit
+		number := int(event[7])
+
+		j.lock.Lock()
+		switch kind {
+		case jsEventAxis:
+			for len(j.state.Axes) <= number {
+				j.state.Axes = append(j.state.Axes, 0)
+			}
+			j.state.Axes[number] = float64(value) / jsAxisMax
+		case jsEventButton:
+			for len(j.state.Buttons) <= number {
+				j.state.Buttons = append(j.state.Buttons, false)
+			}
+			j.state.Buttons[number] = value != 0
+		}
+		j.lock.Unlock()
+	}
+}
+
+// Returns the latest state of the joystick, or the error that stopped it
+// being read, such as it being unplugged
+func (j *Joystick) Input() (InputState, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.err != nil {
+		return InputState{}, j.err
+	}
+	return InputState{
+		Axes:    append([]float64(nil), j.state.Axes...),
+		Buttons: append([]bool(nil), j.state.Buttons...),
+	}, nil
+}
+
+func (j *Joystick) Close() error {
+	return j.file.Close()
+}
@@ -0,0 +1,324 @@
+package mavcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How long to wait for the vehicle's side of a log transfer before asking
+// again, and how many times to ask
+const (
+	logRetryInterval = time.Second
+	logRetries       = 5
+)
+
+// How often a log download reports its progress
+const logProgressInterval = 250 * time.Millisecond
+
+// Suffix of the file a log is downloaded into, renamed once the download is
+// complete, and of the file next to it recording which log it holds
+const (
+	logPartSuffix = ".part"
+	logInfoSuffix = ".part.info"
+)
+
+// LogEntry is a dataflash log stored on the vehicle. Time is zero if the
+// vehicle didn't know the time when the log was written.
+type LogEntry struct {
+	ID   uint16
+	Time time.Time
+	Size uint32
+}
+
+// LogProgress is how much of a log has been downloaded so far
+type LogProgress struct {
+	Received uint32
+	Size     uint32
+}
+
+// Lists the logs stored on the vehicle, ordered by ID
+func (v *Vehicle) ListLogs(ctx context.Context) ([]LogEntry, error) {
+	replies, unsubscribe := v.Connection.Subscribe(mavlink.MAVLINK_MSG_ID_LOG_ENTRY)
+	defer unsubscribe()
+
+	targetSystem, targetComponent := v.Connection.Target()
+	request := mavlink.LogRequestList{
+		Start:           0,
+		End:             0xffff,
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+	}
+	if err := v.Connection.Send(request); err != nil {
+		return nil, err
+	}
+	retry := time.NewTicker(logRetryInterval)
+	defer retry.Stop()
+	retries := 0
+
+	entries := make(map[uint16]LogEntry)
+	count := -1
+
+	for count < 0 || len(entries) < count {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("log list: %w", ctx.Err())
+
+		case <-retry.C:
+			retries++
+			if retries > logRetries {
+				return nil, fmt.Errorf("log list: vehicle stopped responding")
+			}
+			// ask again for the whole list, the entries that already
+			// arrived are just replaced
+			if err := v.Connection.Send(request); err != nil {
+				return nil, err
+			}
+
+		case msg, ok := <-replies:
+			if !ok {
+				return nil, fmt.Errorf("log list: connection closed")
+			}
+			reply := msg.(*mavlink.LogEntryMessage)
+			count = int(reply.NumLogs)
+			// with no logs the vehicle sends a single entry with ID 0
+			if count > 0 {
+				entry := LogEntry{ID: reply.ID, Size: reply.Size}
+				if reply.TimeUtc != 0 {
+					entry.Time = time.Unix(int64(reply.TimeUtc), 0).UTC()
+				}
+				entries[reply.ID] = entry
+			}
+			retries = 0
+			retry.Reset(logRetryInterval)
+		}
+	}
+
+	list := make([]LogEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// A range of a log that hasn't been received yet
+type logRange struct {
+	start uint32
+	end   uint32
+}
+
+// Downloads a log into a file. The log is first written to the file with
+// ".part" appended, which is renamed once every byte has arrived. If the
+// download fails the part file is kept, cut back to the bytes received
+// without gaps, and the next download of the same log carries on from
+// there, as long as the part file holds a log of the same ID, size and time.
+// Chunks lost in the middle of the transfer are noticed from the gap
+// they leave in the offsets and requested again. progress, if not nil, is
+// called from time to time and once more when the download is complete.
+func (v *Vehicle) DownloadLog(ctx context.Context, entry LogEntry, path string, progress func(LogProgress)) (err error) {
+	name := fmt.Sprintf("log %d download", entry.ID)
+	partPath := path + logPartSuffix
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	resumeFrom, err := resumeLog(f, entry, path+logInfoSuffix)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	replies, unsubscribe := v.Connection.Subscribe(mavlink.MAVLINK_MSG_ID_LOG_DATA)
+	defer unsubscribe()
+
+	// everything not yet received, the range being requested first
+	missing := []logRange{{start: resumeFrom, end: entry.Size}}
+	if resumeFrom == entry.Size {
+		missing = nil
+	}
+	received := resumeFrom
+
+	targetSystem, targetComponent := v.Connection.Target()
+	defer func() {
+		if err == nil {
+			return
+		}
+		// let the vehicle go back to logging, the connection may be why
+		// the download failed so a failure to send is ignored
+		v.Connection.Send(mavlink.LogRequestEnd{
+			TargetSystem:    targetSystem,
+			TargetComponent: targetComponent,
+		})
+		// keep only what arrived without gaps, so that resuming only has
+		// to look at the size of the file
+		contiguous := entry.Size
+		for _, r := range missing {
+			contiguous = min(contiguous, r.start)
+		}
+		f.Truncate(int64(contiguous))
+		f.Close()
+	}()
+
+	report := func() {
+		if progress != nil {
+			progress(LogProgress{Received: received, Size: entry.Size})
+		}
+	}
+	lastReport := time.Now()
+	report()
+
+	request := func() error {
+		return v.Connection.Send(mavlink.LogRequestData{
+			Ofs:             missing[0].start,
+			Count:           missing[0].end - missing[0].start,
+			ID:              entry.ID,
+			TargetSystem:    targetSystem,
+			TargetComponent: targetComponent,
+		})
+	}
+	if len(missing) > 0 {
+		if err := request(); err != nil {
+			return err
+		}
+	}
+	retry := time.NewTicker(logRetryInterval)
+	defer retry.Stop()
+	retries := 0
+
+	for len(missing) > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", name, ctx.Err())
+
+		case <-retry.C:
+			retries++
+			if retries > logRetries {
+				return fmt.Errorf("%s: vehicle stopped responding", name)
+			}
+			if err := request(); err != nil {
+				return err
+			}
+
+		case msg, ok := <-replies:
+			if !ok {
+				return fmt.Errorf("%s: connection closed", name)
+			}
+			data := msg.(*mavlink.LogDataMessage)
+			current := &missing[0]
+			if data.ID != entry.ID || data.Ofs < current.start || data.Ofs >= current.end {
+				// from another log, an earlier request or already received
+				continue
+			}
+			if data.Count == 0 {
+				return fmt.Errorf("%s: log ended at %d bytes, expected %d", name, data.Ofs, entry.Size)
+			}
+			if _, err := f.WriteAt(data.Data, int64(data.Ofs)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if data.Ofs > current.start {
+				// chunks were lost before this one, fetch them once the
+				// current request is done
+				missing = append(missing, logRange{start: current.start, end: data.Ofs})
+				current = &missing[0]
+			}
+			end := min(data.Ofs+uint32(len(data.Data)), current.end)
+			received += end - data.Ofs
+			current.start = end
+			if current.start == current.end {
+				missing = missing[1:]
+				if len(missing) > 0 {
+					if err := request(); err != nil {
+						return err
+					}
+				}
+			}
+			retries = 0
+			retry.Reset(logRetryInterval)
+			if time.Since(lastReport) >= logProgressInterval {
+				report()
+				lastReport = time.Now()
+			}
+		}
+	}
+
+	// let the vehicle go back to logging
+	if err := v.Connection.Send(mavlink.LogRequestEnd{
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+	}); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := os.Remove(path + logInfoSuffix); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	report()
+	return nil
+}
+
+// How the info file next to a part file describes the log it holds
+func logInfo(entry LogEntry) string {
+	var utc int64
+	if !entry.Time.IsZero() {
+		utc = entry.Time.Unix()
+	}
+	return fmt.Sprintf("%d %d %d\n", entry.ID, entry.Size, utc)
+}
+
+// Returns how much of the log the part file already holds. A part file
+// left by a different log, such as one with the same ID after the logs were
+// erased, is emptied so that the download starts over.
+func resumeLog(f *os.File, entry LogEntry, infoPath string) (uint32, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.ReadFile(infoPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	if string(info) == logInfo(entry) && stat.Size() <= int64(entry.Size) {
+		return uint32(stat.Size()), nil
+	}
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	return 0, os.WriteFile(infoPath, []byte(logInfo(entry)), 0o644)
+}
+
+// Removes the part file left by a failed download of a log, so that the
+// next download starts from the beginning
+func DiscardPartialLog(path string) error {
+	for _, suffix := range []string{logPartSuffix, logInfoSuffix} {
+		err := os.Remove(path + suffix)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Erases every log stored on the vehicle. The vehicle doesn't acknowledge
+// the erase, so list the logs afterwards to check it happened.
+func (v *Vehicle) EraseLogs() error {
+	targetSystem, targetComponent := v.Connection.Target()
+	return v.Connection.Send(mavlink.LogErase{
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+	})
+}
@@ -0,0 +1,140 @@
+package mavcom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// Lists the simulator's logs and returns the one with the given ID
+func findLog(t *testing.T, v *Vehicle, id uint16) LogEntry {
+	t.Helper()
+	entries, err := v.ListLogs(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry
+		}
+	}
+	t.Fatalf("log %d not listed in %+v", id, entries)
+	return LogEntry{}
+}
+
+func TestDownloadLogDroppedChunks(t *testing.T) {
+	s, v := newLossySimVehicle(t, sim.DefaultConfig(), dropEvery(7, mavlink.MAVLINK_MSG_ID_LOG_DATA))
+	data := testFile(6000)
+	s.WriteLog(3, data)
+	entry := findLog(t, v, 3)
+
+	path := filepath.Join(t.TempDir(), "flight.BIN")
+	var last LogProgress
+	err := v.DownloadLog(testContext(t), entry, path, func(p LogProgress) { last = p })
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Errorf("downloaded %d bytes that differ from the %d logged", len(downloaded), len(data))
+	}
+	if last.Received != entry.Size {
+		t.Errorf("last progress %d of %d bytes", last.Received, last.Size)
+	}
+	for _, suffix := range []string{logPartSuffix, logInfoSuffix} {
+		if _, err := os.Stat(path + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left behind", path+suffix)
+		}
+	}
+}
+
+func TestDownloadLogResume(t *testing.T) {
+	s, v := newSimVehicle(t, sim.DefaultConfig())
+	data := testFile(5000)
+	s.WriteLog(1, data)
+	entry := findLog(t, v, 1)
+	dir := t.TempDir()
+
+	download := func(path string) uint32 {
+		t.Helper()
+		var first *LogProgress
+		err := v.DownloadLog(testContext(t), entry, path, func(p LogProgress) {
+			if first == nil {
+				first = &p
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if downloaded, _ := os.ReadFile(path); !bytes.Equal(downloaded, data) {
+			t.Errorf("downloaded %d bytes that differ from the %d logged", len(downloaded), len(data))
+		}
+		return first.Received
+	}
+
+	// carries on from a part file of the same log
+	path := filepath.Join(dir, "same.BIN")
+	os.WriteFile(path+logPartSuffix, data[:2000], 0o644)
+	os.WriteFile(path+logInfoSuffix, []byte(logInfo(entry)), 0o644)
+	if resumed := download(path); resumed != 2000 {
+		t.Errorf("resumed from %d bytes, want 2000", resumed)
+	}
+
+	// starts over on one left by a log of another size with the same ID,
+	// or with nothing recording which log it is
+	other := entry
+	other.Size++
+	path = filepath.Join(dir, "other.BIN")
+	os.WriteFile(path+logPartSuffix, bytes.Repeat([]byte{0xff}, 2000), 0o644)
+	os.WriteFile(path+logInfoSuffix, []byte(logInfo(other)), 0o644)
+	if resumed := download(path); resumed != 0 {
+		t.Errorf("resumed a different log from %d bytes", resumed)
+	}
+	path = filepath.Join(dir, "unknown.BIN")
+	os.WriteFile(path+logPartSuffix, bytes.Repeat([]byte{0xff}, 2000), 0o644)
+	if resumed := download(path); resumed != 0 {
+		t.Errorf("resumed an unknown log from %d bytes", resumed)
+	}
+}
+
+func TestDownloadLogCancelled(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	path := filepath.Join(t.TempDir(), "flight.BIN")
+	entry := LogEntry{ID: 2, Size: 1000}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- v.DownloadLog(ctx, entry, path, nil)
+	}()
+	a.nextFrame(mavlink.MAVLINK_MSG_ID_LOG_REQUEST_DATA)
+	chunk := mavlink.LogData{ID: entry.ID, Count: 90}
+	copy(chunk.Data[:], testFile(90))
+	a.send(1, chunk)
+	// the chunk is written before the download is cancelled
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled download returned %v", err)
+	}
+	// the vehicle is told to stop sending
+	a.nextFrame(mavlink.MAVLINK_MSG_ID_LOG_REQUEST_END)
+	part, err := os.ReadFile(path + logPartSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(part) != 90 {
+		t.Errorf("part file kept %d bytes, want 90", len(part))
+	}
+}
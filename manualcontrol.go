@@ -0,0 +1,220 @@
+package mavcom
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// ArduPilot treats MANUAL_CONTROL like RC overrides and drops it when it
+// stops arriving, so it is sent continuously
+const defaultManualControlRate = 20 // Hz
+
+// Most buttons MANUAL_CONTROL carries
+const ManualControlButtons = 32
+
+// InputState is a snapshot of a joystick or gamepad. Axes run from -1 to 1,
+// with 0 at rest for sprung sticks.
+type InputState struct {
+	Axes    []float64
+	Buttons []bool
+}
+
+// InputSource is anything that can be flown with, such as a joystick. Input
+// is called at the rate MANUAL_CONTROL is sent and should return the latest
+// state without blocking. An error ends the stream.
+type InputSource interface {
+	Input() (InputState, error)
+}
+
+// AxisMapping says which input axis drives one of the vehicle's axes and how.
+// The zero value leaves the vehicle's axis unused.
+type AxisMapping struct {
+	// whether the vehicle's axis is driven at all, unused axes are sent as
+	// MANUAL_CONTROL's unused value
+	Used bool
+	// index into InputState.Axes
+	Input  int
+	Invert bool
+	// fraction of the travel around the centre that is treated as 0, so
+	// that a stick that doesn't quite centre doesn't drift the vehicle
+	Deadzone float64
+	// from 0 for a linear response to 1 for a cubic one, softening the
+	// response around the centre while keeping full deflection
+	Expo float64
+}
+
+// Applies the inversion, deadzone and expo to an axis value from -1 to 1
+func (m AxisMapping) apply(value float64) float64 {
+	value = math.Max(-1, math.Min(1, value))
+	if m.Invert {
+		value = -value
+	}
+	magnitude := math.Abs(value)
+	if magnitude <= m.Deadzone {
+		return 0
+	}
+	// rescale so that the output still starts from 0 at the edge of the
+	// deadzone and reaches 1 at full deflection
+	magnitude = (magnitude - m.Deadzone) / (1 - m.Deadzone)
+	magnitude = (1-m.Expo)*magnitude + m.Expo*magnitude*magnitude*magnitude
+	return math.Copysign(magnitude, value)
+}
+
+type ManualControlConfig struct {
+	// How often MANUAL_CONTROL is sent, in Hz. Defaults to 20.
+	Rate float64
+
+	Pitch    AxisMapping
+	Roll     AxisMapping
+	Throttle AxisMapping
+	Yaw      AxisMapping
+	// Sent as 0 to 1000 rather than -1000 to 1000, as ArduPilot and PX4
+	// expect, so that the bottom of the stick is no throttle
+	ThrottleFromZero bool
+
+	// The input button behind each MANUAL_CONTROL button, indexed by the
+	// MANUAL_CONTROL button number from 0, or -1 for none
+	Buttons []int
+}
+
+// A mode 2 gamepad as Linux reports it, left stick throttle and yaw, right
+// stick pitch and roll, with the first 16 buttons passed on as they are
+func DefaultManualControlConfig() ManualControlConfig {
+	buttons := make([]int, 16)
+	for i := range buttons {
+		buttons[i] = i
+	}
+	return ManualControlConfig{
+		Rate:             defaultManualControlRate,
+		Yaw:              AxisMapping{Used: true, Input: 0, Deadzone: 0.05, Expo: 0.3},
+		Throttle:         AxisMapping{Used: true, Input: 1, Invert: true, Deadzone: 0.05},
+		Roll:             AxisMapping{Used: true, Input: 2, Deadzone: 0.05, Expo: 0.3},
+		Pitch:            AxisMapping{Used: true, Input: 3, Invert: true, Deadzone: 0.05, Expo: 0.3},
+		ThrottleFromZero: true,
+		Buttons:          buttons,
+	}
+}
+
+// Converts an input axis to a MANUAL_CONTROL one
+func (m AxisMapping) axis(input InputState, fromZero bool) int16 {
+	if !m.Used || m.Input < 0 || m.Input >= len(input.Axes) {
+		return mavlink.MANUAL_CONTROL_AXIS_UNUSED
+	}
+	value := m.apply(input.Axes[m.Input])
+	if fromZero {
+		value = (value + 1) / 2
+	}
+	return int16(math.Round(value * mavlink.MANUAL_CONTROL_AXIS_MAX))
+}
+
+func (c ManualControlConfig) toMessage(input InputState, target uint8) mavlink.ManualControl {
+	msg := mavlink.ManualControl{
+		X:      c.Pitch.axis(input, false),
+		Y:      c.Roll.axis(input, false),
+		Z:      c.Throttle.axis(input, c.ThrottleFromZero),
+		R:      c.Yaw.axis(input, false),
+		Target: target,
+	}
+	for bit, button := range c.Buttons {
+		if bit >= ManualControlButtons || button < 0 || button >= len(input.Buttons) || !input.Buttons[button] {
+			continue
+		}
+		if bit < 16 {
+			msg.Buttons |= 1 << bit
+		} else {
+			msg.Buttons2 |= 1 << (bit - 16)
+		}
+	}
+	return msg
+}
+
+// ManualControl streams MANUAL_CONTROL from an input source until it is
+// stopped
+type ManualControl struct {
+	vehicle  *Vehicle
+	source   InputSource
+	config   ManualControlConfig
+	lock     sync.Mutex
+	last     mavlink.ManualControl
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	err      error
+}
+
+// Starts flying the vehicle from source, reading it and sending
+// MANUAL_CONTROL at config.Rate until Stop is called, ctx is done or the
+// source fails. Nothing is sent after that, so the vehicle goes back to its
+// RC transmitter, or its failsafe if there is none, as it would if the
+// joystick were unplugged.
+func (v *Vehicle) StartManualControl(ctx context.Context, source InputSource, config ManualControlConfig) *ManualControl {
+	if config.Rate <= 0 {
+		config.Rate = defaultManualControlRate
+	}
+	c := &ManualControl{
+		vehicle: v,
+		source:  source,
+		config:  config,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.run(ctx)
+	return c
+}
+
+// Returns the pitch, roll, throttle and yaw last sent, from -1000 to 1000
+// or 0 to 1000 for throttle from zero, with 32767 for unused axes
+func (c *ManualControl) Last() (pitch int16, roll int16, throttle int16, yaw int16) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.last.X, c.last.Y, c.last.Z, c.last.R
+}
+
+// Stops sending and returns any error from the source or from sending
+func (c *ManualControl) Stop() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.done
+	return c.err
+}
+
+// Closed once the stream has stopped, whether through Stop, ctx being done,
+// the source failing or the connection failing
+func (c *ManualControl) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *ManualControl) run(ctx context.Context) {
+	defer close(c.done)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / c.config.Rate))
+	defer ticker.Stop()
+
+	for {
+		input, err := c.source.Input()
+		if err != nil {
+			c.err = fmt.Errorf("manual control input: %w", err)
+			return
+		}
+		targetSystem, _ := c.vehicle.Connection.Target()
+		msg := c.config.toMessage(input, targetSystem)
+		if err := c.vehicle.Connection.Send(msg); err != nil {
+			c.err = err
+			return
+		}
+		c.lock.Lock()
+		c.last = msg
+		c.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package mavcom
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// An input source whose sticks stay where they are put
+type staticInput struct {
+	state InputState
+	err   error
+}
+
+func (s staticInput) Input() (InputState, error) {
+	return s.state, s.err
+}
+
+func TestAxisMappingApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping AxisMapping
+		value   float64
+		want    float64
+	}{
+		{"linear", AxisMapping{}, 0.5, 0.5},
+		{"clamped", AxisMapping{}, -1.5, -1},
+		{"inverted", AxisMapping{Invert: true}, 0.5, -0.5},
+		{"inside the deadzone", AxisMapping{Deadzone: 0.1}, 0.05, 0},
+		{"edge of the deadzone", AxisMapping{Deadzone: 0.1}, -0.1, 0},
+		{"past the deadzone", AxisMapping{Deadzone: 0.1}, 0.55, 0.5},
+		{"full deflection past the deadzone", AxisMapping{Deadzone: 0.1}, -1, -1},
+		{"cubic", AxisMapping{Expo: 1}, 0.5, 0.125},
+		{"half expo", AxisMapping{Expo: 0.5}, -0.5, -0.3125},
+		{"full deflection with expo", AxisMapping{Expo: 0.3}, 1, 1},
+		{"deadzone and expo", AxisMapping{Deadzone: 0.2, Expo: 1}, 0.6, 0.125},
+	}
+	for _, test := range tests {
+		if got := test.mapping.apply(test.value); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: %v maps to %v, want %v", test.name, test.value, got, test.want)
+		}
+	}
+}
+
+func TestManualControlMessage(t *testing.T) {
+	const unused = mavlink.MANUAL_CONTROL_AXIS_UNUSED
+	// throttle and pitch up, roll right and yaw centred
+	input := InputState{Axes: []float64{0, -1, 1, -1}, Buttons: []bool{true, false, true}}
+
+	msg := ManualControlConfig{}.toMessage(input, 1)
+	if msg.X != unused || msg.Y != unused || msg.Z != unused || msg.R != unused {
+		t.Errorf("zero config sent axes %d %d %d %d, want them all unused", msg.X, msg.Y, msg.Z, msg.R)
+	}
+
+	msg = DefaultManualControlConfig().toMessage(input, 1)
+	if msg.X != 1000 || msg.Y != 1000 || msg.Z != 1000 || msg.R != 0 {
+		t.Errorf("default config sent pitch %d, roll %d, throttle %d, yaw %d, want 1000, 1000, 1000, 0", msg.X, msg.Y, msg.Z, msg.R)
+	}
+	if msg.Buttons != 0b101 || msg.Target != 1 {
+		t.Errorf("default config sent buttons %b to system %d, want 101 to 1", msg.Buttons, msg.Target)
+	}
+
+	config := ManualControlConfig{
+		// an input axis the joystick doesn't have
+		Yaw: AxisMapping{Used: true, Input: 4},
+		// throttle centred is half throttle from zero
+		Throttle:         AxisMapping{Used: true, Input: 0},
+		ThrottleFromZero: true,
+		Buttons:          make([]int, ManualControlButtons+1),
+	}
+	for i := range config.Buttons {
+		config.Buttons[i] = -1
+	}
+	config.Buttons[0] = 2
+	config.Buttons[1] = 1
+	config.Buttons[17] = 0
+	config.Buttons[18] = 3
+	// past the buttons MANUAL_CONTROL has
+	config.Buttons[ManualControlButtons] = 0
+	msg = config.toMessage(input, 1)
+	if msg.R != unused || msg.Z != 500 {
+		t.Errorf("sent yaw %d and throttle %d, want unused and 500", msg.R, msg.Z)
+	}
+	if msg.Buttons != 0b1 || msg.Buttons2 != 0b10 {
+		t.Errorf("sent buttons %b and %b, want 1 and 10", msg.Buttons, msg.Buttons2)
+	}
+}
+
+func TestManualControlStream(t *testing.T) {
+	_, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+	// full throttle, pitch forward, roll right and yaw centred
+	source := staticInput{state: InputState{Axes: []float64{0, -1, 1, -1}}}
+	control := v.StartManualControl(ctx, source, DefaultManualControlConfig())
+
+	// the simulator applies MANUAL_CONTROL as an RC override, pushing the
+	// stick forward lowering the pitch channel
+	want := []uint16{2000, 1000, 2000, 1500}
+	err := v.waitFor(ctx, "test", "RC channels to follow the sticks", func() bool {
+		if v.rcChannels == nil || len(v.rcChannels.Channels) < len(want) {
+			return false
+		}
+		for i, pwm := range want {
+			if v.rcChannels.Channels[i] != pwm {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := control.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if pitch, roll, throttle, yaw := control.Last(); pitch != 1000 || roll != 1000 || throttle != 1000 || yaw != 0 {
+		t.Errorf("last sent %d %d %d %d, want 1000 1000 1000 0", pitch, roll, throttle, yaw)
+	}
+}
+
+func TestManualControlStopsWhenSourceFails(t *testing.T) {
+	_, v := newSimVehicle(t, sim.DefaultConfig())
+	unplugged := errors.New("unplugged")
+	control := v.StartManualControl(testContext(t), staticInput{err: unplugged}, DefaultManualControlConfig())
+	<-control.Done()
+	if err := control.Stop(); !errors.Is(err, unplugged) {
+		t.Errorf("stopped with %v, want the source's error", err)
+	}
+}
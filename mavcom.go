@@ -1,13 +1,21 @@
 package mavcom
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"sync"
+	"time"
 
+	"github.com/arducrow/go-mavcom/ftp"
 	"github.com/arducrow/go-mavcom/internal/communicator"
 	"github.com/arducrow/go-mavcom/internal/mavlink"
 )
 
+// How often state that ages out without a message to prompt it, such as a
+// long status text whose last chunk never arrived, is checked
+const housekeepingInterval = 500 * time.Millisecond
+
 type Airframe int
 
 const (
@@ -28,8 +36,9 @@ func (a Airframe) String() string {
 }
 
 type Battery struct {
-	Voltage float64
-	Current float64
+	Voltage   float64
+	Current   float64
+	Remaining float64 // percent, -1 if the autopilot doesn't know
 }
 
 type Position struct {
@@ -38,10 +47,42 @@ type Position struct {
 	AltitudeRelative float64
 	AltitudeAMSL     float64
 	Heading          float64
+	// the vehicle's clock when the position was measured, see
+	// Vehicle.BootTimeToLocal
+	TimeBootMs uint32
+}
+
+// LandedState is whether the vehicle is on the ground or in the air, as
+// reported in EXTENDED_SYS_STATE
+type LandedState int
+
+const (
+	LandedStateUnknown LandedState = iota
+	LandedStateOnGround
+	LandedStateInAir
+	LandedStateTakingOff
+	LandedStateLanding
+)
+
+func (l LandedState) String() string {
+	switch l {
+	case LandedStateOnGround:
+		return "ON_GROUND"
+	case LandedStateInAir:
+		return "IN_AIR"
+	case LandedStateTakingOff:
+		return "TAKEOFF"
+	case LandedStateLanding:
+		return "LANDING"
+	default:
+		return "UNKNOWN"
+	}
 }
 
 type FlightState struct {
+	Mode        string
 	Armed       bool
+	LandedState LandedState
 	ClimbRate   float64
 	Airspeed    float64
 	Groundspeed float64
@@ -55,40 +96,256 @@ type Vehicle struct {
 	Battery     Battery
 	Position    Position
 	FlightState FlightState
-	lock        sync.Mutex
+	// Applied once the vehicle has connected, set to nil before calling
+	// Start to leave the vehicle's message rates as they are
+	TelemetryProfile *TelemetryProfile
+	// How often to sample the vehicle's clock with TIMESYNC once connected,
+	// set to 0 before calling Start to leave it alone
+	TimeSyncInterval time.Duration
+	// The volume around the vehicle that ADS-B traffic is alerted on, set
+	// before calling Start
+	TrafficAlerts TrafficAlertConfig
+	// Set before calling Start to present the connection as a component of
+	// its own, such as a companion computer, rather than a ground station
+	Component *ComponentConfig
+	// What Arm checks before arming, set to nil to arm without checking
+	PreflightChecks *PreflightConfig
+	// Where the vehicle and its connection report what they are doing and
+	// problems that have no caller to return an error to, such as a message
+	// that fails to decode, set before calling Start
+	Logger *slog.Logger
+	lock   sync.Mutex
+	// the log being replayed, nil for a live link, and the time in it when
+	// housekeeping last ran
+	replay    *TlogReplay
+	housekept time.Time
+	// when each message was last received, by ID
+	received map[int]time.Time
+	// closed once the first heartbeat has been received
+	connectedChan chan struct{}
+	// closed once the connection has closed
+	closedChan chan struct{}
+	// recent status texts, long ones still being reassembled, and who to
+	// pass them on to
+	statusTexts      []StatusText
+	statusTextChunks map[statusTextKey]*statusTextChunks
+	statusTextSubs   map[chan StatusText]bool
+	// ID of the last long status text sent
+	statusTextID uint16
+	ftp          *ftp.Client
+	timeSync     timeSync
+	// the autopilot software from the heartbeat, and what it reported in
+	// AUTOPILOT_VERSION
+	firmware         Firmware
+	autopilotVersion *AutopilotVersion
+	// the latest RC inputs and servo outputs
+	rcChannels           *RCChannels
+	servoOutputs         ServoOutputs
+	servoOutputsReceived bool
+	// gimbals heard from, and the managers that have been asked for their
+	// information
+	gimbals                    map[gimbalKey]*Gimbal
+	gimbalInformationRequested map[GimbalID]bool
+	// cameras heard from, the pictures each has taken, and who to pass the
+	// pictures on to
+	cameras      map[CameraID]*Camera
+	cameraImages map[CameraID]*cameraImages
+	imageSubs    map[chan CapturedImage]bool
+	// aircraft heard by the ADS-B receiver, and who to pass alerts on to
+	traffic          map[uint32]*trackedTraffic
+	trafficAlertSubs map[chan TrafficAlert]bool
+	// what to do with commands addressed to the component, and the commands
+	// being carried out or recently acknowledged
+	commandHandlers map[uint16]CommandHandler
+	handledCommands map[commandKey]*handledCommand
+	// the latest SYS_STATUS sensors, EKF_STATUS_REPORT or ESTIMATOR_STATUS
+	// and VIBRATION
+	health Health
+	// the latest GPS_RAW_INT and HOME_POSITION
+	gps  GPS
+	home Home
+}
+
+func newVehicle(mc *communicator.MavlinkCommunicator) *Vehicle {
+	return &Vehicle{
+		Connection:                 mc,
+		replay:                     mc.Replay(),
+		TelemetryProfile:           DefaultTelemetryProfile(),
+		received:                   make(map[int]time.Time),
+		TimeSyncInterval:           defaultTimeSyncInterval,
+		TrafficAlerts:              DefaultTrafficAlertConfig(),
+		PreflightChecks:            DefaultPreflightConfig(),
+		Logger:                     slog.Default(),
+		connectedChan:              make(chan struct{}),
+		closedChan:                 make(chan struct{}),
+		statusTextChunks:           make(map[statusTextKey]*statusTextChunks),
+		statusTextSubs:             make(map[chan StatusText]bool),
+		gimbals:                    make(map[gimbalKey]*Gimbal),
+		gimbalInformationRequested: make(map[GimbalID]bool),
+		cameras:                    make(map[CameraID]*Camera),
+		cameraImages:               make(map[CameraID]*cameraImages),
+		imageSubs:                  make(map[chan CapturedImage]bool),
+		traffic:                    make(map[uint32]*trackedTraffic),
+		trafficAlertSubs:           make(map[chan TrafficAlert]bool),
+		commandHandlers:            make(map[uint16]CommandHandler),
+		handledCommands:            make(map[commandKey]*handledCommand),
+	}
 }
 
 func NewVehicle(port string, baud int, network bool) (*Vehicle, error) {
 	// TODO - Implement the vehicle's main loop
-	fmt.Println("New vehicle")
 	mc, err := communicator.NewMavlinkCommunicator(port, baud, network)
 	if err != nil {
-		fmt.Println("Error creating Vehicle: ", err)
 		return nil, err
 	}
-	vehicle := &Vehicle{Connection: mc}
+	vehicle := newVehicle(mc)
 	return vehicle, nil
 }
 
+// Creates a vehicle from a connection URL such as "tcp://127.0.0.1:5760",
+// "udp://:14550", "serial:///dev/ttyUSB0:57600" or "tlog:///tmp/flight.tlog"
+func Connect(url string) (*Vehicle, error) {
+	t, err := communicator.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return NewVehicleFromTransport(t), nil
+}
+
+// Transport is the byte stream a vehicle's connection runs over
+type Transport = communicator.Transport
+
+// TlogReplay plays back a recorded telemetry log as if it were a live link
+type TlogReplay = communicator.TlogReplay
+
+const (
+	ReplayRealTime         = communicator.ReplayRealTime
+	ReplayAsFastAsPossible = communicator.ReplayAsFastAsPossible
+)
+
+// LinkStats counts the messages, bytes, checksum failures and lost packets
+// on a vehicle's connection
+type LinkStats = communicator.LinkStats
+type MessageStats = communicator.MessageStats
+type SourceStats = communicator.SourceStats
+
+// Returns a snapshot of the statistics for the vehicle's connection
+func (v *Vehicle) Stats() LinkStats {
+	return v.Connection.Stats()
+}
+
+// Returns a MAVLink FTP client for the files on the vehicle. Its operations
+// fail with ftp.ErrUnsupported if AUTOPILOT_VERSION says the vehicle lacks
+// CapabilityFTP.
+func (v *Vehicle) FTP() *ftp.Client {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.ftp == nil {
+		v.ftp = ftp.NewClient(v.Connection)
+		v.ftp.Supported = func() bool {
+			return v.requireCapability(CapabilityFTP, "ftp") == nil
+		}
+	}
+	return v.ftp
+}
+
+// Opens a recorded .tlog file for replay at the given speed, where 1 is real
+// time and 0 is as fast as possible
+func NewTlogReplay(path string, speed float64) (*TlogReplay, error) {
+	return communicator.NewTlogReplay(path, speed)
+}
+
+// Creates a vehicle on top of an already opened transport, such as a
+// telemetry log replay
+func NewVehicleFromTransport(t Transport) *Vehicle {
+	return newVehicle(communicator.NewMavlinkCommunicatorFromTransport(t))
+}
+
 // Begins the vehicles main loop
 // Spawns a goroutine to listen for messages from the connection
 // since reading from a channel is blocking
 // Starts the mavlink connection once this goroutine is running
 func (v *Vehicle) Start() {
-	fmt.Println("Starting Vehicle...")
+	v.Logger.Debug("starting vehicle")
+	v.Connection.Logger = v.Logger
 
 	go func() {
 		for msg := range v.Connection.Messages() {
 			v.updateStates(msg)
 		}
+		v.lock.Lock()
+		v.closeStatusTextSubscriptions()
+		v.closeImageSubscriptions()
+		v.closeTrafficAlertSubscriptions()
+		v.lock.Unlock()
+		close(v.closedChan)
 	}()
+	if v.Component != nil && v.Component.SystemID != 0 {
+		v.Connection.SetSource(v.Component.SystemID, v.Component.ComponentID)
+	}
 	v.Connection.Start()
+	if v.replay != nil {
+		// a replay is read-only, and its housekeeping follows the log's
+		// time as messages arrive
+		return
+	}
+	if v.Component != nil {
+		config := *v.Component
+		if config.HeartbeatInterval <= 0 {
+			config.HeartbeatInterval = time.Second
+		}
+		go v.runComponent(config)
+	}
+	go v.runHousekeeping()
 
 	// select {}
 
 }
+
+// Ages out state that no message arrives to update, until the connection
+// closes
+func (v *Vehicle) runHousekeeping() {
+	ticker := time.NewTicker(housekeepingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.closedChan:
+			return
+		case now := <-ticker.C:
+			v.lock.Lock()
+			v.housekeep(now)
+			v.lock.Unlock()
+		}
+	}
+}
+
+// Must be called holding the lock
+func (v *Vehicle) housekeep(now time.Time) {
+	v.flushStaleStatusTexts(now)
+	v.expireTraffic(now)
+	v.housekept = now
+}
+
+// The current time, which for a replay is the time in the log
+func (v *Vehicle) now() time.Time {
+	if v.replay != nil {
+		return v.replay.Now()
+	}
+	return time.Now()
+}
+
+// Blocks until the first heartbeat has been received from the vehicle
+func (v *Vehicle) WaitConnected(ctx context.Context) error {
+	select {
+	case <-v.connectedChan:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("no heartbeat from vehicle: %w", ctx.Err())
+	}
+}
+
 func (v *Vehicle) Travel(lat float64, lon float64, alt int) {
-	fmt.Printf("PLACEHOLDER. Vehicle travel to to %v, %v\n", lat, lon)
+	v.Logger.Info("PLACEHOLDER. Vehicle travel", "lat", lat, "lon", lon)
 }
 
 func (v *Vehicle) updateStates(msg mavlink.DecodedMessage) {
@@ -96,6 +353,13 @@ func (v *Vehicle) updateStates(msg mavlink.DecodedMessage) {
 	v.lock.Lock()
 	defer v.lock.Unlock()
 
+	// cameras, gimbals and other ground stations send heartbeats too, which
+	// say nothing about the vehicle and mustn't be mistaken for its autopilot
+	if hb, ok := msg.(*mavlink.HeartbeatMessage); ok && hb.Autopilot == mavlink.MAV_AUTOPILOT_INVALID {
+		v.handleComponentHeartbeat(hb)
+		return
+	}
+
 	if msg.GetMessageID() == 0 && !v.connected {
 		v.processInitialHeartbeat(msg)
 	} else if v.connected {
@@ -105,21 +369,141 @@ func (v *Vehicle) updateStates(msg mavlink.DecodedMessage) {
 			// Heartbeat
 			v.Connection.CurrentStates.Heartbeat = msg.MessageData()
 			// fmt.Println("HEARTBEAT SET: ", v.Connection.CurrentStates.Heartbeat)
+		case 1:
+			// SYS_STATUS
+			v.Connection.CurrentStates.SysStatusState = msg.MessageData()
+			v.updateBatteryState()
+			if status, ok := msg.(*mavlink.SysStatusMessage); ok {
+				v.handleSysStatusSensors(status)
+			}
+		case 24:
+			// GPS_RAW_INT
+			if gps, ok := msg.(*mavlink.GpsRawIntMessage); ok {
+				v.handleGpsRawInt(gps)
+			}
 		case 33:
 			// GlobalPositionInt
 			v.Connection.CurrentStates.GlobalPositionIntState = msg.MessageData()
+		case 36:
+			// SERVO_OUTPUT_RAW
+			if outputs, ok := msg.(*mavlink.ServoOutputRawMessage); ok {
+				v.handleServoOutputs(outputs)
+			}
+		case 65:
+			// RC_CHANNELS
+			if channels, ok := msg.(*mavlink.RcChannelsMessage); ok {
+				v.handleRCChannels(channels)
+			}
 		case 74:
 			// VFR_HUD
 			// fmt.Println("VFR_HUD: ", msg.MessageData())
 			v.Connection.CurrentStates.VFRHUDState = msg.MessageData()
 			// fmt.Println("VFR_HUD: ", v.Connection.CurrentStates.VFRHUDState)
+		case 76:
+			// COMMAND_LONG
+			if cmd, ok := msg.(*mavlink.CommandLongMessage); ok {
+				v.handleCommandLong(cmd)
+			}
+		case 111:
+			// TIMESYNC
+			if sync, ok := msg.(*mavlink.TimeSyncMessage); ok {
+				v.handleTimeSync(sync)
+			}
+		case 148:
+			// AUTOPILOT_VERSION
+			if version, ok := msg.(*mavlink.AutopilotVersionMessage); ok {
+				v.handleAutopilotVersion(version)
+			}
+		case 193:
+			// EKF_STATUS_REPORT
+			if report, ok := msg.(*mavlink.EkfStatusReportMessage); ok {
+				v.handleEkfStatusReport(report)
+			}
+		case 230:
+			// ESTIMATOR_STATUS
+			if status, ok := msg.(*mavlink.EstimatorStatusMessage); ok {
+				v.handleEstimatorStatus(status)
+			}
+		case 241:
+			// VIBRATION
+			if vibration, ok := msg.(*mavlink.VibrationMessage); ok {
+				v.handleVibration(vibration)
+			}
+		case 242:
+			// HOME_POSITION
+			if home, ok := msg.(*mavlink.HomePositionMessage); ok {
+				v.handleHomePosition(home)
+			}
+		case 245:
+			// EXTENDED_SYS_STATE
+			v.Connection.CurrentStates.ExtendedSysState = msg.MessageData()
+		case 246:
+			// ADSB_VEHICLE
+			if adsb, ok := msg.(*mavlink.AdsbVehicleMessage); ok {
+				v.handleAdsbVehicle(adsb)
+			}
+		case 253:
+			// STATUSTEXT
+			if text, ok := msg.(*mavlink.StatusTextMessage); ok {
+				v.handleStatusText(text)
+			}
+		case 259:
+			// CAMERA_INFORMATION
+			if info, ok := msg.(*mavlink.CameraInformationMessage); ok {
+				v.handleCameraInformation(info)
+			}
+		case 260:
+			// CAMERA_SETTINGS
+			if settings, ok := msg.(*mavlink.CameraSettingsMessage); ok {
+				v.handleCameraSettings(settings)
+			}
+		case 262:
+			// CAMERA_CAPTURE_STATUS
+			if status, ok := msg.(*mavlink.CameraCaptureStatusMessage); ok {
+				v.handleCameraCaptureStatus(status)
+			}
+		case 263:
+			// CAMERA_IMAGE_CAPTURED
+			if image, ok := msg.(*mavlink.CameraImageCapturedMessage); ok {
+				v.handleCameraImageCaptured(image)
+			}
+		case 280:
+			// GIMBAL_MANAGER_INFORMATION
+			if info, ok := msg.(*mavlink.GimbalManagerInformationMessage); ok {
+				v.handleGimbalManagerInformation(info)
+			}
+		case 281:
+			// GIMBAL_MANAGER_STATUS
+			if status, ok := msg.(*mavlink.GimbalManagerStatusMessage); ok {
+				v.handleGimbalManagerStatus(status)
+			}
+		case 285:
+			// GIMBAL_DEVICE_ATTITUDE_STATUS
+			if status, ok := msg.(*mavlink.GimbalDeviceAttitudeStatusMessage); ok {
+				v.handleGimbalDeviceAttitudeStatus(status)
+			}
 		default:
-			fmt.Println("Unknown message ID: ", msg.GetMessageID())
+			// acknowledgements, parameters and mission items are only of
+			// interest to whoever requested them
+		}
+	}
+
+	if v.connected {
+		v.received[msg.GetMessageID()] = v.now()
+	}
+	if v.replay != nil {
+		// housekeeping follows the time in the log whatever the speed, and
+		// starts over when the replay seeks backwards
+		if now := v.now(); now.Sub(v.housekept) >= housekeepingInterval || now.Before(v.housekept) {
+			v.housekeep(now)
 		}
 	}
 
 	if v.connected && v.Connection.CurrentStates.GlobalPositionIntState != nil {
 		v.updatePosition()
+		if msg.GetMessageID() == mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT {
+			v.updateTrafficAlerts()
+		}
 		if v.Connection.CurrentStates.VFRHUDState != nil && v.Connection.CurrentStates.Heartbeat != nil {
 			v.updateFlightState()
 		}
@@ -131,8 +515,27 @@ func (v *Vehicle) processInitialHeartbeat(msg mavlink.DecodedMessage) {
 	rawAirframe := msg.MessageData()["Type"].(float64)
 	intAirframe := int(rawAirframe)
 	v.Airframe = Airframe(intAirframe)
-	fmt.Println("Airframe: ", v.Airframe.String())
+	if hb, ok := msg.(*mavlink.HeartbeatMessage); ok {
+		v.Connection.SetTarget(hb.SystemID, hb.ComponentID)
+		if v.Component != nil && v.Component.SystemID == 0 {
+			v.Connection.SetSource(hb.SystemID, v.Component.ComponentID)
+		}
+		v.firmware = Firmware(hb.Autopilot)
+	}
+	v.Logger.Info("vehicle connected", "airframe", v.Airframe.String(), "firmware", v.firmware.String())
+	v.Connection.CurrentStates.Heartbeat = msg.MessageData()
 	v.connected = true
+	close(v.connectedChan)
+	if v.replay != nil {
+		return
+	}
+	if v.TelemetryProfile != nil {
+		go v.applyTelemetryProfileOnConnect(v.TelemetryProfile)
+	}
+	go v.requestAutopilotVersionOnConnect()
+	if v.TimeSyncInterval > 0 {
+		go v.runTimeSync(v.TimeSyncInterval)
+	}
 }
 
 func (v *Vehicle) updatePosition() {
@@ -142,6 +545,7 @@ func (v *Vehicle) updatePosition() {
 		AltitudeRelative: v.Connection.CurrentStates.GlobalPositionIntState["RelativeAlt"].(float64),
 		AltitudeAMSL:     v.Connection.CurrentStates.GlobalPositionIntState["Alt"].(float64),
 		Heading:          v.Connection.CurrentStates.GlobalPositionIntState["Hdg"].(float64),
+		TimeBootMs:       uint32(v.Connection.CurrentStates.GlobalPositionIntState["TimeBootMs"].(float64)),
 	}
 
 	// fmt.Println("Position state update: ", v.Position)
@@ -151,18 +555,23 @@ func (v *Vehicle) updateFlightState() {
 	// fmt.Printf("Flight state: %v\n", v.Connection.CurrentStates.VFRHUDState)
 	// fmt.Println("BaseMode: ", v.Connection.CurrentStates.Heartbeat["BaseMode"])
 	v.FlightState = FlightState{
-		Armed:       v.Connection.CurrentStates.Heartbeat["BaseMode"].(float64) >= 209,
+		Mode:        modeName(v.firmware, v.Airframe, uint32(v.Connection.CurrentStates.Heartbeat["CustomMode"].(float64))),
+		Armed:       v.armed(),
 		ClimbRate:   v.Connection.CurrentStates.VFRHUDState["Clb"].(float64),
 		Airspeed:    v.Connection.CurrentStates.VFRHUDState["Airspeed"].(float64),
 		Groundspeed: v.Connection.CurrentStates.VFRHUDState["Groundspeed"].(float64),
 		Throttle:    v.Connection.CurrentStates.VFRHUDState["Throttle"].(float64),
 	}
+	if v.Connection.CurrentStates.ExtendedSysState != nil {
+		v.FlightState.LandedState = LandedState(v.Connection.CurrentStates.ExtendedSysState["LandedState"].(float64))
+	}
 	// fmt.Println("Flight state update: ", v.FlightState)
 }
 
-// func (v *Vehicle) updateBatteryState(voltage float64, current float64) {
-// 	v.Battery = Battery{
-// 		Voltage: voltage,
-// 		Current: current,
-// 	}
-// }
+func (v *Vehicle) updateBatteryState() {
+	v.Battery = Battery{
+		Voltage:   v.Connection.CurrentStates.SysStatusState["VoltageBattery"].(float64),
+		Current:   v.Connection.CurrentStates.SysStatusState["CurrentBattery"].(float64),
+		Remaining: v.Connection.CurrentStates.SysStatusState["BatteryRemaining"].(float64),
+	}
+}
@@ -0,0 +1,112 @@
+package mavcom
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// A writer that is safe to log to from the vehicle's goroutines
+type syncBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestVehicleLogger(t *testing.T) {
+	s := sim.NewSimulator(sim.DefaultConfig())
+	t.Cleanup(func() { s.Close() })
+	v := NewVehicleFromTransport(s.Connect())
+	t.Cleanup(func() { v.Connection.Close() })
+	var logged syncBuffer
+	v.Logger = slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	v.Start()
+	if err := v.WaitConnected(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the connection logs with the vehicle's logger from its own goroutine
+	err := v.waitFor(testContext(t), "log", "heartbeat to be logged", func() bool {
+		return strings.Contains(logged.String(), "heartbeat received")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged.String(), "vehicle connected") {
+		t.Errorf("connection not logged:\n%s", logged.String())
+	}
+}
+
+// A few seconds of the simulator, connecting and arming
+const testTlog = "internal/communicator/testdata/flight.tlog"
+
+// Replays the test log into a vehicle with its default settings as fast as
+// possible, returning once the log has run out
+func replayTestTlog(t *testing.T) (*TlogReplay, *Vehicle) {
+	t.Helper()
+	replay, err := NewTlogReplay(testTlog, ReplayAsFastAsPossible)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewVehicleFromTransport(replay)
+	t.Cleanup(func() { v.Connection.Close() })
+	v.Start()
+	select {
+	case <-v.closedChan:
+	case <-time.After(simTestTimeout):
+		t.Fatal("replay didn't finish")
+	}
+	return replay, v
+}
+
+func TestTlogReplayIsReadOnly(t *testing.T) {
+	_, v := replayTestTlog(t)
+	// give anything started on connecting time to send
+	time.Sleep(100 * time.Millisecond)
+	if stats := v.Stats(); stats.FramesIn == 0 || stats.FramesOut != 0 {
+		t.Errorf("%d frames replayed and %d sent, want some replayed and none sent", stats.FramesIn, stats.FramesOut)
+	}
+}
+
+func TestTlogReplayTime(t *testing.T) {
+	replay, v := replayTestTlog(t)
+	during := func(what string, at time.Time) {
+		t.Helper()
+		if at.Before(replay.StartTime()) || at.After(replay.EndTime()) {
+			t.Errorf("%s at %v, want during the log from %v to %v", what, at, replay.StartTime(), replay.EndTime())
+		}
+	}
+
+	gps, ok := v.GPS()
+	if !ok {
+		t.Fatal("no GPS replayed")
+	}
+	during("GPS received", gps.Received)
+	during("SYS_STATUS received", v.Health().Sensors.Received)
+	texts := v.StatusTexts()
+	if len(texts) == 0 {
+		t.Fatal("no status texts replayed")
+	}
+	during("status text received", texts[0].Time)
+	// the log was recorded long enough ago for every report to be stale by
+	// the wall clock, but at its end they were all fresh
+	if problems := v.Unhealthy(); len(problems) != 0 {
+		t.Errorf("problems %v at the end of the log, want none", problems)
+	}
+}
@@ -0,0 +1,388 @@
+package mavcom
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How long to wait for the vehicle's side of a mission transfer before
+// repeating the last message, and how many times to repeat it
+const (
+	missionRetryInterval = 1500 * time.Millisecond
+	missionRetries       = 5
+)
+
+// Coordinate frames used by mission items
+const (
+	FrameGlobal            = 0
+	FrameLocalNED          = 1
+	FrameMission           = 2
+	FrameGlobalRelativeAlt = 3
+	FrameLocalENU          = 4
+	FrameGlobalTerrainAlt  = 10
+)
+
+// MissionItem is a single command in a mission. For global frames X and Y
+// are latitude and longitude in degrees, for local frames they are meters,
+// and Z is the altitude or height in meters. What Param1 to Param4 mean
+// depends on the command.
+type MissionItem struct {
+	Current      bool
+	Frame        uint8
+	Command      uint16
+	Param1       float32
+	Param2       float32
+	Param3       float32
+	Param4       float32
+	X            float64
+	Y            float64
+	Z            float32
+	Autocontinue bool
+}
+
+// X and Y are sent as integers, degrees scaled by 1e7 for global frames and
+// meters scaled by 1e4 for local ones
+func coordinateScale(frame uint8) float64 {
+	switch frame {
+	case FrameLocalNED, FrameLocalENU:
+		return 1e4
+	case FrameMission:
+		return 1
+	default:
+		return 1e7
+	}
+}
+
+func (item MissionItem) toMessage(seq uint16, missionType uint8, targetSystem uint8, targetComponent uint8) mavlink.MissionItemInt {
+	scale := coordinateScale(item.Frame)
+	msg := mavlink.MissionItemInt{
+		Param1:          item.Param1,
+		Param2:          item.Param2,
+		Param3:          item.Param3,
+		Param4:          item.Param4,
+		X:               int32(math.Round(item.X * scale)),
+		Y:               int32(math.Round(item.Y * scale)),
+		Z:               item.Z,
+		Seq:             seq,
+		Command:         item.Command,
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		Frame:           item.Frame,
+		MissionType:     missionType,
+	}
+	if item.Current {
+		msg.Current = 1
+	}
+	if item.Autocontinue {
+		msg.Autocontinue = 1
+	}
+	return msg
+}
+
+func missionItemFromMessage(msg *mavlink.MissionItemIntMessage) MissionItem {
+	scale := coordinateScale(msg.Frame)
+	return MissionItem{
+		Current:      msg.Current == 1,
+		Frame:        msg.Frame,
+		Command:      msg.Command,
+		Param1:       msg.Param1,
+		Param2:       msg.Param2,
+		Param3:       msg.Param3,
+		Param4:       msg.Param4,
+		X:            float64(msg.X) / scale,
+		Y:            float64(msg.Y) / scale,
+		Z:            msg.Z,
+		Autocontinue: msg.Autocontinue == 1,
+	}
+}
+
+func missionResultName(result uint8) string {
+	switch result {
+	case mavlink.MAV_MISSION_ACCEPTED:
+		return "ACCEPTED"
+	case mavlink.MAV_MISSION_ERROR:
+		return "ERROR"
+	case mavlink.MAV_MISSION_UNSUPPORTED:
+		return "UNSUPPORTED"
+	case mavlink.MAV_MISSION_NO_SPACE:
+		return "NO_SPACE"
+	case mavlink.MAV_MISSION_INVALID_SEQUENCE:
+		return "INVALID_SEQUENCE"
+	case mavlink.MAV_MISSION_DENIED:
+		return "DENIED"
+	case mavlink.MAV_MISSION_OPERATION_CANCELLED:
+		return "OPERATION_CANCELLED"
+	default:
+		return fmt.Sprintf("MISSION_RESULT(%d)", result)
+	}
+}
+
+// The name of a mission type for errors
+func missionTypeName(missionType uint8) string {
+	switch missionType {
+	case mavlink.MAV_MISSION_TYPE_FENCE:
+		return "fence"
+	case mavlink.MAV_MISSION_TYPE_RALLY:
+		return "rally"
+	default:
+		return "mission"
+	}
+}
+
+// The capability a vehicle needs for a mission type to be transferred with
+// MISSION_ITEM_INT
+func missionCapability(missionType uint8) Capability {
+	switch missionType {
+	case mavlink.MAV_MISSION_TYPE_FENCE:
+		return CapabilityMissionInt | CapabilityMissionFence
+	case mavlink.MAV_MISSION_TYPE_RALLY:
+		return CapabilityMissionInt | CapabilityMissionRally
+	default:
+		return CapabilityMissionInt
+	}
+}
+
+// Replaces the mission on the vehicle. The vehicle drives the transfer by
+// requesting each item in turn, and the last message is repeated if it goes
+// quiet. On ArduPilot the first item is the home position.
+func (v *Vehicle) UploadMission(ctx context.Context, items []MissionItem) error {
+	return v.uploadMissionItems(ctx, mavlink.MAV_MISSION_TYPE_MISSION, items)
+}
+
+// Reads the mission stored on the vehicle
+func (v *Vehicle) DownloadMission(ctx context.Context) ([]MissionItem, error) {
+	return v.downloadMissionItems(ctx, mavlink.MAV_MISSION_TYPE_MISSION)
+}
+
+// Replaces the list of items of one mission type on the vehicle. Fences and
+// rally points are transferred the same way as missions.
+func (v *Vehicle) uploadMissionItems(ctx context.Context, missionType uint8, items []MissionItem) error {
+	name := missionTypeName(missionType) + " upload"
+	if err := v.requireCapability(missionCapability(missionType), name); err != nil {
+		return err
+	}
+	replies, unsubscribe := v.Connection.Subscribe(
+		mavlink.MAVLINK_MSG_ID_MISSION_REQUEST,
+		mavlink.MAVLINK_MSG_ID_MISSION_REQUEST_INT,
+		mavlink.MAVLINK_MSG_ID_MISSION_ACK,
+	)
+	defer unsubscribe()
+
+	targetSystem, targetComponent := v.Connection.Target()
+	var last mavlink.MavlinkMessage = mavlink.MissionCount{
+		Count:           uint16(len(items)),
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		MissionType:     missionType,
+	}
+	if err := v.Connection.Send(last); err != nil {
+		return err
+	}
+	retry := time.NewTicker(missionRetryInterval)
+	defer retry.Stop()
+	retries := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", name, ctx.Err())
+
+		case <-retry.C:
+			retries++
+			if retries > missionRetries {
+				return fmt.Errorf("%s: vehicle stopped responding", name)
+			}
+			if err := v.Connection.Send(last); err != nil {
+				return err
+			}
+
+		case msg, ok := <-replies:
+			if !ok {
+				return fmt.Errorf("%s: connection closed", name)
+			}
+			switch reply := msg.(type) {
+			case *mavlink.MissionRequestMessage:
+				if reply.MissionType != missionType {
+					continue
+				}
+				if int(reply.Seq) >= len(items) {
+					return fmt.Errorf("%s: vehicle requested item %d of %d", name, reply.Seq, len(items))
+				}
+				last = items[reply.Seq].toMessage(reply.Seq, missionType, targetSystem, targetComponent)
+				if err := v.Connection.Send(last); err != nil {
+					return err
+				}
+			case *mavlink.MissionAckMessage:
+				if reply.MissionType != missionType {
+					continue
+				}
+				if reply.Type != mavlink.MAV_MISSION_ACCEPTED {
+					return fmt.Errorf("%s: vehicle responded %s", name, missionResultName(reply.Type))
+				}
+				return nil
+			}
+			retries = 0
+			retry.Reset(missionRetryInterval)
+		}
+	}
+}
+
+// Reads the list of items of one mission type stored on the vehicle
+func (v *Vehicle) downloadMissionItems(ctx context.Context, missionType uint8) ([]MissionItem, error) {
+	name := missionTypeName(missionType) + " download"
+	if err := v.requireCapability(missionCapability(missionType), name); err != nil {
+		return nil, err
+	}
+	replies, unsubscribe := v.Connection.Subscribe(
+		mavlink.MAVLINK_MSG_ID_MISSION_COUNT,
+		mavlink.MAVLINK_MSG_ID_MISSION_ITEM_INT,
+	)
+	defer unsubscribe()
+
+	targetSystem, targetComponent := v.Connection.Target()
+	var last mavlink.MavlinkMessage = mavlink.MissionRequestList{
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		MissionType:     missionType,
+	}
+	if err := v.Connection.Send(last); err != nil {
+		return nil, err
+	}
+	retry := time.NewTicker(missionRetryInterval)
+	defer retry.Stop()
+	retries := 0
+
+	var items []MissionItem
+	count := -1
+
+	for count < 0 || len(items) < count {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s: %w", name, ctx.Err())
+
+		case <-retry.C:
+			retries++
+			if retries > missionRetries {
+				return nil, fmt.Errorf("%s: vehicle stopped responding", name)
+			}
+			if err := v.Connection.Send(last); err != nil {
+				return nil, err
+			}
+			continue
+
+		case msg, ok := <-replies:
+			if !ok {
+				return nil, fmt.Errorf("%s: connection closed", name)
+			}
+			switch reply := msg.(type) {
+			case *mavlink.MissionCountMessage:
+				if reply.MissionType != missionType {
+					continue
+				}
+				if count >= 0 {
+					// a repeat of the count, the request for the next item
+					// will be repeated by the retry
+					continue
+				}
+				count = int(reply.Count)
+			case *mavlink.MissionItemIntMessage:
+				if reply.MissionType != missionType || int(reply.Seq) != len(items) {
+					continue
+				}
+				items = append(items, missionItemFromMessage(reply))
+			}
+		}
+
+		retries = 0
+		retry.Reset(missionRetryInterval)
+		if len(items) < count {
+			last = mavlink.MissionRequestInt{
+				Seq:             uint16(len(items)),
+				TargetSystem:    targetSystem,
+				TargetComponent: targetComponent,
+				MissionType:     missionType,
+			}
+			if err := v.Connection.Send(last); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err := v.Connection.Send(mavlink.MissionAck{
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		Type:            mavlink.MAV_MISSION_ACCEPTED,
+		MissionType:     missionType,
+	})
+	return items, err
+}
+
+// Parses a mission in the QGC WPL 110 waypoint file format used by Mission
+// Planner and MAVProxy
+func ReadWaypoints(r io.Reader) ([]MissionItem, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "QGC WPL 110") {
+		return nil, fmt.Errorf("not a QGC WPL 110 waypoint file")
+	}
+
+	var items []MissionItem
+	line := 1
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 12 {
+			return nil, fmt.Errorf("line %d: expected 12 fields, got %d", line, len(fields))
+		}
+		values := make([]float64, len(fields))
+		for i, field := range fields {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			values[i] = value
+		}
+		items = append(items, MissionItem{
+			Current:      values[1] == 1,
+			Frame:        uint8(values[2]),
+			Command:      uint16(values[3]),
+			Param1:       float32(values[4]),
+			Param2:       float32(values[5]),
+			Param3:       float32(values[6]),
+			Param4:       float32(values[7]),
+			X:            values[8],
+			Y:            values[9],
+			Z:            float32(values[10]),
+			Autocontinue: values[11] == 1,
+		})
+	}
+	return items, scanner.Err()
+}
+
+// Writes a mission in the QGC WPL 110 waypoint file format
+func WriteWaypoints(w io.Writer, items []MissionItem) error {
+	if _, err := fmt.Fprintln(w, "QGC WPL 110"); err != nil {
+		return err
+	}
+	boolInt := map[bool]int{false: 0, true: 1}
+	for i, item := range items {
+		_, err := fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%v\t%v\t%v\t%v\t%.8f\t%.8f\t%v\t%d\n",
+			i, boolInt[item.Current], item.Frame, item.Command,
+			item.Param1, item.Param2, item.Param3, item.Param4,
+			item.X, item.Y, item.Z, boolInt[item.Autocontinue])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package mavcom
+
+import (
+	"testing"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// MAV_CMD_NAV_WAYPOINT
+const navWaypoint = 16
+
+func TestMissionRoundTrip(t *testing.T) {
+	_, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+
+	items := []MissionItem{
+		{Frame: FrameGlobal, Command: navWaypoint, X: -35.3632621, Y: 149.1652374, Z: 584, Autocontinue: true},
+		{Frame: FrameGlobalRelativeAlt, Command: mavlink.MAV_CMD_NAV_TAKEOFF, Z: 20, Autocontinue: true},
+		{Frame: FrameGlobalRelativeAlt, Command: navWaypoint, Param1: 5, X: -35.3625, Y: 149.1660, Z: 30, Autocontinue: true},
+		{Frame: FrameGlobalRelativeAlt, Command: mavlink.MAV_CMD_NAV_RETURN_TO_LAUNCH, Autocontinue: true},
+	}
+	if err := v.UploadMission(ctx, items); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := v.DownloadMission(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downloaded) != len(items) {
+		t.Fatalf("downloaded %d items, want %d", len(downloaded), len(items))
+	}
+	for i, item := range items {
+		if downloaded[i] != item {
+			t.Errorf("item %d is %+v, want %+v", i, downloaded[i], item)
+		}
+	}
+
+	if err := v.UploadMission(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if downloaded, err = v.DownloadMission(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(downloaded) != 0 {
+		t.Errorf("downloaded %d items after clearing, want none", len(downloaded))
+	}
+}
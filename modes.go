@@ -0,0 +1,154 @@
+package mavcom
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ArduPilot flight modes, which are sent as the heartbeat's custom mode.
+// Multirotors, helicopters and everything else that isn't a plane share the
+// ArduCopter list.
+var copterModes = map[uint32]string{
+	0:  "STABILIZE",
+	1:  "ACRO",
+	2:  "ALT_HOLD",
+	3:  "AUTO",
+	4:  "GUIDED",
+	5:  "LOITER",
+	6:  "RTL",
+	7:  "CIRCLE",
+	9:  "LAND",
+	11: "DRIFT",
+	13: "SPORT",
+	14: "FLIP",
+	15: "AUTOTUNE",
+	16: "POSHOLD",
+	17: "BRAKE",
+	18: "THROW",
+	19: "AVOID_ADSB",
+	20: "GUIDED_NOGPS",
+	21: "SMART_RTL",
+	22: "FLOWHOLD",
+	23: "FOLLOW",
+	24: "ZIGZAG",
+	25: "SYSTEMID",
+	26: "AUTOROTATE",
+	27: "AUTO_RTL",
+}
+
+var planeModes = map[uint32]string{
+	0:  "MANUAL",
+	1:  "CIRCLE",
+	2:  "STABILIZE",
+	3:  "TRAINING",
+	4:  "ACRO",
+	5:  "FBWA",
+	6:  "FBWB",
+	7:  "CRUISE",
+	8:  "AUTOTUNE",
+	10: "AUTO",
+	11: "RTL",
+	12: "LOITER",
+	13: "TAKEOFF",
+	14: "AVOID_ADSB",
+	15: "GUIDED",
+	17: "QSTABILIZE",
+	18: "QHOVER",
+	19: "QLOITER",
+	20: "QLAND",
+	21: "QRTL",
+	22: "QAUTOTUNE",
+	23: "QACRO",
+	24: "THERMAL",
+	25: "LOITER_ALT_QLAND",
+}
+
+// PX4 packs its main mode into the third byte of the heartbeat's custom mode
+// and the sub mode of AUTO and POSCTL into the fourth
+func px4Mode(mainMode uint32, subMode uint32) uint32 {
+	return mainMode<<16 | subMode<<24
+}
+
+const (
+	px4MainModeManual     = 1
+	px4MainModeAltCtl     = 2
+	px4MainModePosCtl     = 3
+	px4MainModeAuto       = 4
+	px4MainModeAcro       = 5
+	px4MainModeOffboard   = 6
+	px4MainModeStabilized = 7
+	px4MainModeRattitude  = 8
+)
+
+// PX4 flight modes for every airframe, named as pymavlink names them so that
+// those ArduPilot has too, such as RTL and LAND, are named the same
+var px4Modes = map[uint32]string{
+	px4Mode(px4MainModeManual, 0):     "MANUAL",
+	px4Mode(px4MainModeAltCtl, 0):     "ALTCTL",
+	px4Mode(px4MainModePosCtl, 0):     "POSCTL",
+	px4Mode(px4MainModePosCtl, 1):     "ORBIT",
+	px4Mode(px4MainModeAuto, 1):       "READY",
+	px4Mode(px4MainModeAuto, 2):       "TAKEOFF",
+	px4Mode(px4MainModeAuto, 3):       "LOITER",
+	px4Mode(px4MainModeAuto, 4):       "MISSION",
+	px4Mode(px4MainModeAuto, 5):       "RTL",
+	px4Mode(px4MainModeAuto, 6):       "LAND",
+	px4Mode(px4MainModeAuto, 8):       "FOLLOWME",
+	px4Mode(px4MainModeAuto, 9):       "PRECLAND",
+	px4Mode(px4MainModeAcro, 0):       "ACRO",
+	px4Mode(px4MainModeOffboard, 0):   "OFFBOARD",
+	px4Mode(px4MainModeStabilized, 0): "STABILIZED",
+	px4Mode(px4MainModeRattitude, 0):  "RATTITUDE",
+}
+
+// Returns the flight modes of the vehicle's autopilot, or nil for autopilots
+// whose modes aren't known
+func modesFor(firmware Firmware, airframe Airframe) map[uint32]string {
+	switch {
+	case firmware == FirmwarePX4:
+		return px4Modes
+	case firmware != FirmwareArduPilot:
+		return nil
+	case airframe == FixedWing:
+		return planeModes
+	default:
+		return copterModes
+	}
+}
+
+// Returns the mode that stops the vehicle and holds it where it is, or empty
+// for autopilots whose modes aren't known
+func holdMode(firmware Firmware, airframe Airframe) string {
+	switch {
+	case firmware == FirmwarePX4:
+		return "LOITER"
+	case firmware != FirmwareArduPilot:
+		return ""
+	case airframe == FixedWing:
+		return "LOITER"
+	default:
+		return "BRAKE"
+	}
+}
+
+// Returns the name of a custom mode, or the number itself if it isn't known
+func modeName(firmware Firmware, airframe Airframe, customMode uint32) string {
+	if name, ok := modesFor(firmware, airframe)[customMode]; ok {
+		return name
+	}
+	return fmt.Sprintf("MODE(%d)", customMode)
+}
+
+// Looks up the custom mode number for a mode name such as "GUIDED"
+func modeNumber(firmware Firmware, airframe Airframe, name string) (uint32, error) {
+	name = strings.ToUpper(name)
+	for number, modeName := range modesFor(firmware, airframe) {
+		if modeName == name {
+			return number, nil
+		}
+	}
+	if firmware == FirmwarePX4 {
+		return 0, fmt.Errorf("unknown mode %q for %v", name, firmware)
+	}
+	return 0, fmt.Errorf("unknown mode %q for %v %v", name, firmware, airframe)
+}
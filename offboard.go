@@ -0,0 +1,345 @@
+package mavcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	defaultOffboardRate = 10 // Hz
+	// PX4 only accepts a switch into offboard control once setpoints are
+	// already streaming
+	offboardWarmup = time.Second
+	// How long the vehicle is told to hold its position for when the
+	// controller can't switch to a StopMode, and how long the switch can
+	// take
+	offboardHoldTime    = time.Second
+	offboardStopTimeout = 5 * time.Second
+)
+
+// SetpointMask says which parts of a Setpoint the vehicle should follow.
+// Everything else in the setpoint is ignored.
+type SetpointMask uint16
+
+const (
+	UsePosition SetpointMask = 1 << iota
+	UseVelocity
+	UseAcceleration
+	UseYaw
+	UseYawRate
+)
+
+// Converts the mask to MAVLink's POSITION_TARGET_TYPEMASK, which lists what
+// to ignore rather than what to use
+func (m SetpointMask) typeMask() uint16 {
+	var typeMask uint16
+	if m&UsePosition == 0 {
+		typeMask |= mavlink.POSITION_TARGET_TYPEMASK_X_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_Y_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_Z_IGNORE
+	}
+	if m&UseVelocity == 0 {
+		typeMask |= mavlink.POSITION_TARGET_TYPEMASK_VX_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_VY_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_VZ_IGNORE
+	}
+	if m&UseAcceleration == 0 {
+		typeMask |= mavlink.POSITION_TARGET_TYPEMASK_AX_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_AY_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_AZ_IGNORE
+	}
+	if m&UseYaw == 0 {
+		typeMask |= mavlink.POSITION_TARGET_TYPEMASK_YAW_IGNORE
+	}
+	if m&UseYawRate == 0 {
+		typeMask |= mavlink.POSITION_TARGET_TYPEMASK_YAW_RATE_IGNORE
+	}
+	return typeMask
+}
+
+// Setpoint is a target for the vehicle to follow under offboard control.
+// Local positions are meters north, east and down from the EKF origin, which
+// is normally home. Global positions are a latitude and longitude in degrees
+// with an altitude in meters above home. Velocities and accelerations are
+// north, east and down in m/s and m/s², yaw is a heading in degrees and yaw
+// rate is in degrees per second.
+type Setpoint struct {
+	Use    SetpointMask
+	Global bool
+
+	North float64
+	East  float64
+	Down  float64
+
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+
+	VNorth float64
+	VEast  float64
+	VDown  float64
+
+	ANorth float64
+	AEast  float64
+	ADown  float64
+
+	Yaw     float64
+	YawRate float64
+}
+
+// A setpoint that flies at a velocity in m/s
+func VelocitySetpoint(north float64, east float64, down float64) Setpoint {
+	return Setpoint{Use: UseVelocity, VNorth: north, VEast: east, VDown: down}
+}
+
+// A setpoint that flies to a position in meters from the EKF origin
+func LocalPositionSetpoint(north float64, east float64, down float64) Setpoint {
+	return Setpoint{Use: UsePosition, North: north, East: east, Down: down}
+}
+
+// A setpoint that flies to a latitude and longitude at an altitude above home
+func GlobalPositionSetpoint(latitude float64, longitude float64, altitude float64) Setpoint {
+	return Setpoint{Use: UsePosition, Global: true, Latitude: latitude, Longitude: longitude, Altitude: altitude}
+}
+
+// The capability the vehicle needs to follow the setpoint
+func (sp Setpoint) capability() Capability {
+	if sp.Global {
+		return CapabilitySetPositionTargetGlobalInt
+	}
+	return CapabilitySetPositionTargetLocalNED
+}
+
+func (sp Setpoint) toMessage(timeBootMs uint32, targetSystem uint8, targetComponent uint8) mavlink.MavlinkMessage {
+	yaw := float32(sp.Yaw * math.Pi / 180)
+	yawRate := float32(sp.YawRate * math.Pi / 180)
+	if sp.Global {
+		return mavlink.SetPositionTargetGlobalInt{
+			TimeBootMs:      timeBootMs,
+			LatInt:          int32(math.Round(sp.Latitude * 1e7)),
+			LonInt:          int32(math.Round(sp.Longitude * 1e7)),
+			Alt:             float32(sp.Altitude),
+			Vx:              float32(sp.VNorth),
+			Vy:              float32(sp.VEast),
+			Vz:              float32(sp.VDown),
+			Afx:             float32(sp.ANorth),
+			Afy:             float32(sp.AEast),
+			Afz:             float32(sp.ADown),
+			Yaw:             yaw,
+			YawRate:         yawRate,
+			TypeMask:        sp.Use.typeMask(),
+			TargetSystem:    targetSystem,
+			TargetComponent: targetComponent,
+			CoordinateFrame: mavlink.MAV_FRAME_GLOBAL_RELATIVE_ALT_INT,
+		}
+	}
+	return mavlink.SetPositionTargetLocalNed{
+		TimeBootMs:      timeBootMs,
+		X:               float32(sp.North),
+		Y:               float32(sp.East),
+		Z:               float32(sp.Down),
+		Vx:              float32(sp.VNorth),
+		Vy:              float32(sp.VEast),
+		Vz:              float32(sp.VDown),
+		Afx:             float32(sp.ANorth),
+		Afy:             float32(sp.AEast),
+		Afz:             float32(sp.ADown),
+		Yaw:             yaw,
+		YawRate:         yawRate,
+		TypeMask:        sp.Use.typeMask(),
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		CoordinateFrame: mavlink.MAV_FRAME_LOCAL_NED,
+	}
+}
+
+type OffboardConfig struct {
+	// How often the setpoint is sent, in Hz. PX4 drops out of offboard
+	// control if setpoints arrive at less than 2 Hz and ArduPilot stops
+	// following velocities after 3 seconds. Defaults to 10.
+	Rate float64
+	// Mode to switch into once setpoints are streaming, or empty to leave
+	// the mode alone. ArduPilot follows setpoints in GUIDED and PX4 in
+	// OFFBOARD. Mode names are those SetMode takes.
+	Mode string
+	// Mode to switch to when the controller stops. Defaults to the
+	// autopilot's hold mode, BRAKE on ArduCopter and LOITER on ArduPlane and
+	// PX4. If the autopilot's modes aren't known, or the switch fails, the
+	// vehicle is told to hold where it is before the stream stops.
+	StopMode string
+}
+
+// OffboardController streams setpoints to a vehicle until it is stopped
+type OffboardController struct {
+	vehicle  *Vehicle
+	config   OffboardConfig
+	started  time.Time
+	setpoint Setpoint
+	lock     sync.Mutex
+	stop     chan struct{}
+	stopOnce sync.Once
+	// set when the vehicle was never put under offboard control, so there
+	// is nothing to bring to a safe stop
+	abandoned bool
+	done      chan struct{}
+	err       error
+}
+
+// Starts streaming setpoints to the vehicle, beginning with initial, and
+// switches into config.Mode once they are flowing. The stream carries on
+// until Stop is called or ctx is done, at which point the vehicle is brought
+// to a safe stop. It fails straight away if AUTOPILOT_VERSION says the
+// vehicle can't follow the initial setpoint, or the zero velocity it is
+// stopped with when there is no stop mode.
+func (v *Vehicle) StartOffboard(ctx context.Context, initial Setpoint, config OffboardConfig) (*OffboardController, error) {
+	if config.StopMode == "" {
+		v.lock.Lock()
+		config.StopMode = holdMode(v.firmware, v.Airframe)
+		v.lock.Unlock()
+	}
+	required := initial.capability()
+	if config.StopMode == "" {
+		required |= CapabilitySetPositionTargetLocalNED
+	}
+	if err := v.requireCapability(required, "offboard"); err != nil {
+		return nil, err
+	}
+	if config.Rate <= 0 {
+		config.Rate = defaultOffboardRate
+	}
+	c := &OffboardController{
+		vehicle:  v,
+		config:   config,
+		started:  time.Now(),
+		setpoint: initial,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.run(ctx)
+
+	if config.Mode == "" {
+		return c, nil
+	}
+	select {
+	case <-time.After(offboardWarmup):
+	case <-c.done:
+		if c.err != nil {
+			return nil, fmt.Errorf("offboard: %w", c.err)
+		}
+		return nil, fmt.Errorf("offboard: %w", ctx.Err())
+	}
+	if err := v.SetMode(ctx, config.Mode); err != nil {
+		c.halt(false)
+		return nil, fmt.Errorf("offboard: %w", err)
+	}
+	return c, nil
+}
+
+// Replaces the setpoint being streamed. It is sent at the next tick.
+func (c *OffboardController) Set(setpoint Setpoint) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.setpoint = setpoint
+}
+
+// Stops streaming, after switching to the stop mode or telling the vehicle
+// to hold, and returns any error from doing so or from sending setpoints
+func (c *OffboardController) Stop() error {
+	c.halt(true)
+	return c.err
+}
+
+// Closed once the stream has stopped, whether through Stop, ctx being done
+// or the connection failing
+func (c *OffboardController) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *OffboardController) halt(safely bool) {
+	c.stopOnce.Do(func() {
+		c.lock.Lock()
+		c.abandoned = !safely
+		c.lock.Unlock()
+		close(c.stop)
+	})
+	<-c.done
+}
+
+func (c *OffboardController) run(ctx context.Context) {
+	defer close(c.done)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / c.config.Rate))
+	defer ticker.Stop()
+
+	for {
+		c.lock.Lock()
+		setpoint := c.setpoint
+		c.lock.Unlock()
+		if err := c.send(setpoint); err != nil {
+			c.err = err
+			return
+		}
+		select {
+		case <-ctx.Done():
+			c.err = c.safeStop()
+			return
+		case <-c.stop:
+			c.err = c.safeStop()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *OffboardController) send(setpoint Setpoint) error {
+	targetSystem, targetComponent := c.vehicle.Connection.Target()
+	timeBootMs := uint32(time.Since(c.started).Milliseconds())
+	return c.vehicle.Connection.Send(setpoint.toMessage(timeBootMs, targetSystem, targetComponent))
+}
+
+// Switches to the stop mode, or streams a zero velocity for a moment so the
+// vehicle brakes and holds rather than carrying on with its last setpoint. A
+// failed switch still holds, and is returned once the vehicle has been told
+// to.
+func (c *OffboardController) safeStop() error {
+	c.lock.Lock()
+	abandoned := c.abandoned
+	c.lock.Unlock()
+	if abandoned {
+		return nil
+	}
+
+	if c.config.StopMode != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), offboardStopTimeout)
+		defer cancel()
+		err := c.vehicle.SetMode(ctx, c.config.StopMode)
+		if err == nil {
+			return nil
+		}
+		if holdErr := c.hold(); holdErr != nil {
+			return fmt.Errorf("offboard stop: %w", errors.Join(err, holdErr))
+		}
+		return fmt.Errorf("offboard stop: held position instead: %w", err)
+	}
+	if err := c.hold(); err != nil {
+		return fmt.Errorf("offboard stop: %w", err)
+	}
+	return nil
+}
+
+// Streams a zero velocity for offboardHoldTime
+func (c *OffboardController) hold() error {
+	hold := VelocitySetpoint(0, 0, 0)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / c.config.Rate))
+	defer ticker.Stop()
+	deadline := time.After(offboardHoldTime)
+	for {
+		if err := c.send(hold); err != nil {
+			return err
+		}
+		select {
+		case <-deadline:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
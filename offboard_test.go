@@ -0,0 +1,136 @@
+package mavcom
+
+import (
+	"testing"
+
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+func TestOffboard(t *testing.T) {
+	// the mode each autopilot follows setpoints in
+	offboardModes := map[uint8]string{
+		sim.AutopilotArduPilot: "GUIDED",
+		sim.AutopilotPX4:       "OFFBOARD",
+	}
+	for autopilot, mode := range offboardModes {
+		autopilot, mode := autopilot, mode
+		t.Run(Firmware(autopilot).String(), func(t *testing.T) {
+			t.Parallel()
+			s, v := newSimVehicle(t, fastSimConfig(autopilot))
+			ctx := testContext(t)
+			if err := v.Arm(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Takeoff(ctx, 5); err != nil {
+				t.Fatal(err)
+			}
+			start := s.State().Latitude
+
+			c, err := v.StartOffboard(ctx, VelocitySetpoint(5, 0, 0), OffboardConfig{Mode: mode, StopMode: "LOITER"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if simMode := s.State().Mode; simMode != sim.ModeGuided {
+				t.Errorf("simulator in mode %d after starting, want GUIDED", simMode)
+			}
+			err = v.waitFor(ctx, "offboard", "vehicle to fly north", func() bool {
+				return s.State().Latitude > start+2/111319.5
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			if err := c.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			if simMode := s.State().Mode; simMode != sim.ModeLoiter {
+				t.Errorf("simulator in mode %d after stopping, want LOITER", simMode)
+			}
+		})
+	}
+}
+
+func TestOffboardStopsInHoldMode(t *testing.T) {
+	tests := []struct {
+		autopilot uint8
+		mode      string
+		holdMode  uint32
+	}{
+		{sim.AutopilotArduPilot, "GUIDED", sim.ModeBrake},
+		{sim.AutopilotPX4, "OFFBOARD", sim.ModeLoiter},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(Firmware(test.autopilot).String(), func(t *testing.T) {
+			t.Parallel()
+			s, v := newSimVehicle(t, fastSimConfig(test.autopilot))
+			ctx := testContext(t)
+			if err := v.Arm(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := v.Takeoff(ctx, 5); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := v.StartOffboard(ctx, VelocitySetpoint(5, 0, 0), OffboardConfig{Mode: test.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			if simMode := s.State().Mode; simMode != test.holdMode {
+				t.Errorf("simulator in mode %d after stopping, want %d", simMode, test.holdMode)
+			}
+		})
+	}
+}
+
+func TestOffboardHoldsWhenStopModeRefused(t *testing.T) {
+	s, v := newSimVehicle(t, fastSimConfig(sim.AutopilotArduPilot))
+	ctx := testContext(t)
+	if err := v.Arm(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Takeoff(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// the simulator doesn't fly DRIFT
+	c, err := v.StartOffboard(ctx, VelocitySetpoint(5, 0, 0), OffboardConfig{Mode: "GUIDED", StopMode: "DRIFT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.waitFor(ctx, "offboard", "vehicle to fly north", func() bool {
+		return s.State().VNorth > 4
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stop(); err == nil {
+		t.Error("stopping succeeded without switching to DRIFT")
+	}
+	state := s.State()
+	if state.Mode != sim.ModeGuided {
+		t.Errorf("simulator in mode %d after stopping, want GUIDED", state.Mode)
+	}
+	if state.VNorth != 0 || state.VEast != 0 {
+		t.Errorf("simulator flying at %v m/s north, %v m/s east after stopping, want it holding", state.VNorth, state.VEast)
+	}
+}
+
+func TestPX4RefusesOffboardWithoutSetpoints(t *testing.T) {
+	_, v := newSimVehicle(t, fastSimConfig(sim.AutopilotPX4))
+	ctx := testContext(t)
+	if err := v.Arm(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SetMode(ctx, "OFFBOARD"); err == nil {
+		t.Error("switched into OFFBOARD without streaming setpoints")
+	}
+	if err := v.SetMode(ctx, "POSCTL"); err == nil {
+		t.Error("switched into a mode the simulator doesn't have")
+	}
+	if err := v.SetMode(ctx, "GUIDED"); err == nil {
+		t.Error("switched into an ArduPilot mode on PX4")
+	}
+}
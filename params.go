@@ -0,0 +1,159 @@
+package mavcom
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How long to wait for a parameter before asking for it again
+const paramRetryInterval = time.Second
+
+// Parameter values are sent as floats. ArduPilot casts integer parameters to
+// a float, which is what is assumed here, rather than PX4's bytewise
+// encoding.
+
+// Reads a single parameter from the vehicle by name
+func (v *Vehicle) GetParam(ctx context.Context, name string) (float64, error) {
+	values, unsubscribe := v.Connection.Subscribe(mavlink.MAVLINK_MSG_ID_PARAM_VALUE)
+	defer unsubscribe()
+
+	targetSystem, targetComponent := v.Connection.Target()
+	request := mavlink.ParamRequestRead{
+		ParamIndex:      -1,
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		ParamID:         mavlink.NewParamID(name),
+	}
+
+	value, err := v.awaitParam(ctx, values, name, request)
+	if err != nil {
+		return 0, err
+	}
+	return float64(value.ParamValue), nil
+}
+
+// Sets a parameter and waits for the vehicle to report the new value back
+func (v *Vehicle) SetParam(ctx context.Context, name string, value float64) error {
+	values, unsubscribe := v.Connection.Subscribe(mavlink.MAVLINK_MSG_ID_PARAM_VALUE)
+	defer unsubscribe()
+
+	targetSystem, targetComponent := v.Connection.Target()
+	set := mavlink.ParamSet{
+		ParamValue:      float32(value),
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+		ParamID:         mavlink.NewParamID(name),
+		ParamType:       mavlink.MAV_PARAM_TYPE_REAL32,
+	}
+
+	reported, err := v.awaitParam(ctx, values, name, set)
+	if err != nil {
+		return err
+	}
+	if reported.ParamValue != float32(value) {
+		return fmt.Errorf("vehicle kept %s at %v instead of %v", name, reported.ParamValue, value)
+	}
+	return nil
+}
+
+// Sends request until a PARAM_VALUE for the named parameter comes back
+func (v *Vehicle) awaitParam(ctx context.Context, values <-chan mavlink.DecodedMessage, name string, request mavlink.MavlinkMessage) (*mavlink.ParamValueMessage, error) {
+	if err := v.Connection.Send(request); err != nil {
+		return nil, err
+	}
+	retry := time.NewTicker(paramRetryInterval)
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("parameter %s: %w", name, ctx.Err())
+		case <-retry.C:
+			if err := v.Connection.Send(request); err != nil {
+				return nil, err
+			}
+		case msg, ok := <-values:
+			if !ok {
+				return nil, fmt.Errorf("parameter %s: connection closed", name)
+			}
+			value := msg.(*mavlink.ParamValueMessage)
+			if value.ParamID.String() == name {
+				return value, nil
+			}
+		}
+	}
+}
+
+// Downloads every parameter from the vehicle. Parameters that went missing
+// along the way are requested individually until the set is complete or ctx
+// is done.
+func (v *Vehicle) Params(ctx context.Context) (map[string]float64, error) {
+	values, unsubscribe := v.Connection.Subscribe(mavlink.MAVLINK_MSG_ID_PARAM_VALUE)
+	defer unsubscribe()
+
+	targetSystem, targetComponent := v.Connection.Target()
+	err := v.Connection.Send(mavlink.ParamRequestList{
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]float64)
+	received := make(map[uint16]bool)
+	count := -1
+	retry := time.NewTicker(paramRetryInterval)
+	defer retry.Stop()
+
+	for count < 0 || len(received) < count {
+		select {
+		case <-ctx.Done():
+			return params, fmt.Errorf("received %d of %d parameters: %w", len(received), count, ctx.Err())
+
+		case msg, ok := <-values:
+			if !ok {
+				return params, fmt.Errorf("received %d of %d parameters: connection closed", len(received), count)
+			}
+			value := msg.(*mavlink.ParamValueMessage)
+			params[value.ParamID.String()] = float64(value.ParamValue)
+			// an index of 65535 means the value was sent on its own, outside
+			// of the list
+			if value.ParamIndex != math.MaxUint16 {
+				received[value.ParamIndex] = true
+			}
+			count = int(value.ParamCount)
+			retry.Reset(paramRetryInterval)
+
+		case <-retry.C:
+			if count < 0 {
+				err = v.Connection.Send(mavlink.ParamRequestList{
+					TargetSystem:    targetSystem,
+					TargetComponent: targetComponent,
+				})
+				if err != nil {
+					return params, err
+				}
+				continue
+			}
+			for i := 0; i < count; i++ {
+				if received[uint16(i)] {
+					continue
+				}
+				err = v.Connection.Send(mavlink.ParamRequestRead{
+					ParamIndex:      int16(i),
+					TargetSystem:    targetSystem,
+					TargetComponent: targetComponent,
+				})
+				if err != nil {
+					return params, err
+				}
+			}
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,372 @@
+package mavcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// How long the checks wait for the GPS, SYS_STATUS and EKF to be heard
+	// from, for checks run straight after connecting
+	preflightReportTimeout = 3 * time.Second
+	// How long to wait for each parameter a check reads
+	preflightParamTimeout = 3 * time.Second
+)
+
+// Status texts reporting a failed pre-arm check start with one of these,
+// ArduPilot's and PX4's
+var prearmTextPrefixes = []string{"PreArm:", "Preflight Fail:"}
+
+// CheckStatus is the outcome of a pre-flight check. Only failures stop the
+// vehicle from arming.
+type CheckStatus int
+
+const (
+	CheckPass CheckStatus = iota
+	CheckWarn
+	CheckFail
+)
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckPass:
+		return "PASS"
+	case CheckWarn:
+		return "WARN"
+	case CheckFail:
+		return "FAIL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// CheckResult is the outcome of one pre-flight check and what it found
+type CheckResult struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+}
+
+func (r CheckResult) String() string {
+	return fmt.Sprintf("%v %s: %s", r.Status, r.Name, r.Message)
+}
+
+// PreflightCheck is a condition of your own to check before arming. Check
+// returns the outcome and what it found, and may talk to the vehicle as long
+// as it gives up when ctx is done.
+type PreflightCheck struct {
+	Name  string
+	Check func(ctx context.Context, v *Vehicle) (CheckStatus, string)
+}
+
+// ParamCheck is the range a parameter has to be in, inclusive, such as
+// FENCE_ENABLE between 1 and 1
+type ParamCheck struct {
+	Name string
+	Min  float64
+	Max  float64
+	// warns rather than fails when the parameter is out of range
+	Warn bool
+}
+
+// PreflightConfig is what the pre-flight checks require of the vehicle
+type PreflightConfig struct {
+	// the worst GPS fix that passes, and the fewest satellites and highest
+	// HDOP before it warns, 0 to not check them. With no MinGPSFix the GPS
+	// isn't checked at all, for vehicles that fly without one.
+	MinGPSFix     GPSFix
+	MinSatellites int
+	MaxHDOP       float64
+	// battery voltage that fails and that warns, and the percentage
+	// remaining that fails, 0 to not check them
+	MinVoltage   float64
+	WarnVoltage  float64
+	MinRemaining float64
+	// the flight modes the vehicle may be armed in, any if empty
+	Modes []string
+	// whether home has to be set
+	RequireHome bool
+	// how far back to look for pre-arm failures in status texts, 0 to not
+	// look for them
+	StatusTextAge time.Duration
+	Params        []ParamCheck
+	// run after the built-in checks
+	Checks []PreflightCheck
+}
+
+// Requires a 3D fix, home set, a healthy EKF and sensors and no pre-arm
+// failures in the last 30 seconds, which is how often ArduPilot repeats them
+// while disarmed. Battery limits depend on the pack so aren't checked.
+func DefaultPreflightConfig() *PreflightConfig {
+	return &PreflightConfig{
+		MinGPSFix:     GPSFix3D,
+		MinSatellites: 6,
+		MaxHDOP:       2,
+		RequireHome:   true,
+		StatusTextAge: 30 * time.Second,
+	}
+}
+
+// PreflightReport is the outcome of every pre-flight check, in the order
+// they ran
+type PreflightReport struct {
+	Results []CheckResult
+}
+
+// The worst outcome of any check
+func (r PreflightReport) Status() CheckStatus {
+	status := CheckPass
+	for _, result := range r.Results {
+		status = max(status, result.Status)
+	}
+	return status
+}
+
+// Whether nothing failed, warnings allowed
+func (r PreflightReport) Passed() bool {
+	return r.Status() != CheckFail
+}
+
+// The checks that failed
+func (r PreflightReport) Failures() []CheckResult {
+	return r.withStatus(CheckFail)
+}
+
+// The checks that passed with a warning
+func (r PreflightReport) Warnings() []CheckResult {
+	return r.withStatus(CheckWarn)
+}
+
+func (r PreflightReport) withStatus(status CheckStatus) []CheckResult {
+	var results []CheckResult
+	for _, result := range r.Results {
+		if result.Status == status {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// PreflightError is returned by Arm when the pre-flight checks fail
+type PreflightError struct {
+	Report PreflightReport
+}
+
+func (e *PreflightError) Error() string {
+	var failures []string
+	for _, failure := range e.Report.Failures() {
+		failures = append(failures, failure.Name+": "+failure.Message)
+	}
+	return "arm: pre-flight checks failed: " + strings.Join(failures, ", ")
+}
+
+// Checks the vehicle against config. Right after connecting, it first waits a
+// few seconds for the GPS, SYS_STATUS and EKF to report.
+func (v *Vehicle) CheckPreflight(ctx context.Context, config *PreflightConfig) PreflightReport {
+	waitCtx, cancel := context.WithTimeout(ctx, preflightReportTimeout)
+	// not having heard from them is what the checks report
+	v.waitFor(waitCtx, "pre-flight checks", "vehicle to report", func() bool {
+		return (config.MinGPSFix == GPSNoGPS || !v.gps.Received.IsZero()) &&
+			!v.health.Sensors.Received.IsZero() && !v.health.Estimator.Received.IsZero()
+	})
+	cancel()
+
+	now := v.now()
+	v.lock.Lock()
+	gps := v.gps
+	health := v.health
+	battery := v.Battery
+	batteryReported := !v.received[mavlink.MAVLINK_MSG_ID_SYS_STATUS].IsZero()
+	mode := v.FlightState.Mode
+	v.lock.Unlock()
+
+	var checks []PreflightCheck
+	if config.MinGPSFix != GPSNoGPS {
+		checks = append(checks, PreflightCheck{"GPS", func(context.Context, *Vehicle) (CheckStatus, string) {
+			return checkGPS(config, gps, now)
+		}})
+	}
+	checks = append(checks, []PreflightCheck{
+		{"battery", func(context.Context, *Vehicle) (CheckStatus, string) {
+			return checkBattery(config, battery, batteryReported)
+		}},
+		{"EKF", func(context.Context, *Vehicle) (CheckStatus, string) {
+			return checkEstimator(health.Estimator, now)
+		}},
+		{"sensors", func(context.Context, *Vehicle) (CheckStatus, string) {
+			return checkSensors(health.Sensors, now)
+		}},
+		{"mode", func(context.Context, *Vehicle) (CheckStatus, string) {
+			return checkMode(config, mode)
+		}},
+	}...)
+	if config.RequireHome {
+		checks = append(checks, PreflightCheck{"home", checkHome})
+	}
+	if config.StatusTextAge > 0 {
+		checks = append(checks, PreflightCheck{"pre-arm", func(_ context.Context, v *Vehicle) (CheckStatus, string) {
+			return checkPrearmTexts(v.StatusTexts(), now.Add(-config.StatusTextAge))
+		}})
+	}
+	for _, param := range config.Params {
+		param := param
+		checks = append(checks, PreflightCheck{"param " + param.Name, func(ctx context.Context, v *Vehicle) (CheckStatus, string) {
+			return checkParam(ctx, v, param)
+		}})
+	}
+	checks = append(checks, config.Checks...)
+
+	var report PreflightReport
+	for _, check := range checks {
+		status, message := check.Check(ctx, v)
+		report.Results = append(report.Results, CheckResult{Name: check.Name, Status: status, Message: message})
+	}
+	return report
+}
+
+func checkGPS(config *PreflightConfig, gps GPS, now time.Time) (CheckStatus, string) {
+	switch {
+	case gps.Received.IsZero():
+		return CheckFail, "not reported"
+	case now.Sub(gps.Received) > healthTimeout:
+		return CheckFail, "no GPS_RAW_INT for " + now.Sub(gps.Received).Round(time.Second).String()
+	case gps.Fix < config.MinGPSFix:
+		return CheckFail, fmt.Sprintf("%v, needs %v", gps.Fix, config.MinGPSFix)
+	}
+	message := fmt.Sprintf("%v, %d satellites, HDOP %.1f", gps.Fix, gps.Satellites, gps.HDOP)
+	if gps.Satellites >= 0 && gps.Satellites < config.MinSatellites {
+		return CheckWarn, message
+	}
+	if config.MaxHDOP > 0 && gps.HDOP > config.MaxHDOP {
+		return CheckWarn, message
+	}
+	return CheckPass, message
+}
+
+func checkBattery(config *PreflightConfig, battery Battery, reported bool) (CheckStatus, string) {
+	if !reported {
+		return CheckFail, "not reported"
+	}
+	message := fmt.Sprintf("%.2f V", battery.Voltage)
+	if battery.Remaining >= 0 {
+		message += fmt.Sprintf(", %.0f%% remaining", battery.Remaining)
+	}
+	switch {
+	case battery.Voltage < config.MinVoltage:
+		return CheckFail, fmt.Sprintf("%s, needs %.2f V", message, config.MinVoltage)
+	case battery.Remaining >= 0 && battery.Remaining < config.MinRemaining:
+		return CheckFail, fmt.Sprintf("%s, needs %.0f%%", message, config.MinRemaining)
+	case battery.Voltage < config.WarnVoltage:
+		return CheckWarn, fmt.Sprintf("%s, below %.2f V", message, config.WarnVoltage)
+	}
+	return CheckPass, message
+}
+
+func checkEstimator(status EstimatorStatus, now time.Time) (CheckStatus, string) {
+	switch {
+	case status.Received.IsZero():
+		return CheckFail, "not reported"
+	case now.Sub(status.Received) > healthTimeout:
+		return CheckFail, "no status for " + now.Sub(status.Received).Round(time.Second).String()
+	}
+	if problems := status.problems(); len(problems) > 0 {
+		var reasons []string
+		for _, problem := range problems {
+			reasons = append(reasons, problem.Reason)
+		}
+		return CheckFail, strings.Join(reasons, ", ")
+	}
+	return CheckPass, "healthy"
+}
+
+func checkSensors(sensors Sensors, now time.Time) (CheckStatus, string) {
+	switch {
+	case sensors.Received.IsZero():
+		return CheckFail, "not reported"
+	case now.Sub(sensors.Received) > healthTimeout:
+		return CheckFail, "no SYS_STATUS for " + now.Sub(sensors.Received).Round(time.Second).String()
+	}
+	if unhealthy := sensors.Unhealthy(); unhealthy != 0 {
+		return CheckFail, unhealthy.String() + " unhealthy"
+	}
+	return CheckPass, "healthy"
+}
+
+func checkMode(config *PreflightConfig, mode string) (CheckStatus, string) {
+	if len(config.Modes) == 0 {
+		return CheckPass, mode
+	}
+	for _, allowed := range config.Modes {
+		if strings.EqualFold(mode, allowed) {
+			return CheckPass, mode
+		}
+	}
+	return CheckFail, fmt.Sprintf("%s, needs %s", mode, strings.Join(config.Modes, " or "))
+}
+
+// Passes if home has been reported, asking the vehicle for it if not
+func checkHome(ctx context.Context, v *Vehicle) (CheckStatus, string) {
+	home, ok := v.Home()
+	if !ok {
+		var err error
+		if home, err = v.RequestHome(ctx); err != nil {
+			return CheckFail, "not set"
+		}
+	}
+	return CheckPass, fmt.Sprintf("%.7f, %.7f", home.Latitude, home.Longitude)
+}
+
+// Fails on any pre-arm failure reported since the given time, each listed
+// once
+func checkPrearmTexts(texts []StatusText, since time.Time) (CheckStatus, string) {
+	var failures []string
+	seen := make(map[string]bool)
+	for _, text := range texts {
+		if text.Time.Before(since) || seen[text.Text] || !isPrearmText(text.Text) {
+			continue
+		}
+		seen[text.Text] = true
+		failures = append(failures, text.Text)
+	}
+	if len(failures) > 0 {
+		return CheckFail, strings.Join(failures, "; ")
+	}
+	return CheckPass, "no failures reported"
+}
+
+func isPrearmText(text string) bool {
+	for _, prefix := range prearmTextPrefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkParam(ctx context.Context, v *Vehicle, param ParamCheck) (CheckStatus, string) {
+	paramCtx, cancel := context.WithTimeout(ctx, preflightParamTimeout)
+	defer cancel()
+	value, err := v.GetParam(paramCtx, param.Name)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CheckFail, "no reply, the vehicle may not have it"
+	}
+	if err != nil {
+		return CheckFail, err.Error()
+	}
+	if value >= param.Min && value <= param.Max {
+		return CheckPass, fmt.Sprint(value)
+	}
+	status := CheckFail
+	if param.Warn {
+		status = CheckWarn
+	}
+	if param.Min == param.Max {
+		return status, fmt.Sprintf("%v, needs %v", value, param.Min)
+	}
+	return status, fmt.Sprintf("%v, needs %v to %v", value, param.Min, param.Max)
+}
@@ -0,0 +1,195 @@
+package mavcom
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+func TestPreflightPassesHealthyVehicle(t *testing.T) {
+	s, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+
+	report := v.CheckPreflight(ctx, DefaultPreflightConfig())
+	if report.Status() != CheckPass {
+		t.Fatalf("pre-flight checks: %v, want every check to pass", report.Results)
+	}
+	// the simulator sends GPS_RAW_INT with its MAVLink 2 extensions
+	gps, _ := v.GPS()
+	if gps.HorizontalAccuracy <= 0 || gps.VerticalAccuracy <= 0 {
+		t.Errorf("GPS accuracy %v m horizontal, %v m vertical, want both reported", gps.HorizontalAccuracy, gps.VerticalAccuracy)
+	}
+
+	if err := v.Arm(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !s.State().Armed {
+		t.Error("simulator isn't armed")
+	}
+}
+
+func TestPreflightChecksGateArming(t *testing.T) {
+	tests := []struct {
+		name string
+		// degrades the simulator, or changes the config, and waits for the
+		// vehicle to see it
+		setup   func(ctx context.Context, s *sim.Simulator, v *Vehicle, config *PreflightConfig)
+		failure string
+	}{
+		{
+			name: "no GPS fix",
+			setup: func(ctx context.Context, s *sim.Simulator, v *Vehicle, _ *PreflightConfig) {
+				s.SetGPS(mavlink.GPS_FIX_TYPE_NO_FIX, 3)
+				v.waitFor(ctx, "test", "GPS to lose its fix", func() bool { return v.gps.Fix == GPSNoFix })
+			},
+			failure: "GPS",
+		},
+		{
+			name: "unhealthy sensor",
+			setup: func(ctx context.Context, s *sim.Simulator, v *Vehicle, _ *PreflightConfig) {
+				s.SetSensorsUnhealthy(mavlink.MAV_SYS_STATUS_SENSOR_3D_MAG)
+				v.waitFor(ctx, "test", "compass to be unhealthy", func() bool {
+					return v.health.Sensors.Unhealthy().Has(SensorMag)
+				})
+			},
+			failure: "sensors",
+		},
+		{
+			name: "mode not allowed",
+			setup: func(_ context.Context, _ *sim.Simulator, _ *Vehicle, config *PreflightConfig) {
+				config.Modes = []string{"AUTO"}
+			},
+			failure: "mode",
+		},
+		{
+			name: "parameter out of range",
+			setup: func(_ context.Context, _ *sim.Simulator, _ *Vehicle, config *PreflightConfig) {
+				config.Params = []ParamCheck{{Name: "FENCE_ENABLE", Min: 1, Max: 1}}
+			},
+			failure: "param FENCE_ENABLE",
+		},
+		{
+			name: "own check",
+			setup: func(_ context.Context, _ *sim.Simulator, _ *Vehicle, config *PreflightConfig) {
+				config.Checks = []PreflightCheck{{Name: "payload", Check: func(context.Context, *Vehicle) (CheckStatus, string) {
+					return CheckFail, "not attached"
+				}}}
+			},
+			failure: "payload",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			s, v := newSimVehicle(t, sim.DefaultConfig())
+			ctx := testContext(t)
+			config := DefaultPreflightConfig()
+			test.setup(ctx, s, v, config)
+			v.PreflightChecks = config
+
+			err := v.Arm(ctx)
+			var preflightErr *PreflightError
+			if !errors.As(err, &preflightErr) {
+				t.Fatalf("arming returned %v, want a PreflightError", err)
+			}
+			found := false
+			for _, failure := range preflightErr.Report.Failures() {
+				found = found || failure.Name == test.failure
+			}
+			if !found {
+				t.Errorf("failures %v, want %s to fail", preflightErr.Report.Failures(), test.failure)
+			}
+			if s.State().Armed {
+				t.Error("simulator armed despite the failed checks")
+			}
+		})
+	}
+}
+
+func TestPreflightWarningsAllowArming(t *testing.T) {
+	s, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+	s.SetGPS(mavlink.GPS_FIX_TYPE_3D_FIX, 4)
+	v.waitFor(ctx, "test", "GPS to lose satellites", func() bool { return v.gps.Satellites == 4 })
+	v.PreflightChecks.Params = []ParamCheck{{Name: "FENCE_ENABLE", Min: 1, Max: 1, Warn: true}}
+
+	report := v.CheckPreflight(ctx, v.PreflightChecks)
+	warnings := map[string]bool{}
+	for _, warning := range report.Warnings() {
+		warnings[warning.Name] = true
+	}
+	if !warnings["GPS"] || !warnings["param FENCE_ENABLE"] || !report.Passed() {
+		t.Fatalf("pre-flight checks: %v, want GPS and FENCE_ENABLE to warn and nothing to fail", report.Results)
+	}
+	if err := v.Arm(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArmUncheckedSkipsPreflightChecks(t *testing.T) {
+	s, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+	v.PreflightChecks.Checks = []PreflightCheck{{Name: "payload", Check: func(context.Context, *Vehicle) (CheckStatus, string) {
+		return CheckFail, "not attached"
+	}}}
+
+	if err := v.ArmUnchecked(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !s.State().Armed {
+		t.Error("simulator isn't armed")
+	}
+}
+
+func TestPreflightWithoutGPS(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	ctx := testContext(t)
+	// an indoor vehicle flying on vision, which never sends GPS_RAW_INT
+	const sensors = mavlink.MAV_SYS_STATUS_SENSOR_3D_GYRO | mavlink.MAV_SYS_STATUS_SENSOR_3D_ACCEL | mavlink.MAV_SYS_STATUS_SENSOR_3D_MAG
+	a.send(1, mavlink.SysStatus{SensorsPresent: sensors, SensorsEnabled: sensors, SensorsHealth: sensors, VoltageBattery: 12600, BatteryRemaining: -1})
+	a.send(1, mavlink.EkfStatusReport{Flags: mavlink.EKF_ATTITUDE | mavlink.EKF_VELOCITY_HORIZ | mavlink.EKF_VELOCITY_VERT |
+		mavlink.EKF_POS_HORIZ_REL | mavlink.EKF_POS_HORIZ_ABS | mavlink.EKF_POS_VERT_ABS})
+
+	config := DefaultPreflightConfig()
+	config.MinGPSFix = 0
+	config.RequireHome = false
+	v.PreflightChecks = config
+	report := v.CheckPreflight(ctx, config)
+	if !report.Passed() {
+		t.Fatalf("pre-flight checks: %v, want every check to pass", report.Results)
+	}
+	for _, result := range report.Results {
+		if result.Name == "GPS" {
+			t.Errorf("GPS checked: %v", result)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- v.Arm(ctx)
+	}()
+	// skipping the vehicle's request for AUTOPILOT_VERSION
+	long := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_LONG)).(*mavlink.CommandLongMessage)
+	for long.Command != mavlink.MAV_CMD_COMPONENT_ARM_DISARM {
+		long = decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_LONG)).(*mavlink.CommandLongMessage)
+	}
+	a.send(1, mavlink.CommandAck{Command: mavlink.MAV_CMD_COMPONENT_ARM_DISARM})
+	a.send(1, mavlink.Heartbeat{
+		Type:           uint8(Quadcopter),
+		Autopilot:      mavlink.MAV_AUTOPILOT_ARDUPILOTMEGA,
+		BaseMode:       mavlink.MAV_MODE_FLAG_SAFETY_ARMED,
+		MavlinkVersion: 3,
+	})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// the default config still needs the GPS
+	if failures := v.CheckPreflight(ctx, DefaultPreflightConfig()).Failures(); len(failures) == 0 || failures[0].Name != "GPS" {
+		t.Errorf("default failures %v, want GPS to fail", failures)
+	}
+}
@@ -0,0 +1,111 @@
+package mavcom
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// RallyPoint is a safe place for the vehicle to return to instead of home.
+// The altitude is in meters above home, or above the terrain below the point
+// if AltitudeTerrain is set.
+type RallyPoint struct {
+	Latitude        float64
+	Longitude       float64
+	Altitude        float64
+	AltitudeTerrain bool
+}
+
+func (r RallyPoint) Coordinate() Coordinate {
+	return Coordinate{Latitude: r.Latitude, Longitude: r.Longitude}
+}
+
+// Replaces the rally points on the vehicle
+func (v *Vehicle) UploadRallyPoints(ctx context.Context, points []RallyPoint) error {
+	items := make([]MissionItem, len(points))
+	for i, point := range points {
+		items[i] = MissionItem{
+			Frame:   FrameGlobalRelativeAlt,
+			Command: mavlink.MAV_CMD_NAV_RALLY_POINT,
+			X:       point.Latitude,
+			Y:       point.Longitude,
+			Z:       float32(point.Altitude),
+		}
+		if point.AltitudeTerrain {
+			items[i].Frame = FrameGlobalTerrainAlt
+		}
+	}
+	return v.uploadMissionItems(ctx, mavlink.MAV_MISSION_TYPE_RALLY, items)
+}
+
+// Reads the rally points stored on the vehicle. Points stored with an
+// altitude above mean sea level are converted to above home, which is asked
+// for if the vehicle hasn't reported it.
+func (v *Vehicle) DownloadRallyPoints(ctx context.Context) ([]RallyPoint, error) {
+	items, err := v.downloadMissionItems(ctx, mavlink.MAV_MISSION_TYPE_RALLY)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]RallyPoint, len(items))
+	// only looked up if a point needs it
+	var home *Home
+	for i, item := range items {
+		if item.Command != mavlink.MAV_CMD_NAV_RALLY_POINT {
+			return nil, fmt.Errorf("rally download: item %d: unexpected command %d", i, item.Command)
+		}
+		points[i] = RallyPoint{Latitude: item.X, Longitude: item.Y, Altitude: float64(item.Z)}
+		switch item.Frame {
+		case mavlink.MAV_FRAME_GLOBAL_RELATIVE_ALT, mavlink.MAV_FRAME_GLOBAL_RELATIVE_ALT_INT:
+		case mavlink.MAV_FRAME_GLOBAL_TERRAIN_ALT, mavlink.MAV_FRAME_GLOBAL_TERRAIN_ALT_INT:
+			points[i].AltitudeTerrain = true
+		case mavlink.MAV_FRAME_GLOBAL, mavlink.MAV_FRAME_GLOBAL_INT:
+			if home == nil {
+				h, err := v.rallyHome(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("rally download: item %d is above mean sea level: %w", i, err)
+				}
+				home = &h
+			}
+			points[i].Altitude -= home.Altitude
+		default:
+			return nil, fmt.Errorf("rally download: item %d: unsupported frame %d", i, item.Frame)
+		}
+	}
+	return points, nil
+}
+
+// Returns the home position, asking the vehicle for it if it hasn't reported
+// it
+func (v *Vehicle) rallyHome(ctx context.Context) (Home, error) {
+	if home, ok := v.Home(); ok {
+		return home, nil
+	}
+	return v.RequestHome(ctx)
+}
+
+// Returns the rally point closest to a coordinate and its distance in
+// meters, or false if there are no rally points
+func NearestRallyPoint(points []RallyPoint, c Coordinate) (RallyPoint, float64, bool) {
+	if len(points) == 0 {
+		return RallyPoint{}, 0, false
+	}
+	var nearest RallyPoint
+	distance := math.Inf(1)
+	for _, point := range points {
+		if d := Distance(c, point.Coordinate()); d < distance {
+			nearest, distance = point, d
+		}
+	}
+	return nearest, distance, true
+}
+
+// Returns the rally point closest to the vehicle's current position and its
+// distance in meters, or false if there are no rally points
+func (v *Vehicle) NearestRallyPoint(points []RallyPoint) (RallyPoint, float64, bool) {
+	v.lock.Lock()
+	position := v.Position.Coordinate()
+	v.lock.Unlock()
+	return NearestRallyPoint(points, position)
+}
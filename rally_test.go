@@ -0,0 +1,64 @@
+package mavcom
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+func TestRallyPointRoundTrip(t *testing.T) {
+	_, v := newSimVehicle(t, sim.DefaultConfig())
+	ctx := testContext(t)
+
+	points := []RallyPoint{
+		{Latitude: -35.3620, Longitude: 149.1640, Altitude: 30},
+		{Latitude: -35.3650, Longitude: 149.1670, Altitude: 20, AltitudeTerrain: true},
+	}
+	if err := v.UploadRallyPoints(ctx, points); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := v.DownloadRallyPoints(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(downloaded, points) {
+		t.Errorf("downloaded %+v, want %+v", downloaded, points)
+	}
+
+	nearest, _, ok := NearestRallyPoint(points, Coordinate{Latitude: -35.3648, Longitude: 149.1668})
+	if !ok || nearest != points[1] {
+		t.Errorf("nearest %+v, want %+v", nearest, points[1])
+	}
+}
+
+func TestRallyPointFrames(t *testing.T) {
+	config := sim.DefaultConfig()
+	_, v := newSimVehicle(t, config)
+	ctx := testContext(t)
+
+	// as a ground station that stores them above mean sea level would
+	items := []MissionItem{
+		{Frame: FrameGlobal, Command: mavlink.MAV_CMD_NAV_RALLY_POINT, X: -35.3620, Y: 149.1640, Z: float32(config.HomeAltitude + 25)},
+	}
+	if err := v.uploadMissionItems(ctx, mavlink.MAV_MISSION_TYPE_RALLY, items); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := v.DownloadRallyPoints(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downloaded) != 1 || math.Abs(downloaded[0].Altitude-25) > 0.01 || downloaded[0].AltitudeTerrain {
+		t.Errorf("downloaded %+v, want a point 25 m above home", downloaded)
+	}
+
+	items[0].Frame = FrameLocalNED
+	if err := v.uploadMissionItems(ctx, mavlink.MAV_MISSION_TYPE_RALLY, items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.DownloadRallyPoints(ctx); err == nil {
+		t.Error("downloaded a rally point in a local frame")
+	}
+}
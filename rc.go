@@ -0,0 +1,257 @@
+package mavcom
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// Channels an RC override can set
+	RCChannelCount = mavlink.RC_CHANNELS_MAX
+
+	// ArduPilot drops an override it hasn't heard again within
+	// RC_OVERRIDE_TIME, 3 seconds by default
+	defaultRCOverrideRate = 5 // Hz
+	// How many times the release is sent when an override stops, in case
+	// one is lost
+	rcReleaseRepeats = 3
+)
+
+// RCChannels is what the pilot's transmitter is sending, as the autopilot
+// receives it
+type RCChannels struct {
+	// the vehicle's clock when the channels were read
+	TimeBootMs uint32
+	// PWM in microseconds, one per channel the receiver has
+	Channels []uint16
+	// signal strength from 0 to 254, or 255 if the receiver doesn't say
+	RSSI uint8
+}
+
+// ServoOutputs is the PWM the autopilot is driving its outputs with
+type ServoOutputs struct {
+	// the vehicle's clock in microseconds when the outputs were set
+	TimeUsec uint32
+	// PWM in microseconds of outputs 1 to 32, 0 for outputs that aren't
+	// reported
+	Outputs [2 * mavlink.SERVO_OUTPUT_MAX]uint16
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleRCChannels(msg *mavlink.RcChannelsMessage) {
+	count := min(int(msg.ChanCount), mavlink.RC_CHANNELS_MAX)
+	v.rcChannels = &RCChannels{
+		TimeBootMs: msg.TimeBootMs,
+		Channels:   append([]uint16(nil), msg.Chan[:count]...),
+		RSSI:       msg.Rssi,
+	}
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleServoOutputs(msg *mavlink.ServoOutputRawMessage) {
+	if int(msg.Port) >= len(v.servoOutputs.Outputs)/mavlink.SERVO_OUTPUT_MAX {
+		return
+	}
+	if msg.Port == 0 {
+		v.servoOutputs.TimeUsec = msg.TimeUsec
+	}
+	copy(v.servoOutputs.Outputs[int(msg.Port)*mavlink.SERVO_OUTPUT_MAX:], msg.Servo[:])
+	v.servoOutputsReceived = true
+}
+
+// Returns the latest RC_CHANNELS, and false if none has been received
+func (v *Vehicle) RCChannels() (RCChannels, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.rcChannels == nil {
+		return RCChannels{}, false
+	}
+	channels := *v.rcChannels
+	channels.Channels = append([]uint16(nil), channels.Channels...)
+	return channels, true
+}
+
+// Returns the latest SERVO_OUTPUT_RAW, and false if none has been received
+func (v *Vehicle) ServoOutputs() (ServoOutputs, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.servoOutputs, v.servoOutputsReceived
+}
+
+type RCOverrideConfig struct {
+	// How often the override is sent, in Hz. Defaults to 5, well within
+	// the 3 seconds after which ArduPilot drops an override by default.
+	Rate float64
+}
+
+// RCOverride keeps RC_CHANNELS_OVERRIDE flowing to a vehicle, replacing the
+// transmitter's channels that have been set, until it is stopped
+type RCOverride struct {
+	vehicle  *Vehicle
+	config   RCOverrideConfig
+	lock     sync.Mutex
+	channels [RCChannelCount]uint16
+	// channels that have been set and then released, sent as released
+	// rather than ignored so the transmitter takes over straight away
+	released [RCChannelCount]bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	err      error
+}
+
+// Starts sending RC overrides to the vehicle. No channel is overridden until
+// Set is called. The override carries on until Stop is called or ctx is
+// done, at which point every channel is handed back to the transmitter.
+func (v *Vehicle) StartRCOverride(ctx context.Context, config RCOverrideConfig) *RCOverride {
+	if config.Rate <= 0 {
+		config.Rate = defaultRCOverrideRate
+	}
+	o := &RCOverride{
+		vehicle: v,
+		config:  config,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go o.run(ctx)
+	return o
+}
+
+func checkRCChannel(channel int) error {
+	if channel < 1 || channel > RCChannelCount {
+		return fmt.Errorf("RC channel %d out of range 1 to %d", channel, RCChannelCount)
+	}
+	return nil
+}
+
+// Overrides a channel, numbered from 1, with a PWM in microseconds. It is
+// sent at the next tick.
+func (o *RCOverride) Set(channel int, pwm uint16) error {
+	if err := checkRCChannel(channel); err != nil {
+		return err
+	}
+	if pwm == 0 || pwm >= mavlink.RC_OVERRIDE_RELEASE_EXT {
+		return fmt.Errorf("RC channel %d: invalid PWM %d", channel, pwm)
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.channels[channel-1] = pwm
+	o.released[channel-1] = false
+	return nil
+}
+
+// Hands a channel, numbered from 1, back to the transmitter
+func (o *RCOverride) Release(channel int) error {
+	if err := checkRCChannel(channel); err != nil {
+		return err
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.release(channel - 1)
+	return nil
+}
+
+// Hands every overridden channel back to the transmitter, while carrying on
+// sending so that channels can be set again
+func (o *RCOverride) ReleaseAll() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for i := range o.channels {
+		o.release(i)
+	}
+}
+
+// Must be called holding the lock
+func (o *RCOverride) release(i int) {
+	if o.channels[i] != 0 {
+		o.channels[i] = 0
+		o.released[i] = true
+	}
+}
+
+// Releases every channel and stops sending, returning any error from
+// sending the override
+func (o *RCOverride) Stop() error {
+	o.stopOnce.Do(func() { close(o.stop) })
+	<-o.done
+	return o.err
+}
+
+// Closed once the override has stopped, whether through Stop, ctx being done
+// or the connection failing
+func (o *RCOverride) Done() <-chan struct{} {
+	return o.done
+}
+
+func (o *RCOverride) run(ctx context.Context) {
+	defer close(o.done)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / o.config.Rate))
+	defer ticker.Stop()
+
+	for {
+		if err := o.send(); err != nil {
+			o.err = err
+			return
+		}
+		select {
+		case <-ctx.Done():
+			o.err = o.releaseAndStop(ticker)
+			return
+		case <-o.stop:
+			o.err = o.releaseAndStop(ticker)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *RCOverride) releaseAndStop(ticker *time.Ticker) error {
+	o.ReleaseAll()
+	for i := 0; i < rcReleaseRepeats; i++ {
+		if err := o.send(); err != nil {
+			return fmt.Errorf("RC override release: %w", err)
+		}
+		if i < rcReleaseRepeats-1 {
+			<-ticker.C
+		}
+	}
+	return nil
+}
+
+func (o *RCOverride) send() error {
+	o.lock.Lock()
+	channels, released := o.channels, o.released
+	o.lock.Unlock()
+
+	targetSystem, targetComponent := o.vehicle.Connection.Target()
+	msg := mavlink.RcChannelsOverride{
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+	}
+	for i, pwm := range channels {
+		basic := i < mavlink.RC_CHANNELS_OVERRIDE_BASIC
+		value := pwm
+		if pwm == 0 {
+			switch {
+			case released[i] && basic:
+				value = mavlink.RC_OVERRIDE_RELEASE
+			case released[i]:
+				value = mavlink.RC_OVERRIDE_RELEASE_EXT
+			case basic:
+				value = mavlink.RC_OVERRIDE_IGNORE
+			default:
+				value = mavlink.RC_OVERRIDE_IGNORE_EXT
+			}
+		}
+		if basic {
+			msg.Chan[i] = value
+		} else {
+			msg.ChanExt[i-mavlink.RC_CHANNELS_OVERRIDE_BASIC] = value
+		}
+	}
+	return o.vehicle.Connection.Send(msg)
+}
@@ -0,0 +1,137 @@
+package mavcom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// Waits for the vehicle's RC channels, numbered from 1, to read as wanted,
+// where 0 is a channel the receiver doesn't report
+func waitForRCChannels(t *testing.T, v *Vehicle, want map[int]uint16) {
+	t.Helper()
+	err := v.waitFor(testContext(t), "test", "RC channels", func() bool {
+		if v.rcChannels == nil {
+			return false
+		}
+		for channel, pwm := range want {
+			var got uint16
+			if channel <= len(v.rcChannels.Channels) {
+				got = v.rcChannels.Channels[channel-1]
+			}
+			if got != pwm {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRCOverride(t *testing.T) {
+	_, v := newSimVehicle(t, sim.DefaultConfig())
+	override := v.StartRCOverride(testContext(t), RCOverrideConfig{Rate: 20})
+
+	// throttle and one of the extension channels, past the receiver's 16
+	if err := override.Set(3, 1800); err != nil {
+		t.Fatal(err)
+	}
+	if err := override.Set(18, 1700); err != nil {
+		t.Fatal(err)
+	}
+	waitForRCChannels(t, v, map[int]uint16{1: 1500, 3: 1800, 18: 1700})
+
+	// the transmitter takes the throttle back straight away rather than
+	// once the override times out
+	if err := override.Release(3); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	waitForRCChannels(t, v, map[int]uint16{3: 1000, 18: 1700})
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("throttle released after %v", elapsed)
+	}
+
+	if err := override.Set(3, 1200); err != nil {
+		t.Fatal(err)
+	}
+	waitForRCChannels(t, v, map[int]uint16{3: 1200})
+	if err := override.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	waitForRCChannels(t, v, map[int]uint16{3: 1000, 18: 0})
+}
+
+func TestRCOverrideValues(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	override := v.StartRCOverride(testContext(t), RCOverrideConfig{Rate: 50})
+	if err := override.Set(1, 1600); err != nil {
+		t.Fatal(err)
+	}
+	if err := override.Set(10, 1400); err != nil {
+		t.Fatal(err)
+	}
+	nextOverride := func() *mavlink.RcChannelsOverrideMessage {
+		t.Helper()
+		return decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_RC_CHANNELS_OVERRIDE)).(*mavlink.RcChannelsOverrideMessage)
+	}
+	msg := nextOverride()
+	for msg.Chan[0] != 1600 {
+		msg = nextOverride()
+	}
+	if msg.TargetSystem != 1 || msg.TargetComponent != 1 {
+		t.Errorf("sent to %d/%d, want 1/1", msg.TargetSystem, msg.TargetComponent)
+	}
+	if msg.Chan[9] != 1400 || msg.Chan[1] != mavlink.RC_OVERRIDE_IGNORE || msg.Chan[10] != mavlink.RC_OVERRIDE_IGNORE_EXT {
+		t.Errorf("sent channels %v, want 1 and 10 set and the rest ignored", msg.Chan)
+	}
+
+	// the channels that were set are released, each in its own way, and the
+	// rest are still left alone
+	go override.Stop()
+	for msg.Chan[0] == 1600 {
+		msg = nextOverride()
+	}
+	for i := 0; i < rcReleaseRepeats; i++ {
+		if i > 0 {
+			msg = nextOverride()
+		}
+		if msg.Chan[0] != mavlink.RC_OVERRIDE_RELEASE || msg.Chan[9] != mavlink.RC_OVERRIDE_RELEASE_EXT {
+			t.Errorf("release %d sent channels 1 and 10 as %d and %d, want %d and %d", i+1, msg.Chan[0], msg.Chan[9], mavlink.RC_OVERRIDE_RELEASE, mavlink.RC_OVERRIDE_RELEASE_EXT)
+		}
+		if msg.Chan[1] != mavlink.RC_OVERRIDE_IGNORE || msg.Chan[10] != mavlink.RC_OVERRIDE_IGNORE_EXT {
+			t.Errorf("release %d sent untouched channels 2 and 11 as %d and %d, want them ignored", i+1, msg.Chan[1], msg.Chan[10])
+		}
+	}
+	<-override.Done()
+	select {
+	case frame := <-a.frames:
+		if mavlink.FrameMessageID(frame) == mavlink.MAVLINK_MSG_ID_RC_CHANNELS_OVERRIDE {
+			t.Errorf("sent more than %d releases", rcReleaseRepeats)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRCOverrideInvalidChannels(t *testing.T) {
+	_, v := newFakeAutopilot(t)
+	override := v.StartRCOverride(testContext(t), RCOverrideConfig{})
+	defer override.Stop()
+	for _, channel := range []int{0, RCChannelCount + 1} {
+		if err := override.Set(channel, 1500); err == nil {
+			t.Errorf("set channel %d", channel)
+		}
+		if err := override.Release(channel); err == nil {
+			t.Errorf("released channel %d", channel)
+		}
+	}
+	for _, pwm := range []uint16{0, mavlink.RC_OVERRIDE_RELEASE_EXT, mavlink.RC_OVERRIDE_IGNORE} {
+		if err := override.Set(1, pwm); err == nil {
+			t.Errorf("set channel 1 to %d", pwm)
+		}
+	}
+}
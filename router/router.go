@@ -0,0 +1,388 @@
+// Package router forwards MAVLink between links, like mavlink-router or
+// MAVProxy's outputs, so that a vehicle's telemetry can be shared by several
+// ground stations and programs.
+//
+//	r := router.New()
+//	defer r.Close()
+//	r.Add(router.Endpoint{Name: "vehicle", URL: "serial:///dev/ttyACM0:115200"})
+//	r.Add(router.Endpoint{Name: "qgc", URL: "udpout://127.0.0.1:14550"})
+//	v := mavcom.NewVehicleFromTransport(r.Connect("app"))
+//
+// Frames are sent to every endpoint other than the one they came from,
+// except those addressed to a particular system or component, which only go
+// to endpoints the system or component has been heard from over.
+package router
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/communicator"
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// How many frames can wait to be written to an endpoint before more
+	// are dropped, so that a slow endpoint never holds up the others
+	endpointQueue = 256
+
+	// How long frames are remembered by default to drop copies arriving
+	// over another link
+	defaultDedupWindow = 200 * time.Millisecond
+)
+
+// Endpoint is a link the router forwards frames to and from
+type Endpoint struct {
+	// shown in statistics and errors
+	Name string
+	// as for mavcom.Connect, such as "serial:///dev/ttyUSB0:57600",
+	// "udp://:14550", "udpout://127.0.0.1:14550" or "tcp://127.0.0.1:5760".
+	// "tcpin://:5760" accepts TCP connections, each becoming an endpoint of
+	// its own with the same filters.
+	URL string
+	// when not empty, the only messages forwarded to the endpoint, by ID
+	AllowMessages []uint32
+	// messages never forwarded to the endpoint, by ID
+	BlockMessages []uint32
+}
+
+// EndpointStats counts what the router has done with an endpoint's frames
+type EndpointStats struct {
+	Name string
+	// frames received from the endpoint, and those of them dropped for
+	// being copies of frames already forwarded or for failing their CRC
+	FramesIn    uint64
+	Duplicates  uint64
+	CRCFailures uint64
+	// frames written to the endpoint, and those not sent because of its
+	// filters or because it had fallen behind
+	FramesOut uint64
+	Filtered  uint64
+	Dropped   uint64
+	// systems and components heard from over the endpoint, as
+	// "system/component"
+	Components []string
+}
+
+// A system and component
+type address struct {
+	system    uint8
+	component uint8
+}
+
+type endpoint struct {
+	config    Endpoint
+	transport io.ReadWriteCloser
+	frames    chan []byte
+	allow     map[uint32]bool
+	block     map[uint32]bool
+	// systems and components heard from over the endpoint
+	components map[address]bool
+	systems    map[uint8]bool
+	stats      EndpointStats
+}
+
+// Whether a message may be forwarded to the endpoint
+func (e *endpoint) accepts(messageID uint32) bool {
+	if len(e.allow) > 0 && !e.allow[messageID] {
+		return false
+	}
+	return !e.block[messageID]
+}
+
+// A frame recently forwarded, to drop copies of it
+type seenFrame struct {
+	hash uint64
+	at   time.Time
+}
+
+// Router forwards frames between endpoints
+type Router struct {
+	// How long frames are remembered to drop copies of them arriving over
+	// other links, such as from a vehicle connected by two radios. 0 turns
+	// deduplication off.
+	DedupWindow time.Duration
+	// Where errors reading endpoints are reported, set before adding them
+	Logger    *slog.Logger
+	endpoints map[*endpoint]bool
+	listeners []net.Listener
+	// hashes of recently forwarded frames, oldest first
+	seen       []seenFrame
+	seenHashes map[uint64]bool
+	closed     bool
+	lock       sync.Mutex
+}
+
+func New() *Router {
+	return &Router{
+		DedupWindow: defaultDedupWindow,
+		Logger:      slog.Default(),
+		endpoints:   make(map[*endpoint]bool),
+		seenHashes:  make(map[uint64]bool),
+	}
+}
+
+// Opens an endpoint and starts forwarding frames to and from it
+func (r *Router) Add(e Endpoint) error {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint URL %q: %w", e.URL, err)
+	}
+	if u.Scheme == "tcpin" {
+		return r.listenTCP(e, u.Host)
+	}
+	t, err := communicator.Dial(e.URL)
+	if err != nil {
+		return fmt.Errorf("endpoint %s: %w", e.Name, err)
+	}
+	r.AddTransport(e, t)
+	return nil
+}
+
+// Starts forwarding frames to and from an already opened transport. The
+// endpoint's URL is not used.
+func (r *Router) AddTransport(e Endpoint, t io.ReadWriteCloser) {
+	ep := &endpoint{
+		config:     e,
+		transport:  t,
+		frames:     make(chan []byte, endpointQueue),
+		allow:      make(map[uint32]bool),
+		block:      make(map[uint32]bool),
+		components: make(map[address]bool),
+		systems:    make(map[uint8]bool),
+		stats:      EndpointStats{Name: e.Name},
+	}
+	for _, id := range e.AllowMessages {
+		ep.allow[id] = true
+	}
+	for _, id := range e.BlockMessages {
+		ep.block[id] = true
+	}
+
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		t.Close()
+		return
+	}
+	r.endpoints[ep] = true
+	r.lock.Unlock()
+
+	go r.writeEndpoint(ep)
+	go r.readEndpoint(ep)
+}
+
+// Returns one end of an in-memory connection to the router, ready to be
+// used as a vehicle's transport
+func (r *Router) Connect(name string) net.Conn {
+	routerEnd, vehicleEnd := net.Pipe()
+	r.AddTransport(Endpoint{Name: name}, routerEnd)
+	return vehicleEnd
+}
+
+// Accepts TCP connections on address until the router is closed, each one
+// an endpoint of its own
+func (r *Router) listenTCP(e Endpoint, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("endpoint %s: %w", e.Name, err)
+	}
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		listener.Close()
+		return net.ErrClosed
+	}
+	r.listeners = append(r.listeners, listener)
+	r.lock.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			client := e
+			client.Name = fmt.Sprintf("%s %v", e.Name, conn.RemoteAddr())
+			r.AddTransport(client, conn)
+		}
+	}()
+	return nil
+}
+
+// Returns what the router has done with each endpoint's frames, ordered by
+// name
+func (r *Router) Stats() []EndpointStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	stats := make([]EndpointStats, 0, len(r.endpoints))
+	for e := range r.endpoints {
+		s := e.stats
+		s.Components = make([]string, 0, len(e.components))
+		for a := range e.components {
+			s.Components = append(s.Components, fmt.Sprintf("%d/%d", a.system, a.component))
+		}
+		sort.Strings(s.Components)
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// Stops forwarding and closes every endpoint
+func (r *Router) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	for _, listener := range r.listeners {
+		listener.Close()
+	}
+	for e := range r.endpoints {
+		r.dropEndpoint(e)
+	}
+	return nil
+}
+
+// Must be called holding the lock
+func (r *Router) dropEndpoint(e *endpoint) {
+	if !r.endpoints[e] {
+		return
+	}
+	delete(r.endpoints, e)
+	close(e.frames)
+	e.transport.Close()
+}
+
+func (r *Router) writeEndpoint(e *endpoint) {
+	for frame := range e.frames {
+		if _, err := e.transport.Write(frame); err != nil && !errors.Is(err, syscall.ECONNREFUSED) {
+			break
+		}
+	}
+	r.lock.Lock()
+	r.dropEndpoint(e)
+	r.lock.Unlock()
+}
+
+func (r *Router) readEndpoint(e *endpoint) {
+	frameReader := mavlink.NewFrameReader(e.transport)
+	frameReader.OnCRCFailure = func([]byte) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		e.stats.FramesIn++
+		e.stats.CRCFailures++
+	}
+	for {
+		frame, err := frameReader.ReadFrame()
+		// sending UDP to a port nobody is listening on yet, such as a
+		// ground station that hasn't been started
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) && !errors.Is(err, net.ErrClosed) {
+				r.Logger.Warn("error reading from endpoint", "endpoint", e.config.Name, "err", err)
+			}
+			r.lock.Lock()
+			r.dropEndpoint(e)
+			r.lock.Unlock()
+			return
+		}
+		r.route(e, frame)
+	}
+}
+
+// Forwards a frame received from an endpoint to wherever it should go
+func (r *Router) route(from *endpoint, frame []byte) {
+	messageID := mavlink.FrameMessageID(frame)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	from.stats.FramesIn++
+	// copies still teach the router that a system can be reached over more
+	// than one link
+	system, component := mavlink.FrameSource(frame)
+	from.components[address{system, component}] = true
+	from.systems[system] = true
+	if r.duplicate(frame, time.Now()) {
+		from.stats.Duplicates++
+		return
+	}
+
+	for _, e := range r.destinations(from, frame) {
+		if !e.accepts(messageID) {
+			e.stats.Filtered++
+			continue
+		}
+		select {
+		case e.frames <- frame:
+			e.stats.FramesOut++
+		default:
+			e.stats.Dropped++
+		}
+	}
+}
+
+// Returns the endpoints a frame should go to. Frames addressed to a
+// particular system or component go only to the endpoints it has been heard
+// from over, or to every endpoint while it hasn't been heard from at all.
+// Must be called holding the lock.
+func (r *Router) destinations(from *endpoint, frame []byte) []*endpoint {
+	var all, bySystem, byComponent []*endpoint
+	system, component := mavlink.FrameTarget(frame)
+	for e := range r.endpoints {
+		if e == from {
+			continue
+		}
+		all = append(all, e)
+		if system != 0 && e.systems[system] {
+			bySystem = append(bySystem, e)
+		}
+		if system != 0 && component != 0 && e.components[address{system, component}] {
+			byComponent = append(byComponent, e)
+		}
+	}
+	switch {
+	case len(byComponent) > 0:
+		return byComponent
+	case len(bySystem) > 0:
+		return bySystem
+	default:
+		return all
+	}
+}
+
+// Whether a copy of a frame has already been forwarded within the dedup
+// window, remembering it if not. Must be called holding the lock.
+func (r *Router) duplicate(frame []byte, now time.Time) bool {
+	if r.DedupWindow <= 0 {
+		return false
+	}
+	for len(r.seen) > 0 && now.Sub(r.seen[0].at) > r.DedupWindow {
+		delete(r.seenHashes, r.seen[0].hash)
+		r.seen = r.seen[1:]
+	}
+	h := fnv.New64a()
+	h.Write(frame)
+	hash := h.Sum64()
+	if r.seenHashes[hash] {
+		return true
+	}
+	r.seen = append(r.seen, seenFrame{hash, now})
+	r.seenHashes[hash] = true
+	return false
+}
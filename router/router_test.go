@@ -0,0 +1,77 @@
+package router
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+type testSequence struct {
+	seq uint8
+}
+
+func (s *testSequence) GetSequenceNumber() uint8 {
+	return s.seq
+}
+
+func (s *testSequence) IncrementSequenceNumber() {
+	s.seq++
+}
+
+func encodeFrame(t *testing.T, msg mavlink.MavlinkMessage) []byte {
+	t.Helper()
+	encoder := mavlink.NewEncoder()
+	encoder.MavComInterface = &testSequence{}
+	var frame bytes.Buffer
+	if err := encoder.EncodePacket(&frame, 1, 1, msg); err != nil {
+		t.Fatal(err)
+	}
+	return frame.Bytes()
+}
+
+// Reads the next frame forwarded to conn
+func readFrame(t *testing.T, fr *mavlink.FrameReader, conn net.Conn) []byte {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frame, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestRouterForwardsMessagesItDoesNotDecode(t *testing.T) {
+	r := New()
+	defer r.Close()
+	vehicle := r.Connect("a-vehicle")
+	gcs := r.Connect("b-gcs")
+	received := mavlink.NewFrameReader(gcs)
+
+	// RADIO_STATUS from a SiK radio, which mavcom doesn't decode
+	radio := []byte{0xfe, 0x09, 0x00, 0x01, 0x01, 0x6d, 0x03, 0x00, 0x00, 0x00, 0xb4, 0xaa, 0x5f, 0x00, 0x00, 0x4d, 0x8d}
+	// an ID in no dialect mavcom knows, whose CRC can't be checked
+	unknown := []byte{mavlink.FRAME_START_V2, 2, 0, 0, 0, 1, 1, 0x50, 0xc3, 0, 0xab, 0xcd, 0x12, 0x34}
+	// a heartbeat corrupted on the way, which is dropped
+	corrupt := encodeFrame(t, mavlink.Heartbeat{Type: 2, Autopilot: 3})
+	corrupt[len(corrupt)-1] ^= 0xff
+	heartbeat := encodeFrame(t, mavlink.Heartbeat{Type: 2, Autopilot: 3})
+
+	for _, frame := range [][]byte{radio, unknown, corrupt, heartbeat} {
+		if _, err := vehicle.Write(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range [][]byte{radio, unknown, heartbeat} {
+		if got := readFrame(t, received, gcs); !bytes.Equal(got, want) {
+			t.Errorf("forwarded % x, want % x", got, want)
+		}
+	}
+
+	stats := r.Stats()
+	if stats[0].FramesIn != 4 || stats[0].CRCFailures != 1 {
+		t.Errorf("vehicle endpoint received %d frames with %d CRC failures, want 4 and 1", stats[0].FramesIn, stats[0].CRCFailures)
+	}
+}
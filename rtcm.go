@@ -0,0 +1,287 @@
+package mavcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/arducrow/go-mavcom/internal/communicator"
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// Every RTCM3 frame starts with this byte, followed by 6 reserved bits
+	// and a 10 bit length, the message and a 24 bit CRC
+	rtcmPreamble   = 0xd3
+	rtcmHeaderLen  = 3
+	rtcmCRCLen     = 3
+	rtcmMaxPayload = 1023
+)
+
+// The longest RTCM frame that fits in the fragments of one GPS_RTCM_DATA
+// sequence. A frame filling every fragment exactly couldn't be told apart
+// from one still to be continued, as the end of a message is marked by a
+// fragment that isn't full.
+const maxRTCMInject = mavlink.GPS_RTCM_DATA_LEN*mavlink.GPS_RTCM_DATA_MAX_FRAGMENTS - 1
+
+var errRTCMTooLong = errors.New("RTCM message too long to send")
+
+// RTCMStats counts the corrections read from a stream and sent to the
+// vehicle
+type RTCMStats struct {
+	// whole frames sent, and their size including framing
+	Messages uint64
+	Bytes    uint64
+	// frames that failed their CRC, bytes skipped looking for the start of
+	// a frame, and frames too long to send
+	CRCFailures  uint64
+	SkippedBytes uint64
+	TooLong      uint64
+	// frames sent by RTCM message type, such as 1005 for the base station's
+	// position or 1077 for GPS observations
+	Types map[int]uint64
+}
+
+// RTCMInjector sends RTCM3 corrections from an RTK base station to the
+// vehicle's GPS as GPS_RTCM_DATA
+type RTCMInjector struct {
+	vehicle *Vehicle
+	lock    sync.Mutex
+	// the sequence ID of the next message, which only has 5 bits
+	sequence uint8
+	stats    RTCMStats
+}
+
+// Returns an injector for RTCM corrections. ArduPilot passes them on to the
+// GPS as they are, so the GPS has to be set up to take RTCM3 on the port
+// it is connected to.
+func (v *Vehicle) NewRTCMInjector() *RTCMInjector {
+	return &RTCMInjector{vehicle: v, stats: RTCMStats{Types: make(map[int]uint64)}}
+}
+
+// Returns a copy of what the injector has done so far
+func (i *RTCMInjector) Stats() RTCMStats {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	stats := i.stats
+	stats.Types = make(map[int]uint64, len(i.stats.Types))
+	for t, n := range i.stats.Types {
+		stats.Types[t] = n
+	}
+	return stats
+}
+
+// Sends one whole RTCM3 frame, preamble and CRC included, splitting it
+// across as many GPS_RTCM_DATA as it needs. The GPS can only use whole
+// frames, so a stream should be split into frames rather than sent in
+// arbitrary pieces, as ReadFrom does.
+func (i *RTCMInjector) Inject(frame []byte) error {
+	if len(frame) > maxRTCMInject {
+		i.lock.Lock()
+		i.stats.TooLong++
+		i.lock.Unlock()
+		return fmt.Errorf("%w: %d bytes, the most is %d", errRTCMTooLong, len(frame), maxRTCMInject)
+	}
+	i.lock.Lock()
+	sequence := i.sequence
+	i.sequence = (i.sequence + 1) & 0x1f
+	i.lock.Unlock()
+
+	for _, msg := range rtcmFragments(frame, sequence) {
+		if err := i.vehicle.Connection.Send(msg); err != nil {
+			return fmt.Errorf("send RTCM: %w", err)
+		}
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.stats.Messages++
+	i.stats.Bytes += uint64(len(frame))
+	if len(frame) > rtcmHeaderLen+1 {
+		i.stats.Types[rtcmMessageType(frame)]++
+	}
+	return nil
+}
+
+// Splits a frame into GPS_RTCM_DATA messages. One that fits in a single
+// message is sent unfragmented. Otherwise every fragment but the last is
+// full, and one that would be full is followed by an empty one so the
+// vehicle knows the message has ended.
+func rtcmFragments(frame []byte, sequence uint8) []mavlink.GpsRtcmData {
+	sequenceFlags := sequence << mavlink.GPS_RTCM_DATA_SEQUENCE_SHIFT
+	if len(frame) < mavlink.GPS_RTCM_DATA_LEN {
+		msg := mavlink.GpsRtcmData{Flags: sequenceFlags, Len: uint8(len(frame))}
+		copy(msg.Data[:], frame)
+		return []mavlink.GpsRtcmData{msg}
+	}
+
+	var fragments []mavlink.GpsRtcmData
+	for fragment := uint8(0); ; fragment++ {
+		msg := mavlink.GpsRtcmData{
+			Flags: mavlink.GPS_RTCM_DATA_FRAGMENTED | fragment<<mavlink.GPS_RTCM_DATA_FRAGMENT_SHIFT | sequenceFlags,
+		}
+		msg.Len = uint8(copy(msg.Data[:], frame))
+		frame = frame[msg.Len:]
+		fragments = append(fragments, msg)
+		if msg.Len < mavlink.GPS_RTCM_DATA_LEN {
+			return fragments
+		}
+	}
+}
+
+// Returns the message type of an RTCM3 frame, the first 12 bits of its
+// message
+func rtcmMessageType(frame []byte) int {
+	return int(frame[rtcmHeaderLen])<<4 | int(frame[rtcmHeaderLen+1])>>4
+}
+
+// Reads an RTCM3 stream, such as from a base station or an NTRIP caster,
+// and injects each frame as it arrives until the stream ends, which returns
+// nil, or ctx is done. Frames failing their CRC or too long to send are
+// dropped, as is anything between frames. A frame that can't be sent ends it
+// with the error. Closing r once it returns stops the read in progress.
+func (i *RTCMInjector) ReadFrom(ctx context.Context, r io.Reader) error {
+	// stops the reader once the frame it is holding can't be handed over
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	frames := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(frames)
+		scanner := &rtcmScanner{reader: r}
+		for {
+			frame, err := i.readFrame(scanner)
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case frames <- frame:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case frame, ok := <-frames:
+			if !ok {
+				err := <-errs
+				if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+					return nil
+				}
+				return fmt.Errorf("read RTCM: %w", err)
+			}
+			if err := i.Inject(frame); err != nil && !errors.Is(err, errRTCMTooLong) {
+				return err
+			}
+		}
+	}
+}
+
+// Holds what has been read from an RTCM stream but not yet returned as a
+// frame
+type rtcmScanner struct {
+	reader io.Reader
+	buf    []byte
+}
+
+// Reads until at least n bytes are held
+func (s *rtcmScanner) fill(n int) error {
+	if len(s.buf) >= n {
+		return nil
+	}
+	buf := make([]byte, len(s.buf), n+rtcmMaxPayload)
+	copy(buf, s.buf)
+	for len(buf) < n {
+		read, err := s.reader.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+read]
+		if err != nil && len(buf) < n {
+			s.buf = buf
+			return err
+		}
+	}
+	s.buf = buf
+	return nil
+}
+
+// Returns the next frame that passes its CRC, counting what is skipped on
+// the way
+func (i *RTCMInjector) readFrame(s *rtcmScanner) ([]byte, error) {
+	for {
+		if err := s.fill(rtcmHeaderLen); err != nil {
+			return nil, err
+		}
+		// the top 6 bits of the length are reserved and always 0 in a real
+		// frame
+		if s.buf[0] != rtcmPreamble || s.buf[1]&0xfc != 0 {
+			i.countSkipped()
+			s.buf = s.buf[1:]
+			continue
+		}
+		length := rtcmHeaderLen + (int(s.buf[1]&0x03)<<8 | int(s.buf[2])) + rtcmCRCLen
+		if err := s.fill(length); err != nil {
+			return nil, err
+		}
+		crc := uint32(s.buf[length-3])<<16 | uint32(s.buf[length-2])<<8 | uint32(s.buf[length-1])
+		if crc24q(s.buf[:length-rtcmCRCLen]) != crc {
+			// a corrupted frame, or a preamble byte inside something
+			// else, so look for the next frame from just after it
+			i.lock.Lock()
+			i.stats.CRCFailures++
+			i.lock.Unlock()
+			i.countSkipped()
+			s.buf = s.buf[1:]
+			continue
+		}
+		frame := append([]byte(nil), s.buf[:length]...)
+		s.buf = s.buf[length:]
+		return frame, nil
+	}
+}
+
+func (i *RTCMInjector) countSkipped() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.stats.SkippedBytes++
+}
+
+// CRC-24Q, as used by RTCM3 and Qualcomm
+func crc24q(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for bit := 0; bit < 8; bit++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+// Opens a source of RTCM3 corrections: a file such as "file:///tmp/base.rtcm3",
+// a serial port such as "serial:///dev/ttyUSB1:115200", or a TCP server such
+// as "tcp://192.168.1.10:2101"
+func OpenRTCMSource(source string) (io.ReadCloser, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RTCM source %q: %w", source, err)
+	}
+	switch u.Scheme {
+	case "file":
+		return os.Open(u.Host + u.Path)
+	case "serial", "tcp", "udp":
+		return communicator.Dial(source)
+	default:
+		return nil, fmt.Errorf("unsupported RTCM source %q, use file, serial, tcp or udp", u.Scheme)
+	}
+}
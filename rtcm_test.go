@@ -0,0 +1,84 @@
+package mavcom
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// Builds an RTCM3 frame of a message type with a message of n bytes
+func rtcmFrame(messageType int, n int) []byte {
+	frame := []byte{rtcmPreamble, byte(n >> 8), byte(n)}
+	message := make([]byte, n)
+	message[0], message[1] = byte(messageType>>4), byte(messageType<<4)
+	for i := 2; i < n; i++ {
+		message[i] = byte(i)
+	}
+	frame = append(frame, message...)
+	crc := crc24q(frame)
+	return append(frame, byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+func TestRTCMReadFrom(t *testing.T) {
+	s, v := newSimVehicle(t, sim.DefaultConfig())
+	corrupted := rtcmFrame(1077, 100)
+	corrupted[50]++
+	var stream bytes.Buffer
+	stream.Write([]byte{0x01, 0x02})
+	stream.Write(rtcmFrame(1005, 19))
+	stream.Write(corrupted)
+	// takes 4 fragments
+	stream.Write(rtcmFrame(1077, 600))
+
+	injector := v.NewRTCMInjector()
+	if err := injector.ReadFrom(testContext(t), &stream); err != nil {
+		t.Fatal(err)
+	}
+	stats := injector.Stats()
+	if stats.Messages != 2 || stats.CRCFailures != 1 || stats.Types[1005] != 1 || stats.Types[1077] != 1 {
+		t.Errorf("stats %+v, want 2 messages and 1 CRC failure", stats)
+	}
+	deadline := time.Now().Add(simTestTimeout)
+	for s.State().RTCMMessages < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state := s.State(); state.RTCMMessages != 2 || state.RTCMBytes != 19+6+600+6 {
+		t.Errorf("simulator received %d messages of %d bytes", state.RTCMMessages, state.RTCMBytes)
+	}
+}
+
+func TestRTCMReadFromSendFailure(t *testing.T) {
+	// a vehicle that can't be sent to
+	vehicleEnd, otherEnd := net.Pipe()
+	otherEnd.Close()
+	v := NewVehicleFromTransport(vehicleEnd)
+	defer vehicleEnd.Close()
+
+	r, w := io.Pipe()
+	defer r.Close()
+	goroutines := runtime.NumGoroutine()
+	done := make(chan error, 1)
+	go func() {
+		done <- v.NewRTCMInjector().ReadFrom(context.Background(), r)
+	}()
+	w.Write(rtcmFrame(1005, 19))
+	if err := <-done; err == nil {
+		t.Fatal("ReadFrom succeeded without a vehicle to send to")
+	}
+	// the next frame read has nowhere to go, and mustn't hold the reader
+	// up forever
+	w.Write(rtcmFrame(1005, 19))
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("%d goroutines left running", n-goroutines)
+	}
+}
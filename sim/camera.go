@@ -0,0 +1,265 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// The simulated camera is a MAVLink component of its own, like a camera
+	// run by a companion computer, with its own heartbeat and commands
+	simCameraComponentID = mavlink.MAV_COMP_ID_CAMERA
+	// Space on the simulated memory card and what each picture takes, in MiB
+	simCameraCapacity  = 64 * 1024
+	simCameraImageSize = 8
+)
+
+const simCameraCapabilities = mavlink.CAMERA_CAP_FLAGS_CAPTURE_VIDEO |
+	mavlink.CAMERA_CAP_FLAGS_CAPTURE_IMAGE |
+	mavlink.CAMERA_CAP_FLAGS_HAS_MODES |
+	mavlink.CAMERA_CAP_FLAGS_CAN_CAPTURE_IMAGE_IN_VIDEO_MODE |
+	mavlink.CAMERA_CAP_FLAGS_CAN_CAPTURE_VIDEO_IN_IMAGE_MODE
+
+// A camera mounted on the simulated gimbal. Pictures are geotagged with the
+// vehicle's position and the gimbal's attitude.
+type camera struct {
+	// components count their packets separately, so the camera has its own
+	// encoder and sequence number
+	encoder       *mavlink.Encoder
+	seqNumber     uint8
+	lastHeartbeat time.Time
+	mode          uint8
+	// taking pictures every interval, until remaining reaches 0 or forever
+	// when unlimited
+	capturing bool
+	interval  time.Duration
+	remaining int
+	unlimited bool
+	nextShot  time.Time
+	// the sequence number of the last single picture, so that a command
+	// sent again doesn't take another
+	lastSequence int
+	// every picture taken, to send again when asked
+	images         []mavlink.CameraImageCaptured
+	recording      bool
+	recordingStart time.Time
+	// how often the capture status is sent while recording
+	statusInterval time.Duration
+	lastStatus     time.Time
+}
+
+func (c *camera) GetSequenceNumber() uint8 {
+	return c.seqNumber
+}
+
+func (c *camera) IncrementSequenceNumber() {
+	c.seqNumber++
+}
+
+// Must be called holding the lock
+func (s *Simulator) encodeFromCamera(msg mavlink.MavlinkMessage) []byte {
+	return s.encodeFrom(s.camera.encoder, simCameraComponentID, msg)
+}
+
+// Sends the camera's heartbeat, takes pictures that are due and reports the
+// capture status while recording. Must be called holding the lock.
+func (s *Simulator) stepCamera(now time.Time) {
+	c := &s.camera
+	if now.Sub(c.lastHeartbeat) >= time.Second {
+		s.broadcastFrame(s.encodeFromCamera(mavlink.Heartbeat{
+			Type:           mavlink.MAV_TYPE_CAMERA,
+			Autopilot:      mavlink.MAV_AUTOPILOT_INVALID,
+			SystemStatus:   mavlink.MAV_STATE_ACTIVE,
+			MavlinkVersion: 3,
+		}))
+		c.lastHeartbeat = now
+	}
+	if c.capturing && !now.Before(c.nextShot) {
+		s.takePicture(now)
+		c.nextShot = now.Add(c.interval)
+		if !c.unlimited {
+			c.remaining--
+			c.capturing = c.remaining > 0
+		}
+	}
+	if c.recording && c.statusInterval > 0 && now.Sub(c.lastStatus) >= c.statusInterval {
+		s.broadcastFrame(s.encodeFromCamera(s.cameraCaptureStatus(now)))
+		c.lastStatus = now
+	}
+}
+
+// Takes a picture and tells every link where it was taken. Must be called
+// holding the lock.
+func (s *Simulator) takePicture(now time.Time) {
+	c := &s.camera
+	state := s.model.state
+	g := &s.gimbal
+	q := mavlink.QuaternionFromEuler(g.roll*math.Pi/180, g.pitch*math.Pi/180, wrap180(state.Heading+g.yaw)*math.Pi/180)
+	index := len(c.images)
+	image := mavlink.CameraImageCaptured{
+		TimeUTC:       uint64(now.UnixMicro()),
+		TimeBootMs:    uint32(now.Sub(s.model.boot).Milliseconds()),
+		Lat:           int32(math.Round(state.Latitude * 1e7)),
+		Lon:           int32(math.Round(state.Longitude * 1e7)),
+		Alt:           int32(math.Round((s.config.HomeAltitude + state.Altitude) * 1000)),
+		RelativeAlt:   int32(math.Round(state.Altitude * 1000)),
+		Q:             q,
+		ImageIndex:    int32(index),
+		CaptureResult: 1,
+	}
+	copy(image.FileURL[:], fmt.Sprintf("file:///DCIM/IMG_%04d.JPG", index))
+	c.images = append(c.images, image)
+	s.broadcastFrame(s.encodeFromCamera(image))
+}
+
+// Handles a command addressed to the camera, or a request for one of its
+// messages addressed to every component. Must be called holding the lock.
+func (s *Simulator) handleCameraCommand(l *link, cmd *mavlink.CommandLongMessage) {
+	c := &s.camera
+	now := time.Now()
+	result := uint8(mavlink.MAV_RESULT_ACCEPTED)
+	// sent after the acknowledgement, to the link that asked or to every
+	// link for pictures
+	var requested mavlink.MavlinkMessage
+	takePicture := false
+
+	switch cmd.Command {
+	case mavlink.MAV_CMD_REQUEST_MESSAGE:
+		switch int(cmd.Param1) {
+		case mavlink.MAVLINK_MSG_ID_CAMERA_INFORMATION:
+			requested = s.cameraInformation(now)
+		case mavlink.MAVLINK_MSG_ID_CAMERA_SETTINGS:
+			requested = s.cameraSettings(now)
+		case mavlink.MAVLINK_MSG_ID_CAMERA_CAPTURE_STATUS:
+			requested = s.cameraCaptureStatus(now)
+		case mavlink.MAVLINK_MSG_ID_CAMERA_IMAGE_CAPTURED:
+			index := int(cmd.Param2)
+			if index < 0 || index >= len(c.images) {
+				result = mavlink.MAV_RESULT_FAILED
+				break
+			}
+			requested = c.images[index]
+		default:
+			result = mavlink.MAV_RESULT_UNSUPPORTED
+		}
+	case mavlink.MAV_CMD_SET_CAMERA_MODE:
+		mode := uint8(cmd.Param2)
+		switch {
+		case mode != mavlink.CAMERA_MODE_IMAGE && mode != mavlink.CAMERA_MODE_VIDEO:
+			result = mavlink.MAV_RESULT_DENIED
+		case c.recording:
+			result = mavlink.MAV_RESULT_TEMPORARILY_REJECTED
+		default:
+			c.mode = mode
+			requested = s.cameraSettings(now)
+		}
+	case mavlink.MAV_CMD_IMAGE_START_CAPTURE:
+		interval, count, sequence := cmd.Param2, int(cmd.Param3), int(cmd.Param4)
+		switch {
+		case count == 1:
+			// a single picture, unless the command is one sent again
+			if sequence == 0 || sequence != c.lastSequence {
+				c.lastSequence = sequence
+				takePicture = true
+			}
+		case interval <= 0:
+			result = mavlink.MAV_RESULT_DENIED
+		default:
+			c.capturing = true
+			c.interval = time.Duration(float64(interval) * float64(time.Second))
+			c.remaining = count
+			c.unlimited = count == 0
+			c.nextShot = now
+		}
+	case mavlink.MAV_CMD_IMAGE_STOP_CAPTURE:
+		c.capturing = false
+	case mavlink.MAV_CMD_VIDEO_START_CAPTURE:
+		if !c.recording {
+			c.recording = true
+			c.recordingStart = now
+		}
+		c.statusInterval = 0
+		if cmd.Param2 > 0 {
+			c.statusInterval = time.Duration(float64(time.Second) / float64(cmd.Param2))
+		}
+		requested = s.cameraCaptureStatus(now)
+	case mavlink.MAV_CMD_VIDEO_STOP_CAPTURE:
+		c.recording = false
+		requested = s.cameraCaptureStatus(now)
+	default:
+		result = mavlink.MAV_RESULT_UNSUPPORTED
+	}
+
+	s.replyFrame(l, s.encodeFromCamera(mavlink.CommandAck{Command: cmd.Command, Result: result, TargetSystem: cmd.SystemID, TargetComponent: cmd.ComponentID}))
+	if requested != nil {
+		s.replyFrame(l, s.encodeFromCamera(requested))
+	}
+	if takePicture {
+		s.takePicture(now)
+	}
+}
+
+// Whether a command addressed to every component is one the camera answers
+func isCameraRequest(cmd *mavlink.CommandLongMessage) bool {
+	if cmd.Command != mavlink.MAV_CMD_REQUEST_MESSAGE {
+		return false
+	}
+	switch int(cmd.Param1) {
+	case mavlink.MAVLINK_MSG_ID_CAMERA_INFORMATION, mavlink.MAVLINK_MSG_ID_CAMERA_SETTINGS,
+		mavlink.MAVLINK_MSG_ID_CAMERA_CAPTURE_STATUS:
+		return true
+	}
+	return false
+}
+
+func (s *Simulator) cameraInformation(now time.Time) mavlink.CameraInformation {
+	info := mavlink.CameraInformation{
+		TimeBootMs: uint32(now.Sub(s.model.boot).Milliseconds()),
+		// 1.2.0, with the major version in the lowest byte
+		FirmwareVersion: 1 | 2<<8,
+		FocalLength:     8.8,
+		SensorSizeH:     13.2,
+		SensorSizeV:     8.8,
+		Flags:           simCameraCapabilities,
+		ResolutionH:     5472,
+		ResolutionV:     3648,
+		GimbalDeviceID:  simGimbalDeviceID,
+		CameraDeviceID:  1,
+	}
+	copy(info.VendorName[:], "go-mavcom")
+	copy(info.ModelName[:], "Simulated camera")
+	return info
+}
+
+func (s *Simulator) cameraSettings(now time.Time) mavlink.CameraSettings {
+	return mavlink.CameraSettings{
+		TimeBootMs: uint32(now.Sub(s.model.boot).Milliseconds()),
+		ModeID:     s.camera.mode,
+		// the camera has neither zoom nor focus
+		ZoomLevel:      float32(math.NaN()),
+		FocusLevel:     float32(math.NaN()),
+		CameraDeviceID: 1,
+	}
+}
+
+func (s *Simulator) cameraCaptureStatus(now time.Time) mavlink.CameraCaptureStatus {
+	c := &s.camera
+	status := mavlink.CameraCaptureStatus{
+		TimeBootMs:        uint32(now.Sub(s.model.boot).Milliseconds()),
+		AvailableCapacity: float32(simCameraCapacity - simCameraImageSize*len(c.images)),
+		ImageCount:        int32(len(c.images)),
+		CameraDeviceID:    1,
+	}
+	if c.capturing {
+		status.ImageStatus = 2
+		status.ImageInterval = float32(c.interval.Seconds())
+	}
+	if c.recording {
+		status.VideoStatus = 1
+		status.RecordingTimeMs = uint32(now.Sub(c.recordingStart).Milliseconds())
+	}
+	return status
+}
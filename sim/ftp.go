@@ -0,0 +1,324 @@
+package sim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/arducrow/go-mavcom/ftp"
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// How many files can be open at once
+	ftpMaxSessions = 4
+	// How many replies a burst read sends before the client has to ask for
+	// more
+	ftpBurstPackets = 32
+)
+
+// An in-memory filesystem served over MAVLink FTP
+type ftpServer struct {
+	files    map[string][]byte
+	dirs     map[string]bool
+	sessions map[uint8]*ftpSession
+	// the last request and reply, so that a repeated request can be
+	// answered without doing it twice
+	lastRequest mavlink.FTPPacket
+	lastReply   mavlink.FTPPacket
+	answered    bool
+}
+
+type ftpSession struct {
+	path  string
+	write bool
+}
+
+func newFTPServer() ftpServer {
+	return ftpServer{
+		files:    make(map[string][]byte),
+		dirs:     map[string]bool{"/": true, "/APM": true, "/APM/LOGS": true, "/APM/scripts": true},
+		sessions: make(map[uint8]*ftpSession),
+	}
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + strings.TrimRight(p, "\x00"))
+}
+
+// Puts a file on the simulated vehicle's storage, creating its directory if
+// needed, so that it can be read over MAVLink FTP
+func (s *Simulator) WriteFile(name string, data []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	name = cleanPath(name)
+	for dir := path.Dir(name); !s.ftp.dirs[dir]; dir = path.Dir(dir) {
+		s.ftp.dirs[dir] = true
+	}
+	s.ftp.files[name] = append([]byte(nil), data...)
+}
+
+// Returns a file from the simulated vehicle's storage, such as one written
+// over MAVLink FTP
+func (s *Simulator) ReadFile(name string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, ok := s.ftp.files[cleanPath(name)]
+	return append([]byte(nil), data...), ok
+}
+
+// Must be called holding the lock
+func (s *Simulator) handleFTPMessage(l *link, msg *mavlink.FileTransferProtocolMessage) {
+	if msg.TargetSystem != 0 && msg.TargetSystem != s.config.SystemID {
+		return
+	}
+	req, err := mavlink.DecodeFTPPacket(msg.Payload)
+	if err != nil {
+		return
+	}
+	send := func(reply mavlink.FTPPacket) {
+		s.reply(l, mavlink.FileTransferProtocol{
+			TargetSystem:    msg.SystemID,
+			TargetComponent: msg.ComponentID,
+			Payload:         reply.Encode(),
+		})
+	}
+
+	server := &s.ftp
+	if req.Opcode == mavlink.FTP_OPCODE_BURST_READ_FILE {
+		for _, reply := range server.burstRead(req) {
+			send(reply)
+		}
+		return
+	}
+	if server.answered && req.Seq == server.lastRequest.Seq && req.Opcode == server.lastRequest.Opcode {
+		send(server.lastReply)
+		return
+	}
+	reply := server.handle(req)
+	reply.Seq = req.Seq + 1
+	reply.ReqOpcode = req.Opcode
+	server.lastRequest, server.lastReply, server.answered = req, reply, true
+	send(reply)
+}
+
+func ftpAck(session uint8, data []byte) mavlink.FTPPacket {
+	return mavlink.FTPPacket{Opcode: mavlink.FTP_OPCODE_ACK, Session: session, Data: data}
+}
+
+func ftpNak(code uint8) mavlink.FTPPacket {
+	return mavlink.FTPPacket{Opcode: mavlink.FTP_OPCODE_NAK, Data: []byte{code}}
+}
+
+func (server *ftpServer) handle(req mavlink.FTPPacket) mavlink.FTPPacket {
+	name := cleanPath(string(req.Data))
+
+	switch req.Opcode {
+	case mavlink.FTP_OPCODE_RESET_SESSIONS:
+		server.sessions = make(map[uint8]*ftpSession)
+		return ftpAck(0, nil)
+
+	case mavlink.FTP_OPCODE_TERMINATE_SESSION:
+		if server.sessions[req.Session] == nil {
+			return ftpNak(mavlink.FTP_ERR_INVALID_SESSION)
+		}
+		delete(server.sessions, req.Session)
+		return ftpAck(req.Session, nil)
+
+	case mavlink.FTP_OPCODE_LIST_DIRECTORY:
+		return server.list(name, req.Offset)
+
+	case mavlink.FTP_OPCODE_OPEN_FILE_RO, mavlink.FTP_OPCODE_OPEN_FILE_WO, mavlink.FTP_OPCODE_CREATE_FILE:
+		if req.Opcode == mavlink.FTP_OPCODE_CREATE_FILE {
+			if !server.dirs[path.Dir(name)] || server.dirs[name] {
+				return ftpNak(mavlink.FTP_ERR_FAIL)
+			}
+			server.files[name] = nil
+		}
+		data, ok := server.files[name]
+		if !ok {
+			return ftpNak(mavlink.FTP_ERR_FILE_NOT_FOUND)
+		}
+		session, ok := server.openSession(name, req.Opcode != mavlink.FTP_OPCODE_OPEN_FILE_RO)
+		if !ok {
+			return ftpNak(mavlink.FTP_ERR_NO_SESSIONS_AVAILABLE)
+		}
+		return ftpAck(session, binary.LittleEndian.AppendUint32(nil, uint32(len(data))))
+
+	case mavlink.FTP_OPCODE_READ_FILE:
+		session := server.sessions[req.Session]
+		if session == nil {
+			return ftpNak(mavlink.FTP_ERR_INVALID_SESSION)
+		}
+		data := server.files[session.path]
+		if int(req.Offset) >= len(data) {
+			return ftpNak(mavlink.FTP_ERR_EOF)
+		}
+		end := min(len(data), int(req.Offset)+int(req.Size))
+		reply := ftpAck(req.Session, data[req.Offset:end])
+		reply.Offset = req.Offset
+		return reply
+
+	case mavlink.FTP_OPCODE_WRITE_FILE:
+		session := server.sessions[req.Session]
+		if session == nil || !session.write {
+			return ftpNak(mavlink.FTP_ERR_INVALID_SESSION)
+		}
+		data := server.files[session.path]
+		if end := int(req.Offset) + len(req.Data); end > len(data) {
+			data = append(data, make([]byte, end-len(data))...)
+		}
+		copy(data[req.Offset:], req.Data)
+		server.files[session.path] = data
+		return ftpAck(req.Session, nil)
+
+	case mavlink.FTP_OPCODE_TRUNCATE_FILE:
+		data, ok := server.files[name]
+		if !ok {
+			return ftpNak(mavlink.FTP_ERR_FILE_NOT_FOUND)
+		}
+		if int(req.Offset) > len(data) {
+			return ftpNak(mavlink.FTP_ERR_FAIL)
+		}
+		server.files[name] = data[:req.Offset]
+		return ftpAck(0, nil)
+
+	case mavlink.FTP_OPCODE_REMOVE_FILE:
+		if _, ok := server.files[name]; !ok {
+			return ftpNak(mavlink.FTP_ERR_FILE_NOT_FOUND)
+		}
+		delete(server.files, name)
+		return ftpAck(0, nil)
+
+	case mavlink.FTP_OPCODE_CREATE_DIRECTORY:
+		if _, isFile := server.files[name]; isFile || server.dirs[name] {
+			return ftpNak(mavlink.FTP_ERR_FILE_EXISTS)
+		}
+		if !server.dirs[path.Dir(name)] {
+			return ftpNak(mavlink.FTP_ERR_FILE_NOT_FOUND)
+		}
+		server.dirs[name] = true
+		return ftpAck(0, nil)
+
+	case mavlink.FTP_OPCODE_REMOVE_DIRECTORY:
+		if !server.dirs[name] {
+			return ftpNak(mavlink.FTP_ERR_FILE_NOT_FOUND)
+		}
+		if len(server.children(name)) > 0 {
+			return ftpNak(mavlink.FTP_ERR_FAIL)
+		}
+		delete(server.dirs, name)
+		return ftpAck(0, nil)
+
+	case mavlink.FTP_OPCODE_RENAME:
+		from, to, _ := strings.Cut(string(req.Data), "\x00")
+		from, to = cleanPath(from), cleanPath(to)
+		data, ok := server.files[from]
+		if !ok {
+			return ftpNak(mavlink.FTP_ERR_FILE_NOT_FOUND)
+		}
+		if !server.dirs[path.Dir(to)] {
+			return ftpNak(mavlink.FTP_ERR_FAIL)
+		}
+		delete(server.files, from)
+		server.files[to] = data
+		return ftpAck(0, nil)
+
+	case mavlink.FTP_OPCODE_CALC_FILE_CRC32:
+		data, ok := server.files[name]
+		if !ok {
+			return ftpNak(mavlink.FTP_ERR_FILE_NOT_FOUND)
+		}
+		return ftpAck(0, binary.LittleEndian.AppendUint32(nil, ftp.CRC32(data)))
+
+	default:
+		return ftpNak(mavlink.FTP_ERR_UNKNOWN_COMMAND)
+	}
+}
+
+func (server *ftpServer) openSession(name string, write bool) (uint8, bool) {
+	for id := uint8(0); id < ftpMaxSessions; id++ {
+		if server.sessions[id] == nil {
+			server.sessions[id] = &ftpSession{path: name, write: write}
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// The names of the files and directories in a directory, sorted
+func (server *ftpServer) children(dir string) []string {
+	var names []string
+	for name := range server.files {
+		if path.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	for name := range server.dirs {
+		if name != "/" && path.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lists as many entries as fit in one reply, starting from the entry at
+// offset
+func (server *ftpServer) list(dir string, offset uint32) mavlink.FTPPacket {
+	if !server.dirs[dir] {
+		return ftpNak(mavlink.FTP_ERR_FILE_NOT_FOUND)
+	}
+	children := server.children(dir)
+	if int(offset) >= len(children) {
+		return ftpNak(mavlink.FTP_ERR_EOF)
+	}
+	var data []byte
+	for _, name := range children[offset:] {
+		entry := "D" + path.Base(name)
+		if contents, ok := server.files[name]; ok {
+			entry = fmt.Sprintf("F%s\t%d", path.Base(name), len(contents))
+		}
+		if len(data)+len(entry)+1 > mavlink.FTP_MAX_DATA_LEN {
+			break
+		}
+		data = append(append(data, entry...), 0)
+	}
+	reply := ftpAck(0, data)
+	reply.Offset = offset
+	return reply
+}
+
+// Answers a burst read with a run of replies, each carrying the next
+// sequence number, with the last marked as completing the burst
+func (server *ftpServer) burstRead(req mavlink.FTPPacket) []mavlink.FTPPacket {
+	reply := func(packet mavlink.FTPPacket, n int) mavlink.FTPPacket {
+		packet.Seq = req.Seq + uint16(n) + 1
+		packet.ReqOpcode = req.Opcode
+		packet.Session = req.Session
+		return packet
+	}
+	session := server.sessions[req.Session]
+	if session == nil {
+		return []mavlink.FTPPacket{reply(ftpNak(mavlink.FTP_ERR_INVALID_SESSION), 0)}
+	}
+	data := server.files[session.path]
+	if int(req.Offset) >= len(data) {
+		return []mavlink.FTPPacket{reply(ftpNak(mavlink.FTP_ERR_EOF), 0)}
+	}
+	size := int(req.Size)
+	if size == 0 || size > mavlink.FTP_MAX_DATA_LEN {
+		size = mavlink.FTP_MAX_DATA_LEN
+	}
+
+	var replies []mavlink.FTPPacket
+	for offset := int(req.Offset); offset < len(data) && len(replies) < ftpBurstPackets; offset += size {
+		packet := reply(ftpAck(req.Session, data[offset:min(offset+size, len(data))]), len(replies))
+		packet.Offset = uint32(offset)
+		replies = append(replies, packet)
+	}
+	replies[len(replies)-1].BurstComplete = true
+	return replies
+}
@@ -0,0 +1,324 @@
+package sim
+
+import (
+	"math"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// The simulated gimbal is driven by the autopilot, like a servo or
+	// serial gimbal on ArduPilot, so the autopilot is its manager
+	simGimbalDeviceID = 1
+	// How fast the gimbal turns towards its target, in degrees per second
+	gimbalSlewRate = 90
+	// Range of travel in degrees, like a typical 3 axis camera gimbal
+	gimbalRollLimit = 30
+	gimbalPitchMin  = -90
+	gimbalPitchMax  = 30
+	gimbalYawLimit  = 180
+)
+
+const simGimbalCapabilities = mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_NEUTRAL |
+	mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_ROLL_AXIS |
+	mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_ROLL_LOCK |
+	mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_PITCH_AXIS |
+	mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_PITCH_LOCK |
+	mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_YAW_AXIS |
+	mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_YAW_FOLLOW |
+	mavlink.GIMBAL_MANAGER_CAP_FLAGS_HAS_YAW_LOCK |
+	mavlink.GIMBAL_MANAGER_CAP_FLAGS_CAN_POINT_LOCATION_GLOBAL
+
+// A gimbal that holds roll and pitch level and follows the vehicle's heading
+// unless its yaw is locked. Angles are in degrees, with yaw relative to the
+// vehicle.
+type gimbal struct {
+	roll  float64
+	pitch float64
+	yaw   float64
+	// where it is turning to, with the yaw relative to north when locked
+	targetRoll  float64
+	targetPitch float64
+	targetYaw   float64
+	yawLock     bool
+	// rates in degrees per second it is turning at instead, while set
+	pitchRate float64
+	yawRate   float64
+	rates     bool
+	// a location to keep pointing at, in degrees and meters above home
+	roi            bool
+	roiLat, roiLon float64
+	roiAlt         float64
+	// how fast it turned over the last step, in degrees per second
+	rollVelocity       float64
+	pitchVelocity      float64
+	yawVelocity        float64
+	primarySystem      uint8
+	primaryComponent   uint8
+	secondarySystem    uint8
+	secondaryComponent uint8
+}
+
+func clamp(value float64, low float64, high float64) float64 {
+	return math.Max(low, math.Min(high, value))
+}
+
+// Wraps an angle in degrees to between -180 and 180
+func wrap180(angle float64) float64 {
+	angle = math.Mod(angle+180, 360)
+	if angle < 0 {
+		angle += 360
+	}
+	return angle - 180
+}
+
+// Turns the gimbal towards its target. Must be called holding the lock.
+func (s *Simulator) stepGimbal(dt time.Duration) {
+	g := &s.gimbal
+	seconds := dt.Seconds()
+	heading := s.model.state.Heading
+
+	switch {
+	case g.roi:
+		state := s.model.state
+		north := (g.roiLat - state.Latitude) * metersPerDegree
+		east := (g.roiLon - state.Longitude) * metersPerDegree * math.Cos(state.Latitude*math.Pi/180)
+		g.targetPitch = math.Atan2(g.roiAlt-state.Altitude, math.Hypot(north, east)) * 180 / math.Pi
+		g.targetYaw = math.Atan2(east, north) * 180 / math.Pi
+		g.targetRoll = 0
+		g.yawLock = true
+	case g.rates:
+		g.targetPitch += g.pitchRate * seconds
+		g.targetYaw += g.yawRate * seconds
+	}
+	g.targetPitch = clamp(g.targetPitch, gimbalPitchMin, gimbalPitchMax)
+	g.targetRoll = clamp(g.targetRoll, -gimbalRollLimit, gimbalRollLimit)
+
+	targetYaw := g.targetYaw
+	if g.yawLock {
+		targetYaw -= heading
+	}
+	targetYaw = clamp(wrap180(targetYaw), -gimbalYawLimit, gimbalYawLimit)
+
+	step := gimbalSlewRate * seconds
+	roll := clamp(g.targetRoll-g.roll, -step, step)
+	pitch := clamp(g.targetPitch-g.pitch, -step, step)
+	yaw := clamp(wrap180(targetYaw-g.yaw), -step, step)
+	g.roll += roll
+	g.pitch += pitch
+	g.yaw += yaw
+	if seconds > 0 {
+		g.rollVelocity, g.pitchVelocity, g.yawVelocity = roll/seconds, pitch/seconds, yaw/seconds
+	}
+}
+
+// Points the gimbal at angles in degrees, leaving NaN angles as they are.
+// Must be called holding the lock.
+func (s *Simulator) pointGimbal(roll float64, pitch float64, yaw float64, flags uint32) {
+	g := &s.gimbal
+	g.roi = false
+	g.rates = false
+	g.yawLock = flags&mavlink.GIMBAL_MANAGER_FLAGS_YAW_LOCK != 0
+	if !math.IsNaN(roll) {
+		g.targetRoll = roll
+	}
+	if !math.IsNaN(pitch) {
+		g.targetPitch = pitch
+	}
+	if !math.IsNaN(yaw) {
+		g.targetYaw = yaw
+	}
+}
+
+// Turns the gimbal at rates in degrees per second, leaving NaN rates as
+// they are. Must be called holding the lock.
+func (s *Simulator) turnGimbal(pitchRate float64, yawRate float64, flags uint32) {
+	g := &s.gimbal
+	if !g.rates {
+		// carry on from where the gimbal is pointing
+		g.targetPitch = g.pitch
+		g.targetYaw = g.yaw
+		if flags&mavlink.GIMBAL_MANAGER_FLAGS_YAW_LOCK != 0 {
+			g.targetYaw += s.model.state.Heading
+		}
+		g.pitchRate, g.yawRate = 0, 0
+	}
+	g.roi = false
+	g.rates = true
+	g.yawLock = flags&mavlink.GIMBAL_MANAGER_FLAGS_YAW_LOCK != 0
+	if !math.IsNaN(pitchRate) {
+		g.pitchRate = pitchRate
+	}
+	if !math.IsNaN(yawRate) {
+		g.yawRate = yawRate
+	}
+}
+
+// Whether a gimbal device ID in a command or message means the simulated
+// gimbal, where 0 means every gimbal
+func isSimGimbal(deviceID uint8) bool {
+	return deviceID == 0 || deviceID == simGimbalDeviceID
+}
+
+func radiansToDegrees(radians float32) float64 {
+	return float64(radians) * 180 / math.Pi
+}
+
+// Must be called holding the lock
+func (s *Simulator) handleGimbalSetPitchyaw(msg *mavlink.GimbalManagerSetPitchyawMessage) {
+	if (msg.TargetSystem != 0 && msg.TargetSystem != s.config.SystemID) || !isSimGimbal(msg.GimbalDeviceID) {
+		return
+	}
+	pitch, yaw := radiansToDegrees(msg.Pitch), radiansToDegrees(msg.Yaw)
+	if !math.IsNaN(pitch) || !math.IsNaN(yaw) {
+		s.pointGimbal(math.NaN(), pitch, yaw, msg.Flags)
+	} else {
+		s.turnGimbal(radiansToDegrees(msg.PitchRate), radiansToDegrees(msg.YawRate), msg.Flags)
+	}
+}
+
+// Must be called holding the lock
+func (s *Simulator) handleGimbalSetAttitude(msg *mavlink.GimbalManagerSetAttitudeMessage) {
+	if (msg.TargetSystem != 0 && msg.TargetSystem != s.config.SystemID) || !isSimGimbal(msg.GimbalDeviceID) {
+		return
+	}
+	if !math.IsNaN(float64(msg.Q[0])) {
+		roll, pitch, yaw := mavlink.EulerFromQuaternion(msg.Q)
+		s.pointGimbal(roll*180/math.Pi, pitch*180/math.Pi, yaw*180/math.Pi, msg.Flags)
+	} else {
+		s.turnGimbal(radiansToDegrees(msg.AngularVelocityY), radiansToDegrees(msg.AngularVelocityZ), msg.Flags)
+	}
+}
+
+// Handles the gimbal manager and ROI commands. Must be called holding the
+// lock.
+func (s *Simulator) handleGimbalCommand(cmd *mavlink.CommandLongMessage) uint8 {
+	g := &s.gimbal
+	switch cmd.Command {
+	case mavlink.MAV_CMD_DO_GIMBAL_MANAGER_PITCHYAW:
+		if !isSimGimbal(uint8(cmd.Param7)) {
+			return mavlink.MAV_RESULT_DENIED
+		}
+		flags := uint32(cmd.Param5)
+		if !math.IsNaN(float64(cmd.Param1)) || !math.IsNaN(float64(cmd.Param2)) {
+			s.pointGimbal(math.NaN(), float64(cmd.Param1), float64(cmd.Param2), flags)
+		} else {
+			s.turnGimbal(float64(cmd.Param3), float64(cmd.Param4), flags)
+		}
+	case mavlink.MAV_CMD_DO_GIMBAL_MANAGER_CONFIGURE:
+		if !isSimGimbal(uint8(cmd.Param7)) {
+			return mavlink.MAV_RESULT_DENIED
+		}
+		configure := func(system float32, component float32, toSystem *uint8, toComponent *uint8) {
+			switch system {
+			case -1:
+			case -2:
+				*toSystem, *toComponent = cmd.SystemID, cmd.ComponentID
+			case -3:
+				*toSystem, *toComponent = 0, 0
+			default:
+				*toSystem, *toComponent = uint8(system), uint8(component)
+			}
+		}
+		configure(cmd.Param1, cmd.Param2, &g.primarySystem, &g.primaryComponent)
+		configure(cmd.Param3, cmd.Param4, &g.secondarySystem, &g.secondaryComponent)
+	case mavlink.MAV_CMD_DO_SET_ROI_LOCATION:
+		if !isSimGimbal(uint8(cmd.Param1)) {
+			return mavlink.MAV_RESULT_DENIED
+		}
+		g.roi = true
+		g.rates = false
+		g.roiLat, g.roiLon, g.roiAlt = float64(cmd.Param5), float64(cmd.Param6), float64(cmd.Param7)
+	case mavlink.MAV_CMD_DO_SET_ROI_NONE:
+		if !isSimGimbal(uint8(cmd.Param1)) {
+			return mavlink.MAV_RESULT_DENIED
+		}
+		// back to neutral, level and facing forwards
+		s.pointGimbal(0, 0, 0, 0)
+	default:
+		// the simulator doesn't track other systems, so can't point at
+		// them for MAV_CMD_DO_SET_ROI_SYSID
+		return mavlink.MAV_RESULT_UNSUPPORTED
+	}
+	return mavlink.MAV_RESULT_ACCEPTED
+}
+
+// Handles the commands sent as COMMAND_INT, of which the simulator only
+// knows MAV_CMD_DO_SET_ROI_LOCATION. Must be called holding the lock.
+func (s *Simulator) handleCommandInt(cmd *mavlink.CommandIntMessage) uint8 {
+	if cmd.Command != mavlink.MAV_CMD_DO_SET_ROI_LOCATION {
+		return mavlink.MAV_RESULT_UNSUPPORTED
+	}
+	if cmd.Frame != mavlink.MAV_FRAME_GLOBAL_RELATIVE_ALT && cmd.Frame != mavlink.MAV_FRAME_GLOBAL_RELATIVE_ALT_INT {
+		return mavlink.MAV_RESULT_DENIED
+	}
+	if !isSimGimbal(uint8(cmd.Param1)) {
+		return mavlink.MAV_RESULT_DENIED
+	}
+	g := &s.gimbal
+	g.roi = true
+	g.rates = false
+	g.roiLat, g.roiLon, g.roiAlt = float64(cmd.X)/1e7, float64(cmd.Y)/1e7, float64(cmd.Z)
+	return mavlink.MAV_RESULT_ACCEPTED
+}
+
+// Must be called holding the lock
+func (s *Simulator) gimbalManagerInformation() mavlink.GimbalManagerInformation {
+	toRadians := func(degrees float64) float32 { return float32(degrees * math.Pi / 180) }
+	return mavlink.GimbalManagerInformation{
+		TimeBootMs:     uint32(time.Since(s.model.boot).Milliseconds()),
+		CapFlags:       simGimbalCapabilities,
+		RollMin:        toRadians(-gimbalRollLimit),
+		RollMax:        toRadians(gimbalRollLimit),
+		PitchMin:       toRadians(gimbalPitchMin),
+		PitchMax:       toRadians(gimbalPitchMax),
+		YawMin:         toRadians(-gimbalYawLimit),
+		YawMax:         toRadians(gimbalYawLimit),
+		GimbalDeviceID: simGimbalDeviceID,
+	}
+}
+
+func (g *gimbal) flags() uint32 {
+	flags := uint32(mavlink.GIMBAL_MANAGER_FLAGS_ROLL_LOCK | mavlink.GIMBAL_MANAGER_FLAGS_PITCH_LOCK)
+	if g.yawLock {
+		flags |= mavlink.GIMBAL_MANAGER_FLAGS_YAW_LOCK
+	}
+	return flags
+}
+
+// Must be called holding the lock
+func (s *Simulator) gimbalManagerStatus() mavlink.GimbalManagerStatus {
+	g := &s.gimbal
+	return mavlink.GimbalManagerStatus{
+		TimeBootMs:             uint32(time.Since(s.model.boot).Milliseconds()),
+		Flags:                  g.flags(),
+		GimbalDeviceID:         simGimbalDeviceID,
+		PrimaryControlSysid:    g.primarySystem,
+		PrimaryControlCompid:   g.primaryComponent,
+		SecondaryControlSysid:  g.secondarySystem,
+		SecondaryControlCompid: g.secondaryComponent,
+	}
+}
+
+// The attitude is reported relative to the vehicle, like ArduPilot does.
+// Must be called holding the lock.
+func (s *Simulator) gimbalDeviceAttitudeStatus() mavlink.GimbalDeviceAttitudeStatus {
+	g := &s.gimbal
+	var failures uint32
+	if g.pitch <= gimbalPitchMin || g.pitch >= gimbalPitchMax {
+		failures |= mavlink.GIMBAL_DEVICE_ERROR_FLAGS_AT_PITCH_LIMIT
+	}
+	return mavlink.GimbalDeviceAttitudeStatus{
+		TimeBootMs:       uint32(time.Since(s.model.boot).Milliseconds()),
+		Q:                mavlink.QuaternionFromEuler(g.roll*math.Pi/180, g.pitch*math.Pi/180, g.yaw*math.Pi/180),
+		AngularVelocityX: float32(g.rollVelocity * math.Pi / 180),
+		AngularVelocityY: float32(g.pitchVelocity * math.Pi / 180),
+		AngularVelocityZ: float32(g.yawVelocity * math.Pi / 180),
+		FailureFlags:     failures,
+		Flags:            uint16(g.flags() | mavlink.GIMBAL_DEVICE_FLAGS_YAW_IN_VEHICLE_FRAME),
+		DeltaYaw:         float32(s.model.state.Heading * math.Pi / 180),
+		DeltaYawVelocity: float32(math.NaN()),
+		GimbalDeviceID:   simGimbalDeviceID,
+	}
+}
@@ -0,0 +1,74 @@
+package sim
+
+import (
+	"math"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// What the simulated GPS reports with a good fix
+const (
+	simSatellites = 14
+	simHDOP       = 0.8
+	// meters, roughly how a u-blox module converts a good HDOP
+	simHorizontalAccuracy = 1.2
+	simVerticalAccuracy   = 1.8
+	simSpeedAccuracy      = 0.2
+)
+
+// Sets the fix the simulated GPS reports, as a GPS_FIX_TYPE such as 3 for a
+// 3D fix, and how many satellites it sees. Like ArduPilot, home is set the
+// first time the GPS has a 3D fix, and the vehicle won't arm without one.
+func (s *Simulator) SetGPS(fixType uint8, satellites uint8) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.model.gpsFix = fixType
+	s.model.satellites = satellites
+}
+
+// Sets home once the GPS first has a 3D fix
+func (m *model) updateHome() {
+	if !m.homeSet && m.gpsFix >= mavlink.GPS_FIX_TYPE_3D_FIX {
+		m.homeSet = true
+	}
+}
+
+func (m *model) gpsRawInt() mavlink.GpsRawInt {
+	s := m.state
+	msg := mavlink.GpsRawInt{
+		TimeUsec:          uint64(time.Since(m.boot).Microseconds()),
+		Eph:               mavlink.GPS_UNKNOWN,
+		Epv:               mavlink.GPS_UNKNOWN,
+		Vel:               mavlink.GPS_UNKNOWN,
+		Cog:               mavlink.GPS_UNKNOWN,
+		FixType:           m.gpsFix,
+		SatellitesVisible: m.satellites,
+	}
+	if m.gpsFix < mavlink.GPS_FIX_TYPE_2D_FIX {
+		return msg
+	}
+	msg.Lat = int32(math.Round(s.Latitude * 1e7))
+	msg.Lon = int32(math.Round(s.Longitude * 1e7))
+	msg.Alt = int32(math.Round((m.config.HomeAltitude + s.Altitude) * 1000))
+	msg.Eph = uint16(math.Round(simHDOP * 100))
+	msg.Epv = uint16(math.Round(1.5 * simHDOP * 100))
+	msg.Vel = uint16(math.Round(math.Hypot(s.VNorth, s.VEast) * 100))
+	msg.Cog = uint16(math.Round(s.Heading * 100))
+	// the simulated geoid sits on the ellipsoid
+	msg.AltEllipsoid = msg.Alt
+	msg.HAcc = uint32(simHorizontalAccuracy * 1000)
+	msg.VAcc = uint32(simVerticalAccuracy * 1000)
+	msg.VelAcc = uint32(simSpeedAccuracy * 1000)
+	return msg
+}
+
+func (m *model) homePosition() mavlink.HomePosition {
+	return mavlink.HomePosition{
+		Latitude:  int32(math.Round(m.config.HomeLatitude * 1e7)),
+		Longitude: int32(math.Round(m.config.HomeLongitude * 1e7)),
+		Altitude:  int32(math.Round(m.config.HomeAltitude * 1000)),
+		Q:         [4]float32{1, 0, 0, 0},
+		TimeUsec:  uint64(time.Since(m.boot).Microseconds()),
+	}
+}
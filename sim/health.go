@@ -0,0 +1,66 @@
+package sim
+
+import (
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// What a copter on the bench reports in SYS_STATUS as present and enabled
+const simSensors = mavlink.MAV_SYS_STATUS_SENSOR_3D_GYRO |
+	mavlink.MAV_SYS_STATUS_SENSOR_3D_ACCEL |
+	mavlink.MAV_SYS_STATUS_SENSOR_3D_MAG |
+	mavlink.MAV_SYS_STATUS_SENSOR_ABSOLUTE_PRESSURE |
+	mavlink.MAV_SYS_STATUS_SENSOR_GPS |
+	mavlink.MAV_SYS_STATUS_SENSOR_ANGULAR_RATE_CONTROL |
+	mavlink.MAV_SYS_STATUS_SENSOR_ATTITUDE_STABILIZATION |
+	mavlink.MAV_SYS_STATUS_SENSOR_YAW_POSITION |
+	mavlink.MAV_SYS_STATUS_SENSOR_Z_ALTITUDE_CONTROL |
+	mavlink.MAV_SYS_STATUS_SENSOR_XY_POSITION_CONTROL |
+	mavlink.MAV_SYS_STATUS_SENSOR_MOTOR_OUTPUTS |
+	mavlink.MAV_SYS_STATUS_SENSOR_RC_RECEIVER |
+	mavlink.MAV_SYS_STATUS_AHRS |
+	mavlink.MAV_SYS_STATUS_LOGGING |
+	mavlink.MAV_SYS_STATUS_SENSOR_BATTERY |
+	mavlink.MAV_SYS_STATUS_PREARM_CHECK
+
+// Makes sensors report as unhealthy in SYS_STATUS, by MAV_SYS_STATUS_SENSOR
+// bit, such as 1<<5 for the GPS. Any unhealthy sensor also fails the pre-arm
+// checks. 0 makes every sensor healthy again.
+func (s *Simulator) SetSensorsUnhealthy(sensors uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.model.sensorsUnhealthy = sensors
+}
+
+// Sets the vibration the simulated accelerometers report, in m/s² along
+// each axis, and whether they are clipping
+func (s *Simulator) SetVibration(x float64, y float64, z float64, clipping bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.model.vibration = [3]float64{x, y, z}
+	s.model.clipping = clipping
+}
+
+// The sensors reported as healthy, all but those made unhealthy
+func (m *model) sensorsHealth() uint32 {
+	health := uint32(simSensors) &^ m.sensorsUnhealthy
+	if m.sensorsUnhealthy != 0 {
+		health &^= mavlink.MAV_SYS_STATUS_PREARM_CHECK
+	}
+	return health
+}
+
+// Clipping counts up for as long as the accelerometers are clipping
+func (m *model) vibrationReport() mavlink.Vibration {
+	if m.clipping {
+		m.clips++
+	}
+	return mavlink.Vibration{
+		TimeUsec:   uint64(time.Since(m.boot).Microseconds()),
+		VibrationX: float32(m.vibration[0]),
+		VibrationY: float32(m.vibration[1]),
+		VibrationZ: float32(m.vibration[2]),
+		Clipping0:  m.clips,
+	}
+}
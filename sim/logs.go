@@ -0,0 +1,131 @@
+package sim
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// Where logs are stored, also visible over MAVLink FTP
+	logDirectory = "/APM/LOGS"
+	// How many LOG_DATA messages are sent every step of the simulation
+	logPacketsPerStep = 8
+)
+
+// A log being sent in answer to LOG_REQUEST_DATA
+type logTransfer struct {
+	l    *link
+	id   uint16
+	data []byte
+	ofs  uint32
+	end  uint32
+}
+
+// Puts a dataflash log on the simulated vehicle, as the file ArduPilot would
+// write it to, so that it can be listed and downloaded
+func (s *Simulator) WriteLog(id uint16, data []byte) {
+	s.WriteFile(logPath(id), data)
+}
+
+func logPath(id uint16) string {
+	return fmt.Sprintf("%s/%08d.BIN", logDirectory, id)
+}
+
+// The IDs of the logs stored in the log directory, in order. Must be called
+// holding the lock.
+func (s *Simulator) logIDs() []uint16 {
+	var ids []uint16
+	for _, name := range s.ftp.children(logDirectory) {
+		base, ok := strings.CutSuffix(path.Base(name), ".BIN")
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(base, 10, 16)
+		if err != nil || id == 0 {
+			continue
+		}
+		ids = append(ids, uint16(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Must be called holding the lock
+func (s *Simulator) handleLogMessage(l *link, msg mavlink.DecodedMessage) {
+	switch m := msg.(type) {
+	case *mavlink.LogRequestListMessage:
+		if m.TargetSystem != 0 && m.TargetSystem != s.config.SystemID {
+			return
+		}
+		ids := s.logIDs()
+		if len(ids) == 0 {
+			s.reply(l, mavlink.LogEntry{})
+			return
+		}
+		for _, id := range ids {
+			if id < m.Start || id > m.End {
+				continue
+			}
+			s.reply(l, mavlink.LogEntry{
+				Size:       uint32(len(s.ftp.files[logPath(id)])),
+				ID:         id,
+				NumLogs:    uint16(len(ids)),
+				LastLogNum: ids[len(ids)-1],
+			})
+		}
+
+	case *mavlink.LogRequestDataMessage:
+		if m.TargetSystem != 0 && m.TargetSystem != s.config.SystemID {
+			return
+		}
+		data := s.ftp.files[logPath(m.ID)]
+		if int(m.Ofs) >= len(data) {
+			s.reply(l, mavlink.LogData{Ofs: m.Ofs, ID: m.ID})
+			s.logTransfer = nil
+			return
+		}
+		// a new request replaces the one being sent, like ArduPilot
+		s.logTransfer = &logTransfer{
+			l:    l,
+			id:   m.ID,
+			data: data,
+			ofs:  m.Ofs,
+			end:  uint32(min(uint64(len(data)), uint64(m.Ofs)+uint64(m.Count))),
+		}
+
+	case *mavlink.LogTargetMessage:
+		if m.TargetSystem != 0 && m.TargetSystem != s.config.SystemID {
+			return
+		}
+		s.logTransfer = nil
+		if m.MessageID == mavlink.MAVLINK_MSG_ID_LOG_ERASE {
+			for _, id := range s.logIDs() {
+				delete(s.ftp.files, logPath(id))
+			}
+		}
+	}
+}
+
+// Sends the next few chunks of the log being transferred. Must be called
+// holding the lock.
+func (s *Simulator) sendLogData() {
+	transfer := s.logTransfer
+	if transfer == nil {
+		return
+	}
+	for i := 0; i < logPacketsPerStep && transfer.ofs < transfer.end; i++ {
+		msg := mavlink.LogData{Ofs: transfer.ofs, ID: transfer.id}
+		n := copy(msg.Data[:], transfer.data[transfer.ofs:transfer.end])
+		msg.Count = uint8(n)
+		s.reply(transfer.l, msg)
+		transfer.ofs += uint32(n)
+	}
+	if transfer.ofs >= transfer.end {
+		s.logTransfer = nil
+	}
+}
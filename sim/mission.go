@@ -0,0 +1,118 @@
+package sim
+
+import "github.com/arducrow/go-mavcom/internal/mavlink"
+
+// Missions, fences and rally points are stored but not flown
+type missionStore struct {
+	items []mavlink.MissionItemInt
+	// set while a ground station is uploading a mission
+	uploading []mavlink.MissionItemInt
+	expected  int
+}
+
+// Returns the store for a mission type, or nil if the simulator doesn't
+// support it. Must be called holding the lock.
+func (s *Simulator) missionStore(missionType uint8) *missionStore {
+	if missionType > mavlink.MAV_MISSION_TYPE_RALLY {
+		return nil
+	}
+	return &s.missions[missionType]
+}
+
+// Must be called holding the lock
+func (s *Simulator) handleMissionMessage(l *link, msg mavlink.DecodedMessage) {
+	var missionType uint8
+	var from mavlink.DecodedMavlinkMessage
+	switch m := msg.(type) {
+	case *mavlink.MissionCountMessage:
+		missionType, from = m.MissionType, m.DecodedMavlinkMessage
+	case *mavlink.MissionItemIntMessage:
+		missionType, from = m.MissionType, m.DecodedMavlinkMessage
+	case *mavlink.MissionRequestListMessage:
+		missionType, from = m.MissionType, m.DecodedMavlinkMessage
+	case *mavlink.MissionRequestMessage:
+		missionType, from = m.MissionType, m.DecodedMavlinkMessage
+	}
+	mission := s.missionStore(missionType)
+	if mission == nil {
+		s.reply(l, mavlink.MissionAck{
+			TargetSystem:    from.SystemID,
+			TargetComponent: from.ComponentID,
+			Type:            mavlink.MAV_MISSION_UNSUPPORTED,
+			MissionType:     missionType,
+		})
+		return
+	}
+
+	switch m := msg.(type) {
+	case *mavlink.MissionCountMessage:
+		mission.expected = int(m.Count)
+		mission.uploading = make([]mavlink.MissionItemInt, 0, m.Count)
+		if m.Count == 0 {
+			mission.items = nil
+			s.reply(l, mavlink.MissionAck{TargetSystem: m.SystemID, TargetComponent: m.ComponentID, MissionType: missionType})
+			return
+		}
+		s.reply(l, mavlink.MissionRequestInt{Seq: 0, TargetSystem: m.SystemID, TargetComponent: m.ComponentID, MissionType: missionType})
+
+	case *mavlink.MissionItemIntMessage:
+		if mission.uploading == nil || int(m.Seq) != len(mission.uploading) {
+			return
+		}
+		mission.uploading = append(mission.uploading, mavlink.MissionItemInt{
+			Param1:       m.Param1,
+			Param2:       m.Param2,
+			Param3:       m.Param3,
+			Param4:       m.Param4,
+			X:            m.X,
+			Y:            m.Y,
+			Z:            m.Z,
+			Seq:          m.Seq,
+			Command:      m.Command,
+			Frame:        m.Frame,
+			Current:      m.Current,
+			Autocontinue: m.Autocontinue,
+			MissionType:  missionType,
+		})
+		if len(mission.uploading) < mission.expected {
+			s.reply(l, mavlink.MissionRequestInt{
+				Seq:             uint16(len(mission.uploading)),
+				TargetSystem:    m.SystemID,
+				TargetComponent: m.ComponentID,
+				MissionType:     missionType,
+			})
+			return
+		}
+		mission.items = mission.uploading
+		mission.uploading = nil
+		s.reply(l, mavlink.MissionAck{
+			TargetSystem:    m.SystemID,
+			TargetComponent: m.ComponentID,
+			Type:            mavlink.MAV_MISSION_ACCEPTED,
+			MissionType:     missionType,
+		})
+
+	case *mavlink.MissionRequestListMessage:
+		s.reply(l, mavlink.MissionCount{
+			Count:           uint16(len(mission.items)),
+			TargetSystem:    m.SystemID,
+			TargetComponent: m.ComponentID,
+			MissionType:     missionType,
+		})
+
+	case *mavlink.MissionRequestMessage:
+		if int(m.Seq) >= len(mission.items) {
+			s.reply(l, mavlink.MissionAck{
+				TargetSystem:    m.SystemID,
+				TargetComponent: m.ComponentID,
+				Type:            mavlink.MAV_MISSION_INVALID_SEQUENCE,
+				MissionType:     missionType,
+			})
+			return
+		}
+		item := mission.items[m.Seq]
+		item.TargetSystem = m.SystemID
+		item.TargetComponent = m.ComponentID
+		s.reply(l, item)
+	}
+}
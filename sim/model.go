@@ -0,0 +1,430 @@
+package sim
+
+import (
+	"math"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// ArduCopter flight modes, reported as the heartbeat's custom mode
+const (
+	ModeStabilize = 0
+	ModeAltHold   = 2
+	ModeAuto      = 3
+	ModeGuided    = 4
+	ModeLoiter    = 5
+	ModeRTL       = 6
+	ModeLand      = 9
+	ModeBrake     = 17
+)
+
+// Force parameter that allows disarming in the air, as used by ArduPilot
+const forceDisarm = 21196
+
+const metersPerDegree = 111319.5
+
+// State is a snapshot of the simulated vehicle. Altitude is relative to home
+// and velocities are north, east and up in m/s.
+type State struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Heading   float64
+	VNorth    float64
+	VEast     float64
+	VUp       float64
+	Armed     bool
+	Landed    bool
+	Mode      uint32
+	Voltage   float64
+	Current   float64
+	Remaining float64
+	// external position estimates received as VISION_POSITION_ESTIMATE,
+	// VISION_SPEED_ESTIMATE or ODOMETRY
+	VisionEstimates int
+	// RTCM corrections received as GPS_RTCM_DATA, counting whole messages
+	// once every fragment has arrived
+	RTCMMessages int
+	RTCMBytes    int
+}
+
+// The kinematic model. The vehicle flies in straight lines at fixed speeds
+// towards a target, there are no dynamics or wind.
+type model struct {
+	state  State
+	config Config
+	// where the vehicle is heading while flying in guided or RTL
+	targetLat float64
+	targetLon float64
+	targetAlt float64
+	// velocity north, east and up commanded in guided, followed until it
+	// times out
+	velocityNorth   float64
+	velocityEast    float64
+	velocityUp      float64
+	velocityTimeout time.Duration
+	// consumed battery capacity in mAh
+	consumed float64
+	boot     time.Time
+	// status texts waiting to be sent
+	statusTexts []mavlink.StatusText
+	// MAV_SYS_STATUS_SENSOR bits reported as unhealthy, and the vibration
+	// and clipping the accelerometers report
+	sensorsUnhealthy uint32
+	vibration        [3]float64
+	clipping         bool
+	clips            uint32
+	// the GPS fix and satellites reported, and whether home has been set
+	gpsFix     uint8
+	satellites uint8
+	homeSet    bool
+	// when the last setpoint arrived, which PX4 needs to be recent to
+	// switch into OFFBOARD
+	lastSetpoint time.Time
+}
+
+func newModel(config Config) *model {
+	m := &model{
+		config: config,
+		boot:   time.Now(),
+		state: State{
+			Latitude:  config.HomeLatitude,
+			Longitude: config.HomeLongitude,
+			Landed:    true,
+			Mode:      ModeGuided,
+			Remaining: 100,
+		},
+		gpsFix:     mavlink.GPS_FIX_TYPE_3D_FIX,
+		satellites: simSatellites,
+	}
+	if m.px4() {
+		// PX4 holds position on the ground, it has no GUIDED
+		m.state.Mode = ModeLoiter
+	}
+	m.updateBattery()
+	m.updateHome()
+	return m
+}
+
+// Advances the model by dt
+func (m *model) step(dt time.Duration) {
+	seconds := dt.Seconds()
+	s := &m.state
+
+	switch {
+	case s.Landed:
+		s.VNorth, s.VEast, s.VUp = 0, 0, 0
+	case s.Mode == ModeLand:
+		m.hold()
+		m.descend(seconds)
+	case s.Mode == ModeRTL:
+		if m.distanceToTarget() > 1 || s.Altitude < m.targetAlt-0.5 {
+			m.flyToTarget(seconds)
+		} else {
+			m.hold()
+			m.descend(seconds)
+		}
+	case m.velocityTimeout > 0:
+		m.flyVelocity(seconds)
+		m.velocityTimeout -= dt
+		if m.velocityTimeout <= 0 {
+			// like ArduPilot, stop and hold once velocity commands stop
+			m.hold()
+			m.targetAlt = s.Altitude
+		}
+	default:
+		m.flyToTarget(seconds)
+	}
+
+	if s.Armed {
+		if s.Landed {
+			s.Current = m.config.IdleCurrent
+		} else {
+			s.Current = m.config.HoverCurrent
+		}
+	} else {
+		s.Current = 0
+	}
+	m.consumed += s.Current * seconds / 3.6
+	m.updateBattery()
+	m.updateHome()
+}
+
+func (m *model) updateBattery() {
+	s := &m.state
+	used := math.Min(m.consumed/m.config.BatteryCapacity, 1)
+	s.Remaining = math.Round(100 * (1 - used))
+	// a rough LiPo curve, sagging under load
+	s.Voltage = m.config.BatteryVoltage*(1-0.2*used) - 0.01*s.Current
+}
+
+func (m *model) hold() {
+	m.targetLat = m.state.Latitude
+	m.targetLon = m.state.Longitude
+}
+
+// Descends at the configured rate, touching down at home altitude
+func (m *model) descend(seconds float64) {
+	s := &m.state
+	s.VNorth, s.VEast = 0, 0
+	s.VUp = -m.config.DescentRate
+	s.Altitude += s.VUp * seconds
+	if s.Altitude <= 0 {
+		s.Altitude = 0
+		s.VUp = 0
+		s.Landed = true
+		// like ArduPilot, disarm as soon as the vehicle is on the ground
+		s.Armed = false
+	}
+}
+
+func (m *model) flyToTarget(seconds float64) {
+	s := &m.state
+	north, east := m.offsetToTarget()
+	distance := math.Hypot(north, east)
+
+	speed := math.Min(m.config.CruiseSpeed, distance/seconds)
+	if distance > 0.01 {
+		s.VNorth = speed * north / distance
+		s.VEast = speed * east / distance
+		s.Heading = math.Mod(math.Atan2(east, north)*180/math.Pi+360, 360)
+	} else {
+		s.VNorth, s.VEast = 0, 0
+	}
+
+	climb := m.targetAlt - s.Altitude
+	if climb > 0 {
+		s.VUp = math.Min(m.config.ClimbRate, climb/seconds)
+	} else {
+		s.VUp = math.Max(-m.config.DescentRate, climb/seconds)
+	}
+
+	s.Latitude += s.VNorth * seconds / metersPerDegree
+	s.Longitude += s.VEast * seconds / (metersPerDegree * math.Cos(s.Latitude*math.Pi/180))
+	s.Altitude += s.VUp * seconds
+}
+
+func (m *model) flyVelocity(seconds float64) {
+	s := &m.state
+	speed := math.Hypot(m.velocityNorth, m.velocityEast)
+	scale := 1.0
+	if speed > m.config.CruiseSpeed {
+		scale = m.config.CruiseSpeed / speed
+	}
+	s.VNorth = m.velocityNorth * scale
+	s.VEast = m.velocityEast * scale
+	s.VUp = math.Max(-m.config.DescentRate, math.Min(m.config.ClimbRate, m.velocityUp))
+	if speed > 0.01 {
+		s.Heading = math.Mod(math.Atan2(s.VEast, s.VNorth)*180/math.Pi+360, 360)
+	}
+
+	s.Latitude += s.VNorth * seconds / metersPerDegree
+	s.Longitude += s.VEast * seconds / (metersPerDegree * math.Cos(s.Latitude*math.Pi/180))
+	s.Altitude = math.Max(0, s.Altitude+s.VUp*seconds)
+}
+
+// North and east distance in meters from the vehicle to its target
+func (m *model) offsetToTarget() (float64, float64) {
+	s := m.state
+	north := (m.targetLat - s.Latitude) * metersPerDegree
+	east := (m.targetLon - s.Longitude) * metersPerDegree * math.Cos(s.Latitude*math.Pi/180)
+	return north, east
+}
+
+func (m *model) distanceToTarget() float64 {
+	north, east := m.offsetToTarget()
+	return math.Hypot(north, east)
+}
+
+// Acts on a command sent to the vehicle and returns the MAV_RESULT for it
+func (m *model) handleCommand(cmd *mavlink.CommandLongMessage) uint8 {
+	s := &m.state
+	switch cmd.Command {
+	case mavlink.MAV_CMD_COMPONENT_ARM_DISARM:
+		if cmd.Param1 == 1 {
+			return m.arm()
+		}
+		if !s.Landed && cmd.Param2 != forceDisarm {
+			return mavlink.MAV_RESULT_DENIED
+		}
+		s.Armed = false
+		if !s.Landed {
+			// falls out of the sky
+			s.Altitude = 0
+			s.Landed = true
+		}
+		m.say(mavlink.MAV_SEVERITY_INFO, "Disarming motors")
+		return mavlink.MAV_RESULT_ACCEPTED
+
+	case mavlink.MAV_CMD_NAV_TAKEOFF:
+		if m.px4() {
+			return m.px4Takeoff(cmd)
+		}
+		if !s.Armed || !s.Landed || s.Mode != ModeGuided || cmd.Param7 <= 0 {
+			return mavlink.MAV_RESULT_FAILED
+		}
+		s.Landed = false
+		m.hold()
+		m.targetAlt = float64(cmd.Param7)
+		return mavlink.MAV_RESULT_ACCEPTED
+
+	case mavlink.MAV_CMD_DO_SET_MODE:
+		if uint8(cmd.Param1)&mavlink.MAV_MODE_FLAG_CUSTOM_MODE_ENABLED == 0 {
+			return mavlink.MAV_RESULT_UNSUPPORTED
+		}
+		if m.px4() {
+			return m.px4SetMode(uint32(cmd.Param2), uint32(cmd.Param3))
+		}
+		return m.setMode(uint32(cmd.Param2))
+
+	case mavlink.MAV_CMD_NAV_LAND:
+		return m.setMode(ModeLand)
+
+	case mavlink.MAV_CMD_NAV_RETURN_TO_LAUNCH:
+		return m.setMode(ModeRTL)
+
+	default:
+		return mavlink.MAV_RESULT_UNSUPPORTED
+	}
+}
+
+func (m *model) arm() uint8 {
+	s := &m.state
+	if s.Armed {
+		return mavlink.MAV_RESULT_ACCEPTED
+	}
+	if s.Mode != ModeGuided && s.Mode != ModeStabilize && s.Mode != ModeAltHold && s.Mode != ModeLoiter {
+		m.say(mavlink.MAV_SEVERITY_CRITICAL, "Arm: Mode not armable")
+		return mavlink.MAV_RESULT_DENIED
+	}
+	if m.gpsFix < mavlink.GPS_FIX_TYPE_3D_FIX {
+		m.say(mavlink.MAV_SEVERITY_CRITICAL, "PreArm: GPS 1: Bad fix")
+		return mavlink.MAV_RESULT_FAILED
+	}
+	s.Armed = true
+	m.say(mavlink.MAV_SEVERITY_INFO, "Arming motors")
+	return mavlink.MAV_RESULT_ACCEPTED
+}
+
+// Queues a status text to be sent
+func (m *model) say(severity uint8, text string) {
+	msg := mavlink.StatusText{Severity: severity}
+	copy(msg.Text[:], text)
+	m.statusTexts = append(m.statusTexts, msg)
+}
+
+func (m *model) setMode(mode uint32) uint8 {
+	s := &m.state
+	m.velocityTimeout = 0
+	switch mode {
+	case ModeStabilize, ModeAltHold, ModeGuided, ModeLoiter, ModeBrake:
+		m.hold()
+		m.targetAlt = s.Altitude
+	case ModeRTL:
+		m.targetLat = m.config.HomeLatitude
+		m.targetLon = m.config.HomeLongitude
+		m.targetAlt = math.Max(s.Altitude, m.config.RTLAltitude)
+	case ModeLand:
+	default:
+		return mavlink.MAV_RESULT_UNSUPPORTED
+	}
+	s.Mode = mode
+	return mavlink.MAV_RESULT_ACCEPTED
+}
+
+func (m *model) heartbeat() mavlink.Heartbeat {
+	s := m.state
+	baseMode := uint8(mavlink.MAV_MODE_FLAG_CUSTOM_MODE_ENABLED | mavlink.MAV_MODE_FLAG_STABILIZE_ENABLED | mavlink.MAV_MODE_FLAG_MANUAL_INPUT_ENABLED)
+	if s.Mode == ModeGuided || s.Mode == ModeAuto || s.Mode == ModeRTL || s.Mode == ModeLand {
+		baseMode |= mavlink.MAV_MODE_FLAG_GUIDED_ENABLED
+	}
+	systemStatus := uint8(mavlink.MAV_STATE_STANDBY)
+	if s.Armed {
+		baseMode |= mavlink.MAV_MODE_FLAG_SAFETY_ARMED
+		systemStatus = mavlink.MAV_STATE_ACTIVE
+	}
+	customMode := s.Mode
+	if m.px4() {
+		customMode = px4CustomModes[s.Mode]
+	}
+	return mavlink.Heartbeat{
+		CustomMode:     customMode,
+		Type:           m.config.Airframe,
+		Autopilot:      m.config.Autopilot,
+		BaseMode:       baseMode,
+		SystemStatus:   systemStatus,
+		MavlinkVersion: 3,
+	}
+}
+
+func (m *model) globalPositionInt() mavlink.GlobalPositionInt {
+	s := m.state
+	return mavlink.GlobalPositionInt{
+		TimeBootMs:  uint32(time.Since(m.boot).Milliseconds()),
+		Lat:         int32(math.Round(s.Latitude * 1e7)),
+		Lon:         int32(math.Round(s.Longitude * 1e7)),
+		Alt:         int32(math.Round((m.config.HomeAltitude + s.Altitude) * 1000)),
+		RelativeAlt: int32(math.Round(s.Altitude * 1000)),
+		Vx:          int16(math.Round(s.VNorth * 100)),
+		Vy:          int16(math.Round(s.VEast * 100)),
+		Vz:          int16(math.Round(-s.VUp * 100)),
+		Hdg:         uint16(math.Round(s.Heading * 100)),
+	}
+}
+
+func (m *model) vfrHud() mavlink.VfrHud {
+	s := m.state
+	groundspeed := math.Hypot(s.VNorth, s.VEast)
+	throttle := uint16(0)
+	if s.Armed && !s.Landed {
+		throttle = 50
+	}
+	return mavlink.VfrHud{
+		Airspeed:    float32(groundspeed),
+		Groundspeed: float32(groundspeed),
+		Alt:         float32(m.config.HomeAltitude + s.Altitude),
+		Climb:       float32(s.VUp),
+		Heading:     int16(math.Round(s.Heading)),
+		Throttle:    throttle,
+	}
+}
+
+func (m *model) sysStatus() mavlink.SysStatus {
+	s := m.state
+	return mavlink.SysStatus{
+		SensorsPresent:   simSensors,
+		SensorsEnabled:   simSensors,
+		SensorsHealth:    m.sensorsHealth(),
+		Load:             200,
+		VoltageBattery:   uint16(math.Round(s.Voltage * 1000)),
+		CurrentBattery:   int16(math.Round(s.Current * 100)),
+		BatteryRemaining: int8(s.Remaining),
+	}
+}
+
+func (m *model) extendedSysState() mavlink.ExtendedSysState {
+	s := m.state
+	landedState := uint8(mavlink.MAV_LANDED_STATE_IN_AIR)
+	switch {
+	case s.Landed:
+		landedState = mavlink.MAV_LANDED_STATE_ON_GROUND
+	case s.Mode == ModeLand:
+		landedState = mavlink.MAV_LANDED_STATE_LANDING
+	}
+	return mavlink.ExtendedSysState{LandedState: landedState}
+}
+
+// A healthy EKF with GPS, which is all the model has
+func (m *model) ekfStatusReport() mavlink.EkfStatusReport {
+	return mavlink.EkfStatusReport{
+		VelocityVariance:   0.05,
+		PosHorizVariance:   0.03,
+		PosVertVariance:    0.04,
+		CompassVariance:    0.02,
+		TerrainAltVariance: 0,
+		Flags: mavlink.EKF_ATTITUDE | mavlink.EKF_VELOCITY_HORIZ | mavlink.EKF_VELOCITY_VERT |
+			mavlink.EKF_POS_HORIZ_REL | mavlink.EKF_POS_HORIZ_ABS | mavlink.EKF_POS_VERT_ABS |
+			mavlink.EKF_PRED_POS_HORIZ_REL | mavlink.EKF_PRED_POS_HORIZ_ABS,
+	}
+}
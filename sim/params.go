@@ -0,0 +1,78 @@
+package sim
+
+import (
+	"sort"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// A handful of ArduCopter parameters so that parameter tooling has something
+// to work with. They don't change how the simulation behaves.
+func defaultParams(config Config) map[string]float32 {
+	return map[string]float32{
+		"SYSID_THISMAV":  float32(config.SystemID),
+		"SYSID_MYGCS":    255,
+		"ARMING_CHECK":   1,
+		"BATT_CAPACITY":  float32(config.BatteryCapacity),
+		"FENCE_ENABLE":   0,
+		"PILOT_SPEED_UP": float32(config.ClimbRate * 100),
+		"RTL_ALT":        float32(config.RTLAltitude * 100),
+		"WPNAV_SPEED":    float32(config.CruiseSpeed * 100),
+		"WPNAV_SPEED_DN": float32(config.DescentRate * 100),
+	}
+}
+
+// Parameter names in index order
+func (s *Simulator) paramNames() []string {
+	names := make([]string, 0, len(s.params))
+	for name := range s.params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Must be called holding the lock
+func (s *Simulator) paramValue(names []string, index int) mavlink.ParamValue {
+	name := names[index]
+	return mavlink.ParamValue{
+		ParamValue: s.params[name],
+		ParamCount: uint16(len(names)),
+		ParamIndex: uint16(index),
+		ParamID:    mavlink.NewParamID(name),
+		ParamType:  mavlink.MAV_PARAM_TYPE_REAL32,
+	}
+}
+
+// Must be called holding the lock
+func (s *Simulator) handleParamMessage(l *link, msg mavlink.DecodedMessage) {
+	names := s.paramNames()
+	indexOf := func(name string) int {
+		i := sort.SearchStrings(names, name)
+		if i < len(names) && names[i] == name {
+			return i
+		}
+		return -1
+	}
+
+	switch m := msg.(type) {
+	case *mavlink.ParamRequestListMessage:
+		for i := range names {
+			s.reply(l, s.paramValue(names, i))
+		}
+	case *mavlink.ParamRequestReadMessage:
+		index := int(m.ParamIndex)
+		if index < 0 {
+			index = indexOf(m.ParamID.String())
+		}
+		if index >= 0 && index < len(names) {
+			s.reply(l, s.paramValue(names, index))
+		}
+	case *mavlink.ParamSetMessage:
+		name := m.ParamID.String()
+		if index := indexOf(name); index >= 0 {
+			s.params[name] = m.ParamValue
+			s.reply(l, s.paramValue(names, index))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package sim
+
+import (
+	"math"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// Autopilots the simulator can behave like, for Config.Autopilot
+const (
+	AutopilotArduPilot = mavlink.MAV_AUTOPILOT_ARDUPILOTMEGA
+	AutopilotPX4       = mavlink.MAV_AUTOPILOT_PX4
+)
+
+const (
+	// How high PX4 takes off when no altitude is given, its MIS_TAKEOFF_ALT
+	px4DefaultTakeoffAltitude = 2.5
+	// How recent a setpoint has to be for PX4 to switch into OFFBOARD, its
+	// COM_OF_LOSS_T
+	px4OffboardTimeout = time.Second
+)
+
+// The PX4 custom modes reported for the model's modes. PX4 has no GUIDED, its
+// nearest is OFFBOARD, which follows setpoints.
+var px4CustomModes = map[uint32]uint32{
+	ModeStabilize: 7 << 16,       // STABILIZED
+	ModeAltHold:   2 << 16,       // ALTCTL
+	ModeAuto:      4<<16 | 4<<24, // AUTO.MISSION
+	ModeGuided:    6 << 16,       // OFFBOARD
+	ModeLoiter:    4<<16 | 3<<24, // AUTO.LOITER
+	ModeRTL:       4<<16 | 5<<24, // AUTO.RTL
+	ModeLand:      4<<16 | 6<<24, // AUTO.LAND
+}
+
+func (m *model) px4() bool {
+	return m.config.Autopilot == AutopilotPX4
+}
+
+// Takes off the way PX4 does, to an altitude above mean sea level or its
+// default height if that is NaN, and holds there once it is reached
+func (m *model) px4Takeoff(cmd *mavlink.CommandLongMessage) uint8 {
+	s := &m.state
+	if !s.Armed || !s.Landed {
+		return mavlink.MAV_RESULT_FAILED
+	}
+	altitude := px4DefaultTakeoffAltitude
+	if !math.IsNaN(float64(cmd.Param7)) {
+		altitude = float64(cmd.Param7) - m.config.HomeAltitude
+	}
+	if altitude <= 0 {
+		return mavlink.MAV_RESULT_FAILED
+	}
+	s.Landed = false
+	s.Mode = ModeLoiter
+	m.hold()
+	m.targetAlt = altitude
+	return mavlink.MAV_RESULT_ACCEPTED
+}
+
+// Switches into the model's mode for a PX4 main and sub mode, refusing
+// OFFBOARD unless setpoints are already arriving as PX4 does
+func (m *model) px4SetMode(mainMode uint32, subMode uint32) uint8 {
+	customMode := mainMode<<16 | subMode<<24
+	for mode, px4Mode := range px4CustomModes {
+		if px4Mode != customMode {
+			continue
+		}
+		if mode == ModeGuided && time.Since(m.lastSetpoint) > px4OffboardTimeout {
+			return mavlink.MAV_RESULT_DENIED
+		}
+		return m.setMode(mode)
+	}
+	return mavlink.MAV_RESULT_UNSUPPORTED
+}
@@ -0,0 +1,115 @@
+package sim
+
+import (
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// Channels the simulated receiver has
+	rcReceiverChannels = 16
+	// How long an override lasts without being repeated, ArduPilot's
+	// default RC_OVERRIDE_TIME
+	rcOverrideTimeout = 3 * time.Second
+	// Motor outputs on the ground, armed but idle and at hover
+	pwmMotorStopped = 1000
+	pwmMotorIdle    = 1100
+	pwmMotorHover   = 1500
+)
+
+// What the simulated transmitter sends with the sticks centred and the
+// throttle down
+func rcNeutral(channel int) uint16 {
+	switch channel {
+	case 0, 1, 3:
+		return 1500
+	default:
+		return 1000
+	}
+}
+
+type rcOverride struct {
+	pwm      [mavlink.RC_CHANNELS_MAX]uint16
+	received [mavlink.RC_CHANNELS_MAX]time.Time
+}
+
+// Must be called holding the lock
+func (s *Simulator) handleRCOverride(msg *mavlink.RcChannelsOverrideMessage) {
+	if msg.TargetSystem != 0 && msg.TargetSystem != s.config.SystemID {
+		return
+	}
+	now := time.Now()
+	for i, value := range msg.Chan {
+		basic := i < mavlink.RC_CHANNELS_OVERRIDE_BASIC
+		switch {
+		case basic && value == mavlink.RC_OVERRIDE_IGNORE, !basic && value == mavlink.RC_OVERRIDE_IGNORE_EXT:
+		case basic && value == mavlink.RC_OVERRIDE_RELEASE, !basic && value == mavlink.RC_OVERRIDE_RELEASE_EXT:
+			s.rcOverride.pwm[i] = 0
+		default:
+			s.rcOverride.pwm[i] = value
+			s.rcOverride.received[i] = now
+		}
+	}
+}
+
+// MANUAL_CONTROL is applied as an override of the roll, pitch, throttle and
+// yaw channels, like ArduPilot does. Must be called holding the lock.
+func (s *Simulator) handleManualControl(msg *mavlink.ManualControlMessage) {
+	if msg.Target != 0 && msg.Target != s.config.SystemID {
+		return
+	}
+	now := time.Now()
+	set := func(channel int, value int16, pwm uint16) {
+		if value != mavlink.MANUAL_CONTROL_AXIS_UNUSED {
+			s.rcOverride.pwm[channel] = pwm
+			s.rcOverride.received[channel] = now
+		}
+	}
+	// pushing the stick forward lowers the pitch channel
+	set(0, msg.Y, uint16(1500+int(msg.Y)/2))
+	set(1, msg.X, uint16(1500-int(msg.X)/2))
+	set(2, msg.Z, uint16(1000+int(msg.Z)))
+	set(3, msg.R, uint16(1500+int(msg.R)/2))
+}
+
+// Must be called holding the lock
+func (s *Simulator) rcChannels() mavlink.RcChannels {
+	msg := mavlink.RcChannels{
+		TimeBootMs: uint32(time.Since(s.model.boot).Milliseconds()),
+		ChanCount:  rcReceiverChannels,
+		Rssi:       mavlink.RC_RSSI_UNKNOWN,
+	}
+	now := time.Now()
+	for i := range msg.Chan {
+		switch {
+		case s.rcOverride.pwm[i] != 0 && now.Sub(s.rcOverride.received[i]) < rcOverrideTimeout:
+			msg.Chan[i] = s.rcOverride.pwm[i]
+			msg.ChanCount = max(msg.ChanCount, uint8(i+1))
+		case i < rcReceiverChannels:
+			msg.Chan[i] = rcNeutral(i)
+		default:
+			msg.Chan[i] = mavlink.RC_OVERRIDE_IGNORE
+		}
+	}
+	return msg
+}
+
+// Must be called holding the lock
+func (s *Simulator) servoOutputRaw() mavlink.ServoOutputRaw {
+	state := s.model.state
+	motor := uint16(pwmMotorStopped)
+	if state.Armed {
+		motor = pwmMotorIdle
+		if !state.Landed {
+			motor = pwmMotorHover
+		}
+	}
+	msg := mavlink.ServoOutputRaw{
+		TimeUsec: uint32(time.Since(s.model.boot).Microseconds()),
+	}
+	for i := 0; i < 4; i++ {
+		msg.Servo[i] = motor
+	}
+	return msg
+}
@@ -0,0 +1,41 @@
+package sim
+
+import "github.com/arducrow/go-mavcom/internal/mavlink"
+
+// A fragmented RTCM message being put back together, as ArduPilot does
+// before passing it on to the GPS
+type rtcmAssembly struct {
+	sequence int
+	// which fragments have arrived, and how many there are once the last,
+	// which isn't full, has arrived
+	received  uint8
+	fragments int
+	length    int
+}
+
+// Handles GPS_RTCM_DATA, counting each whole message. Must be called
+// holding the lock.
+func (s *Simulator) handleRTCMData(msg *mavlink.GpsRtcmDataMessage) {
+	if !msg.Fragmented() {
+		s.model.state.RTCMMessages++
+		s.model.state.RTCMBytes += len(msg.Data)
+		return
+	}
+	a := &s.rtcm
+	fragment := msg.FragmentID()
+	// a new message, or a fragment seen already meaning the last message
+	// never finished
+	if a.received == 0 || a.sequence != msg.SequenceID() || a.received&(1<<fragment) != 0 {
+		*a = rtcmAssembly{sequence: msg.SequenceID()}
+	}
+	a.received |= 1 << fragment
+	a.length += len(msg.Data)
+	if len(msg.Data) < mavlink.GPS_RTCM_DATA_LEN {
+		a.fragments = fragment + 1
+	}
+	if a.fragments > 0 && a.received == 1<<a.fragments-1 {
+		s.model.state.RTCMMessages++
+		s.model.state.RTCMBytes += a.length
+		*a = rtcmAssembly{}
+	}
+}
@@ -0,0 +1,58 @@
+package sim
+
+import (
+	"math"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How long a velocity setpoint is followed for before the vehicle stops, as
+// ArduCopter does in guided
+const velocityTimeout = 3 * time.Second
+
+const (
+	positionIgnore = mavlink.POSITION_TARGET_TYPEMASK_X_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_Y_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_Z_IGNORE
+	velocityIgnore = mavlink.POSITION_TARGET_TYPEMASK_VX_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_VY_IGNORE | mavlink.POSITION_TARGET_TYPEMASK_VZ_IGNORE
+)
+
+// Follows a position or velocity setpoint while flying in guided. Positions
+// in the local frame are relative to home. Acceleration and yaw are ignored.
+func (m *model) handleSetpoint(typeMask uint16, lat float64, lon float64, alt float64, vNorth float64, vEast float64, vDown float64) {
+	s := &m.state
+	m.lastSetpoint = time.Now()
+	if !s.Armed || s.Landed || s.Mode != ModeGuided {
+		return
+	}
+	switch {
+	case typeMask&positionIgnore == 0:
+		m.velocityTimeout = 0
+		m.targetLat = lat
+		m.targetLon = lon
+		m.targetAlt = alt
+	case typeMask&velocityIgnore == 0:
+		m.velocityNorth = vNorth
+		m.velocityEast = vEast
+		m.velocityUp = -vDown
+		m.velocityTimeout = velocityTimeout
+	}
+}
+
+// Must be called holding the lock
+func (s *Simulator) handleSetpointMessage(msg mavlink.DecodedMessage) {
+	switch m := msg.(type) {
+	case *mavlink.SetPositionTargetLocalNedMessage:
+		if m.TargetSystem != s.config.SystemID || m.CoordinateFrame != mavlink.MAV_FRAME_LOCAL_NED {
+			return
+		}
+		lat := s.config.HomeLatitude + float64(m.X)/metersPerDegree
+		lon := s.config.HomeLongitude + float64(m.Y)/(metersPerDegree*math.Cos(s.config.HomeLatitude*math.Pi/180))
+		s.model.handleSetpoint(m.TypeMask, lat, lon, -float64(m.Z), float64(m.Vx), float64(m.Vy), float64(m.Vz))
+	case *mavlink.SetPositionTargetGlobalIntMessage:
+		if m.TargetSystem != s.config.SystemID || m.CoordinateFrame != mavlink.MAV_FRAME_GLOBAL_RELATIVE_ALT_INT {
+			return
+		}
+		s.model.handleSetpoint(m.TypeMask, float64(m.LatInt)/1e7, float64(m.LonInt)/1e7, float64(m.Alt),
+			float64(m.Vx), float64(m.Vy), float64(m.Vz))
+	}
+}
@@ -0,0 +1,427 @@
+// Package sim provides a lightweight simulated autopilot that speaks MAVLink,
+// so that a Vehicle can be exercised without hardware or SITL.
+//
+//	s := sim.NewSimulator(sim.DefaultConfig())
+//	defer s.Close()
+//	v := mavcom.NewVehicleFromTransport(s.Connect())
+//	v.Start()
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+type Config struct {
+	SystemID    uint8
+	ComponentID uint8
+	Airframe    uint8 // MAV_TYPE reported in the heartbeat
+	// MAV_AUTOPILOT reported in the heartbeat. With AutopilotPX4 the
+	// simulator uses PX4's flight modes and takeoff altitudes, otherwise
+	// ArduCopter's.
+	Autopilot uint8
+
+	HomeLatitude  float64
+	HomeLongitude float64
+	HomeAltitude  float64 // meters above mean sea level
+	RTLAltitude   float64 // meters above home
+
+	ClimbRate   float64 // m/s
+	DescentRate float64 // m/s
+	CruiseSpeed float64 // m/s
+
+	BatteryVoltage  float64 // volts when full
+	BatteryCapacity float64 // mAh
+	IdleCurrent     float64 // amps drawn while armed on the ground
+	HoverCurrent    float64 // amps drawn while flying
+
+	// How often position, VFR_HUD, SYS_STATUS and EXTENDED_SYS_STATE are
+	// sent until a ground station asks for something different. The
+	// heartbeat is sent once a second.
+	TelemetryRate time.Duration
+
+	// Where errors on the simulator's links are reported, slog.Default() if
+	// nil
+	Logger *slog.Logger
+}
+
+// A quadcopter sitting at the ArduPilot SITL default location
+func DefaultConfig() Config {
+	return Config{
+		SystemID:        1,
+		ComponentID:     1,
+		Airframe:        2,
+		Autopilot:       AutopilotArduPilot,
+		HomeLatitude:    -35.3632621,
+		HomeLongitude:   149.1652374,
+		HomeAltitude:    584,
+		RTLAltitude:     15,
+		ClimbRate:       2.5,
+		DescentRate:     1.5,
+		CruiseSpeed:     5,
+		BatteryVoltage:  16.8,
+		BatteryCapacity: 5000,
+		IdleCurrent:     1,
+		HoverCurrent:    15,
+		TelemetryRate:   100 * time.Millisecond,
+	}
+}
+
+// Simulator runs the vehicle model and talks to any number of links. Every
+// link receives all telemetry and commands can arrive from any of them.
+type Simulator struct {
+	config    Config
+	model     *model
+	encoder   *mavlink.Encoder
+	seqNumber uint8
+	links     map[*link]bool
+	listeners []net.Listener
+	params    map[string]float32
+	// by mission type
+	missions [mavlink.MAV_MISSION_TYPE_RALLY + 1]missionStore
+	ftp      ftpServer
+	// the log being sent, if any
+	logTransfer *logTransfer
+	rcOverride  rcOverride
+	gimbal      gimbal
+	camera      camera
+	traffic     traffic
+	rtcm        rtcmAssembly
+	intervals   map[int]time.Duration
+	lastSent    map[int]time.Time
+	closed      bool
+	done        chan struct{}
+	lock        sync.Mutex
+}
+
+// A connection to a ground station. Frames are queued and written by their
+// own goroutine so that a slow reader never stalls the simulation, like a
+// radio they are dropped if the queue fills up.
+type link struct {
+	conn   io.ReadWriteCloser
+	frames chan []byte
+}
+
+func NewSimulator(config Config) *Simulator {
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	s := &Simulator{
+		config: config,
+		model:  newModel(config),
+		links:  make(map[*link]bool),
+		done:   make(chan struct{}),
+		params: defaultParams(config),
+		ftp:    newFTPServer(),
+		// intervals are shared by every link, like a real autopilot with a
+		// single telemetry port
+		intervals: defaultIntervals(config),
+		lastSent:  make(map[int]time.Time),
+	}
+	s.encoder = mavlink.NewEncoder()
+	s.encoder.MavComInterface = s
+	s.camera.encoder = mavlink.NewEncoder()
+	s.camera.encoder.MavComInterface = &s.camera
+	go s.run()
+	return s
+}
+
+func (s *Simulator) GetSequenceNumber() uint8 {
+	return s.seqNumber
+}
+
+func (s *Simulator) IncrementSequenceNumber() {
+	s.seqNumber++
+}
+
+// Returns one end of an in-memory connection to the simulator, ready to be
+// used as a vehicle's transport
+func (s *Simulator) Connect() net.Conn {
+	simEnd, vehicleEnd := net.Pipe()
+	s.Serve(simEnd)
+	return vehicleEnd
+}
+
+// Accepts TCP connections on address (e.g. "127.0.0.1:5760") until the
+// simulator is closed, so that other programs can connect to it
+func (s *Simulator) ListenTCP(address string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		listener.Close()
+		return nil, net.ErrClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	s.lock.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.Serve(conn)
+		}
+	}()
+	return listener.Addr(), nil
+}
+
+// Starts talking MAVLink over an existing connection
+func (s *Simulator) Serve(conn io.ReadWriteCloser) {
+	l := &link{conn: conn, frames: make(chan []byte, 256)}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		conn.Close()
+		return
+	}
+	s.links[l] = true
+	s.lock.Unlock()
+
+	go s.writeLink(l)
+	go s.readLink(l)
+}
+
+// Returns a snapshot of the simulated vehicle's state
+func (s *Simulator) State() State {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.model.state
+}
+
+// Stops the simulation and closes every link
+func (s *Simulator) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for l := range s.links {
+		s.dropLink(l)
+	}
+	return nil
+}
+
+// Must be called holding the lock
+func (s *Simulator) dropLink(l *link) {
+	if !s.links[l] {
+		return
+	}
+	delete(s.links, l)
+	close(l.frames)
+	l.conn.Close()
+}
+
+func (s *Simulator) run() {
+	ticker := time.NewTicker(stepInterval)
+	defer ticker.Stop()
+	last := time.Now()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.lock.Lock()
+			s.model.step(now.Sub(last))
+			s.stepGimbal(now.Sub(last))
+			s.stepTraffic(now.Sub(last), now)
+			last = now
+			s.sendTelemetry(now)
+			s.stepCamera(now)
+			s.sendStatusTexts()
+			s.sendLogData()
+			s.lock.Unlock()
+		}
+	}
+}
+
+// Queues a message on every link. Must be called holding the lock.
+func (s *Simulator) broadcast(msg mavlink.MavlinkMessage) {
+	s.broadcastFrame(s.encode(msg))
+}
+
+// Must be called holding the lock
+func (s *Simulator) broadcastFrame(frame []byte) {
+	if frame == nil {
+		return
+	}
+	for l := range s.links {
+		s.queue(l, frame)
+	}
+}
+
+// Encodes a message from the autopilot, returning nil if it can't be. Must
+// be called holding the lock.
+func (s *Simulator) encode(msg mavlink.MavlinkMessage) []byte {
+	return s.encodeFrom(s.encoder, s.config.ComponentID, msg)
+}
+
+// Must be called holding the lock
+func (s *Simulator) encodeFrom(encoder *mavlink.Encoder, componentID uint8, msg mavlink.MavlinkMessage) []byte {
+	var buf bytes.Buffer
+	if err := encoder.EncodePacket(&buf, s.config.SystemID, componentID, msg); err != nil {
+		s.config.Logger.Error("error encoding simulator message", "err", err)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// Must be called holding the lock
+func (s *Simulator) queue(l *link, frame []byte) {
+	select {
+	case l.frames <- frame:
+	default:
+	}
+}
+
+func (s *Simulator) writeLink(l *link) {
+	for frame := range l.frames {
+		if _, err := l.conn.Write(frame); err != nil {
+			break
+		}
+	}
+	s.lock.Lock()
+	s.dropLink(l)
+	s.lock.Unlock()
+}
+
+func (s *Simulator) readLink(l *link) {
+	frameReader := mavlink.NewFrameReader(l.conn)
+	for {
+		frame, err := frameReader.ReadFrame()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) && !errors.Is(err, net.ErrClosed) {
+				s.config.Logger.Warn("error reading from simulator link", "err", err)
+			}
+			s.lock.Lock()
+			s.dropLink(l)
+			s.lock.Unlock()
+			return
+		}
+		raw, err := mavlink.NewRawMessage(frame)
+		if err != nil {
+			continue
+		}
+		decoded, err := mavlink.DecodeMessage(raw)
+		if err != nil {
+			continue
+		}
+		s.handleMessage(l, decoded)
+	}
+}
+
+func (s *Simulator) handleMessage(l *link, msg mavlink.DecodedMessage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch m := msg.(type) {
+	case *mavlink.CommandLongMessage:
+		if m.TargetSystem != 0 && m.TargetSystem != s.config.SystemID {
+			return
+		}
+		if m.TargetComponent == simCameraComponentID {
+			s.handleCameraCommand(l, m)
+			return
+		}
+		if m.TargetComponent == 0 && isCameraRequest(m) {
+			// every component answers commands addressed to all of them
+			s.handleCameraCommand(l, m)
+		}
+		var result uint8
+		// sent after the acknowledgement, like ArduPilot
+		var requested mavlink.MavlinkMessage
+		switch m.Command {
+		case mavlink.MAV_CMD_SET_MESSAGE_INTERVAL:
+			result = s.setMessageInterval(m)
+		case mavlink.MAV_CMD_REQUEST_MESSAGE:
+			result, requested = s.requestMessage(int(m.Param1))
+		case mavlink.MAV_CMD_REQUEST_AUTOPILOT_CAPABILITIES:
+			result, requested = s.requestMessage(mavlink.MAVLINK_MSG_ID_AUTOPILOT_VERSION)
+		case mavlink.MAV_CMD_DO_GIMBAL_MANAGER_PITCHYAW, mavlink.MAV_CMD_DO_GIMBAL_MANAGER_CONFIGURE,
+			mavlink.MAV_CMD_DO_SET_ROI_LOCATION, mavlink.MAV_CMD_DO_SET_ROI_NONE, mavlink.MAV_CMD_DO_SET_ROI_SYSID:
+			result = s.handleGimbalCommand(m)
+		default:
+			result = s.model.handleCommand(m)
+		}
+		s.reply(l, mavlink.CommandAck{Command: m.Command, Result: result, TargetSystem: m.SystemID, TargetComponent: m.ComponentID})
+		if requested != nil {
+			s.reply(l, requested)
+		}
+	case *mavlink.CommandIntMessage:
+		if m.TargetSystem != 0 && m.TargetSystem != s.config.SystemID {
+			return
+		}
+		s.reply(l, mavlink.CommandAck{Command: m.Command, Result: s.handleCommandInt(m), TargetSystem: m.SystemID, TargetComponent: m.ComponentID})
+	case *mavlink.RequestDataStreamMessage:
+		if m.TargetSystem == 0 || m.TargetSystem == s.config.SystemID {
+			s.requestDataStream(m)
+		}
+	case *mavlink.ParamRequestListMessage, *mavlink.ParamRequestReadMessage, *mavlink.ParamSetMessage:
+		s.handleParamMessage(l, msg)
+	case *mavlink.SetPositionTargetLocalNedMessage, *mavlink.SetPositionTargetGlobalIntMessage:
+		s.handleSetpointMessage(msg)
+	case *mavlink.RcChannelsOverrideMessage:
+		s.handleRCOverride(m)
+	case *mavlink.ManualControlMessage:
+		s.handleManualControl(m)
+	case *mavlink.GimbalManagerSetPitchyawMessage:
+		s.handleGimbalSetPitchyaw(m)
+	case *mavlink.GimbalManagerSetAttitudeMessage:
+		s.handleGimbalSetAttitude(m)
+	case *mavlink.MissionCountMessage, *mavlink.MissionItemIntMessage,
+		*mavlink.MissionRequestListMessage, *mavlink.MissionRequestMessage:
+		s.handleMissionMessage(l, msg)
+	case *mavlink.FileTransferProtocolMessage:
+		s.handleFTPMessage(l, m)
+	case *mavlink.VisionPositionEstimateMessage, *mavlink.VisionSpeedEstimateMessage, *mavlink.OdometryMessage:
+		s.model.state.VisionEstimates++
+	case *mavlink.GpsRtcmDataMessage:
+		s.handleRTCMData(m)
+	case *mavlink.TimeSyncMessage:
+		// answered with the time since boot, the clock TimeBootMs counts
+		if m.Tc1 == 0 && (m.TargetSystem == 0 || m.TargetSystem == s.config.SystemID) {
+			s.reply(l, mavlink.TimeSync{
+				Tc1:             time.Since(s.model.boot).Nanoseconds(),
+				Ts1:             m.Ts1,
+				TargetSystem:    m.SystemID,
+				TargetComponent: m.ComponentID,
+			})
+		}
+	case *mavlink.LogRequestListMessage, *mavlink.LogRequestDataMessage, *mavlink.LogTargetMessage:
+		s.handleLogMessage(l, msg)
+	}
+}
+
+// Sends a message back over the link a request came in on. Must be called
+// holding the lock.
+func (s *Simulator) reply(l *link, msg mavlink.MavlinkMessage) {
+	s.replyFrame(l, s.encode(msg))
+}
+
+// Must be called holding the lock
+func (s *Simulator) replyFrame(l *link, frame []byte) {
+	if frame == nil {
+		return
+	}
+	if s.links[l] {
+		s.queue(l, frame)
+	}
+}
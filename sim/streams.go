@@ -0,0 +1,175 @@
+package sim
+
+import (
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How often the simulation steps and checks whether telemetry is due, which
+// is also the shortest interval a message can be sent at
+const stepInterval = 10 * time.Millisecond
+
+// Legacy data streams and the messages in them
+var dataStreams = map[uint8][]int{
+	mavlink.MAV_DATA_STREAM_EXTENDED_STATUS: {mavlink.MAVLINK_MSG_ID_SYS_STATUS, mavlink.MAVLINK_MSG_ID_GPS_RAW_INT, mavlink.MAVLINK_MSG_ID_EXTENDED_SYS_STATE},
+	mavlink.MAV_DATA_STREAM_POSITION:        {mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT},
+	mavlink.MAV_DATA_STREAM_EXTRA2:          {mavlink.MAVLINK_MSG_ID_VFR_HUD},
+	mavlink.MAV_DATA_STREAM_RC_CHANNELS:     {mavlink.MAVLINK_MSG_ID_RC_CHANNELS, mavlink.MAVLINK_MSG_ID_SERVO_OUTPUT_RAW},
+	mavlink.MAV_DATA_STREAM_EXTRA3:          {mavlink.MAVLINK_MSG_ID_EKF_STATUS_REPORT, mavlink.MAVLINK_MSG_ID_VIBRATION},
+}
+
+// How often each message the simulator sends goes out by default. An
+// interval of 0 stops the message.
+func defaultIntervals(config Config) map[int]time.Duration {
+	return map[int]time.Duration{
+		mavlink.MAVLINK_MSG_ID_HEARTBEAT:           time.Second,
+		mavlink.MAVLINK_MSG_ID_SYS_STATUS:          config.TelemetryRate,
+		mavlink.MAVLINK_MSG_ID_GPS_RAW_INT:         config.TelemetryRate,
+		mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT: config.TelemetryRate,
+		mavlink.MAVLINK_MSG_ID_VFR_HUD:             config.TelemetryRate,
+		mavlink.MAVLINK_MSG_ID_EXTENDED_SYS_STATE:  config.TelemetryRate,
+		mavlink.MAVLINK_MSG_ID_RC_CHANNELS:         500 * time.Millisecond,
+		mavlink.MAVLINK_MSG_ID_SERVO_OUTPUT_RAW:    500 * time.Millisecond,
+		mavlink.MAVLINK_MSG_ID_EKF_STATUS_REPORT:   time.Second,
+		mavlink.MAVLINK_MSG_ID_VIBRATION:           time.Second,
+		// ArduPilot's rates for a gimbal it manages
+		mavlink.MAVLINK_MSG_ID_GIMBAL_MANAGER_STATUS:         200 * time.Millisecond,
+		mavlink.MAVLINK_MSG_ID_GIMBAL_DEVICE_ATTITUDE_STATUS: 100 * time.Millisecond,
+	}
+}
+
+// Builds a message the simulator streams. Must be called holding the lock.
+func (s *Simulator) telemetry(id int) mavlink.MavlinkMessage {
+	switch id {
+	case mavlink.MAVLINK_MSG_ID_HEARTBEAT:
+		return s.model.heartbeat()
+	case mavlink.MAVLINK_MSG_ID_SYS_STATUS:
+		return s.model.sysStatus()
+	case mavlink.MAVLINK_MSG_ID_GPS_RAW_INT:
+		return s.model.gpsRawInt()
+	case mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT:
+		return s.model.globalPositionInt()
+	case mavlink.MAVLINK_MSG_ID_VFR_HUD:
+		return s.model.vfrHud()
+	case mavlink.MAVLINK_MSG_ID_EXTENDED_SYS_STATE:
+		return s.model.extendedSysState()
+	case mavlink.MAVLINK_MSG_ID_RC_CHANNELS:
+		return s.rcChannels()
+	case mavlink.MAVLINK_MSG_ID_SERVO_OUTPUT_RAW:
+		return s.servoOutputRaw()
+	case mavlink.MAVLINK_MSG_ID_EKF_STATUS_REPORT:
+		return s.model.ekfStatusReport()
+	case mavlink.MAVLINK_MSG_ID_VIBRATION:
+		return s.model.vibrationReport()
+	case mavlink.MAVLINK_MSG_ID_GIMBAL_MANAGER_STATUS:
+		return s.gimbalManagerStatus()
+	case mavlink.MAVLINK_MSG_ID_GIMBAL_DEVICE_ATTITUDE_STATUS:
+		return s.gimbalDeviceAttitudeStatus()
+	}
+	return nil
+}
+
+// Capabilities the simulator reports in AUTOPILOT_VERSION
+const simCapabilities = mavlink.MAV_PROTOCOL_CAPABILITY_PARAM_FLOAT |
+	mavlink.MAV_PROTOCOL_CAPABILITY_MISSION_INT |
+	mavlink.MAV_PROTOCOL_CAPABILITY_COMMAND_INT |
+	mavlink.MAV_PROTOCOL_CAPABILITY_FTP |
+	mavlink.MAV_PROTOCOL_CAPABILITY_SET_POSITION_TARGET_LOCAL_NED |
+	mavlink.MAV_PROTOCOL_CAPABILITY_SET_POSITION_TARGET_GLOBAL_INT |
+	mavlink.MAV_PROTOCOL_CAPABILITY_MISSION_FENCE |
+	mavlink.MAV_PROTOCOL_CAPABILITY_MISSION_RALLY
+
+// Firmware version the simulator reports, 4.5.0 official
+const simFirmwareVersion = 4<<24 | 5<<16 | 0<<8 | mavlink.FIRMWARE_VERSION_TYPE_OFFICIAL
+
+func (s *Simulator) autopilotVersion() mavlink.AutopilotVersion {
+	version := mavlink.AutopilotVersion{
+		Capabilities:    simCapabilities,
+		UID:             uint64(s.config.SystemID),
+		FlightSwVersion: simFirmwareVersion,
+		BoardVersion:    1,
+	}
+	copy(version.FlightCustomVersion[:], "00000000")
+	return version
+}
+
+// Handles MAV_CMD_REQUEST_MESSAGE, returning the message to send once the
+// command has been acknowledged. Must be called holding the lock.
+func (s *Simulator) requestMessage(id int) (uint8, mavlink.MavlinkMessage) {
+	switch id {
+	case mavlink.MAVLINK_MSG_ID_AUTOPILOT_VERSION:
+		return mavlink.MAV_RESULT_ACCEPTED, s.autopilotVersion()
+	case mavlink.MAVLINK_MSG_ID_GIMBAL_MANAGER_INFORMATION:
+		return mavlink.MAV_RESULT_ACCEPTED, s.gimbalManagerInformation()
+	case mavlink.MAVLINK_MSG_ID_HOME_POSITION:
+		if !s.model.homeSet {
+			return mavlink.MAV_RESULT_FAILED, nil
+		}
+		return mavlink.MAV_RESULT_ACCEPTED, s.model.homePosition()
+	}
+	if msg := s.telemetry(id); msg != nil {
+		return mavlink.MAV_RESULT_ACCEPTED, msg
+	}
+	return mavlink.MAV_RESULT_UNSUPPORTED, nil
+}
+
+// Sends every message whose interval has passed. Must be called holding the
+// lock.
+func (s *Simulator) sendTelemetry(now time.Time) {
+	for id, interval := range s.intervals {
+		if interval <= 0 || now.Sub(s.lastSent[id]) < interval {
+			continue
+		}
+		s.broadcast(s.telemetry(id))
+		s.lastSent[id] = now
+	}
+}
+
+// Handles MAV_CMD_SET_MESSAGE_INTERVAL, where param1 is the message ID and
+// param2 the interval in microseconds, -1 to stop the message or 0 for its
+// default rate. Must be called holding the lock.
+func (s *Simulator) setMessageInterval(cmd *mavlink.CommandLongMessage) uint8 {
+	id := int(cmd.Param1)
+	if _, ok := s.intervals[id]; !ok {
+		return mavlink.MAV_RESULT_FAILED
+	}
+	switch {
+	case cmd.Param2 == 0:
+		s.intervals[id] = defaultIntervals(s.config)[id]
+	case cmd.Param2 < 0:
+		s.intervals[id] = 0
+	default:
+		s.intervals[id] = time.Duration(cmd.Param2) * time.Microsecond
+	}
+	return mavlink.MAV_RESULT_ACCEPTED
+}
+
+// Handles the legacy REQUEST_DATA_STREAM. Must be called holding the lock.
+func (s *Simulator) requestDataStream(req *mavlink.RequestDataStreamMessage) {
+	var ids []int
+	if req.ReqStreamID == mavlink.MAV_DATA_STREAM_ALL {
+		for _, streamIDs := range dataStreams {
+			ids = append(ids, streamIDs...)
+		}
+	} else {
+		ids = dataStreams[req.ReqStreamID]
+	}
+
+	var interval time.Duration
+	if req.StartStop == 1 && req.ReqMessageRate > 0 {
+		interval = time.Second / time.Duration(req.ReqMessageRate)
+	}
+	for _, id := range ids {
+		s.intervals[id] = interval
+	}
+}
+
+// Sends the status texts the model has queued. Must be called holding the
+// lock.
+func (s *Simulator) sendStatusTexts() {
+	for _, text := range s.model.statusTexts {
+		s.broadcast(text)
+	}
+	s.model.statusTexts = nil
+}
@@ -0,0 +1,101 @@
+package sim
+
+import (
+	"math"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How often the simulated ADS-B receiver reports each aircraft, about as
+// often as a real one hears them
+const trafficInterval = time.Second
+
+// Traffic is an aircraft heard by the simulated vehicle's ADS-B receiver. It
+// holds its heading, speed and climb rate.
+type Traffic struct {
+	ICAOAddress uint32
+	Callsign    string
+	// ADSB_EMITTER_TYPE, such as 1 for a light aircraft or 14 for a drone
+	EmitterType uint8
+	Latitude    float64
+	Longitude   float64
+	Altitude    float64 // meters above mean sea level
+	Heading     float64 // degrees
+	Speed       float64 // m/s
+	ClimbRate   float64 // m/s
+}
+
+// The aircraft the receiver hears
+type traffic struct {
+	aircraft []*Traffic
+	lastSent time.Time
+}
+
+// Adds an aircraft for the simulated ADS-B receiver to hear, replacing any
+// with the same ICAO address
+func (s *Simulator) AddTraffic(t Traffic) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, a := range s.traffic.aircraft {
+		if a.ICAOAddress == t.ICAOAddress {
+			s.traffic.aircraft[i] = &t
+			return
+		}
+	}
+	s.traffic.aircraft = append(s.traffic.aircraft, &t)
+}
+
+// Stops the simulated ADS-B receiver hearing an aircraft, which the ground
+// station will drop once it hasn't heard from it for a while
+func (s *Simulator) RemoveTraffic(icaoAddress uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, a := range s.traffic.aircraft {
+		if a.ICAOAddress == icaoAddress {
+			s.traffic.aircraft = append(s.traffic.aircraft[:i], s.traffic.aircraft[i+1:]...)
+			return
+		}
+	}
+}
+
+// Flies each aircraft on and reports them all when due. Must be called
+// holding the lock.
+func (s *Simulator) stepTraffic(dt time.Duration, now time.Time) {
+	seconds := dt.Seconds()
+	for _, a := range s.traffic.aircraft {
+		heading := a.Heading * math.Pi / 180
+		a.Latitude += a.Speed * math.Cos(heading) * seconds / metersPerDegree
+		a.Longitude += a.Speed * math.Sin(heading) * seconds / (metersPerDegree * math.Cos(a.Latitude*math.Pi/180))
+		a.Altitude += a.ClimbRate * seconds
+	}
+	if now.Sub(s.traffic.lastSent) < trafficInterval {
+		return
+	}
+	s.traffic.lastSent = now
+	for _, a := range s.traffic.aircraft {
+		s.broadcast(adsbVehicle(a))
+	}
+}
+
+func adsbVehicle(a *Traffic) mavlink.AdsbVehicle {
+	msg := mavlink.AdsbVehicle{
+		ICAOAddress:  a.ICAOAddress,
+		Lat:          int32(math.Round(a.Latitude * 1e7)),
+		Lon:          int32(math.Round(a.Longitude * 1e7)),
+		Altitude:     int32(math.Round(a.Altitude * 1000)),
+		Heading:      uint16(math.Round(math.Mod(a.Heading+360, 360) * 100)),
+		HorVelocity:  uint16(math.Round(a.Speed * 100)),
+		VerVelocity:  int16(math.Round(a.ClimbRate * 100)),
+		AltitudeType: mavlink.ADSB_ALTITUDE_TYPE_GEOMETRIC,
+		EmitterType:  a.EmitterType,
+		Flags: mavlink.ADSB_FLAGS_VALID_COORDS | mavlink.ADSB_FLAGS_VALID_ALTITUDE |
+			mavlink.ADSB_FLAGS_VALID_HEADING | mavlink.ADSB_FLAGS_VALID_VELOCITY |
+			mavlink.ADSB_FLAGS_VERTICAL_VELOCITY_VALID | mavlink.ADSB_FLAGS_SIMULATED,
+	}
+	if a.Callsign != "" {
+		copy(msg.Callsign[:8], a.Callsign)
+		msg.Flags |= mavlink.ADSB_FLAGS_VALID_CALLSIGN
+	}
+	return msg
+}
@@ -0,0 +1,219 @@
+package mavcom
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// How long a test waits for the simulator before giving up
+const simTestTimeout = 10 * time.Second
+
+// Connects a vehicle to a fresh simulator and waits for its heartbeat. Both
+// are closed when the test ends.
+func newSimVehicle(t *testing.T, config sim.Config) (*sim.Simulator, *Vehicle) {
+	t.Helper()
+	return newSimVehicleWith(t, config, nil)
+}
+
+// Like newSimVehicle, calling configure, if not nil, on the vehicle before it
+// starts
+func newSimVehicleWith(t *testing.T, config sim.Config, configure func(v *Vehicle)) (*sim.Simulator, *Vehicle) {
+	t.Helper()
+	s := sim.NewSimulator(config)
+	t.Cleanup(func() { s.Close() })
+	v := NewVehicleFromTransport(s.Connect())
+	if configure != nil {
+		configure(v)
+	}
+	v.Start()
+	t.Cleanup(func() { v.Connection.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), simTestTimeout)
+	defer cancel()
+	if err := v.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s, v
+}
+
+// Like newSimVehicle, but the frames the simulator sends are dropped when drop
+// returns true for them, to see how the vehicle copes with a lossy link
+func newLossySimVehicle(t *testing.T, config sim.Config, drop func(frame []byte) bool) (*sim.Simulator, *Vehicle) {
+	t.Helper()
+	s := sim.NewSimulator(config)
+	t.Cleanup(func() { s.Close() })
+	simEnd := s.Connect()
+	lossyEnd, vehicleEnd := net.Pipe()
+	go io.Copy(simEnd, lossyEnd)
+	go func() {
+		frameReader := mavlink.NewFrameReader(simEnd)
+		for {
+			frame, err := frameReader.ReadFrame()
+			if err != nil {
+				return
+			}
+			if drop(frame) {
+				continue
+			}
+			if _, err := lossyEnd.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+	v := NewVehicleFromTransport(vehicleEnd)
+	v.Start()
+	t.Cleanup(func() {
+		v.Connection.Close()
+		lossyEnd.Close()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), simTestTimeout)
+	defer cancel()
+	if err := v.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s, v
+}
+
+// Drops every nth frame of a message, the first being the nth
+func dropEvery(n int, messageID uint32) func(frame []byte) bool {
+	count := 0
+	return func(frame []byte) bool {
+		if mavlink.FrameMessageID(frame) != messageID {
+			return false
+		}
+		count++
+		return count%n == 0
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), simTestTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestConnectToSimulator(t *testing.T) {
+	config := sim.DefaultConfig()
+	_, v := newSimVehicle(t, config)
+	err := v.waitFor(testContext(t), "connect", "position and mode", func() bool {
+		return v.Position.Latitude != 0 && v.FlightState.Mode != ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if math.Abs(v.Position.Latitude-config.HomeLatitude) > 1e-6 {
+		t.Errorf("latitude %v, want %v", v.Position.Latitude, config.HomeLatitude)
+	}
+	if v.FlightState.Armed {
+		t.Error("armed on connecting")
+	}
+}
+
+// fakeAutopilot is the far end of a vehicle's link, for tests that need to
+// send what the simulator doesn't or see exactly what the vehicle sends
+type fakeAutopilot struct {
+	t       *testing.T
+	conn    net.Conn
+	encoder *mavlink.Encoder
+	seq     uint8
+	// every frame the vehicle sends, dropped if the test doesn't keep up
+	frames chan []byte
+	lock   sync.Mutex
+}
+
+func (a *fakeAutopilot) GetSequenceNumber() uint8 {
+	return a.seq
+}
+
+func (a *fakeAutopilot) IncrementSequenceNumber() {
+	a.seq++
+}
+
+// Connects a vehicle to a fake ArduCopter as system 1 and waits for it to
+// take the fake's heartbeat
+func newFakeAutopilot(t *testing.T) (*fakeAutopilot, *Vehicle) {
+	t.Helper()
+	return newFakeAutopilotWith(t, nil)
+}
+
+// Like newFakeAutopilot, calling configure, if not nil, on the vehicle
+// before it starts
+func newFakeAutopilotWith(t *testing.T, configure func(v *Vehicle)) (*fakeAutopilot, *Vehicle) {
+	t.Helper()
+	fakeEnd, vehicleEnd := net.Pipe()
+	a := &fakeAutopilot{t: t, conn: fakeEnd, frames: make(chan []byte, 256)}
+	a.encoder = mavlink.NewEncoder()
+	a.encoder.MavComInterface = a
+	go func() {
+		frameReader := mavlink.NewFrameReader(fakeEnd)
+		for {
+			frame, err := frameReader.ReadFrame()
+			if err != nil {
+				return
+			}
+			select {
+			case a.frames <- frame:
+			default:
+			}
+		}
+	}()
+
+	v := NewVehicleFromTransport(vehicleEnd)
+	v.TelemetryProfile = nil
+	v.TimeSyncInterval = 0
+	if configure != nil {
+		configure(v)
+	}
+	v.Start()
+	t.Cleanup(func() {
+		v.Connection.Close()
+		fakeEnd.Close()
+	})
+	a.send(1, mavlink.Heartbeat{
+		Type:           uint8(Quadcopter),
+		Autopilot:      mavlink.MAV_AUTOPILOT_ARDUPILOTMEGA,
+		MavlinkVersion: 3,
+	})
+	if err := v.WaitConnected(testContext(t)); err != nil {
+		t.Fatal(err)
+	}
+	return a, v
+}
+
+// Sends a message from a component of system 1
+func (a *fakeAutopilot) send(componentID uint8, msg mavlink.MavlinkMessage) {
+	a.t.Helper()
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if err := a.encoder.EncodePacket(a.conn, 1, componentID, msg); err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+// Waits for the vehicle to send a frame of a message, skipping any others
+func (a *fakeAutopilot) nextFrame(messageID uint32) []byte {
+	a.t.Helper()
+	timeout := time.After(simTestTimeout)
+	for {
+		select {
+		case frame := <-a.frames:
+			if mavlink.FrameMessageID(frame) == messageID {
+				return frame
+			}
+		case <-timeout:
+			a.t.Fatalf("no message %d from the vehicle", messageID)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package mavcom
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// How many status texts Vehicle keeps
+	statusTextHistory = 100
+	// How long to wait for the rest of a long status text before giving up
+	// and passing on the chunks that did arrive
+	statusTextChunkTimeout = 2 * time.Second
+	// How many status texts a subscriber can fall behind by before they are
+	// dropped
+	statusTextBuffer = 64
+)
+
+// Severity is how serious a status text is, from SeverityEmergency down to
+// SeverityDebug
+type Severity uint8
+
+const (
+	SeverityEmergency Severity = mavlink.MAV_SEVERITY_EMERGENCY
+	SeverityAlert     Severity = mavlink.MAV_SEVERITY_ALERT
+	SeverityCritical  Severity = mavlink.MAV_SEVERITY_CRITICAL
+	SeverityError     Severity = mavlink.MAV_SEVERITY_ERROR
+	SeverityWarning   Severity = mavlink.MAV_SEVERITY_WARNING
+	SeverityNotice    Severity = mavlink.MAV_SEVERITY_NOTICE
+	SeverityInfo      Severity = mavlink.MAV_SEVERITY_INFO
+	SeverityDebug     Severity = mavlink.MAV_SEVERITY_DEBUG
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityEmergency:
+		return "EMERGENCY"
+	case SeverityAlert:
+		return "ALERT"
+	case SeverityCritical:
+		return "CRITICAL"
+	case SeverityError:
+		return "ERROR"
+	case SeverityWarning:
+		return "WARNING"
+	case SeverityNotice:
+		return "NOTICE"
+	case SeverityInfo:
+		return "INFO"
+	case SeverityDebug:
+		return "DEBUG"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// StatusText is a message from the autopilot or another component, such as
+// a pre-arm check failure
+type StatusText struct {
+	Time        time.Time
+	SystemID    uint8
+	ComponentID uint8
+	Severity    Severity
+	Text        string
+}
+
+// Identifies the chunks of one long status text
+type statusTextKey struct {
+	systemID    uint8
+	componentID uint8
+	id          uint16
+}
+
+type statusTextChunks struct {
+	first    StatusText
+	chunks   map[uint8]string
+	received time.Time
+}
+
+// Joins the chunks that arrived, in order. A gap, or a missing end if the
+// text isn't complete, is left as "..." so that a lost chunk doesn't silently
+// change the meaning of the text.
+func (c *statusTextChunks) assemble(complete bool) StatusText {
+	seqs := make([]int, 0, len(c.chunks))
+	for seq := range c.chunks {
+		seqs = append(seqs, int(seq))
+	}
+	sort.Ints(seqs)
+	var text strings.Builder
+	next := 0
+	for _, seq := range seqs {
+		if seq != next {
+			text.WriteString("...")
+		}
+		text.WriteString(c.chunks[uint8(seq)])
+		next = seq + 1
+	}
+	if !complete {
+		text.WriteString("...")
+	}
+	assembled := c.first
+	assembled.Text = text.String()
+	return assembled
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleStatusText(msg *mavlink.StatusTextMessage) {
+	now := v.now()
+	v.flushStaleStatusTexts(now)
+
+	text := StatusText{
+		Time:        now,
+		SystemID:    msg.SystemID,
+		ComponentID: msg.ComponentID,
+		Severity:    Severity(msg.Severity),
+		Text:        msg.Text,
+	}
+	if msg.ID == 0 {
+		v.addStatusText(text)
+		return
+	}
+
+	key := statusTextKey{systemID: msg.SystemID, componentID: msg.ComponentID, id: msg.ID}
+	pending := v.statusTextChunks[key]
+	if pending == nil {
+		pending = &statusTextChunks{first: text, chunks: make(map[uint8]string)}
+		v.statusTextChunks[key] = pending
+	}
+	pending.chunks[msg.ChunkSeq] = msg.Text
+	pending.received = now
+	// every chunk but the last is full
+	if len(msg.Text) < mavlink.STATUSTEXT_MAX_LEN {
+		delete(v.statusTextChunks, key)
+		v.addStatusText(pending.assemble(true))
+	}
+}
+
+// Passes on long status texts whose last chunk never arrived, which happens
+// as they arrive and every housekeepingInterval. Must be called holding the
+// lock.
+func (v *Vehicle) flushStaleStatusTexts(now time.Time) {
+	for key, pending := range v.statusTextChunks {
+		if now.Sub(pending.received) > statusTextChunkTimeout {
+			delete(v.statusTextChunks, key)
+			v.addStatusText(pending.assemble(false))
+		}
+	}
+}
+
+// Must be called holding the lock
+func (v *Vehicle) addStatusText(text StatusText) {
+	if len(v.statusTexts) == statusTextHistory {
+		copy(v.statusTexts, v.statusTexts[1:])
+		v.statusTexts = v.statusTexts[:statusTextHistory-1]
+	}
+	v.statusTexts = append(v.statusTexts, text)
+	for sub := range v.statusTextSubs {
+		select {
+		case sub <- text:
+		default:
+		}
+	}
+}
+
+// Returns the most recent status texts, oldest first
+func (v *Vehicle) StatusTexts() []StatusText {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	texts := make([]StatusText, len(v.statusTexts))
+	copy(texts, v.statusTexts)
+	return texts
+}
+
+// Returns a channel that receives every status text as it arrives, with long
+// texts already reassembled, and a function that ends the subscription.
+// Texts are dropped if the channel isn't read fast enough.
+func (v *Vehicle) SubscribeStatusText() (<-chan StatusText, func()) {
+	sub := make(chan StatusText, statusTextBuffer)
+	v.lock.Lock()
+	if v.statusTextSubs == nil {
+		// the connection has already closed
+		close(sub)
+	} else {
+		v.statusTextSubs[sub] = true
+	}
+	v.lock.Unlock()
+
+	unsubscribe := func() {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+		if v.statusTextSubs[sub] {
+			delete(v.statusTextSubs, sub)
+			close(sub)
+		}
+	}
+	return sub, unsubscribe
+}
+
+// Must be called holding the lock
+func (v *Vehicle) closeStatusTextSubscriptions() {
+	for sub := range v.statusTextSubs {
+		close(sub)
+	}
+	v.statusTextSubs = nil
+}
+
+// Sends a status text from this component, for example to have a companion
+// computer's warnings show up in the ground station alongside the
+// autopilot's. Texts longer than 50 characters are sent in chunks, as
+// MAVLink 2, with an empty chunk after a last one that is full so that
+// receivers know the text has ended.
+func (v *Vehicle) SendStatusText(severity Severity, text string) error {
+	if len(text) <= mavlink.STATUSTEXT_MAX_LEN {
+		msg := mavlink.StatusText{Severity: uint8(severity)}
+		copy(msg.Text[:], text)
+		return v.Connection.Send(msg)
+	}
+
+	v.lock.Lock()
+	v.statusTextID++
+	if v.statusTextID == 0 {
+		v.statusTextID = 1
+	}
+	id := v.statusTextID
+	v.lock.Unlock()
+
+	for seq := 0; ; seq++ {
+		chunk := text[min(seq*mavlink.STATUSTEXT_MAX_LEN, len(text)):]
+		msg := mavlink.StatusText{Severity: uint8(severity), ID: id, ChunkSeq: uint8(seq)}
+		copy(msg.Text[:], chunk)
+		if err := v.Connection.Send(msg); err != nil {
+			return err
+		}
+		if len(chunk) < mavlink.STATUSTEXT_MAX_LEN {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package mavcom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+func textChunk(id uint16, seq uint8, text string) mavlink.StatusText {
+	msg := mavlink.StatusText{Severity: mavlink.MAV_SEVERITY_WARNING, ID: id, ChunkSeq: seq}
+	copy(msg.Text[:], text)
+	return msg
+}
+
+func TestStatusTextReassembly(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	texts, unsubscribe := v.SubscribeStatusText()
+	defer unsubscribe()
+
+	long := strings.Repeat("0123456789", 5) + "the end"
+	// chunks of other texts can arrive in between
+	a.send(1, textChunk(7, 0, long[:50]))
+	a.send(1, textChunk(0, 0, "short"))
+	a.send(1, textChunk(7, 1, long[50:]))
+
+	for _, want := range []string{"short", long} {
+		select {
+		case text := <-texts:
+			if text.Text != want || text.Severity != SeverityWarning {
+				t.Errorf("received %v %q, want WARNING %q", text.Severity, text.Text, want)
+			}
+		case <-time.After(simTestTimeout):
+			t.Fatalf("%q not received", want)
+		}
+	}
+}
+
+func TestStatusTextMissingChunk(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	texts, unsubscribe := v.SubscribeStatusText()
+	defer unsubscribe()
+
+	// nothing else arrives after the first chunk, so only the timer can
+	// pass it on
+	first := strings.Repeat("x", 50)
+	a.send(1, textChunk(3, 0, first))
+	select {
+	case text := <-texts:
+		if text.Text != first+"..." {
+			t.Errorf("received %q, want %q", text.Text, first+"...")
+		}
+	case <-time.After(statusTextChunkTimeout + 2*housekeepingInterval):
+		t.Fatal("incomplete text not passed on")
+	}
+}
+
+func TestSendStatusText(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+
+	if err := v.SendStatusText(SeverityInfo, "short"); err != nil {
+		t.Fatal(err)
+	}
+	frame := a.nextFrame(mavlink.MAVLINK_MSG_ID_STATUSTEXT)
+	if frame[0] != mavlink.FRAME_START || int(frame[1]) != mavlink.MAVLINK_MSG_SIZE_STATUSTEXT {
+		t.Errorf("short text sent as % x, want MAVLink 1 without extensions", frame[:2])
+	}
+
+	// the chunks of a text that ends part way through its last one, and of
+	// one that fills it and so is ended by an empty chunk
+	for _, test := range []struct {
+		text   string
+		chunks []string
+	}{
+		{strings.Repeat("x", 70), []string{strings.Repeat("x", 50), strings.Repeat("x", 20)}},
+		{strings.Repeat("y", 100), []string{strings.Repeat("y", 50), strings.Repeat("y", 50), ""}},
+	} {
+		if err := v.SendStatusText(SeverityInfo, test.text); err != nil {
+			t.Fatal(err)
+		}
+		for seq, want := range test.chunks {
+			frame := a.nextFrame(mavlink.MAVLINK_MSG_ID_STATUSTEXT)
+			if frame[0] != mavlink.FRAME_START_V2 {
+				t.Fatalf("chunk %d sent as MAVLink 1", seq)
+			}
+			msg := decodeFrame(t, frame).(*mavlink.StatusTextMessage)
+			if msg.ID == 0 || int(msg.ChunkSeq) != seq {
+				t.Errorf("chunk %d has ID %d and sequence %d", seq, msg.ID, msg.ChunkSeq)
+			}
+			if msg.Text != want {
+				t.Errorf("chunk %d holds %q, want %q", seq, msg.Text, want)
+			}
+		}
+	}
+	if err := v.SendStatusText(SeverityInfo, "next"); err != nil {
+		t.Fatal(err)
+	}
+	if frame := a.nextFrame(mavlink.MAVLINK_MSG_ID_STATUSTEXT); frame[0] != mavlink.FRAME_START {
+		t.Error("more chunks followed the end of a long text")
+	}
+}
@@ -0,0 +1,157 @@
+package mavcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// How long to wait for each SET_MESSAGE_INTERVAL to be acknowledged while
+// applying a telemetry profile, and for the whole profile when it is applied
+// on connecting
+const (
+	telemetryCommandTimeout = 3 * time.Second
+	telemetryProfileTimeout = 30 * time.Second
+)
+
+// Legacy groups of messages for RequestDataStream
+const (
+	StreamAll            = mavlink.MAV_DATA_STREAM_ALL
+	StreamRawSensors     = mavlink.MAV_DATA_STREAM_RAW_SENSORS
+	StreamExtendedStatus = mavlink.MAV_DATA_STREAM_EXTENDED_STATUS
+	StreamRCChannels     = mavlink.MAV_DATA_STREAM_RC_CHANNELS
+	StreamRawController  = mavlink.MAV_DATA_STREAM_RAW_CONTROLLER
+	StreamPosition       = mavlink.MAV_DATA_STREAM_POSITION
+	StreamExtra1         = mavlink.MAV_DATA_STREAM_EXTRA1
+	StreamExtra2         = mavlink.MAV_DATA_STREAM_EXTRA2
+	StreamExtra3         = mavlink.MAV_DATA_STREAM_EXTRA3
+)
+
+// TelemetryProfile is the set of messages to ask the vehicle for and how
+// often. Rates are in Hz by message ID. Firmware that doesn't support setting
+// message intervals is sent the legacy Streams instead, in Hz by stream ID.
+type TelemetryProfile struct {
+	Rates   map[int]float64
+	Streams map[uint8]uint16
+}
+
+// The messages Vehicle keeps its state from, fast enough for a ground
+// station display without crowding a telemetry radio
+func DefaultTelemetryProfile() *TelemetryProfile {
+	return &TelemetryProfile{
+		Rates: map[int]float64{
+			mavlink.MAVLINK_MSG_ID_SYS_STATUS:          2,
+			mavlink.MAVLINK_MSG_ID_GPS_RAW_INT:         1,
+			mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT: 5,
+			mavlink.MAVLINK_MSG_ID_VFR_HUD:             4,
+			mavlink.MAVLINK_MSG_ID_EXTENDED_SYS_STATE:  2,
+			mavlink.MAVLINK_MSG_ID_RC_CHANNELS:         2,
+			mavlink.MAVLINK_MSG_ID_SERVO_OUTPUT_RAW:    2,
+			mavlink.MAVLINK_MSG_ID_EKF_STATUS_REPORT:   1,
+			mavlink.MAVLINK_MSG_ID_VIBRATION:           1,
+		},
+		Streams: map[uint8]uint16{
+			StreamExtendedStatus: 2,
+			StreamRCChannels:     2,
+			StreamPosition:       5,
+			StreamExtra2:         4,
+			StreamExtra3:         1,
+		},
+	}
+}
+
+// Sets how often the vehicle sends a message, in Hz. A rate of 0 stops the
+// message altogether.
+func (v *Vehicle) SetMessageRate(ctx context.Context, messageID int, hz float64) error {
+	if hz < 0 {
+		return fmt.Errorf("invalid rate %v Hz", hz)
+	}
+	return v.command(ctx, fmt.Sprintf("set message %d rate", messageID),
+		mavlink.MAV_CMD_SET_MESSAGE_INTERVAL, float32(messageID), messageInterval(hz))
+}
+
+// SET_MESSAGE_INTERVAL takes an interval in microseconds, with -1 meaning
+// don't send the message
+func messageInterval(hz float64) float32 {
+	if hz <= 0 {
+		return -1
+	}
+	return float32(1e6 / hz)
+}
+
+// Puts a message back to the rate the vehicle sends it at by default
+func (v *Vehicle) ResetMessageRate(ctx context.Context, messageID int) error {
+	return v.command(ctx, fmt.Sprintf("reset message %d rate", messageID),
+		mavlink.MAV_CMD_SET_MESSAGE_INTERVAL, float32(messageID), 0)
+}
+
+// Asks for one of the legacy groups of messages at a rate in Hz, or stops it
+// if hz is 0. Only needed for firmware that doesn't support SetMessageRate.
+// The vehicle doesn't acknowledge the request.
+func (v *Vehicle) RequestDataStream(stream uint8, hz uint16) error {
+	return v.Connection.RequestDataStream(stream, hz)
+}
+
+// Asks the vehicle for the messages in a profile. If the vehicle doesn't
+// understand SET_MESSAGE_INTERVAL the profile's legacy streams are requested
+// instead.
+func (v *Vehicle) ApplyTelemetryProfile(ctx context.Context, profile *TelemetryProfile) error {
+	ids := make([]int, 0, len(profile.Rates))
+	for id := range profile.Rates {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var errs []error
+	for _, id := range ids {
+		hz := profile.Rates[id]
+		if hz < 0 {
+			errs = append(errs, fmt.Errorf("message %d: invalid rate %v Hz", id, hz))
+			continue
+		}
+		commandCtx, cancel := context.WithTimeout(ctx, telemetryCommandTimeout)
+		result, err := v.SendCommand(commandCtx, mavlink.MAV_CMD_SET_MESSAGE_INTERVAL,
+			float32(id), messageInterval(hz))
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// no answer at all, or not knowing the command, both mean old
+		// firmware
+		if err != nil || result == ResultUnsupported {
+			return v.requestStreams(profile.Streams)
+		}
+		if result != ResultAccepted {
+			errs = append(errs, fmt.Errorf("set message %d rate: vehicle responded %v", id, result))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (v *Vehicle) requestStreams(streams map[uint8]uint16) error {
+	ids := make([]int, 0, len(streams))
+	for id := range streams {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if err := v.RequestDataStream(uint8(id), streams[uint8(id)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Applies the vehicle's telemetry profile in the background once it has
+// connected
+func (v *Vehicle) applyTelemetryProfileOnConnect(profile *TelemetryProfile) {
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryProfileTimeout)
+	defer cancel()
+	if err := v.ApplyTelemetryProfile(ctx, profile); err != nil {
+		v.Logger.Warn("error applying telemetry profile", "err", err)
+	}
+}
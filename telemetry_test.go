@@ -0,0 +1,90 @@
+package mavcom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+// Counts how many of each message arrive over a while
+func countMessages(v *Vehicle, over time.Duration, ids ...int) map[int]uint64 {
+	before := v.Stats().Messages
+	time.Sleep(over)
+	after := v.Stats().Messages
+	counts := make(map[int]uint64, len(ids))
+	for _, id := range ids {
+		counts[id] = after[id].Count - before[id].Count
+	}
+	return counts
+}
+
+func TestApplyTelemetryProfile(t *testing.T) {
+	// the simulator sends its telemetry at 10 Hz until asked otherwise
+	_, v := newSimVehicleWith(t, sim.DefaultConfig(), func(v *Vehicle) {
+		v.TelemetryProfile = nil
+	})
+	ctx := testContext(t)
+	profile := &TelemetryProfile{Rates: map[int]float64{
+		mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT: 2,
+		mavlink.MAVLINK_MSG_ID_VFR_HUD:             0,
+	}}
+	if err := v.ApplyTelemetryProfile(ctx, profile); err != nil {
+		t.Fatal(err)
+	}
+	// any VFR_HUD already on its way
+	time.Sleep(100 * time.Millisecond)
+
+	counts := countMessages(v, 2*time.Second, mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT,
+		mavlink.MAVLINK_MSG_ID_VFR_HUD, mavlink.MAVLINK_MSG_ID_SYS_STATUS)
+	if position := counts[mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT]; position < 3 || position > 5 {
+		t.Errorf("%d GLOBAL_POSITION_INT in 2 seconds, want 4", position)
+	}
+	if hud := counts[mavlink.MAVLINK_MSG_ID_VFR_HUD]; hud != 0 {
+		t.Errorf("%d VFR_HUD in 2 seconds after stopping it", hud)
+	}
+	// messages not in the profile are left alone
+	if status := counts[mavlink.MAVLINK_MSG_ID_SYS_STATUS]; status < 15 {
+		t.Errorf("%d SYS_STATUS in 2 seconds, want 20", status)
+	}
+
+	if err := v.ResetMessageRate(ctx, mavlink.MAVLINK_MSG_ID_VFR_HUD); err != nil {
+		t.Fatal(err)
+	}
+	counts = countMessages(v, time.Second, mavlink.MAVLINK_MSG_ID_VFR_HUD)
+	if hud := counts[mavlink.MAVLINK_MSG_ID_VFR_HUD]; hud < 7 {
+		t.Errorf("%d VFR_HUD in a second after resetting its rate, want 10", hud)
+	}
+}
+
+func TestTelemetryProfileFallsBackToStreams(t *testing.T) {
+	// firmware that predates SET_MESSAGE_INTERVAL, with the profile applied
+	// on connecting
+	a, _ := newFakeAutopilotWith(t, func(v *Vehicle) {
+		v.TelemetryProfile = &TelemetryProfile{
+			Rates:   map[int]float64{mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT: 5},
+			Streams: map[uint8]uint16{StreamExtra2: 4, StreamPosition: 5},
+		}
+	})
+
+	// skipping the vehicle's request for AUTOPILOT_VERSION
+	long := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_LONG)).(*mavlink.CommandLongMessage)
+	for long.Command != mavlink.MAV_CMD_SET_MESSAGE_INTERVAL {
+		long = decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_COMMAND_LONG)).(*mavlink.CommandLongMessage)
+	}
+	if long.Param1 != mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT || long.Param2 != 200000 {
+		t.Errorf("asked for message %v every %v µs, want %d every 200000 µs", long.Param1, long.Param2, mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT)
+	}
+	a.send(1, mavlink.CommandAck{Command: mavlink.MAV_CMD_SET_MESSAGE_INTERVAL, Result: mavlink.MAV_RESULT_UNSUPPORTED})
+
+	for _, want := range []struct {
+		stream uint8
+		hz     uint16
+	}{{StreamPosition, 5}, {StreamExtra2, 4}} {
+		request := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_REQUEST_DATA_STREAM)).(*mavlink.RequestDataStreamMessage)
+		if request.ReqStreamID != want.stream || request.ReqMessageRate != want.hz || request.StartStop != 1 {
+			t.Errorf("requested stream %d at %d Hz, start %d, want stream %d at %d Hz", request.ReqStreamID, request.ReqMessageRate, request.StartStop, want.stream, want.hz)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package mavcom
+
+import (
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// How often the vehicle's clock is sampled by default
+	defaultTimeSyncInterval = time.Second
+	// How many unanswered requests are remembered
+	timeSyncPending = 8
+	// How much a new sample moves the estimate once it has settled, earlier
+	// samples are averaged
+	timeSyncGain = 0.1
+	// Samples are ignored for the offset if their round trip is this many
+	// times longer than usual, as most of it was spent queued on one side
+	timeSyncSlowFactor = 3
+	// Round trips shorter than this are never considered slow
+	timeSyncMinSlow = 5 * time.Millisecond
+	// An offset this far from the estimate means the vehicle's clock jumped,
+	// usually because it rebooted, once it has been seen a few times running
+	timeSyncJump    = time.Second
+	timeSyncJumpRun = 3
+)
+
+// Local time in nanoseconds, from the monotonic clock so that it doesn't
+// jump when the wall clock is set
+var clockBase = time.Now()
+
+func localNanos() int64 {
+	return clockBase.UnixNano() + int64(time.Since(clockBase))
+}
+
+// ClockSync is the estimated relation between the vehicle's clock, which
+// counts from when it booted, and ours
+type ClockSync struct {
+	// the vehicle's clock minus ours
+	Offset time.Duration
+	// how long a message takes to get to the vehicle and back
+	RoundTrip time.Duration
+	// how many samples the estimate is based on
+	Samples int
+}
+
+type timeSync struct {
+	estimate ClockSync
+	// the local times of requests still waiting for a response
+	pending []int64
+	// how many samples in a row have disagreed with the estimate
+	jumps int
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleTimeSync(msg *mavlink.TimeSyncMessage) {
+	now := localNanos()
+	if msg.Tc1 == 0 {
+		// a request, answered with our time so the sender can sync to us
+		if systemID, _ := v.Connection.Source(); v.replay != nil || msg.TargetSystem != 0 && msg.TargetSystem != systemID {
+			return
+		}
+		go v.Connection.Send(mavlink.TimeSync{
+			Tc1:             now,
+			Ts1:             msg.Ts1,
+			TargetSystem:    msg.SystemID,
+			TargetComponent: msg.ComponentID,
+		})
+		return
+	}
+
+	sync := &v.timeSync
+	found := false
+	for i, sent := range sync.pending {
+		if sent == msg.Ts1 {
+			sync.pending = append(sync.pending[:i], sync.pending[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		// a response to someone else, or too late
+		return
+	}
+	roundTrip := time.Duration(now - msg.Ts1)
+	// the vehicle read its clock half way through the round trip
+	offset := time.Duration(msg.Tc1 + int64(roundTrip/2) - now)
+	sync.addSample(offset, roundTrip)
+}
+
+func (sync *timeSync) addSample(offset time.Duration, roundTrip time.Duration) {
+	estimate := &sync.estimate
+	if estimate.Samples > 0 {
+		if diff := offset - estimate.Offset; diff > timeSyncJump || diff < -timeSyncJump {
+			sync.jumps++
+			if sync.jumps < timeSyncJumpRun {
+				return
+			}
+			*estimate = ClockSync{}
+		}
+		sync.jumps = 0
+	}
+
+	gain := max(1/float64(estimate.Samples+1), timeSyncGain)
+	slow := estimate.Samples > 0 && roundTrip > timeSyncMinSlow &&
+		roundTrip > timeSyncSlowFactor*estimate.RoundTrip
+	estimate.RoundTrip += time.Duration(gain * float64(roundTrip-estimate.RoundTrip))
+	if slow {
+		return
+	}
+	estimate.Offset += time.Duration(gain * float64(offset-estimate.Offset))
+	estimate.Samples++
+}
+
+// Sends TIMESYNC requests until the connection closes
+func (v *Vehicle) runTimeSync(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		v.requestTimeSync()
+		select {
+		case <-v.closedChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (v *Vehicle) requestTimeSync() error {
+	now := localNanos()
+	v.lock.Lock()
+	if len(v.timeSync.pending) == timeSyncPending {
+		v.timeSync.pending = v.timeSync.pending[1:]
+	}
+	v.timeSync.pending = append(v.timeSync.pending, now)
+	v.lock.Unlock()
+
+	targetSystem, targetComponent := v.Connection.Target()
+	return v.Connection.Send(mavlink.TimeSync{
+		Ts1:             now,
+		TargetSystem:    targetSystem,
+		TargetComponent: targetComponent,
+	})
+}
+
+// Returns the current estimate of the vehicle's clock, and false if no
+// TIMESYNC response has arrived yet
+func (v *Vehicle) ClockSync() (ClockSync, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.timeSync.estimate, v.timeSync.estimate.Samples > 0
+}
+
+// Converts a time from a message's TimeBootMs field, such as
+// Position.TimeBootMs, to local wall-clock time. It returns false until the
+// vehicle's clock has been synced.
+func (v *Vehicle) BootTimeToLocal(timeBootMs uint32) (time.Time, bool) {
+	sync, ok := v.ClockSync()
+	if !ok {
+		return time.Time{}, false
+	}
+	vehicleNanos := int64(timeBootMs) * int64(time.Millisecond)
+	return time.Unix(0, vehicleNanos-int64(sync.Offset)), true
+}
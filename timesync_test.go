@@ -0,0 +1,110 @@
+package mavcom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+func TestTimeSyncWithSimulator(t *testing.T) {
+	_, v := newSimVehicleWith(t, sim.DefaultConfig(), func(v *Vehicle) {
+		v.TimeSyncInterval = 50 * time.Millisecond
+	})
+	ctx := testContext(t)
+	err := v.waitFor(ctx, "test", "clock to sync", func() bool {
+		return v.timeSync.estimate.Samples >= 5 && v.Position.TimeBootMs != 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sync, ok := v.ClockSync()
+	if !ok {
+		t.Fatal("clock not synced")
+	}
+	// the simulator booted just before connecting, so its clock is a little
+	// ahead of zero
+	booted := -sync.Offset
+	if since := time.Since(time.Unix(0, int64(booted))); since < 0 || since > simTestTimeout {
+		t.Errorf("simulator booted %v ago by the offset, want since the test started", since)
+	}
+	if sync.RoundTrip <= 0 || sync.RoundTrip > 50*time.Millisecond {
+		t.Errorf("round trip %v, want a few milliseconds over a pipe", sync.RoundTrip)
+	}
+
+	// a position is stamped when the simulator sent it, which was when it
+	// arrived give or take the link
+	v.lock.Lock()
+	timeBootMs, received := v.Position.TimeBootMs, v.received[mavlink.MAVLINK_MSG_ID_GLOBAL_POSITION_INT]
+	v.lock.Unlock()
+	sent, ok := v.BootTimeToLocal(timeBootMs)
+	if !ok {
+		t.Fatal("boot time not converted")
+	}
+	if diff := received.Sub(sent); diff < -20*time.Millisecond || diff > 20*time.Millisecond {
+		t.Errorf("position sent at %v and received at %v", sent, received)
+	}
+}
+
+func TestTimeSyncAnswersRequests(t *testing.T) {
+	a, _ := newFakeAutopilot(t)
+	before := localNanos()
+	a.send(1, mavlink.TimeSync{Ts1: 12345})
+	reply := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_TIMESYNC)).(*mavlink.TimeSyncMessage)
+	if reply.Ts1 != 12345 || reply.TargetSystem != 1 || reply.TargetComponent != 1 {
+		t.Errorf("answered %d to %d/%d, want 12345 to 1/1", reply.Ts1, reply.TargetSystem, reply.TargetComponent)
+	}
+	if reply.Tc1 < before || reply.Tc1 > localNanos() {
+		t.Errorf("answered with time %d, want our clock", reply.Tc1)
+	}
+
+	// requests for another system aren't answered
+	a.send(1, mavlink.TimeSync{Ts1: 1, TargetSystem: 42})
+	a.send(1, mavlink.TimeSync{Ts1: 2})
+	if reply := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_TIMESYNC)).(*mavlink.TimeSyncMessage); reply.Ts1 != 2 {
+		t.Errorf("answered request %d, want only 2", reply.Ts1)
+	}
+}
+
+func TestTimeSyncSamples(t *testing.T) {
+	const offset = 5 * time.Second
+	var sync timeSync
+	for _, sample := range []time.Duration{offset + 2*time.Millisecond, offset - 2*time.Millisecond} {
+		sync.addSample(sample, 4*time.Millisecond)
+	}
+	if sync.estimate.Samples != 2 || sync.estimate.Offset != offset || sync.estimate.RoundTrip != 4*time.Millisecond {
+		t.Fatalf("estimate %+v from two samples, want their average", sync.estimate)
+	}
+
+	// a slow round trip counts towards the usual round trip but not the
+	// offset, as most of it was spent queued
+	sync.addSample(offset+100*time.Millisecond, 200*time.Millisecond)
+	if sync.estimate.Samples != 2 || sync.estimate.Offset != offset {
+		t.Errorf("estimate %+v after a slow sample, want the offset unchanged", sync.estimate)
+	}
+
+	// the vehicle rebooted, which is only believed once it has been seen a
+	// few times running
+	rebooted := -time.Minute
+	for i := 1; i < timeSyncJumpRun; i++ {
+		sync.addSample(rebooted, 4*time.Millisecond)
+		if sync.estimate.Offset != offset {
+			t.Fatalf("estimate %+v after %d samples from the rebooted clock, want it unchanged", sync.estimate, i)
+		}
+	}
+	sync.addSample(rebooted, 4*time.Millisecond)
+	if sync.estimate.Samples != 1 || sync.estimate.Offset != rebooted {
+		t.Errorf("estimate %+v after %d samples from the rebooted clock, want it started over", sync.estimate, timeSyncJumpRun)
+	}
+
+	// a single outlier is ignored and forgotten
+	sync.addSample(time.Hour, 4*time.Millisecond)
+	sync.addSample(rebooted, 4*time.Millisecond)
+	sync.addSample(time.Hour, 4*time.Millisecond)
+	sync.addSample(time.Hour, 4*time.Millisecond)
+	if sync.estimate.Offset != rebooted {
+		t.Errorf("estimate %+v after outliers broken up by a good sample, want it unchanged", sync.estimate)
+	}
+}
@@ -0,0 +1,428 @@
+package mavcom
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// Aircraft not heard from for this long are dropped from the traffic
+	// table
+	trafficTimeout = 20 * time.Second
+
+	// Traffic alerts buffered for each subscriber
+	trafficAlertBuffer = 16
+)
+
+// EmitterType is the kind of aircraft or obstacle an ADS-B report comes from
+type EmitterType uint8
+
+const (
+	EmitterNoInfo           EmitterType = mavlink.ADSB_EMITTER_TYPE_NO_INFO
+	EmitterLight            EmitterType = mavlink.ADSB_EMITTER_TYPE_LIGHT
+	EmitterSmall            EmitterType = mavlink.ADSB_EMITTER_TYPE_SMALL
+	EmitterLarge            EmitterType = mavlink.ADSB_EMITTER_TYPE_LARGE
+	EmitterHighVortexLarge  EmitterType = mavlink.ADSB_EMITTER_TYPE_HIGH_VORTEX_LARGE
+	EmitterHeavy            EmitterType = mavlink.ADSB_EMITTER_TYPE_HEAVY
+	EmitterHighlyManeuvable EmitterType = mavlink.ADSB_EMITTER_TYPE_HIGHLY_MANUV
+	EmitterRotorcraft       EmitterType = mavlink.ADSB_EMITTER_TYPE_ROTOCRAFT
+	EmitterGlider           EmitterType = mavlink.ADSB_EMITTER_TYPE_GLIDER
+	EmitterLighterThanAir   EmitterType = mavlink.ADSB_EMITTER_TYPE_LIGHTER_AIR
+	EmitterParachute        EmitterType = mavlink.ADSB_EMITTER_TYPE_PARACHUTE
+	EmitterUltraLight       EmitterType = mavlink.ADSB_EMITTER_TYPE_ULTRA_LIGHT
+	EmitterUAV              EmitterType = mavlink.ADSB_EMITTER_TYPE_UAV
+	EmitterSpace            EmitterType = mavlink.ADSB_EMITTER_TYPE_SPACE
+	EmitterEmergencySurface EmitterType = mavlink.ADSB_EMITTER_TYPE_EMERGENCY_SURFACE
+	EmitterServiceSurface   EmitterType = mavlink.ADSB_EMITTER_TYPE_SERVICE_SURFACE
+	EmitterPointObstacle    EmitterType = mavlink.ADSB_EMITTER_TYPE_POINT_OBSTACLE
+)
+
+var emitterTypeNames = map[EmitterType]string{
+	EmitterNoInfo:           "NO_INFO",
+	EmitterLight:            "LIGHT",
+	EmitterSmall:            "SMALL",
+	EmitterLarge:            "LARGE",
+	EmitterHighVortexLarge:  "HIGH_VORTEX_LARGE",
+	EmitterHeavy:            "HEAVY",
+	EmitterHighlyManeuvable: "HIGHLY_MANEUVERABLE",
+	EmitterRotorcraft:       "ROTORCRAFT",
+	EmitterGlider:           "GLIDER",
+	EmitterLighterThanAir:   "LIGHTER_THAN_AIR",
+	EmitterParachute:        "PARACHUTE",
+	EmitterUltraLight:       "ULTRA_LIGHT",
+	EmitterUAV:              "UAV",
+	EmitterSpace:            "SPACE",
+	EmitterEmergencySurface: "EMERGENCY_SURFACE",
+	EmitterServiceSurface:   "SERVICE_SURFACE",
+	EmitterPointObstacle:    "POINT_OBSTACLE",
+}
+
+func (e EmitterType) String() string {
+	if name, ok := emitterTypeNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("EMITTER(%d)", uint8(e))
+}
+
+// Whether the emitter may have people on board. Emitters that don't say
+// what they are are assumed to.
+func (e EmitterType) Manned() bool {
+	switch e {
+	case EmitterUAV, EmitterSpace, EmitterEmergencySurface, EmitterServiceSurface, EmitterPointObstacle:
+		return false
+	default:
+		return true
+	}
+}
+
+// Traffic is an aircraft heard by the vehicle's ADS-B receiver, from
+// ADSB_VEHICLE. The Has fields say which of the rest the aircraft reported.
+type Traffic struct {
+	ICAOAddress uint32
+	// empty when the aircraft doesn't send one
+	Callsign string
+	// the transponder code, -1 when unknown
+	Squawk  int
+	Emitter EmitterType
+
+	HasPosition bool
+	Latitude    float64
+	Longitude   float64
+	HasAltitude bool
+	// meters above mean sea level, barometric unless AltitudeGeometric
+	Altitude          float64
+	AltitudeGeometric bool
+	HasHeading        bool
+	// degrees from north
+	Heading     float64
+	HasVelocity bool
+	// m/s
+	GroundSpeed      float64
+	HasVerticalSpeed bool
+	// m/s, positive up
+	VerticalSpeed float64
+
+	// reported by a simulator rather than a real aircraft
+	Simulated bool
+	// when the aircraft was last heard from, in local time
+	LastSeen time.Time
+}
+
+// Returns the callsign, or the ICAO address when there is none
+func (t Traffic) Name() string {
+	if t.Callsign != "" {
+		return t.Callsign
+	}
+	return fmt.Sprintf("%06X", t.ICAOAddress)
+}
+
+// TrafficEncounter is where an aircraft is relative to the vehicle, and how
+// close the two will come if both keep their course and speed
+type TrafficEncounter struct {
+	Traffic
+	// horizontal distance in meters, and the bearing in degrees from north,
+	// from the vehicle to the aircraft
+	Range   float64
+	Bearing float64
+	// meters the aircraft is above the vehicle, negative when below. 0 when
+	// the aircraft doesn't report its altitude.
+	RelativeAltitude float64
+	// how long until the two are closest horizontally, 0 when they are
+	// already moving apart, and how far apart they are then horizontally and
+	// vertically
+	TimeToCPA         time.Duration
+	RangeAtCPA        float64
+	RelativeAltAtCPA  float64
+	closingHorizontal bool
+}
+
+// TrafficAlertLevel is how much of a threat an aircraft is
+type TrafficAlertLevel int
+
+const (
+	TrafficClear TrafficAlertLevel = iota
+	// predicted to come inside the alert volume within the advisory time
+	TrafficAdvisory
+	// inside the alert volume, or predicted to be within the warning time
+	TrafficWarning
+)
+
+func (l TrafficAlertLevel) String() string {
+	switch l {
+	case TrafficClear:
+		return "CLEAR"
+	case TrafficAdvisory:
+		return "ADVISORY"
+	case TrafficWarning:
+		return "WARNING"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// TrafficAlertConfig is the volume around the vehicle that aircraft are
+// alerted on, and how far ahead their paths are predicted
+type TrafficAlertConfig struct {
+	// meters
+	HorizontalRadius   float64
+	VerticalSeparation float64
+	AdvisoryTime       time.Duration
+	WarningTime        time.Duration
+	// also alerts on drones and obstacles, rather than only aircraft that
+	// may have people on board
+	IncludeUnmanned bool
+}
+
+// Alerts on manned aircraft predicted to come within 600 meters and 150
+// meters vertically, a little more than the 2000 feet and 250 feet
+// commonly used for keeping well clear
+func DefaultTrafficAlertConfig() TrafficAlertConfig {
+	return TrafficAlertConfig{
+		HorizontalRadius:   600,
+		VerticalSeparation: 150,
+		AdvisoryTime:       60 * time.Second,
+		WarningTime:        20 * time.Second,
+	}
+}
+
+// TrafficAlert is sent whenever an aircraft's alert level changes, including
+// back to clear when it moves away or is no longer heard from
+type TrafficAlert struct {
+	Level     TrafficAlertLevel
+	Encounter TrafficEncounter
+}
+
+// An aircraft in the traffic table and the alert last sent for it
+type trackedTraffic struct {
+	traffic Traffic
+	level   TrafficAlertLevel
+	// the encounter the level was worked out from
+	encounter TrafficEncounter
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleAdsbVehicle(msg *mavlink.AdsbVehicleMessage) {
+	now := v.now()
+	flags := msg.Flags
+	t := Traffic{
+		ICAOAddress:       msg.ICAOAddress,
+		Squawk:            -1,
+		Emitter:           EmitterType(msg.EmitterType),
+		HasPosition:       flags&mavlink.ADSB_FLAGS_VALID_COORDS != 0,
+		Latitude:          float64(msg.Lat) / 1e7,
+		Longitude:         float64(msg.Lon) / 1e7,
+		HasAltitude:       flags&mavlink.ADSB_FLAGS_VALID_ALTITUDE != 0,
+		Altitude:          float64(msg.Altitude) / 1000,
+		AltitudeGeometric: msg.AltitudeType == mavlink.ADSB_ALTITUDE_TYPE_GEOMETRIC,
+		HasHeading:        flags&mavlink.ADSB_FLAGS_VALID_HEADING != 0,
+		Heading:           float64(msg.Heading) / 100,
+		HasVelocity:       flags&mavlink.ADSB_FLAGS_VALID_VELOCITY != 0,
+		GroundSpeed:       float64(msg.HorVelocity) / 100,
+		HasVerticalSpeed:  flags&mavlink.ADSB_FLAGS_VERTICAL_VELOCITY_VALID != 0,
+		VerticalSpeed:     float64(msg.VerVelocity) / 100,
+		Simulated:         flags&mavlink.ADSB_FLAGS_SIMULATED != 0,
+		LastSeen:          now.Add(-time.Duration(msg.Tslc) * time.Second),
+	}
+	if flags&mavlink.ADSB_FLAGS_VALID_CALLSIGN != 0 {
+		t.Callsign = strings.TrimSpace(msg.Callsign)
+	}
+	if flags&mavlink.ADSB_FLAGS_VALID_SQUAWK != 0 {
+		t.Squawk = int(msg.Squawk)
+	}
+
+	tracked, ok := v.traffic[t.ICAOAddress]
+	if !ok {
+		tracked = &trackedTraffic{}
+		v.traffic[t.ICAOAddress] = tracked
+	}
+	tracked.traffic = t
+	v.expireTraffic(now)
+	v.updateTrafficAlert(tracked)
+}
+
+// Drops aircraft that haven't been heard from for a while, clearing any
+// alert on them. Must be called holding the lock.
+func (v *Vehicle) expireTraffic(now time.Time) {
+	for icao, tracked := range v.traffic {
+		if now.Sub(tracked.traffic.LastSeen) < trafficTimeout {
+			continue
+		}
+		delete(v.traffic, icao)
+		if tracked.level != TrafficClear {
+			v.sendTrafficAlert(TrafficAlert{Level: TrafficClear, Encounter: tracked.encounter})
+		}
+	}
+}
+
+// Must be called holding the lock
+func (v *Vehicle) updateTrafficAlert(tracked *trackedTraffic) {
+	encounter, ok := v.encounter(tracked.traffic)
+	if !ok {
+		return
+	}
+	config := v.TrafficAlerts
+	level := TrafficClear
+	if tracked.traffic.Emitter.Manned() || config.IncludeUnmanned {
+		level = encounter.alertLevel(config)
+	}
+	tracked.encounter = encounter
+	if level != tracked.level {
+		tracked.level = level
+		v.sendTrafficAlert(TrafficAlert{Level: level, Encounter: encounter})
+	}
+}
+
+// Works out every aircraft's alert level again, as the vehicle moving
+// changes how close it will come to them. Must be called holding the lock.
+func (v *Vehicle) updateTrafficAlerts() {
+	for _, tracked := range v.traffic {
+		v.updateTrafficAlert(tracked)
+	}
+}
+
+// Must be called holding the lock
+func (v *Vehicle) sendTrafficAlert(alert TrafficAlert) {
+	for sub := range v.trafficAlertSubs {
+		select {
+		case sub <- alert:
+		default:
+		}
+	}
+}
+
+// Works out where an aircraft is relative to the vehicle, and false if
+// either position isn't known. Must be called holding the lock.
+func (v *Vehicle) encounter(t Traffic) (TrafficEncounter, bool) {
+	state := v.Connection.CurrentStates.GlobalPositionIntState
+	if !t.HasPosition || !v.connected || state == nil {
+		return TrafficEncounter{}, false
+	}
+	own := v.Position
+	e := TrafficEncounter{Traffic: t, Range: Distance(own.Coordinate(), Coordinate{t.Latitude, t.Longitude})}
+	north, east := offsetFrom(own.Coordinate(), Coordinate{t.Latitude, t.Longitude})
+	e.Bearing = math.Mod(math.Atan2(east, north)*180/math.Pi+360, 360)
+
+	// the aircraft's velocity relative to the vehicle's, north, east and up
+	ownNorth, ownEast := state["Vx"].(float64), state["Vy"].(float64)
+	ownUp := -state["Vz"].(float64)
+	var vn, ve, vu float64
+	if t.HasVelocity && t.HasHeading {
+		heading := t.Heading * math.Pi / 180
+		vn, ve = t.GroundSpeed*math.Cos(heading), t.GroundSpeed*math.Sin(heading)
+	}
+	if t.HasVerticalSpeed {
+		vu = t.VerticalSpeed
+	}
+	vn, ve, vu = vn-ownNorth, ve-ownEast, vu-ownUp
+
+	if t.HasAltitude {
+		e.RelativeAltitude = t.Altitude - own.AltitudeAMSL
+	}
+	// the time the horizontal distance is smallest, when the relative
+	// position is perpendicular to the relative velocity
+	e.RangeAtCPA, e.RelativeAltAtCPA = e.Range, e.RelativeAltitude
+	if speed := vn*vn + ve*ve; speed > 0 {
+		if seconds := -(north*vn + east*ve) / speed; seconds > 0 {
+			e.closingHorizontal = true
+			e.TimeToCPA = time.Duration(seconds * float64(time.Second))
+			e.RangeAtCPA = math.Hypot(north+vn*seconds, east+ve*seconds)
+			if t.HasAltitude {
+				e.RelativeAltAtCPA = e.RelativeAltitude + vu*seconds
+			}
+		}
+	}
+	return e, true
+}
+
+func (e TrafficEncounter) alertLevel(config TrafficAlertConfig) TrafficAlertLevel {
+	// aircraft that don't report their altitude could be at any height
+	inside := func(horizontal float64, vertical float64) bool {
+		return horizontal <= config.HorizontalRadius &&
+			(!e.HasAltitude || math.Abs(vertical) <= config.VerticalSeparation)
+	}
+	switch {
+	case inside(e.Range, e.RelativeAltitude):
+		return TrafficWarning
+	case !e.closingHorizontal || !inside(e.RangeAtCPA, e.RelativeAltAtCPA):
+		return TrafficClear
+	case e.TimeToCPA <= config.WarningTime:
+		return TrafficWarning
+	case e.TimeToCPA <= config.AdvisoryTime:
+		return TrafficAdvisory
+	default:
+		return TrafficClear
+	}
+}
+
+// Returns every aircraft heard from recently, ordered by ICAO address
+func (v *Vehicle) Traffic() []Traffic {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.expireTraffic(v.now())
+	traffic := make([]Traffic, 0, len(v.traffic))
+	for _, tracked := range v.traffic {
+		traffic = append(traffic, tracked.traffic)
+	}
+	sort.Slice(traffic, func(i, j int) bool {
+		return traffic[i].ICAOAddress < traffic[j].ICAOAddress
+	})
+	return traffic
+}
+
+// Returns where each aircraft heard from recently is relative to the
+// vehicle, nearest first. Aircraft without a position are left out, as is
+// everything until the vehicle's own position is known.
+func (v *Vehicle) TrafficEncounters() []TrafficEncounter {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.expireTraffic(v.now())
+	encounters := make([]TrafficEncounter, 0, len(v.traffic))
+	for _, tracked := range v.traffic {
+		if e, ok := v.encounter(tracked.traffic); ok {
+			encounters = append(encounters, e)
+		}
+	}
+	sort.Slice(encounters, func(i, j int) bool {
+		return encounters[i].Range < encounters[j].Range
+	})
+	return encounters
+}
+
+// Returns a channel that receives an alert whenever an aircraft comes
+// within, or leaves, the volume set by Vehicle.TrafficAlerts, and a function
+// that ends the subscription. Alerts are dropped if the channel isn't read
+// fast enough.
+func (v *Vehicle) SubscribeTrafficAlerts() (<-chan TrafficAlert, func()) {
+	sub := make(chan TrafficAlert, trafficAlertBuffer)
+	v.lock.Lock()
+	if v.trafficAlertSubs == nil {
+		// the connection has already closed
+		close(sub)
+	} else {
+		v.trafficAlertSubs[sub] = true
+	}
+	v.lock.Unlock()
+
+	unsubscribe := func() {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+		if v.trafficAlertSubs[sub] {
+			delete(v.trafficAlertSubs, sub)
+			close(sub)
+		}
+	}
+	return sub, unsubscribe
+}
+
+// Must be called holding the lock
+func (v *Vehicle) closeTrafficAlertSubscriptions() {
+	for sub := range v.trafficAlertSubs {
+		close(sub)
+	}
+	v.trafficAlertSubs = nil
+}
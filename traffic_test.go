@@ -0,0 +1,80 @@
+package mavcom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	trafficTestLatitude  = -35.3632621
+	trafficTestLongitude = 149.1652374
+	trafficTestAltitude  = 600
+)
+
+// Puts the vehicle a distance north of the test location, hovering
+func sendOwnPosition(a *fakeAutopilot, north float64) {
+	a.send(1, mavlink.GlobalPositionInt{
+		Lat:         int32((trafficTestLatitude + north/111320) * 1e7),
+		Lon:         trafficTestLongitude * 1e7,
+		Alt:         trafficTestAltitude * 1000,
+		RelativeAlt: 20000,
+	})
+}
+
+// A stationary aircraft at the test location, last heard from secondsAgo
+func sendTraffic(a *fakeAutopilot, secondsAgo uint8) {
+	a.send(1, mavlink.AdsbVehicle{
+		ICAOAddress: 0xabc123,
+		Lat:         trafficTestLatitude * 1e7,
+		Lon:         trafficTestLongitude * 1e7,
+		Altitude:    trafficTestAltitude * 1000,
+		Flags: mavlink.ADSB_FLAGS_VALID_COORDS | mavlink.ADSB_FLAGS_VALID_ALTITUDE |
+			mavlink.ADSB_FLAGS_VALID_HEADING | mavlink.ADSB_FLAGS_VALID_VELOCITY,
+		EmitterType: mavlink.ADSB_EMITTER_TYPE_LIGHT,
+		Tslc:        secondsAgo,
+	})
+}
+
+func expectTrafficAlert(t *testing.T, alerts <-chan TrafficAlert, level TrafficAlertLevel, within time.Duration) {
+	t.Helper()
+	select {
+	case alert := <-alerts:
+		if alert.Level != level {
+			t.Fatalf("%v alert at %.0f m, want %v", alert.Level, alert.Encounter.Range, level)
+		}
+	case <-time.After(within):
+		t.Fatalf("no %v alert", level)
+	}
+}
+
+func TestTrafficAlertsFollowOwnPosition(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	alerts, unsubscribe := v.SubscribeTrafficAlerts()
+	defer unsubscribe()
+
+	// far enough away not to be a threat
+	sendOwnPosition(a, 2000)
+	sendTraffic(a, 0)
+	// only the vehicle moves, towards the aircraft and away again
+	sendOwnPosition(a, 300)
+	expectTrafficAlert(t, alerts, TrafficWarning, simTestTimeout)
+	sendOwnPosition(a, 2000)
+	expectTrafficAlert(t, alerts, TrafficClear, simTestTimeout)
+}
+
+func TestTrafficAlertClearedWhenLost(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	alerts, unsubscribe := v.SubscribeTrafficAlerts()
+	defer unsubscribe()
+
+	sendOwnPosition(a, 300)
+	// about to time out, and not heard from again
+	sendTraffic(a, uint8(trafficTimeout/time.Second)-1)
+	expectTrafficAlert(t, alerts, TrafficWarning, simTestTimeout)
+	expectTrafficAlert(t, alerts, TrafficClear, time.Second+2*housekeepingInterval)
+	if traffic := v.Traffic(); len(traffic) != 0 {
+		t.Errorf("lost aircraft still in %+v", traffic)
+	}
+}
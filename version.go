@@ -0,0 +1,298 @@
+package mavcom
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+const (
+	// How long to wait for each way of asking for AUTOPILOT_VERSION
+	versionCommandTimeout = 3 * time.Second
+	// How long to keep trying to get AUTOPILOT_VERSION after connecting
+	versionOnConnectTimeout = 15 * time.Second
+)
+
+// Firmware is the autopilot software a vehicle runs, from the heartbeat
+type Firmware uint8
+
+const (
+	FirmwareGeneric   Firmware = mavlink.MAV_AUTOPILOT_GENERIC
+	FirmwareArduPilot Firmware = mavlink.MAV_AUTOPILOT_ARDUPILOTMEGA
+	FirmwarePX4       Firmware = mavlink.MAV_AUTOPILOT_PX4
+)
+
+func (f Firmware) String() string {
+	switch f {
+	case FirmwareGeneric:
+		return "Generic"
+	case FirmwareArduPilot:
+		return "ArduPilot"
+	case FirmwarePX4:
+		return "PX4"
+	default:
+		return fmt.Sprintf("Autopilot(%d)", uint8(f))
+	}
+}
+
+// VersionType is how far along the release process a firmware build is
+type VersionType uint8
+
+const (
+	VersionDev      VersionType = mavlink.FIRMWARE_VERSION_TYPE_DEV
+	VersionAlpha    VersionType = mavlink.FIRMWARE_VERSION_TYPE_ALPHA
+	VersionBeta     VersionType = mavlink.FIRMWARE_VERSION_TYPE_BETA
+	VersionRC       VersionType = mavlink.FIRMWARE_VERSION_TYPE_RC
+	VersionOfficial VersionType = mavlink.FIRMWARE_VERSION_TYPE_OFFICIAL
+)
+
+func (t VersionType) String() string {
+	switch t {
+	case VersionDev:
+		return "dev"
+	case VersionAlpha:
+		return "alpha"
+	case VersionBeta:
+		return "beta"
+	case VersionRC:
+		return "rc"
+	case VersionOfficial:
+		return "official"
+	default:
+		return fmt.Sprintf("type(%d)", uint8(t))
+	}
+}
+
+// Version is a software version as AUTOPILOT_VERSION reports it
+type Version struct {
+	Major uint8
+	Minor uint8
+	Patch uint8
+	Type  VersionType
+}
+
+func versionFromMessage(v uint32) Version {
+	return Version{
+		Major: uint8(v >> 24),
+		Minor: uint8(v >> 16),
+		Patch: uint8(v >> 8),
+		Type:  VersionType(v),
+	}
+}
+
+// Formats the version like "4.5.1", with the type added for anything but an
+// official release, like "4.6.0-beta"
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Type != VersionOfficial {
+		s += "-" + v.Type.String()
+	}
+	return s
+}
+
+// Capability is a set of MAV_PROTOCOL_CAPABILITY flags
+type Capability uint64
+
+const (
+	CapabilityMissionFloat               Capability = mavlink.MAV_PROTOCOL_CAPABILITY_MISSION_FLOAT
+	CapabilityParamFloat                 Capability = mavlink.MAV_PROTOCOL_CAPABILITY_PARAM_FLOAT
+	CapabilityMissionInt                 Capability = mavlink.MAV_PROTOCOL_CAPABILITY_MISSION_INT
+	CapabilityCommandInt                 Capability = mavlink.MAV_PROTOCOL_CAPABILITY_COMMAND_INT
+	CapabilityParamEncodeBytewise        Capability = mavlink.MAV_PROTOCOL_CAPABILITY_PARAM_ENCODE_BYTEWISE
+	CapabilityFTP                        Capability = mavlink.MAV_PROTOCOL_CAPABILITY_FTP
+	CapabilitySetAttitudeTarget          Capability = mavlink.MAV_PROTOCOL_CAPABILITY_SET_ATTITUDE_TARGET
+	CapabilitySetPositionTargetLocalNED  Capability = mavlink.MAV_PROTOCOL_CAPABILITY_SET_POSITION_TARGET_LOCAL_NED
+	CapabilitySetPositionTargetGlobalInt Capability = mavlink.MAV_PROTOCOL_CAPABILITY_SET_POSITION_TARGET_GLOBAL_INT
+	CapabilityTerrain                    Capability = mavlink.MAV_PROTOCOL_CAPABILITY_TERRAIN
+	CapabilityFlightTermination          Capability = mavlink.MAV_PROTOCOL_CAPABILITY_FLIGHT_TERMINATION
+	CapabilityCompassCalibration         Capability = mavlink.MAV_PROTOCOL_CAPABILITY_COMPASS_CALIBRATION
+	CapabilityMAVLink2                   Capability = mavlink.MAV_PROTOCOL_CAPABILITY_MAVLINK2
+	CapabilityMissionFence               Capability = mavlink.MAV_PROTOCOL_CAPABILITY_MISSION_FENCE
+	CapabilityMissionRally               Capability = mavlink.MAV_PROTOCOL_CAPABILITY_MISSION_RALLY
+	CapabilityParamEncodeCCast           Capability = mavlink.MAV_PROTOCOL_CAPABILITY_PARAM_ENCODE_C_CAST
+)
+
+var capabilityNames = []struct {
+	flag Capability
+	name string
+}{
+	{CapabilityMissionFloat, "MISSION_FLOAT"},
+	{CapabilityParamFloat, "PARAM_FLOAT"},
+	{CapabilityMissionInt, "MISSION_INT"},
+	{CapabilityCommandInt, "COMMAND_INT"},
+	{CapabilityParamEncodeBytewise, "PARAM_ENCODE_BYTEWISE"},
+	{CapabilityFTP, "FTP"},
+	{CapabilitySetAttitudeTarget, "SET_ATTITUDE_TARGET"},
+	{CapabilitySetPositionTargetLocalNED, "SET_POSITION_TARGET_LOCAL_NED"},
+	{CapabilitySetPositionTargetGlobalInt, "SET_POSITION_TARGET_GLOBAL_INT"},
+	{CapabilityTerrain, "TERRAIN"},
+	{CapabilityFlightTermination, "FLIGHT_TERMINATION"},
+	{CapabilityCompassCalibration, "COMPASS_CALIBRATION"},
+	{CapabilityMAVLink2, "MAVLINK2"},
+	{CapabilityMissionFence, "MISSION_FENCE"},
+	{CapabilityMissionRally, "MISSION_RALLY"},
+	{CapabilityParamEncodeCCast, "PARAM_ENCODE_C_CAST"},
+}
+
+// Lists the flags that are set, like "MISSION_INT|FTP"
+func (c Capability) String() string {
+	var names []string
+	for _, capability := range capabilityNames {
+		if c&capability.flag != 0 {
+			names = append(names, capability.name)
+			c &^= capability.flag
+		}
+	}
+	if c != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint64(c)))
+	}
+	return strings.Join(names, "|")
+}
+
+// AutopilotVersion is what the autopilot reports about its firmware and
+// hardware in AUTOPILOT_VERSION
+type AutopilotVersion struct {
+	Firmware          Firmware
+	FlightVersion     Version
+	MiddlewareVersion Version
+	OSVersion         Version
+	// the start of the git hash the firmware was built from
+	FlightGitHash string
+	Board         uint32
+	VendorID      uint16
+	ProductID     uint16
+	// unique to the flight controller, UID2 is used instead of UID by
+	// boards with longer IDs
+	UID          uint64
+	UID2         [18]byte
+	Capabilities Capability
+}
+
+// Has reports whether every flag in c is set
+func (a AutopilotVersion) Has(c Capability) bool {
+	return a.Capabilities&c == c
+}
+
+// ArduPilot sends the git hash as text, others as raw bytes
+func customVersionString(b [8]byte) string {
+	text := strings.TrimRight(string(b[:]), "\x00")
+	for _, r := range text {
+		if r < ' ' || r > '~' {
+			return hex.EncodeToString(b[:])
+		}
+	}
+	return text
+}
+
+func autopilotVersionFromMessage(firmware Firmware, msg *mavlink.AutopilotVersionMessage) AutopilotVersion {
+	return AutopilotVersion{
+		Firmware:          firmware,
+		FlightVersion:     versionFromMessage(msg.FlightSwVersion),
+		MiddlewareVersion: versionFromMessage(msg.MiddlewareSwVersion),
+		OSVersion:         versionFromMessage(msg.OsSwVersion),
+		FlightGitHash:     customVersionString(msg.FlightCustomVersion),
+		Board:             msg.BoardVersion,
+		VendorID:          msg.VendorID,
+		ProductID:         msg.ProductID,
+		UID:               msg.UID,
+		UID2:              msg.UID2,
+		Capabilities:      Capability(msg.Capabilities),
+	}
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleAutopilotVersion(msg *mavlink.AutopilotVersionMessage) {
+	// gimbals, cameras and companion computers send their own
+	targetSystem, targetComponent := v.Connection.Target()
+	if msg.SystemID != targetSystem || msg.ComponentID != targetComponent {
+		return
+	}
+	version := autopilotVersionFromMessage(v.firmware, msg)
+	v.autopilotVersion = &version
+}
+
+// Returns what the autopilot reported in AUTOPILOT_VERSION, and false if it
+// hasn't been received. It is asked for once the vehicle has connected.
+func (v *Vehicle) AutopilotVersion() (AutopilotVersion, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.autopilotVersion == nil {
+		return AutopilotVersion{}, false
+	}
+	return *v.autopilotVersion, true
+}
+
+// Reports whether the autopilot has every capability in c. It is false until
+// AUTOPILOT_VERSION has been received.
+func (v *Vehicle) HasCapability(c Capability) bool {
+	version, ok := v.AutopilotVersion()
+	return ok && version.Has(c)
+}
+
+// Fails if the autopilot is known to lack a capability. Without
+// AUTOPILOT_VERSION the vehicle is given the benefit of the doubt.
+func (v *Vehicle) requireCapability(c Capability, what string) error {
+	version, ok := v.AutopilotVersion()
+	if ok && !version.Has(c) {
+		return fmt.Errorf("%s: not supported by the vehicle, it lacks %v", what, c)
+	}
+	return nil
+}
+
+// Asks the autopilot for AUTOPILOT_VERSION, with MAV_CMD_REQUEST_MESSAGE or
+// on older firmware MAV_CMD_REQUEST_AUTOPILOT_CAPABILITIES, and waits for it
+func (v *Vehicle) RequestAutopilotVersion(ctx context.Context) (AutopilotVersion, error) {
+	versions, unsubscribe := v.Connection.Subscribe(mavlink.MAVLINK_MSG_ID_AUTOPILOT_VERSION)
+	defer unsubscribe()
+
+	request := func(command uint16, param float32) (CommandResult, error) {
+		commandCtx, cancel := context.WithTimeout(ctx, versionCommandTimeout)
+		defer cancel()
+		return v.SendCommand(commandCtx, command, param)
+	}
+	result, err := request(mavlink.MAV_CMD_REQUEST_MESSAGE, mavlink.MAVLINK_MSG_ID_AUTOPILOT_VERSION)
+	if ctx.Err() != nil {
+		return AutopilotVersion{}, fmt.Errorf("autopilot version: %w", ctx.Err())
+	}
+	if err != nil || result == ResultUnsupported {
+		result, err = request(mavlink.MAV_CMD_REQUEST_AUTOPILOT_CAPABILITIES, 1)
+	}
+	if err != nil {
+		return AutopilotVersion{}, fmt.Errorf("autopilot version: %w", err)
+	}
+	if result != ResultAccepted {
+		return AutopilotVersion{}, fmt.Errorf("autopilot version: vehicle responded %v", result)
+	}
+
+	targetSystem, targetComponent := v.Connection.Target()
+	for {
+		select {
+		case <-ctx.Done():
+			return AutopilotVersion{}, fmt.Errorf("autopilot version: %w", ctx.Err())
+		case msg, ok := <-versions:
+			if !ok {
+				return AutopilotVersion{}, fmt.Errorf("autopilot version: connection closed")
+			}
+			reply := msg.(*mavlink.AutopilotVersionMessage)
+			if reply.SystemID != targetSystem || reply.ComponentID != targetComponent {
+				continue
+			}
+			v.lock.Lock()
+			firmware := v.firmware
+			v.lock.Unlock()
+			return autopilotVersionFromMessage(firmware, reply), nil
+		}
+	}
+}
+
+func (v *Vehicle) requestAutopilotVersionOnConnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), versionOnConnectTimeout)
+	defer cancel()
+	if _, err := v.RequestAutopilotVersion(ctx); err != nil {
+		v.Logger.Warn("error requesting autopilot version", "err", err)
+	}
+}
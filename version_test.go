@@ -0,0 +1,43 @@
+package mavcom
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arducrow/go-mavcom/ftp"
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+func TestCapabilitiesGateFeatures(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	ctx := testContext(t)
+
+	// assumed capable until AUTOPILOT_VERSION says otherwise
+	if err := v.requireCapability(CapabilityFTP, "ftp"); err != nil {
+		t.Fatal(err)
+	}
+	a.send(1, mavlink.AutopilotVersion{
+		Capabilities: mavlink.MAV_PROTOCOL_CAPABILITY_MISSION_INT | mavlink.MAV_PROTOCOL_CAPABILITY_SET_POSITION_TARGET_LOCAL_NED,
+	})
+	err := v.waitFor(ctx, "autopilot version", "AUTOPILOT_VERSION", func() bool {
+		return v.autopilotVersion != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.FTP().ReadFile(ctx, "/APM/LOGS/1.BIN"); !errors.Is(err, ftp.ErrUnsupported) {
+		t.Errorf("FTP read returned %v, want %v", err, ftp.ErrUnsupported)
+	}
+	_, err = v.StartOffboard(ctx, GlobalPositionSetpoint(-35, 149, 10), OffboardConfig{})
+	if err == nil || !strings.Contains(err.Error(), "SET_POSITION_TARGET_GLOBAL_INT") {
+		t.Errorf("global offboard returned %v, want it unsupported", err)
+	}
+	controller, err := v.StartOffboard(ctx, VelocitySetpoint(0, 0, 0), OffboardConfig{StopMode: "LOITER"})
+	if err != nil {
+		t.Fatalf("local offboard returned %v", err)
+	}
+	// there is no autopilot to switch modes, so only the stream is stopped
+	controller.halt(false)
+}
@@ -0,0 +1,422 @@
+package mavcom
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+)
+
+// Estimates arriving faster than this are dropped by default. ArduPilot and
+// PX4 fuse external vision at up to 30 Hz or so and gain nothing from more.
+const defaultVisionRate = 30 // Hz
+
+// PoseFrame is the frame an external pose estimate is in
+type PoseFrame int
+
+const (
+	// X north, Y east and Z down, with yaw clockwise from north, from
+	// wherever the estimator started
+	PoseFrameNED PoseFrame = iota
+	// X forward, Y right and Z down from where the estimator started, with
+	// yaw clockwise from its starting heading, not aligned with north. This
+	// is what most visual odometry produces.
+	PoseFrameFRD
+	// X east, Y north and Z up, with yaw anticlockwise from east and the
+	// body forward, left and up, as ROS uses. Estimates are converted to
+	// NED before sending.
+	PoseFrameENU
+)
+
+func (f PoseFrame) String() string {
+	switch f {
+	case PoseFrameNED:
+		return "NED"
+	case PoseFrameFRD:
+		return "FRD"
+	case PoseFrameENU:
+		return "ENU"
+	}
+	return fmt.Sprintf("PoseFrame(%d)", int(f))
+}
+
+// VisionEstimate is the vehicle's pose from an external source such as
+// visual odometry or motion capture. Positions are in meters and velocities
+// in m/s, both in the sender's frame. Unlike elsewhere, angles are in
+// radians, as pose estimators produce them and their covariances are in.
+type VisionEstimate struct {
+	// when the pose was captured, now if zero. Latency matters to the EKF,
+	// so this should be the camera's timestamp rather than when the
+	// estimate was finished.
+	Time  time.Time
+	X     float64
+	Y     float64
+	Z     float64
+	Roll  float64
+	Pitch float64
+	Yaw   float64
+	// upper triangle of the 6x6 covariance of X, Y, Z, roll, pitch and
+	// yaw, row by row, nil if unknown
+	PoseCovariance *[21]float64
+
+	// velocity in the same frame as the position
+	HasVelocity bool
+	VX          float64
+	VY          float64
+	VZ          float64
+	// the 3x3 covariance of the velocity, row by row, nil if unknown
+	VelocityCovariance *[9]float64
+
+	// how good the estimate is, from 1 to 100, -1 if it failed and 0 if
+	// unknown. Only sent with ODOMETRY.
+	Quality int
+}
+
+// VisionConfig says how estimates are sent to the vehicle
+type VisionConfig struct {
+	Frame PoseFrame
+	// Estimates arriving faster than this, in Hz, are dropped. Defaults
+	// to 30.
+	MaxRate float64
+	// Send ODOMETRY rather than VISION_POSITION_ESTIMATE and
+	// VISION_SPEED_ESTIMATE. PX4 prefers ODOMETRY. ArduPilot takes both,
+	// but only takes ODOMETRY in PoseFrameFRD.
+	Odometry bool
+	// MAV_ESTIMATOR_TYPE sent with ODOMETRY, such as 3 for visual inertial
+	// odometry or 6 for motion capture
+	EstimatorType uint8
+}
+
+// VisionSender injects external pose estimates into the vehicle's EKF for
+// flight without GPS, such as indoors
+type VisionSender struct {
+	vehicle      *Vehicle
+	config       VisionConfig
+	lock         sync.Mutex
+	lastSent     time.Time
+	resetCounter uint8
+}
+
+// Returns a sender for external pose estimates. The autopilot has to be set
+// up to use them, such as with ArduPilot's VISO_TYPE and EK3_SRC1_POSXY or
+// PX4's EKF2_EV_CTRL.
+func (v *Vehicle) NewVisionSender(config VisionConfig) *VisionSender {
+	if config.MaxRate <= 0 {
+		config.MaxRate = defaultVisionRate
+	}
+	return &VisionSender{vehicle: v, config: config}
+}
+
+// Sends an estimate to the vehicle, or drops it if it came too soon after
+// the last one
+func (s *VisionSender) Send(estimate VisionEstimate) error {
+	if estimate.Time.IsZero() {
+		estimate.Time = time.Now()
+	}
+	s.lock.Lock()
+	if !s.lastSent.IsZero() && estimate.Time.Sub(s.lastSent) < time.Duration(float64(time.Second)/s.config.MaxRate) {
+		s.lock.Unlock()
+		return nil
+	}
+	s.lastSent = estimate.Time
+	resetCounter := s.resetCounter
+	s.lock.Unlock()
+
+	if s.config.Frame == PoseFrameENU {
+		estimate = estimate.toNED()
+	}
+	// the clock TIMESYNC requests from the vehicle are answered with, which
+	// both autopilots can relate to their own
+	usec := uint64((clockBase.UnixNano() + int64(estimate.Time.Sub(clockBase))) / int64(time.Microsecond))
+
+	if s.config.Odometry {
+		return s.vehicle.Connection.Send(s.odometry(estimate, usec, resetCounter))
+	}
+	err := s.vehicle.Connection.Send(mavlink.VisionPositionEstimate{
+		Usec:         usec,
+		X:            float32(estimate.X),
+		Y:            float32(estimate.Y),
+		Z:            float32(estimate.Z),
+		Roll:         float32(estimate.Roll),
+		Pitch:        float32(estimate.Pitch),
+		Yaw:          float32(estimate.Yaw),
+		Covariance:   covariance21(estimate.PoseCovariance),
+		ResetCounter: resetCounter,
+	})
+	if err != nil || !estimate.HasVelocity {
+		return err
+	}
+	speed := mavlink.VisionSpeedEstimate{
+		Usec:         usec,
+		X:            float32(estimate.VX),
+		Y:            float32(estimate.VY),
+		Z:            float32(estimate.VZ),
+		ResetCounter: resetCounter,
+	}
+	speed.Covariance[0] = float32(math.NaN())
+	if c := estimate.VelocityCovariance; c != nil {
+		for i := range c {
+			speed.Covariance[i] = float32(c[i])
+		}
+	}
+	return s.vehicle.Connection.Send(speed)
+}
+
+// Tells the vehicle the estimator has jumped, such as after visual odometry
+// lost tracking and started again, so that the EKF resets to the new pose
+// rather than treating the jump as movement
+func (s *VisionSender) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.resetCounter++
+}
+
+func (s *VisionSender) odometry(estimate VisionEstimate, usec uint64, resetCounter uint8) mavlink.Odometry {
+	msg := mavlink.Odometry{
+		TimeUsec:      usec,
+		X:             float32(estimate.X),
+		Y:             float32(estimate.Y),
+		Z:             float32(estimate.Z),
+		Q:             mavlink.QuaternionFromEuler(estimate.Roll, estimate.Pitch, estimate.Yaw),
+		Vx:            float32(math.NaN()),
+		Vy:            float32(math.NaN()),
+		Vz:            float32(math.NaN()),
+		Rollspeed:     float32(math.NaN()),
+		Pitchspeed:    float32(math.NaN()),
+		Yawspeed:      float32(math.NaN()),
+		FrameID:       mavlink.MAV_FRAME_LOCAL_NED,
+		ChildFrameID:  mavlink.MAV_FRAME_BODY_FRD,
+		ResetCounter:  resetCounter,
+		EstimatorType: s.config.EstimatorType,
+		Quality:       int8(max(-1, min(100, estimate.Quality))),
+	}
+	if s.config.Frame == PoseFrameFRD {
+		msg.FrameID = mavlink.MAV_FRAME_LOCAL_FRD
+	}
+	msg.PoseCovariance = covariance21(estimate.PoseCovariance)
+	msg.VelocityCovariance[0] = float32(math.NaN())
+
+	if estimate.HasVelocity {
+		// ODOMETRY carries velocity in the body frame
+		r := rotationMatrix(estimate.Roll, estimate.Pitch, estimate.Yaw)
+		body := r.transposeMul([3]float64{estimate.VX, estimate.VY, estimate.VZ})
+		msg.Vx, msg.Vy, msg.Vz = float32(body[0]), float32(body[1]), float32(body[2])
+		if c := estimate.VelocityCovariance; c != nil {
+			// Rᵀ C R, into the velocity rows of the 6x6 upper triangle
+			var world, rotated [3][3]float64
+			for i := 0; i < 3; i++ {
+				for j := 0; j < 3; j++ {
+					world[i][j] = c[3*i+j]
+				}
+			}
+			for i := 0; i < 3; i++ {
+				for j := 0; j < 3; j++ {
+					for k := 0; k < 3; k++ {
+						for l := 0; l < 3; l++ {
+							rotated[i][j] += r[k][i] * world[k][l] * r[l][j]
+						}
+					}
+				}
+			}
+			msg.VelocityCovariance = [21]float32{}
+			for i := 0; i < 3; i++ {
+				for j := i; j < 3; j++ {
+					msg.VelocityCovariance[upperTriangleIndex(i, j)] = float32(rotated[i][j])
+				}
+			}
+		}
+	}
+	return msg
+}
+
+// Converts an estimate from ENU with the body forward, left and up to NED
+// with the body forward, right and down
+func (e VisionEstimate) toNED() VisionEstimate {
+	ned := e
+	ned.X, ned.Y, ned.Z = e.Y, e.X, -e.Z
+	ned.VX, ned.VY, ned.VZ = e.VY, e.VX, -e.VZ
+	ned.Pitch = -e.Pitch
+	ned.Yaw = math.Remainder(math.Pi/2-e.Yaw, 2*math.Pi)
+
+	if c := e.PoseCovariance; c != nil {
+		// NED axis i is ENU axis from[i], negated where sign[i] is
+		from := [6]int{1, 0, 2, 3, 4, 5}
+		sign := [6]float64{1, 1, -1, 1, -1, -1}
+		var converted [21]float64
+		for i := 0; i < 6; i++ {
+			for j := i; j < 6; j++ {
+				converted[upperTriangleIndex(i, j)] = sign[i] * sign[j] * c[upperTriangleIndex(from[i], from[j])]
+			}
+		}
+		ned.PoseCovariance = &converted
+	}
+	if c := e.VelocityCovariance; c != nil {
+		from := [3]int{1, 0, 2}
+		sign := [3]float64{1, 1, -1}
+		var converted [9]float64
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				converted[3*i+j] = sign[i] * sign[j] * c[3*from[i]+from[j]]
+			}
+		}
+		ned.VelocityCovariance = &converted
+	}
+	return ned
+}
+
+// Returns where row i and column j of a 6x6 symmetric matrix are in its
+// upper triangle, stored row by row
+func upperTriangleIndex(i int, j int) int {
+	if i > j {
+		i, j = j, i
+	}
+	return i*6 - i*(i-1)/2 + j - i
+}
+
+// Converts a covariance for a message, with NaN first if it is unknown
+func covariance21(c *[21]float64) [21]float32 {
+	var converted [21]float32
+	if c == nil {
+		converted[0] = float32(math.NaN())
+		return converted
+	}
+	for i := range c {
+		converted[i] = float32(c[i])
+	}
+	return converted
+}
+
+// The rotation from the body frame to the world frame
+type rotation [3][3]float64
+
+func rotationMatrix(roll float64, pitch float64, yaw float64) rotation {
+	sr, cr := math.Sincos(roll)
+	sp, cp := math.Sincos(pitch)
+	sy, cy := math.Sincos(yaw)
+	return rotation{
+		{cp * cy, sr*sp*cy - cr*sy, cr*sp*cy + sr*sy},
+		{cp * sy, sr*sp*sy + cr*cy, cr*sp*sy - sr*cy},
+		{-sp, sr * cp, cr * cp},
+	}
+}
+
+// Rotates a vector from the world frame into the body frame
+func (r rotation) transposeMul(v [3]float64) [3]float64 {
+	var out [3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			out[i] += r[j][i] * v[j]
+		}
+	}
+	return out
+}
+
+// EstimatorFlags say which parts of the EKF's solution are good, from
+// ArduPilot's EKF_STATUS_REPORT or PX4's ESTIMATOR_STATUS
+type EstimatorFlags uint16
+
+const (
+	EstimatorAttitude EstimatorFlags = 1 << iota
+	EstimatorVelocityHoriz
+	EstimatorVelocityVert
+	// position relative to where the EKF started, which is all there is
+	// from external vision
+	EstimatorPosHorizRel
+	EstimatorPosHorizAbs
+	EstimatorPosVertAbs
+	EstimatorPosVertAGL
+	// holding a made up position as nothing is measuring it, before arming
+	// or once every position source has been lost
+	EstimatorConstPosMode
+	EstimatorPredPosHorizRel
+	EstimatorPredPosHorizAbs
+	EstimatorUninitialized
+	EstimatorGPSGlitch
+	EstimatorAccelError
+)
+
+// Whether every one of flags is set
+func (f EstimatorFlags) Has(flags EstimatorFlags) bool {
+	return f&flags == flags
+}
+
+// EstimatorStatus is how well the vehicle's EKF is doing. The ratios compare
+// each kind of measurement against the EKF's prediction, where 0.5 or less is
+// good and above 1 means the measurements are being rejected.
+type EstimatorStatus struct {
+	Flags         EstimatorFlags
+	VelocityRatio float64
+	PosHorizRatio float64
+	PosVertRatio  float64
+	CompassRatio  float64
+	TerrainRatio  float64
+	// how far off the position may be, in meters, -1 if not reported as
+	// ArduPilot doesn't
+	PosHorizAccuracy float64
+	PosVertAccuracy  float64
+	Received         time.Time
+}
+
+// Whether the EKF has a horizontal position it can fly on, which is what
+// accepting external vision looks like without GPS
+func (s EstimatorStatus) HasPosition() bool {
+	if s.Flags&EstimatorConstPosMode != 0 || s.Flags&EstimatorUninitialized != 0 {
+		return false
+	}
+	return s.Flags&(EstimatorPosHorizRel|EstimatorPosHorizAbs) != 0
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleEkfStatusReport(msg *mavlink.EkfStatusReportMessage) {
+	// the first ten flags are the same as ours
+	flags := EstimatorFlags(msg.Flags & 0x3ff)
+	if msg.Flags&mavlink.EKF_UNINITIALIZED != 0 {
+		flags |= EstimatorUninitialized
+	}
+	if msg.Flags&mavlink.EKF_GPS_GLITCH != 0 {
+		flags |= EstimatorGPSGlitch
+	}
+	v.health.Estimator = EstimatorStatus{
+		Flags:            flags,
+		VelocityRatio:    float64(msg.VelocityVariance),
+		PosHorizRatio:    float64(msg.PosHorizVariance),
+		PosVertRatio:     float64(msg.PosVertVariance),
+		CompassRatio:     float64(msg.CompassVariance),
+		TerrainRatio:     float64(msg.TerrainAltVariance),
+		PosHorizAccuracy: -1,
+		PosVertAccuracy:  -1,
+		Received:         v.now(),
+	}
+}
+
+// Must be called holding the lock
+func (v *Vehicle) handleEstimatorStatus(msg *mavlink.EstimatorStatusMessage) {
+	flags := EstimatorFlags(msg.Flags & 0x3ff)
+	if msg.Flags&mavlink.ESTIMATOR_GPS_GLITCH != 0 {
+		flags |= EstimatorGPSGlitch
+	}
+	if msg.Flags&mavlink.ESTIMATOR_ACCEL_ERROR != 0 {
+		flags |= EstimatorAccelError
+	}
+	v.health.Estimator = EstimatorStatus{
+		Flags:            flags,
+		VelocityRatio:    float64(msg.VelRatio),
+		PosHorizRatio:    float64(msg.PosHorizRatio),
+		PosVertRatio:     float64(msg.PosVertRatio),
+		CompassRatio:     float64(msg.MagRatio),
+		TerrainRatio:     float64(msg.HaglRatio),
+		PosHorizAccuracy: float64(msg.PosHorizAccuracy),
+		PosVertAccuracy:  float64(msg.PosVertAccuracy),
+		Received:         v.now(),
+	}
+}
+
+// Returns the latest EKF status from EKF_STATUS_REPORT or ESTIMATOR_STATUS,
+// and false if neither has arrived yet
+func (v *Vehicle) EstimatorStatus() (EstimatorStatus, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.health.Estimator, !v.health.Estimator.Received.IsZero()
+}
@@ -0,0 +1,187 @@
+package mavcom
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/arducrow/go-mavcom/internal/mavlink"
+	"github.com/arducrow/go-mavcom/sim"
+)
+
+func closeTo(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestUpperTriangleIndex(t *testing.T) {
+	index := 0
+	for i := 0; i < 6; i++ {
+		for j := i; j < 6; j++ {
+			if got := upperTriangleIndex(i, j); got != index {
+				t.Errorf("row %d column %d at %d, want %d", i, j, got, index)
+			}
+			if got := upperTriangleIndex(j, i); got != index {
+				t.Errorf("row %d column %d at %d, want %d as for row %d column %d", j, i, got, index, i, j)
+			}
+			index++
+		}
+	}
+}
+
+func TestVisionEstimateToNED(t *testing.T) {
+	// 1 m east, 2 m north and 3 m up, heading north and nose up. The pose
+	// covariance has x with y and x with z correlated, and z with yaw.
+	var pose [21]float64
+	for i := 0; i < 6; i++ {
+		pose[upperTriangleIndex(i, i)] = float64(i + 1)
+	}
+	pose[upperTriangleIndex(0, 1)] = 0.1
+	pose[upperTriangleIndex(0, 2)] = 0.2
+	pose[upperTriangleIndex(2, 5)] = 0.3
+	velocity := [9]float64{1, 0.1, 0.2, 0.1, 2, 0, 0.2, 0, 3}
+	enu := VisionEstimate{
+		X: 1, Y: 2, Z: 3, Roll: 0.1, Pitch: 0.2, Yaw: math.Pi / 2,
+		PoseCovariance: &pose,
+		HasVelocity:    true, VX: 4, VY: 5, VZ: 6,
+		VelocityCovariance: &velocity,
+	}
+
+	ned := enu.toNED()
+	if ned.X != 2 || ned.Y != 1 || ned.Z != -3 || ned.VX != 5 || ned.VY != 4 || ned.VZ != -6 {
+		t.Errorf("position %v %v %v and velocity %v %v %v, want 2 1 -3 and 5 4 -6", ned.X, ned.Y, ned.Z, ned.VX, ned.VY, ned.VZ)
+	}
+	if !closeTo(ned.Roll, 0.1) || !closeTo(ned.Pitch, -0.2) || !closeTo(ned.Yaw, 0) {
+		t.Errorf("attitude %v %v %v, want 0.1 -0.2 0", ned.Roll, ned.Pitch, ned.Yaw)
+	}
+	// heading west is anticlockwise from north
+	if west := (VisionEstimate{Yaw: math.Pi}).toNED(); !closeTo(west.Yaw, -math.Pi/2) {
+		t.Errorf("yaw %v heading west, want %v", west.Yaw, -math.Pi/2)
+	}
+
+	c := ned.PoseCovariance
+	wantPose := []struct {
+		i, j int
+		want float64
+	}{
+		// north and east swap, and z and yaw change sign, which cancel out
+		// in the z and yaw correlation
+		{0, 0, 2}, {1, 1, 1}, {2, 2, 3}, {5, 5, 6},
+		{0, 1, 0.1},
+		{1, 2, -0.2},
+		{0, 2, 0},
+		{2, 5, 0.3},
+	}
+	for _, w := range wantPose {
+		if got := c[upperTriangleIndex(w.i, w.j)]; !closeTo(got, w.want) {
+			t.Errorf("pose covariance %d %d is %v, want %v", w.i, w.j, got, w.want)
+		}
+	}
+	wantVelocity := [9]float64{2, 0.1, 0, 0.1, 1, -0.2, 0, -0.2, 3}
+	if *ned.VelocityCovariance != wantVelocity {
+		t.Errorf("velocity covariance %v, want %v", *ned.VelocityCovariance, wantVelocity)
+	}
+	if pose[upperTriangleIndex(0, 0)] != 1 {
+		t.Error("converting changed the estimate's covariance")
+	}
+}
+
+func TestVisionPositionEstimate(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	sender := v.NewVisionSender(VisionConfig{Frame: PoseFrameENU})
+	captured := time.Now().Add(-20 * time.Millisecond)
+	velocity := [9]float64{1, 0, 0, 0, 2, 0, 0, 0, 3}
+	err := sender.Send(VisionEstimate{
+		Time: captured,
+		X:    1, Y: 2, Z: 3, Yaw: math.Pi / 2,
+		HasVelocity: true, VX: 4, VY: 5, VZ: 6,
+		VelocityCovariance: &velocity,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pose := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_VISION_POSITION_ESTIMATE)).(*mavlink.VisionPositionEstimateMessage)
+	if pose.X != 2 || pose.Y != 1 || pose.Z != -3 || pose.Yaw != 0 {
+		t.Errorf("sent %v %v %v heading %v, want 2 1 -3 heading 0", pose.X, pose.Y, pose.Z, pose.Yaw)
+	}
+	if want := uint64(captured.UnixMicro()); pose.Usec < want-1000 || pose.Usec > want+1000 {
+		t.Errorf("sent time %d, want when it was captured %d", pose.Usec, want)
+	}
+	if !math.IsNaN(float64(pose.Covariance[0])) {
+		t.Errorf("sent covariance %v without one, want NaN first", pose.Covariance)
+	}
+	speed := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_VISION_SPEED_ESTIMATE)).(*mavlink.VisionSpeedEstimateMessage)
+	if speed.X != 5 || speed.Y != 4 || speed.Z != -6 || speed.Usec != pose.Usec {
+		t.Errorf("sent speed %v %v %v at %d, want 5 4 -6 at %d", speed.X, speed.Y, speed.Z, speed.Usec, pose.Usec)
+	}
+	if speed.Covariance != [9]float32{2, 0, 0, 0, 1, 0, 0, 0, 3} {
+		t.Errorf("sent speed covariance %v, want north and east swapped", speed.Covariance)
+	}
+}
+
+func TestVisionOdometry(t *testing.T) {
+	a, v := newFakeAutopilot(t)
+	sender := v.NewVisionSender(VisionConfig{Frame: PoseFrameFRD, Odometry: true, EstimatorType: 3})
+	sender.Reset()
+	velocity := [9]float64{1, 0, 0, 0, 4, 0, 0, 0, 9}
+	// heading east and moving north, which is to the left
+	err := sender.Send(VisionEstimate{
+		X: 1, Y: 2, Z: -3, Yaw: math.Pi / 2,
+		HasVelocity: true, VX: 1,
+		VelocityCovariance: &velocity,
+		Quality:            150,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := decodeFrame(t, a.nextFrame(mavlink.MAVLINK_MSG_ID_ODOMETRY)).(*mavlink.OdometryMessage)
+	if msg.FrameID != mavlink.MAV_FRAME_LOCAL_FRD || msg.ChildFrameID != mavlink.MAV_FRAME_BODY_FRD {
+		t.Errorf("sent in frame %d with the body in %d, want local FRD and body FRD", msg.FrameID, msg.ChildFrameID)
+	}
+	if msg.X != 1 || msg.Y != 2 || msg.Z != -3 {
+		t.Errorf("sent position %v %v %v, want 1 2 -3", msg.X, msg.Y, msg.Z)
+	}
+	if _, _, yaw := mavlink.EulerFromQuaternion(msg.Q); !closeTo(yaw, math.Pi/2) {
+		t.Errorf("sent yaw %v, want %v", yaw, math.Pi/2)
+	}
+	if !closeTo(float64(msg.Vx), 0) || !closeTo(float64(msg.Vy), -1) || !closeTo(float64(msg.Vz), 0) {
+		t.Errorf("sent body velocity %v %v %v, want 0 -1 0", msg.Vx, msg.Vy, msg.Vz)
+	}
+	// the body's x is east, so its variance is the east variance
+	for i, want := range []float64{4, 1, 9} {
+		if got := msg.VelocityCovariance[upperTriangleIndex(i, i)]; !closeTo(float64(got), want) {
+			t.Errorf("sent body velocity variance %d as %v, want %v", i, got, want)
+		}
+	}
+	if !math.IsNaN(float64(msg.PoseCovariance[0])) {
+		t.Errorf("sent pose covariance %v without one, want NaN first", msg.PoseCovariance)
+	}
+	if msg.ResetCounter != 1 || msg.EstimatorType != 3 || msg.Quality != 100 {
+		t.Errorf("sent reset %d, estimator %d and quality %d, want 1, 3 and 100", msg.ResetCounter, msg.EstimatorType, msg.Quality)
+	}
+}
+
+func TestVisionSenderWithSimulator(t *testing.T) {
+	s, v := newSimVehicle(t, sim.DefaultConfig())
+	sender := v.NewVisionSender(VisionConfig{MaxRate: 10})
+	start := time.Now()
+	// 5 estimates at 10 Hz, with ones in between at 40 Hz that are dropped
+	for i := 0; i < 20; i++ {
+		estimate := VisionEstimate{Time: start.Add(time.Duration(i) * 25 * time.Millisecond), X: float64(i)}
+		if err := sender.Send(estimate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(simTestTimeout)
+	for s.State().VisionEstimates < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("simulator took %d estimates, want 5", s.State().VisionEstimates)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if estimates := s.State().VisionEstimates; estimates != 5 {
+		t.Errorf("simulator took %d estimates, want 5", estimates)
+	}
+}